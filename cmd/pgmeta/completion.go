@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/config"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+	"github.com/spf13/cobra"
+)
+
+// newCompletionCmd creates the command that prints shell completion scripts
+func newCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:                   "completion [bash|zsh|fish|powershell]",
+		Short:                 "Generate the autocompletion script for the specified shell",
+		DisableFlagsInUseLine: true,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(os.Stdout, true)
+			case "zsh":
+				return root.GenZshCompletion(os.Stdout)
+			case "fish":
+				return root.GenFishCompletion(os.Stdout, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(os.Stdout)
+			}
+			return stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Unsupported shell: %s", args[0])
+		},
+	}
+}
+
+// completeConnectionNames suggests the connection names configured in config.json. The
+// config is only read: anything logged would become a completion candidate.
+func completeConnectionNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := config.ReadConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, conn := range cfg.Connections {
+		if strings.HasPrefix(conn.Name, toComplete) {
+			names = append(names, conn.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeObjectTypes suggests object types for the comma-separated --types flag,
+// completing only the element after the last comma
+func completeObjectTypes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix := ""
+	current := toComplete
+	if idx := strings.LastIndex(toComplete, ","); idx >= 0 {
+		prefix = toComplete[:idx+1]
+		current = toComplete[idx+1:]
+	}
+
+	var suggestions []string
+	if prefix == "" && strings.HasPrefix("ALL", current) {
+		suggestions = append(suggestions, "ALL")
+	}
+	for _, t := range types.ValidTypes() {
+		if strings.HasPrefix(string(t), current) {
+			suggestions = append(suggestions, prefix+string(t))
+		}
+	}
+	return suggestions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/config"
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+)
+
+// Exit codes, so scripts can tell the outcome of a command apart without parsing its output
+const (
+	exitError           = 1 // Any error without a more specific code
+	exitChangesFound    = 2 // --report-changes found changes
+	exitPartialFailure  = 3 // Some objects could not be exported under --on-error warn
+	exitConnectionError = 4 // The database could not be reached
+	exitConfigError     = 5 // Invalid flags, configuration or connection name
+	exitNoObjects       = 6 // Nothing matched the selection
+)
+
+// exitCodeError ends the command with code without printing anything further
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// exitCode returns the code the process exits with after err
+func exitCode(err error) int {
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	switch stacktrace.GetCode(err) {
+	case db.ErrCodeConnection:
+		return exitConnectionError
+	case config.ErrCodeConfig:
+		return exitConfigError
+	}
+	return exitError
+}
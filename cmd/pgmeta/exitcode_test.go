@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/config"
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"no objects", &exitCodeError{code: exitNoObjects}, exitNoObjects},
+		{"partial failure", &exitCodeError{code: exitPartialFailure}, exitPartialFailure},
+		{"changes found", &exitCodeError{code: exitChangesFound}, exitChangesFound},
+		{"connection", stacktrace.Propagate(
+			stacktrace.PropagateWithCode(errors.New("connection refused"), db.ErrCodeConnection, "Failed to connect to database"),
+			"Failed to initialize metadata fetcher"), exitConnectionError},
+		{"invalid flag", stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--write requires --report-changes"), exitConfigError},
+		{"unknown connection", stacktrace.Propagate(
+			stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Connection not found: prod"), "Failed to resolve"), exitConfigError},
+		{"other", stacktrace.NewError("Failed to save objects"), exitError},
+		{"plain", errors.New("boom"), exitError},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: expected exit code %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestExitCodeFlagErrors(t *testing.T) {
+	rootCmd.SetArgs([]string{"export", "--no-such-flag"})
+	defer rootCmd.SetArgs(nil)
+	err := rootCmd.Execute()
+	if err == nil {
+		t.Fatal("Expected an unknown flag to fail")
+	}
+	if got := exitCode(err); got != exitConfigError {
+		t.Errorf("Expected exit code %d for an unknown flag, got %d", exitConfigError, got)
+	}
+}
+
+func TestExitCodeConfigValidation(t *testing.T) {
+	// Flags are validated before any connection is opened
+	rootCmd.SetArgs([]string{"export", "--write"})
+	defer rootCmd.SetArgs(nil)
+	err := rootCmd.Execute()
+	if err == nil {
+		t.Fatal("Expected --write without --report-changes to fail")
+	}
+	if got := exitCode(err); got != exitConfigError {
+		t.Errorf("Expected exit code %d for invalid flags, got %d (%v)", exitConfigError, got, err)
+	}
+}
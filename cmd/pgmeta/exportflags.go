@@ -0,0 +1,340 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/config"
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+	"github.com/skamensky/pgmeta/internal/metadata/export"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+	"github.com/spf13/cobra"
+)
+
+// exportFlags holds the validated flags of the export command
+type exportFlags struct {
+	query                string
+	typesList            string
+	connName             string
+	onErrorOption        string
+	writeManifest        bool
+	wrapTransaction      bool
+	psqlMetaCommands     bool
+	concurrentIndexes    bool
+	maxDefinitionSize    int
+	writeIndex           bool
+	compression          string
+	lint                 bool
+	lintFail             bool
+	dedupe               bool
+	formatSQL            bool
+	outputEncoding       string
+	sequenceCurrentValue bool
+	identitySequences    bool
+	definitionSource     string
+	normalizeDefaults    bool
+	fetchConcurrency     int
+	writeConcurrency     int
+	batchSize            int
+	objectTimeout        time.Duration
+	profileTop           int
+	forceConcurrency     bool
+	poolWarmup           bool
+	prune                bool
+	resume               bool
+	groupBy              string
+	catalog              string
+	databaseComments     bool
+	commentsLayout       string
+	skipPermissionErrors bool
+	caveatHeaders        bool
+	hashOnly             bool
+	retryFailed          string
+	writeChanges         bool
+	withStats            bool
+	outputDir            string
+	combinedOutputs      []string
+	manifestOrder        []types.ObjectType
+	redactPatterns       []*regexp.Regexp
+	dirNames             export.DirNames
+	toStdout             bool
+	stdoutTaken          bool
+	toS3                 bool
+	reporting            bool
+}
+
+// parseExportFlags reads the flags of the export command and rejects invalid values and
+// combinations, before anything is written or fetched
+func parseExportFlags(cmd *cobra.Command) (*exportFlags, error) {
+	query, _ := cmd.Flags().GetString("query")
+	typesList, _ := cmd.Flags().GetString("types")
+	connName, _ := cmd.Flags().GetString("connection")
+	outputs, _ := cmd.Flags().GetStringArray("output")
+	outputFormats, _ := cmd.Flags().GetStringArray("output-format")
+	onErrorOption, _ := cmd.Flags().GetString("on-error")
+	writeManifest, _ := cmd.Flags().GetBool("manifest")
+	wrapTransaction, _ := cmd.Flags().GetBool("wrap-transaction")
+	psqlMetaCommands, _ := cmd.Flags().GetBool("emit-psql-meta-commands")
+	concurrentIndexes, _ := cmd.Flags().GetBool("concurrent-indexes")
+	maxDefinitionSize, _ := cmd.Flags().GetInt("max-definition-size")
+	writeIndex, _ := cmd.Flags().GetBool("write-index")
+	compression, _ := cmd.Flags().GetString("compress")
+	lint, _ := cmd.Flags().GetBool("lint")
+	lintFail, _ := cmd.Flags().GetBool("lint-fail")
+	dedupe, _ := cmd.Flags().GetBool("dedupe")
+	formatSQL, _ := cmd.Flags().GetBool("format-sql")
+	outputEncoding, _ := cmd.Flags().GetString("output-encoding")
+	sequenceCurrentValue, _ := cmd.Flags().GetBool("sequence-current-value")
+	identitySequences, _ := cmd.Flags().GetBool("include-sequences-for-identity")
+	definitionSource, _ := cmd.Flags().GetString("definition-source")
+	normalizeDefaults, _ := cmd.Flags().GetBool("normalize-defaults")
+	fetchConcurrency, _ := cmd.Flags().GetInt("parallel-definition-fetch")
+	writeConcurrency, _ := cmd.Flags().GetInt("write-concurrency")
+	batchSize, _ := cmd.Flags().GetInt("batch-size")
+	objectTimeout, _ := cmd.Flags().GetDuration("timeout-per-object")
+	profileTop, _ := cmd.Flags().GetInt("profile")
+	forceConcurrency, _ := cmd.Flags().GetBool("force-concurrency")
+	poolWarmup, _ := cmd.Flags().GetBool("pool-warmup")
+	prune, _ := cmd.Flags().GetBool("prune")
+	resume, _ := cmd.Flags().GetBool("resume")
+	groupBy, _ := cmd.Flags().GetString("group-by")
+	dirNamesList, _ := cmd.Flags().GetString("dir-names")
+	catalog, _ := cmd.Flags().GetString("catalog")
+	databaseComments, _ := cmd.Flags().GetBool("database-comments")
+	commentsLayout, _ := cmd.Flags().GetString("comments-layout")
+	skipPermissionErrors, _ := cmd.Flags().GetBool("skip-permission-errors")
+	caveatHeaders, _ := cmd.Flags().GetBool("caveat-headers")
+	reportFormat, _ := cmd.Flags().GetString("report-changes")
+	hashOnly, _ := cmd.Flags().GetBool("definition-hash-only")
+	retryFailed, _ := cmd.Flags().GetString("retry-failed")
+	writeChanges, _ := cmd.Flags().GetBool("write")
+	orderList, _ := cmd.Flags().GetString("order")
+	withStats, _ := cmd.Flags().GetBool("with-stats")
+	redactList, _ := cmd.Flags().GetStringArray("redact-pattern")
+
+	// Every combined script is written from the definitions fetched for the tree
+	outputDir, combinedOutputs, err := parseOutputs(outputs, outputFormats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate on-error option
+	if onErrorOption != "fail" && onErrorOption != "warn" {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid on-error option: %s. Valid options are: warn, fail", onErrorOption)
+	}
+
+	if fetchConcurrency < 1 {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--parallel-definition-fetch must be at least 1")
+	}
+	if writeConcurrency < 1 {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--write-concurrency must be at least 1")
+	}
+	if batchSize < 0 {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--batch-size cannot be negative")
+	}
+	if objectTimeout < 0 {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--timeout-per-object cannot be negative")
+	}
+	if profileTop < 0 {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--profile cannot be negative")
+	}
+	// Lint findings in a later batch would abort an export whose earlier batches are written
+	if batchSize > 0 && lintFail {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--batch-size cannot be combined with --lint-fail")
+	}
+
+	if wrapTransaction && !writeManifest {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--wrap-transaction requires --manifest")
+	}
+	if psqlMetaCommands && !writeManifest {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--emit-psql-meta-commands requires --manifest")
+	}
+
+	manifestOrder, err := parseManifestOrder(orderList)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifestOrder) > 0 && !writeManifest && outputDir != "-" {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--order requires --manifest or --output -")
+	}
+
+	if !export.IsValidOutputEncoding(outputEncoding) {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid output-encoding option: %s. Valid options are: %s", outputEncoding, strings.Join(export.OutputEncodings(), ", "))
+	}
+
+	var redactPatterns []*regexp.Regexp
+	for _, pattern := range redactList {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, stacktrace.PropagateWithCode(err, config.ErrCodeConfig, "Invalid --redact-pattern: %s", pattern)
+		}
+		redactPatterns = append(redactPatterns, re)
+	}
+
+	if !db.IsValidDefinitionSource(definitionSource) {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid definition-source option: %s. Valid options are: %s", definitionSource, strings.Join(db.DefinitionSources(), ", "))
+	}
+	if filepath.IsAbs(catalog) {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--catalog must be a path relative to the output directory: %s", catalog)
+	}
+	if !export.IsValidGroupBy(groupBy) {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid group-by option: %s. Valid options are: %s", groupBy, strings.Join(export.GroupByModes(), ", "))
+	}
+	dirNames, err := export.ParseDirNames(dirNamesList)
+	if err != nil {
+		return nil, stacktrace.PropagateWithCode(err, config.ErrCodeConfig, "Invalid --dir-names")
+	}
+	if !export.IsValidCompression(compression) {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid compress option: %s. Valid options are: gzip", compression)
+	}
+	// The owner layout has no single directory per schema to hold its schema.sql
+	if databaseComments && groupBy == export.GroupByOwner {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--database-comments cannot be combined with --group-by owner")
+	}
+	if !export.IsValidCommentsLayout(commentsLayout) {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid comments layout: %s. Valid layouts are: none, inline, separate", commentsLayout)
+	}
+	if commentsLayout == export.CommentsSeparate && groupBy == export.GroupByOwner {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--comments-layout separate cannot be combined with --group-by owner")
+	}
+	if compression != export.CompressionNone && writeManifest {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--compress cannot be combined with --manifest because psql cannot include compressed files")
+	}
+
+	// Without a tree the whole export is streamed to the combined outputs, as with --output -
+	toStdout := outputDir == "-"
+	// A script written to stdout takes it from the logs and the inventory
+	stdoutTaken := slices.Contains(combinedOutputs, "-")
+	if toStdout {
+		if writeManifest || writeIndex || compression != export.CompressionNone || dedupe || withStats || catalog != "" || batchSize > 0 || databaseComments || commentsLayout == export.CommentsSeparate || len(dirNames) > 0 {
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--output - cannot be combined with --manifest, --write-index, --compress, --dedupe, --with-stats, --catalog, --batch-size, --database-comments, --comments-layout separate or --dir-names")
+		}
+	} else if len(combinedOutputs) > 0 && batchSize > 0 {
+		// A combined script is ordered across every object, which batches never hold at once
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "A combined --output-format cannot be combined with --batch-size")
+	}
+
+	// S3 outputs need no local directory
+	_, _, toS3 := export.ParseS3URL(outputDir)
+	if prune {
+		if toStdout || toS3 {
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--prune requires a local output directory")
+		}
+		if groupBy == export.GroupByOwner {
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--prune cannot be combined with --group-by owner")
+		}
+		// A narrower selection would prune the files of every object it left out
+		if err := rejectNarrowSelection(cmd, "prune"); err != nil {
+			return nil, err
+		}
+	}
+	// The report takes stdout, so logs and the inventory must stay off it
+	reporting := reportFormat != ""
+	if reporting {
+		if reportFormat != "json" {
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid report-changes option: %s. Valid options are: json", reportFormat)
+		}
+		if toStdout || toS3 {
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--report-changes requires a local output directory")
+		}
+		if groupBy == export.GroupByOwner || resume {
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--report-changes cannot be combined with --group-by owner or --resume")
+		}
+		// A narrower selection would report every object it left out as removed
+		if err := rejectNarrowSelection(cmd, "report-changes"); err != nil {
+			return nil, err
+		}
+	} else if writeChanges {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--write requires --report-changes")
+	}
+	if reporting && len(combinedOutputs) > 0 {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--report-changes cannot be combined with a combined --output-format")
+	}
+	// The hash report takes stdout like --report-changes, and no definition files are written
+	if hashOnly {
+		if toStdout || toS3 || len(combinedOutputs) > 0 {
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--definition-hash-only requires a single local output directory")
+		}
+		if writeManifest || writeIndex || compression != export.CompressionNone || dedupe || withStats || catalog != "" || batchSize > 0 || databaseComments || commentsLayout == export.CommentsSeparate || len(dirNames) > 0 || prune || reporting || resume {
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--definition-hash-only cannot be combined with --manifest, --write-index, --compress, --dedupe, --with-stats, --catalog, --batch-size, --database-comments, --comments-layout separate, --dir-names, --prune, --report-changes or --resume")
+		}
+		// A narrower selection would report every object it left out as removed
+		if err := rejectNarrowSelection(cmd, "definition-hash-only"); err != nil {
+			return nil, err
+		}
+	}
+	// Files covering the whole export would be rewritten to list only the retried objects
+	if retryFailed != "" && (writeManifest || writeIndex || catalog != "" || dedupe || resume) {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--retry-failed cannot be combined with --manifest, --write-index, --catalog, --dedupe or --resume")
+	}
+	if resume && (toStdout || toS3) {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--resume requires a local output directory")
+	}
+
+	return &exportFlags{
+		query:                query,
+		typesList:            typesList,
+		connName:             connName,
+		onErrorOption:        onErrorOption,
+		writeManifest:        writeManifest,
+		wrapTransaction:      wrapTransaction,
+		psqlMetaCommands:     psqlMetaCommands,
+		concurrentIndexes:    concurrentIndexes,
+		maxDefinitionSize:    maxDefinitionSize,
+		writeIndex:           writeIndex,
+		compression:          compression,
+		lint:                 lint,
+		lintFail:             lintFail,
+		dedupe:               dedupe,
+		formatSQL:            formatSQL,
+		outputEncoding:       outputEncoding,
+		sequenceCurrentValue: sequenceCurrentValue,
+		identitySequences:    identitySequences,
+		definitionSource:     definitionSource,
+		normalizeDefaults:    normalizeDefaults,
+		fetchConcurrency:     fetchConcurrency,
+		writeConcurrency:     writeConcurrency,
+		batchSize:            batchSize,
+		objectTimeout:        objectTimeout,
+		profileTop:           profileTop,
+		forceConcurrency:     forceConcurrency,
+		poolWarmup:           poolWarmup,
+		prune:                prune,
+		resume:               resume,
+		groupBy:              groupBy,
+		catalog:              catalog,
+		databaseComments:     databaseComments,
+		commentsLayout:       commentsLayout,
+		skipPermissionErrors: skipPermissionErrors,
+		caveatHeaders:        caveatHeaders,
+		hashOnly:             hashOnly,
+		retryFailed:          retryFailed,
+		writeChanges:         writeChanges,
+		withStats:            withStats,
+		outputDir:            outputDir,
+		combinedOutputs:      combinedOutputs,
+		manifestOrder:        manifestOrder,
+		redactPatterns:       redactPatterns,
+		dirNames:             dirNames,
+		toStdout:             toStdout,
+		stdoutTaken:          stdoutTaken,
+		toS3:                 toS3,
+		reporting:            reporting,
+	}, nil
+}
+
+// rejectNarrowSelection returns a config error if any flag that narrows the selection below
+// whole schemas and types is set. flagName needs every object of them, e.g. --prune would
+// otherwise remove the files of every object the selection left out.
+func rejectNarrowSelection(cmd *cobra.Command, flagName string) error {
+	for _, flag := range []string{"query", "names", "objects-from-file", "retry-failed", "comment-tag"} {
+		if cmd.Flags().Changed(flag) {
+			return stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--%s cannot be combined with --%s; it must cover every object of the selected schemas and types", flagName, flag)
+		}
+	}
+	return nil
+}
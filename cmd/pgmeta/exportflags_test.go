@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func TestRejectNarrowSelection(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		addSelectionFlags(cmd)
+		cmd.Flags().String("retry-failed", "", "")
+		if err := cmd.Flags().Parse(args); err != nil {
+			t.Fatalf("Failed to parse flags: %v", err)
+		}
+		return cmd
+	}
+
+	// Whole schemas and types are a full selection
+	if err := rejectNarrowSelection(newCmd("--schema", "app", "--types", "table"), "prune"); err != nil {
+		t.Errorf("Expected a schema and type selection to be accepted, got %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"--query", "^users$"},
+		{"--names", "public.users"},
+		{"--retry-failed", "failed.txt"},
+		{"--comment-tag", "pgmeta:export"},
+	} {
+		err := rejectNarrowSelection(newCmd(args...), "report-changes")
+		if err == nil {
+			t.Errorf("Expected %s to be rejected", args[0])
+			continue
+		}
+		if stacktrace.GetCode(err) != config.ErrCodeConfig {
+			t.Errorf("Expected a config error for %s, got code %d", args[0], stacktrace.GetCode(err))
+		}
+		if msg := err.Error(); !strings.Contains(msg, "--report-changes cannot be combined with "+args[0]) {
+			t.Errorf("Expected the error to name both flags, got %q", msg)
+		}
+	}
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/palantir/stacktrace"
 	"github.com/skamensky/pgmeta/internal/config"
 	"github.com/skamensky/pgmeta/internal/log"
-	"github.com/skamensky/pgmeta/internal/metadata"
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+	"github.com/skamensky/pgmeta/internal/metadata/export"
 	"github.com/skamensky/pgmeta/internal/metadata/types"
 	"github.com/skamensky/pgmeta/internal/version"
 	"github.com/spf13/cobra"
@@ -18,6 +25,10 @@ var debugMode bool
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		if debugMode {
 			// In debug mode, show full stacktrace
 			fmt.Fprintln(os.Stderr, err)
@@ -27,7 +38,7 @@ func main() {
 			msg = strings.TrimPrefix(msg, "Error: ")
 			fmt.Fprintln(os.Stderr, "Error:", msg)
 		}
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -46,6 +57,9 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&debugMode, "debug", false, "Enable debug mode with stack traces")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return stacktrace.PropagateWithCode(err, config.ErrCodeConfig, "Invalid flags for %s", cmd.CommandPath())
+	})
 
 	// Add version command
 	rootCmd.AddCommand(&cobra.Command{
@@ -56,6 +70,8 @@ func init() {
 		},
 	})
 
+	rootCmd.AddCommand(newCompletionCmd())
+
 	connectionCmd := &cobra.Command{
 		Use:   "connection",
 		Short: "Manage database connections",
@@ -67,21 +83,23 @@ func init() {
 		Short: "Create a new connection",
 		RunE:  runCreateConnection,
 	}
-	createCmd.Flags().String("name", "", "Connection name (required)")
-	createCmd.Flags().String("url", "", "Database URL (required)")
+	createCmd.Flags().String("name", "", "Connection name (required unless --interactive)")
+	createCmd.Flags().String("url", "", "Database URL (required unless --interactive)")
 	createCmd.Flags().Bool("make-default", false, "Set as default connection")
-	if err := createCmd.MarkFlagRequired("name"); err != nil {
-		log.Error("Failed to mark 'name' flag as required: %v", err)
-	}
-	if err := createCmd.MarkFlagRequired("url"); err != nil {
-		log.Error("Failed to mark 'url' flag as required: %v", err)
-	}
+	createCmd.Flags().String("default-schema", "", "Schema to export from this connection when --schema is omitted (default public)")
+	createCmd.Flags().Bool("interactive", false, "Prompt for host, port, database, user, password and sslmode")
+	addTLSFlags(createCmd)
+	createCmd.MarkFlagsMutuallyExclusive("interactive", "url")
 
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all connections",
 		RunE:  runListConnections,
 	}
+	listCmd.Flags().Bool("show-duplicates", false, "Only list connections that point at the same database, grouped by database")
+	listCmd.Flags().String("format", "text", "Output format: 'text' or 'json' (an array of name, url, is_default and default_schema)")
+	listCmd.Flags().Bool("show-secrets", false, "Print passwords in connection strings instead of masking them")
+	listCmd.MarkFlagsMutuallyExclusive("show-duplicates", "format")
 
 	deleteCmd := &cobra.Command{
 		Use:   "delete",
@@ -103,27 +121,140 @@ func init() {
 		log.Error("Failed to mark 'name' flag as required: %v", err)
 	}
 
-	connectionCmd.AddCommand(createCmd, listCmd, deleteCmd, makeDefaultCmd)
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show a connection's settings",
+		RunE:  runShowConnection,
+	}
+	showCmd.Flags().String("name", "", "Connection name (required)")
+	showCmd.Flags().Bool("url-only", false, "Print only the stored connection string, for use in scripts")
+	showCmd.Flags().Bool("show-secrets", false, "Print the password instead of masking it (with --url-only)")
+	if err := showCmd.MarkFlagRequired("name"); err != nil {
+		log.Error("Failed to mark 'name' flag as required: %v", err)
+	}
+
+	for _, c := range []*cobra.Command{deleteCmd, makeDefaultCmd, showCmd} {
+		if err := c.RegisterFlagCompletionFunc("name", completeConnectionNames); err != nil {
+			log.Error("Failed to register completion for 'name' flag: %v", err)
+		}
+	}
+
+	connectionCmd.AddCommand(createCmd, listCmd, deleteCmd, makeDefaultCmd, showCmd)
 
 	exportCmd := &cobra.Command{
 		Use:   "export",
 		Short: "Export database metadata",
 		RunE:  runExport,
 	}
-	exportCmd.Flags().String("query", "ALL", "Regex pattern to match object names (optional, 'ALL' fetches everything)")
-	exportCmd.Flags().String("types", "ALL", "Comma-separated list of object types. Valid types: ALL, table, view, function, aggregate, trigger, index, constraint, sequence, materialized_view, policy, extension, procedure, publication, subscription, rule")
-	exportCmd.Flags().String("connection", "", "Connection name (optional). Defaults to the default connection ")
-	exportCmd.Flags().String("schema", "public", "Comma-separated list of schema names or 'ALL' to export all schemas (optional)")
-	exportCmd.Flags().String("output", "./pgmeta-output", "Output directory for generated files")
+	addSelectionFlags(exportCmd)
+	exportCmd.Flags().StringArray("output", []string{"./pgmeta-output"}, "Output directory for generated files, s3://bucket/prefix to upload them to S3, or '-' to write a single SQL stream to stdout; repeat it with --output-format to write several outputs from one fetch")
+	exportCmd.Flags().StringArray("output-format", nil, "Format of the --output at the same position: 'tree' writes a directory of definition files, 'combined' writes a single SQL script to a file or to stdout with '-'")
+	exportCmd.Flags().Bool("manifest", false, "Write an apply.sql script that replays all exported files in dependency order")
+	exportCmd.Flags().Bool("wrap-transaction", false, "Wrap apply.sql in BEGIN/COMMIT, moving non-transactional statements to apply_post.sql (requires --manifest)")
+	exportCmd.Flags().Bool("emit-psql-meta-commands", false, "Start apply.sql with \\set ON_ERROR_STOP on and \\echo each file before including it, so psql stops at the first error and reports progress (requires --manifest)")
+	exportCmd.Flags().String("order", "", "Comma-separated object types replayed first, in this order, by apply.sql and --output -; unlisted types follow in the default dependency order")
+	exportCmd.Flags().Bool("concurrent-indexes", false, "Emit indexes as CREATE INDEX CONCURRENTLY (moved out of the --wrap-transaction block)")
+	exportCmd.Flags().Bool("write-index", false, "Write an index.json per schema listing each exported file, its object type and parent table")
+	exportCmd.Flags().String("compress", "", "Compress each definition file: 'gzip' writes <name>.sql.gz (default uncompressed; cannot be combined with --manifest)")
+	exportCmd.Flags().StringArray("redact-pattern", nil, "Regex whose matches are replaced with [REDACTED] in every definition before it is written, e.g. for API keys in function bodies (repeatable)")
+	exportCmd.Flags().Bool("with-stats", false, "Write a stats.json beside each table.sql with its row estimate, total and toast size, toast and autovacuum storage parameters and vacuum history (one extra query per schema)")
+	exportCmd.Flags().Bool("format-sql", false, "Reformat definitions with uppercase keywords and consistent indentation (function bodies, literals and comments are left as is)")
+	exportCmd.Flags().String("output-encoding", export.EncodingUTF8, "Character encoding of the written definitions: "+strings.Join(export.OutputEncodings(), ", ")+"; characters it cannot represent fail the file")
+	exportCmd.Flags().Bool("dedupe", false, "Write byte-identical definitions once and link the other files to it with relative symlinks (copies where unsupported), recorded in dedupe.json")
+	exportCmd.Flags().Bool("lint", false, "Report functions without an explicit SET search_path and views or policies referencing other schemas")
+	exportCmd.Flags().Bool("lint-fail", false, "Abort the export when --lint reports any findings (implies --lint)")
+	exportCmd.Flags().Bool("normalize-defaults", false, "Drop casts from column defaults that the column's type makes redundant, e.g. 'active'::character varying on a varchar column (cosmetic; the defaults are unchanged)")
+	exportCmd.Flags().String("definition-source", db.DefinitionSourcePgCatalog, "Where table and view definitions are read from: "+strings.Join(db.DefinitionSources(), ", "))
+	exportCmd.Flags().Bool("sequence-current-value", false, "Append SELECT setval(...) to each sequence so it resumes at its current value (a point-in-time snapshot, not a clean schema)")
+	exportCmd.Flags().Bool("include-sequences-for-identity", false, "Also export the sequences backing identity columns, which their column's identity clause already recreates")
+	exportCmd.Flags().Bool("database-comments", false, "Write COMMENT ON DATABASE to database.sql and each exported schema's COMMENT ON SCHEMA to <schema>/schema.sql")
+	exportCmd.Flags().Bool("caveat-headers", false, "Start the files of subscriptions, publications, materialized views, extensions and concurrent indexes with a comment noting what replaying them requires")
+	exportCmd.Flags().Bool("skip-permission-errors", false, "Warn about objects whose definition the role is not permitted to fetch instead of failing, even with --on-error fail")
+	exportCmd.Flags().String("comments-layout", export.CommentsNone, "Export COMMENT ON statements of objects and columns: 'inline' appends them to each definition file, 'separate' collects them into <schema>/comments.sql, 'none' skips them")
+	exportCmd.Flags().String("catalog", "", "Write a catalog with one row per exported object (schema, type, name, table_name, owner, definition_sha256, file_path) to this path in the output directory; tab-separated if it ends in .tsv, otherwise CSV")
+	exportCmd.Flags().String("group-by", export.GroupBySchema, "Layout of the output directory: 'schema' writes <schema>/<type>/..., 'owner' writes <owner>/<schema>/<type>/... with objects that have no owner, such as extensions, under unowned/")
+	exportCmd.Flags().String("dir-names", "", "Comma-separated default=name list renaming output directories, e.g. 'tables=relations,indexes=idx'; any schema-level type directory (tables, functions, views, ...) or table-level one (indexes, constraints, triggers, ...) can be renamed")
+	exportCmd.Flags().Bool("resume", false, "Fetch definitions in batches recorded in .pgmeta-checkpoint.jsonl, and reuse those recorded by an interrupted run instead of fetching them again")
+	exportCmd.Flags().Bool("definition-hash-only", false, "Write only hashes.json, mapping each object to the SHA-256 of its definition, instead of the definition files, and print the objects added, removed and changed since the previous hashes.json as JSON to stdout; exits with status 2 when there are changes")
+	exportCmd.Flags().String("report-changes", "", "Instead of writing to --output, export to a temporary directory and print the objects added, removed and changed relative to --output as 'json' to stdout; exits with status 2 when there are changes")
+	exportCmd.Flags().Bool("write", false, "With --report-changes, also update --output, deleting the files of removed objects as --prune does")
+	exportCmd.Flags().String("retry-failed", "", "Export only the objects listed in the "+export.FailedObjectsFile+" an earlier --on-error warn export wrote to its output directory, instead of --query, --names, --types and --schema")
+	for _, flag := range []string{"query", "names", "objects-from-file", "types", "schema", "schema-regex", "with-dependents", "comment-tag", "exclude-owned-by-extensions", "exclude-owned-by-extensions-except"} {
+		exportCmd.MarkFlagsMutuallyExclusive("retry-failed", flag)
+	}
+	if err := exportCmd.MarkFlagFilename("retry-failed"); err != nil {
+		log.Error("Failed to mark 'retry-failed' flag as a filename: %v", err)
+	}
+	exportCmd.Flags().Bool("prune", false, "After a successful export, delete .sql files in the exported schemas and types whose objects no longer exist, and directories left empty (not with --query, --names, --objects-from-file, --retry-failed or --comment-tag)")
+	exportCmd.Flags().Int("max-definition-size", db.DefaultMaxDefinitionSize, "Maximum size of a single object definition in bytes; larger ones are truncated with on-error=warn or fail with on-error=fail (0 disables the check)")
+	exportCmd.Flags().Int("parallel-definition-fetch", db.DefaultFetchConcurrency, "Number of definitions fetched from the database at once; each holds a connection, so keep it below the server's max_connections")
+	exportCmd.Flags().Int("batch-size", 0, "Fetch and write definitions this many objects at a time, so only one batch is held in memory; a table and its indexes, constraints and triggers always share a batch (default 0 fetches everything first)")
+	exportCmd.Flags().Int("write-concurrency", export.DefaultWriteConcurrency, "Number of definition files written at once")
+	exportCmd.Flags().Bool("force-concurrency", false, "Keep --parallel-definition-fetch even when it exceeds half of the server's free connection slots")
+	exportCmd.Flags().Bool("pool-warmup", true, "Open --parallel-definition-fetch connections at once before fetching, failing early if the server or network cannot take them (--pool-warmup=false skips it)")
+	addTimeoutFlags(exportCmd)
+	addTLSFlags(exportCmd)
+	exportCmd.Flags().Int("profile", 0, "Time every definition fetch and print the N slowest objects at the end, to tune --parallel-definition-fetch and spot problem objects (0 disables it)")
+	exportCmd.Flags().Duration("timeout-per-object", 0, "Give up on any single definition that takes longer than this to fetch, e.g. 20s, and record the object as failed while the export continues (0 for no limit)")
 	exportCmd.Flags().String("on-error", "warn", "Error handling behavior: 'warn' (default) or 'fail' (Use 'warn' for older PostgreSQL versions)")
 
 	rootCmd.AddCommand(exportCmd)
+
+	estimateCmd := &cobra.Command{
+		Use:   "estimate",
+		Short: "Count matching objects and estimate the export size",
+		RunE:  runEstimate,
+	}
+	addSelectionFlags(estimateCmd)
+	estimateCmd.Flags().Int("sample-size", 50, "Number of definitions to fetch for the size estimate")
+	estimateCmd.Flags().Int("concurrency", 10, "Number of definitions to fetch concurrently")
+	estimateCmd.Flags().Bool("force-concurrency", false, "Keep --concurrency even when it exceeds half of the server's free connection slots")
+	estimateCmd.Flags().Bool("pool-warmup", true, "Open --concurrency connections at once before fetching, failing early if the server or network cannot take them (--pool-warmup=false skips it)")
+	addTimeoutFlags(estimateCmd)
+	addTLSFlags(estimateCmd)
+
+	rootCmd.AddCommand(estimateCmd)
+
+	schemaTreeCmd := &cobra.Command{
+		Use:   "schema-tree",
+		Short: "Print the matching objects as the directory tree an export would write, without fetching definitions",
+		RunE:  runSchemaTree,
+	}
+	addSelectionFlags(schemaTreeCmd)
+	addTimeoutFlags(schemaTreeCmd)
+	addTLSFlags(schemaTreeCmd)
+
+	rootCmd.AddCommand(schemaTreeCmd)
+
+	databasesCmd := &cobra.Command{
+		Use:   "databases",
+		Short: "List the databases on the connection's server that can be exported",
+		RunE:  runDatabases,
+	}
+	databasesCmd.Flags().String("connection", "", "Connection name, or a prefix matching exactly one connection (optional). Defaults to the default connection")
+	databasesCmd.Flags().Bool("strict-version", false, "Fail instead of warning when the server is older than PostgreSQL 11 or not PostgreSQL (e.g. Redshift, CockroachDB)")
+	addTimeoutFlags(databasesCmd)
+	addTLSFlags(databasesCmd)
+
+	rootCmd.AddCommand(databasesCmd)
 }
 
 func runCreateConnection(cmd *cobra.Command, args []string) error {
 	name, _ := cmd.Flags().GetString("name")
 	url, _ := cmd.Flags().GetString("url")
 	makeDefault, _ := cmd.Flags().GetBool("make-default")
+	interactive, _ := cmd.Flags().GetBool("interactive")
+	defaultSchema, _ := cmd.Flags().GetString("default-schema")
+
+	if interactive {
+		var err error
+		name, url, err = runConnectionWizard(name, tlsFiles(cmd, &config.Connection{}))
+		if err != nil {
+			return err
+		}
+	} else if name == "" || url == "" {
+		return stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Both --name and --url are required unless --interactive is set")
+	}
 
 	log.Debug("Creating connection %s with URL %s (default: %v)", name, url, makeDefault)
 
@@ -135,26 +266,63 @@ func runCreateConnection(cmd *cobra.Command, args []string) error {
 	if err := cfg.AddConnection(name, url, makeDefault); err != nil {
 		return stacktrace.Propagate(err, "Failed to add connection %s", name)
 	}
+	if defaultSchema != "" {
+		if err := cfg.SetConnectionDefaultSchema(name, defaultSchema); err != nil {
+			return stacktrace.Propagate(err, "Failed to set default schema of connection %s", name)
+		}
+	}
+	if files := tlsFiles(cmd, &config.Connection{}); files != (db.TLSFiles{}) {
+		if err := cfg.SetConnectionTLS(name, files.RootCert, files.Cert, files.Key); err != nil {
+			return stacktrace.Propagate(err, "Failed to set TLS files of connection %s", name)
+		}
+	}
 
 	fmt.Printf("Added new connection: %s\n", name)
 	return nil
 }
 
 func runListConnections(cmd *cobra.Command, args []string) error {
+	format, _ := cmd.Flags().GetString("format")
+	showSecrets, _ := cmd.Flags().GetBool("show-secrets")
+
 	log.Debug("Listing connections")
+	if format != "text" && format != "json" {
+		return stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid format option: %s. Valid options are: text, json", format)
+	}
 
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		return stacktrace.Propagate(err, "Failed to load config")
 	}
 
-	if len(cfg.Connections) == 0 {
+	connections := make([]config.Connection, len(cfg.Connections))
+	for i, conn := range cfg.Connections {
+		connections[i] = conn
+		if !showSecrets {
+			connections[i].URL = conn.MaskedURL()
+		}
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(connections, "", "  ")
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to encode connections")
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(connections) == 0 {
 		fmt.Println("No connections configured")
 		return nil
 	}
 
+	if showDuplicates, _ := cmd.Flags().GetBool("show-duplicates"); showDuplicates {
+		return printDuplicateConnections(cfg)
+	}
+
 	fmt.Println("Configured connections:")
-	for _, conn := range cfg.Connections {
+	for _, conn := range connections {
 		defaultMark := " "
 		if conn.IsDefault {
 			defaultMark = "*"
@@ -164,6 +332,74 @@ func runListConnections(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// printDuplicateConnections lists each group of connections pointing at the same database
+func printDuplicateConnections(cfg *config.Config) error {
+	groups := cfg.DuplicateConnections()
+	if len(groups) == 0 {
+		fmt.Println("No duplicate connections found")
+		return nil
+	}
+
+	fmt.Println("Connections pointing at the same database:")
+	for _, group := range groups {
+		fmt.Printf("%s\n", group[0].NormalizedURL())
+		for _, conn := range group {
+			defaultMark := " "
+			if conn.IsDefault {
+				defaultMark = "*"
+			}
+			fmt.Printf("  %s %s\n", defaultMark, conn.Name)
+		}
+	}
+	return nil
+}
+
+func runShowConnection(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("name")
+	urlOnly, _ := cmd.Flags().GetBool("url-only")
+	showSecrets, _ := cmd.Flags().GetBool("show-secrets")
+
+	log.Debug("Showing connection: %s", name)
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to load config")
+	}
+
+	conn := cfg.GetConnection(name)
+	if conn == nil {
+		return stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Connection not found: %s", name)
+	}
+
+	if urlOnly {
+		if showSecrets {
+			fmt.Println(conn.URL)
+		} else {
+			fmt.Println(conn.MaskedURL())
+		}
+		return nil
+	}
+
+	fmt.Printf("name: %s\n", conn.Name)
+	fmt.Printf("default: %v\n", conn.IsDefault)
+	fmt.Printf("default_schema: %s\n", conn.ResolveSchemas("", false))
+	for _, file := range [][2]string{{"sslrootcert", conn.SSLRootCert}, {"sslcert", conn.SSLCert}, {"sslkey", conn.SSLKey}} {
+		if file[1] != "" {
+			fmt.Printf("%s: %s\n", file[0], file[1])
+		}
+	}
+	params := conn.Params()
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s: %s\n", k, params[k])
+	}
+	return nil
+}
+
 func runDeleteConnection(cmd *cobra.Command, args []string) error {
 	name, _ := cmd.Flags().GetString("name")
 
@@ -201,120 +437,406 @@ func runMakeDefaultConnection(cmd *cobra.Command, args []string) error {
 }
 
 func runExport(cmd *cobra.Command, args []string) error {
-	query, _ := cmd.Flags().GetString("query")
-	typesList, _ := cmd.Flags().GetString("types")
-	connName, _ := cmd.Flags().GetString("connection")
-	schemasList, _ := cmd.Flags().GetString("schema")
-	outputDir, _ := cmd.Flags().GetString("output")
-	onErrorOption, _ := cmd.Flags().GetString("on-error")
-
-	// Validate on-error option
-	if onErrorOption != "fail" && onErrorOption != "warn" {
-		return stacktrace.NewError("Invalid on-error option: %s. Valid options are: warn, fail", onErrorOption)
+	f, err := parseExportFlags(cmd)
+	if err != nil {
+		return err
+	}
+	// Logs must stay off a script, report or hash report written to stdout
+	if f.stdoutTaken || f.reporting || f.hashOnly {
+		log.RedirectToStderr()
+	}
+	// Without --write the report leaves --output untouched
+	if !f.toStdout && !f.toS3 && (!f.reporting || f.writeChanges) {
+		if err := export.PrepareOutputDir(f.outputDir); err != nil {
+			return err
+		}
 	}
 
-	log.Info("Exporting database objects with pattern %s, types %s, schemas %s, on-error: %s",
-		query, typesList, schemasList, onErrorOption)
-
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return stacktrace.Propagate(err, "Failed to create output directory: %s", outputDir)
+	combinedWriters, closeCombined, err := openCombinedOutputs(f.combinedOutputs)
+	if err != nil {
+		return err
 	}
+	defer closeCombined()
 
-	cfg, err := config.LoadConfig()
+	conn, err := resolveConnection(f.connName)
 	if err != nil {
-		return stacktrace.Propagate(err, "Failed to load config")
+		return err
 	}
 
-	var connectionURL string
-	if connName != "" {
-		conn := cfg.GetConnection(connName)
-		if conn == nil {
-			return stacktrace.NewError("Connection not found: %s", connName)
+	log.Info("Exporting database objects with pattern %s, types %s, schemas %s, on-error: %s",
+		f.query, f.typesList, selectedSchemas(cmd, conn), f.onErrorOption)
+
+	fetcher, err := openFetcher(cmd, conn)
+	if err != nil {
+		return err
+	}
+	defer fetcher.Close()
+	fetcher.SetMaxDefinitionSize(f.maxDefinitionSize, f.onErrorOption == "warn")
+	fetcher.SetDefinitionSource(f.definitionSource)
+	fetcher.SetNormalizeDefaults(f.normalizeDefaults)
+	fetcher.SetObjectTimeout(f.objectTimeout)
+	fetcher.SetProfiling(f.profileTop > 0)
+	if !f.forceConcurrency {
+		f.fetchConcurrency = fetcher.ClampConcurrency(f.fetchConcurrency)
+	}
+	if f.poolWarmup {
+		if err := fetcher.WarmUpPool(f.fetchConcurrency); err != nil {
+			return err
+		}
+	}
+	if f.sequenceCurrentValue {
+		log.Info("Sequences will be exported with their current values; the export is a snapshot of this point in time")
+		fetcher.SetSequenceCurrentValue(true)
+	}
+	fetcher.SetIdentitySequences(f.identitySequences)
+
+	var objects []types.DBObject
+	var missing []string
+	var scope types.QueryOptions
+	if f.prune || f.reporting || f.hashOnly {
+		// Pruning and reporting need the schemas and types that were queried, not just what was found
+		scope, err = selectionOptions(cmd, fetcher, conn)
+		if err != nil {
+			return err
+		}
+		objects, err = fetcher.QueryObjects(scope)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to query objects")
+		}
+		if withDependents, _ := cmd.Flags().GetBool("with-dependents"); withDependents {
+			if objects, err = addDependents(fetcher, scope, objects); err != nil {
+				return err
+			}
+			if slices.Contains(scope.Types, types.TypeTable) {
+				// Stale dependents of the selected tables are pruned too
+				for _, t := range types.DependentTypes() {
+					if !slices.Contains(scope.Types, t) {
+						scope.Types = append(scope.Types, t)
+					}
+				}
+			}
+		}
+	} else if f.retryFailed != "" {
+		objects, missing, err = selectObjectsFromFile(f.retryFailed, fetcher)
+		if err != nil {
+			return err
 		}
-		connectionURL = conn.URL
-		log.Debug("Using specified connection: %s", connName)
 	} else {
-		conn := cfg.GetDefaultConnection()
-		if conn == nil {
-			return stacktrace.NewError("No connection specified and no default connection found")
+		objects, missing, err = selectObjects(cmd, fetcher, conn)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		if f.onErrorOption == "fail" {
+			return stacktrace.NewError("Requested objects not found: %s", strings.Join(missing, ", "))
 		}
-		connectionURL = conn.URL
-		log.Debug("Using default connection: %s", conn.Name)
+		log.Warn("Requested objects not found: %s", strings.Join(missing, ", "))
 	}
 
-	fetcher, err := metadata.NewFetcher(connectionURL)
+	serverInfo, err := fetcher.ServerInfo()
 	if err != nil {
-		return stacktrace.Propagate(err, "Failed to initialize metadata fetcher")
+		return stacktrace.Propagate(err, "Failed to fetch server info")
 	}
-	defer fetcher.Close()
 
-	var objectTypes []types.ObjectType
-	if typesList == "ALL" {
-		objectTypes = []types.ObjectType{} // Empty slice means all types in our implementation
-		log.Debug("Querying all object types")
+	var lintSchemas []string
+	if f.lint || f.lintFail {
+		// Lint needs every schema, not just the exported ones, to spot cross-schema references
+		lintSchemas, err = fetcher.GetAllSchemas(true)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to fetch schemas for lint")
+		}
+	}
+
+	log.Info("Found %d objects", len(objects))
+	if len(objects) == 0 {
+		if f.stdoutTaken || f.reporting || f.hashOnly {
+			log.Warn("No objects found matching the criteria")
+		} else {
+			fmt.Println("No objects found matching the criteria")
+		}
+		// Every object having been dropped is still something to prune or report
+		if !f.prune && !f.reporting && !f.hashOnly {
+			return &exitCodeError{code: exitNoObjects}
+		}
+	}
+	if f.stdoutTaken || f.reporting || f.hashOnly {
+		// The inventory would corrupt the SQL stream
+		log.Info("Server: %s", serverInfo)
 	} else {
-		// Parse comma-separated types
-		for _, t := range strings.Split(typesList, ",") {
-			objType := types.ObjectType(strings.TrimSpace(t))
-			if !metadata.IsValidType(objType) {
-				return stacktrace.NewError("Invalid object type: %s. Valid types are: ALL, table, view, function, trigger, index, constraint", t)
-			}
-			objectTypes = append(objectTypes, objType)
+		fmt.Printf("Server: %s\n", serverInfo)
+		fmt.Println("Found objects:")
+		for i, obj := range objects {
+			fmt.Printf("%d. [%s] %s.%s\n", i+1, obj.Type, obj.Schema, obj.Name)
 		}
-		log.Debug("Querying specific object types: %v", objectTypes)
 	}
 
-	// Use a special regex that matches everything if query is "ALL"
-	nameRegex := query
-	if query == "ALL" {
-		nameRegex = ".*" // Regex that matches everything
-		log.Debug("Using wildcard regex pattern")
+	exportOpts := types.ExportOptions{
+		OutputDir:            f.outputDir,
+		ContinueOnError:      f.onErrorOption == "warn",
+		Manifest:             f.writeManifest,
+		WrapTransaction:      f.wrapTransaction,
+		PsqlMetaCommands:     f.psqlMetaCommands,
+		ManifestOrder:        f.manifestOrder,
+		WithStats:            f.withStats,
+		RedactPatterns:       f.redactPatterns,
+		Resume:               f.resume,
+		GroupBy:              f.groupBy,
+		DirNames:             f.dirNames,
+		Catalog:              f.catalog,
+		DatabaseComments:     f.databaseComments,
+		CommentsLayout:       f.commentsLayout,
+		SkipPermissionErrors: f.skipPermissionErrors,
+		DefinitionHashOnly:   f.hashOnly,
+		CaveatHeaders:        f.caveatHeaders,
+		ConcurrentIndexes:    f.concurrentIndexes,
+		ServerInfo:           &serverInfo,
+		WriteIndex:           f.writeIndex,
+		Compression:          f.compression,
+		Lint:                 f.lint || f.lintFail,
+		LintFail:             f.lintFail,
+		LintSchemas:          lintSchemas,
+		Dedupe:               f.dedupe,
+		FormatSQL:            f.formatSQL,
+		OutputEncoding:       f.outputEncoding,
+		FetchConcurrency:     f.fetchConcurrency,
+		WriteConcurrency:     f.writeConcurrency,
+		BatchSize:            f.batchSize,
+		Prune:                f.prune,
+		PruneSchemas:         scope.Schemas,
+		PruneTypes:           scope.Types,
+	}
+	if f.toStdout {
+		exportOpts.Stream = io.MultiWriter(combinedWriters...)
 	} else {
-		log.Debug("Using regex pattern: %s", nameRegex)
+		exportOpts.CombinedOutputs = combinedWriters
 	}
 
-	var schemas []string
-	// Special handling for "ALL" to fetch all schemas
-	if schemasList == "ALL" {
-		allSchemas, err := fetcher.GetAllSchemas()
+	var before *export.Snapshot
+	var beforeHashes export.DefinitionHashes
+	if f.hashOnly {
+		if beforeHashes, err = export.ReadHashes(filepath.Join(f.outputDir, export.HashesFile)); err != nil {
+			return err
+		}
+	}
+	if f.reporting {
+		if before, err = export.SnapshotDefinitions(f.outputDir, scope.Schemas, scope.Types, f.dirNames); err != nil {
+			return err
+		}
+		if f.writeChanges {
+			// Files of removed objects are deleted, as with --prune
+			exportOpts.Prune = true
+		} else {
+			tempDir, err := os.MkdirTemp("", "pgmeta-report-")
+			if err != nil {
+				return stacktrace.Propagate(err, "Failed to create a temporary export directory")
+			}
+			defer os.RemoveAll(tempDir)
+			exportOpts.OutputDir = tempDir
+		}
+	}
+
+	incomplete, err := fetcher.SaveObjects(objects, exportOpts)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to save objects")
+	}
+	if err := closeCombined(); err != nil {
+		return err
+	}
+	if f.profileTop > 0 {
+		// Like the inventory, the report stays off stdout when stdout carries output
+		profileOut := os.Stdout
+		if f.stdoutTaken || f.reporting || f.hashOnly {
+			profileOut = os.Stderr
+		}
+		printProfile(profileOut, fetcher.SlowestFetches(f.profileTop))
+	}
+	// Objects skipped under --on-error warn, or not found, leave the export partial
+	partial := incomplete || len(missing) > 0
+	if f.reporting {
+		after, err := export.SnapshotDefinitions(exportOpts.OutputDir, scope.Schemas, scope.Types, f.dirNames)
 		if err != nil {
-			return stacktrace.Propagate(err, "Failed to fetch all schemas")
+			return err
 		}
-		schemas = allSchemas
-		log.Info("Fetching objects from all schemas: %v", schemas)
-	} else {
-		// Parse comma-separated schemas
-		for _, s := range strings.Split(schemasList, ",") {
-			schemas = append(schemas, strings.TrimSpace(s))
+		return reportSnapshotChanges(before, after, partial)
+	}
+	if f.hashOnly {
+		afterHashes, err := export.ReadHashes(filepath.Join(f.outputDir, export.HashesFile))
+		if err != nil {
+			return err
+		}
+		if err := reportChanges(export.CompareHashes(beforeHashes, afterHashes)); err != nil {
+			return err
 		}
+		if partial {
+			return &exitCodeError{code: exitPartialFailure}
+		}
+		return nil
+	}
+	if f.toStdout {
+		if partial {
+			return &exitCodeError{code: exitPartialFailure}
+		}
+		return nil
+	}
+	if f.stdoutTaken {
+		// The combined script on stdout must end with its last definition
+		if partial {
+			log.Warn("Saved objects to %s, but some objects could not be exported", f.outputDir)
+			return &exitCodeError{code: exitPartialFailure}
+		}
+		log.Info("Successfully saved objects to %s", f.outputDir)
+		return nil
 	}
 
-	objects, err := fetcher.QueryObjects(types.QueryOptions{
-		Types:     objectTypes,
-		Schemas:   schemas,
-		NameRegex: nameRegex,
-	})
+	if partial {
+		fmt.Printf("Saved objects to %s, but some objects could not be exported\n", f.outputDir)
+		return &exitCodeError{code: exitPartialFailure}
+	}
+	fmt.Printf("Successfully saved objects to %s\n", f.outputDir)
+	return nil
+}
+
+// parseManifestOrder parses the --order list of object types
+func parseManifestOrder(list string) ([]types.ObjectType, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var order []types.ObjectType
+	seen := make(map[types.ObjectType]bool)
+	for _, t := range strings.Split(list, ",") {
+		objType := types.ObjectType(strings.TrimSpace(t))
+		switch {
+		case !types.IsValidType(objType):
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid object type in --order: %s. Valid types are: %s", t, joinTypes(types.ValidTypes()))
+		case !export.IsManifestType(objType):
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--order cannot include %s: its files are not replayed by the manifest", objType)
+		case seen[objType]:
+			return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--order lists %s more than once", objType)
+		}
+		seen[objType] = true
+		order = append(order, objType)
+	}
+	return order, nil
+}
+
+func runEstimate(cmd *cobra.Command, args []string) error {
+	connName, _ := cmd.Flags().GetString("connection")
+	sampleSize, _ := cmd.Flags().GetInt("sample-size")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	forceConcurrency, _ := cmd.Flags().GetBool("force-concurrency")
+	poolWarmup, _ := cmd.Flags().GetBool("pool-warmup")
+
+	if sampleSize < 1 {
+		return stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--sample-size must be at least 1")
+	}
+	if concurrency < 1 {
+		return stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--concurrency must be at least 1")
+	}
+
+	conn, err := resolveConnection(connName)
 	if err != nil {
-		return stacktrace.Propagate(err, "Failed to query objects")
+		return err
 	}
 
-	log.Info("Found %d objects", len(objects))
-	if len(objects) > 0 {
-		fmt.Println("Found objects:")
-		for i, obj := range objects {
-			fmt.Printf("%d. [%s] %s.%s\n", i+1, obj.Type, obj.Schema, obj.Name)
+	fetcher, err := openFetcher(cmd, conn)
+	if err != nil {
+		return err
+	}
+	defer fetcher.Close()
+	if !forceConcurrency {
+		concurrency = fetcher.ClampConcurrency(concurrency)
+	}
+	if poolWarmup {
+		if err := fetcher.WarmUpPool(concurrency); err != nil {
+			return err
 		}
-	} else {
+	}
+
+	objects, _, err := selectObjects(cmd, fetcher, conn)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
 		fmt.Println("No objects found matching the criteria")
-		return nil
+		return &exitCodeError{code: exitNoObjects}
 	}
 
-	continueOnError := onErrorOption == "warn"
-	if err := fetcher.SaveObjects(objects, outputDir, continueOnError); err != nil {
-		return stacktrace.Propagate(err, "Failed to save objects")
+	estimate, err := fetcher.EstimateObjects(objects, sampleSize, concurrency)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to estimate export size")
+	}
+	if estimate.TotalFailed > 0 {
+		log.Warn("%d sampled definitions could not be fetched and are left out of the estimate", estimate.TotalFailed)
 	}
 
-	fmt.Printf("Successfully saved objects to %s\n", outputDir)
+	fmt.Printf("%-20s %8s %8s %12s\n", "TYPE", "COUNT", "SAMPLED", "EST. BYTES")
+	for _, t := range estimate.Types {
+		fmt.Printf("%-20s %8d %8d %12d\n", t.Type, t.Count, t.Sampled, t.EstimatedBytes)
+	}
+	fmt.Printf("%-20s %8d %8d %12d\n", "total", estimate.TotalCount, estimate.TotalSampled, estimate.EstimatedBytes)
 	return nil
 }
+
+func runSchemaTree(cmd *cobra.Command, args []string) error {
+	connName, _ := cmd.Flags().GetString("connection")
+
+	conn, err := resolveConnection(connName)
+	if err != nil {
+		return err
+	}
+
+	fetcher, err := openFetcher(cmd, conn)
+	if err != nil {
+		return err
+	}
+	defer fetcher.Close()
+
+	objects, missing, err := selectObjects(cmd, fetcher, conn)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		log.Warn("Requested objects not found: %s", strings.Join(missing, ", "))
+	}
+	if len(objects) == 0 {
+		fmt.Println("No objects found matching the criteria")
+		return &exitCodeError{code: exitNoObjects}
+	}
+	return export.WriteTree(os.Stdout, objects)
+}
+
+// runDatabases prints the databases of the connection's server, one per line
+func runDatabases(cmd *cobra.Command, args []string) error {
+	connName, _ := cmd.Flags().GetString("connection")
+
+	conn, err := resolveConnection(connName)
+	if err != nil {
+		return err
+	}
+
+	fetcher, err := openFetcher(cmd, conn)
+	if err != nil {
+		return err
+	}
+	defer fetcher.Close()
+
+	databases, err := fetcher.ListDatabases()
+	if err != nil {
+		return err
+	}
+	for _, name := range databases {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// joinTypes renders object types as a comma-separated list
+func joinTypes(objectTypes []types.ObjectType) string {
+	names := make([]string, len(objectTypes))
+	for i, t := range objectTypes {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"os"
+	"slices"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/config"
+	"github.com/skamensky/pgmeta/internal/metadata/export"
+)
+
+// Formats of the outputs given with --output-format
+const (
+	outputFormatTree     = "tree"     // A directory of definition files, as --output has always written
+	outputFormatCombined = "combined" // A single SQL script, as --output - writes to stdout
+)
+
+// parseOutputs pairs each --output with its --output-format. It returns where the tree is
+// written, or "-" when only combined scripts are, and the paths of the combined scripts,
+// with "-" standing for stdout. Without --output-format every output is a tree, so only
+// one output can be given, and "-" is the combined script on stdout it has always been.
+func parseOutputs(outputs, formats []string) (string, []string, error) {
+	if len(formats) > 0 && len(formats) != len(outputs) {
+		return "", nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--output-format must be given once for each --output, got %d formats for %d outputs", len(formats), len(outputs))
+	}
+
+	tree := ""
+	var combined []string
+	for i, output := range outputs {
+		format := outputFormatTree
+		if len(formats) > 0 {
+			format = formats[i]
+		}
+		switch {
+		case format == outputFormatCombined || (format == outputFormatTree && output == "-"):
+			if _, _, toS3 := export.ParseS3URL(output); toS3 {
+				return "", nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "A combined output must be a local file or '-', got %s", output)
+			}
+			if slices.Contains(combined, output) {
+				return "", nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--output %s is given more than once", output)
+			}
+			combined = append(combined, output)
+		case format == outputFormatTree:
+			if tree != "" {
+				return "", nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Only one --output can be a tree, got %s and %s", tree, output)
+			}
+			tree = output
+		default:
+			return "", nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid output-format option: %s. Valid options are: %s, %s", format, outputFormatTree, outputFormatCombined)
+		}
+	}
+	if tree == "" {
+		tree = "-"
+	}
+	return tree, combined, nil
+}
+
+// openCombinedOutputs creates the files of the combined scripts at paths, with "-" writing
+// to stdout. closeAll closes the files, returning the first error; it may be called again.
+func openCombinedOutputs(paths []string) ([]io.Writer, func() error, error) {
+	var writers []io.Writer
+	var files []*os.File
+	closeAll := func() error {
+		var firstErr error
+		for _, f := range files {
+			if err := f.Close(); err != nil && firstErr == nil {
+				firstErr = stacktrace.Propagate(err, "Failed to write combined output: %s", f.Name())
+			}
+		}
+		files = nil
+		return firstErr
+	}
+	for _, path := range paths {
+		if path == "-" {
+			writers = append(writers, os.Stdout)
+			continue
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			closeAll()
+			return nil, nil, stacktrace.Propagate(err, "Failed to create combined output: %s", path)
+		}
+		files = append(files, f)
+		writers = append(writers, f)
+	}
+	return writers, closeAll, nil
+}
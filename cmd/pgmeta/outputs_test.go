@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseOutputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		outputs  []string
+		formats  []string
+		tree     string
+		combined []string
+		wantErr  bool
+	}{
+		{name: "directory", outputs: []string{"./schema"}, tree: "./schema"},
+		{name: "stdout", outputs: []string{"-"}, tree: "-", combined: []string{"-"}},
+		{name: "tree and combined", outputs: []string{"./schema", "schema.sql"}, formats: []string{"tree", "combined"}, tree: "./schema", combined: []string{"schema.sql"}},
+		{name: "combined only", outputs: []string{"schema.sql", "-"}, formats: []string{"combined", "combined"}, tree: "-", combined: []string{"schema.sql", "-"}},
+		{name: "two outputs without formats", outputs: []string{"./a", "./b"}, wantErr: true},
+		{name: "format count mismatch", outputs: []string{"./a", "b.sql"}, formats: []string{"tree"}, wantErr: true},
+		{name: "two trees", outputs: []string{"./a", "./b"}, formats: []string{"tree", "tree"}, wantErr: true},
+		{name: "combined on S3", outputs: []string{"./a", "s3://bucket/schema.sql"}, formats: []string{"tree", "combined"}, wantErr: true},
+		{name: "stdout twice", outputs: []string{"-", "-"}, formats: []string{"tree", "combined"}, wantErr: true},
+		{name: "unknown format", outputs: []string{"./a"}, formats: []string{"yaml"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tree, combined, err := parseOutputs(tt.outputs, tt.formats)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if tree != tt.tree || !slices.Equal(combined, tt.combined) {
+			t.Errorf("%s: expected tree %q and combined %v, got %q and %v", tt.name, tt.tree, tt.combined, tree, combined)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+)
+
+// printProfile writes the slowest definition fetches given by --profile to w, slowest first
+func printProfile(w io.Writer, timings []db.ObjectTiming) {
+	if len(timings) == 0 {
+		fmt.Fprintln(w, "Slowest definition fetches: none timed")
+		return
+	}
+	fmt.Fprintf(w, "Slowest definition fetches:\n")
+	for i, t := range timings {
+		fmt.Fprintf(w, "%d. %10s  [%s] %s.%s\n", i+1, t.Duration.Round(time.Millisecond), t.Object.Type, t.Object.Schema, t.Object.Name)
+	}
+}
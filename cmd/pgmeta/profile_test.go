@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestPrintProfile(t *testing.T) {
+	var buf bytes.Buffer
+	printProfile(&buf, []db.ObjectTiming{
+		{Object: types.ObjectKey{Type: types.TypeView, Schema: "public", Name: "totals"}, Duration: 2345678 * time.Microsecond},
+		{Object: types.ObjectKey{Type: types.TypeTable, Schema: "app", Name: "users"}, Duration: 12 * time.Millisecond},
+	})
+	want := "Slowest definition fetches:\n" +
+		"1.     2.346s  [view] public.totals\n" +
+		"2.       12ms  [table] app.users\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected report:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	printProfile(&buf, nil)
+	if buf.String() != "Slowest definition fetches: none timed\n" {
+		t.Errorf("Unexpected report without timings: %q", buf.String())
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/export"
+)
+
+// changeReport is a report of changes, to definition files or to definition hashes
+type changeReport interface {
+	HasChanges() bool
+}
+
+// reportChanges prints report to stdout as JSON and returns an exitCodeError when it has changes
+func reportChanges(report changeReport) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return stacktrace.Propagate(err, "Failed to write the change report")
+	}
+	if report.HasChanges() {
+		return &exitCodeError{code: exitChangesFound}
+	}
+	return nil
+}
+
+// reportSnapshotChanges prints the changes to definition files from before to after. When
+// the export was partial, the files of the objects it could not fetch are missing from after
+// and would be reported as removed, so nothing is reported and it ends with exitPartialFailure.
+func reportSnapshotChanges(before, after *export.Snapshot, partial bool) error {
+	if partial {
+		log.Warn("Some objects could not be exported, so no changes are reported")
+		return &exitCodeError{code: exitPartialFailure}
+	}
+	return reportChanges(export.CompareSnapshots(before, after))
+}
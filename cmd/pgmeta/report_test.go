@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/export"
+)
+
+func TestReportSnapshotChangesPartial(t *testing.T) {
+	writeViews := func(dir string, names ...string) *export.Snapshot {
+		t.Helper()
+		viewsDir := filepath.Join(dir, "public", "views")
+		if err := os.MkdirAll(viewsDir, 0755); err != nil {
+			t.Fatalf("Failed to create views directory: %v", err)
+		}
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(viewsDir, name+".sql"), []byte("CREATE VIEW "+name+" AS SELECT 1;"), 0644); err != nil {
+				t.Fatalf("Failed to write view: %v", err)
+			}
+		}
+		snapshot, err := export.SnapshotDefinitions(dir, []string{"public"}, nil, export.DirNames{})
+		if err != nil {
+			t.Fatalf("SnapshotDefinitions failed: %v", err)
+		}
+		return snapshot
+	}
+
+	before := writeViews(t.TempDir(), "active_users", "totals")
+	// Fetching totals failed, so the new export has no file for it
+	after := writeViews(t.TempDir(), "active_users")
+
+	err := reportSnapshotChanges(before, after, true)
+	if got := exitCode(err); got != exitPartialFailure {
+		t.Errorf("Expected exit code %d when a fetch failed, got %d (%v)", exitPartialFailure, got, err)
+	}
+
+	// A complete export reports the view as removed
+	err = reportSnapshotChanges(before, after, false)
+	if got := exitCode(err); got != exitChangesFound {
+		t.Errorf("Expected exit code %d for a removed view, got %d (%v)", exitChangesFound, got, err)
+	}
+}
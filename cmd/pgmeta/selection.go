@@ -0,0 +1,371 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/config"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata"
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+	"github.com/spf13/cobra"
+)
+
+// addSelectionFlags registers the flags that choose a connection and the objects to query,
+// shared by every command that runs QueryObjects
+func addSelectionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("query", "ALL", "Regex pattern to match object names (optional, 'ALL' fetches everything)")
+	cmd.Flags().String("names", "", "Comma-separated list of schema-qualified object names (schema.name) to select instead of --query (optional)")
+	cmd.Flags().String("objects-from-file", "", "Path to a file of newline-delimited 'type schema.name' entries to select exactly, instead of --query, --names, --types and --schema (optional)")
+	cmd.MarkFlagsMutuallyExclusive("names", "query", "objects-from-file")
+	cmd.Flags().String("types", "ALL", "Comma-separated list of object types. Valid types: ALL, "+joinTypes(types.ValidTypes()))
+	cmd.Flags().String("connection", "", "Connection name, or a prefix matching exactly one connection (optional). Defaults to the default connection")
+	cmd.Flags().Bool("strict-version", false, "Fail instead of warning when the server is older than PostgreSQL 11 or not PostgreSQL (e.g. Redshift, CockroachDB)")
+	cmd.Flags().String("schema", "public", "Comma-separated list of schema names or 'ALL' to select all schemas (optional). Defaults to the connection's default schema, or public")
+	cmd.Flags().String("schema-regex", "", "Select every schema whose name matches this regex, e.g. '^tenant_[0-9]+$', instead of --schema (optional)")
+	cmd.Flags().Bool("include-system-schemas", false, "Include system schemas such as pg_catalog and information_schema when --schema is ALL or --schema-regex is set")
+	cmd.Flags().String("exclude-schemas", "", "Comma-separated list of schema names to skip when --schema is ALL or --schema-regex is set (optional)")
+	cmd.Flags().Bool("include-system-functions", false, "Also select objects from pg_catalog, e.g. to read built-in function and view definitions (produces many files)")
+	cmd.Flags().Bool("with-dependents", false, "Also select the indexes, constraints and triggers of every selected table, whatever their names")
+	cmd.Flags().String("comment-tag", "", "Only select objects whose COMMENT contains this text, e.g. 'pgmeta:export' (optional)")
+	cmd.Flags().Bool("exclude-owned-by-extensions", false, "Skip objects created by an extension, such as PostGIS's spatial_ref_sys, which CREATE EXTENSION restores")
+	cmd.Flags().String("exclude-owned-by-extensions-except", "", "Comma-separated list of schema-qualified extension objects (schema.name) to export anyway; implies --exclude-owned-by-extensions (optional)")
+
+	if err := cmd.RegisterFlagCompletionFunc("connection", completeConnectionNames); err != nil {
+		log.Error("Failed to register completion for 'connection' flag: %v", err)
+	}
+	if err := cmd.RegisterFlagCompletionFunc("types", completeObjectTypes); err != nil {
+		log.Error("Failed to register completion for 'types' flag: %v", err)
+	}
+	cmd.MarkFlagsMutuallyExclusive("objects-from-file", "types")
+	cmd.MarkFlagsMutuallyExclusive("objects-from-file", "schema")
+	cmd.MarkFlagsMutuallyExclusive("objects-from-file", "schema-regex")
+	cmd.MarkFlagsMutuallyExclusive("schema", "schema-regex")
+	cmd.MarkFlagsMutuallyExclusive("names", "schema-regex")
+	cmd.MarkFlagsMutuallyExclusive("objects-from-file", "with-dependents")
+	cmd.MarkFlagsMutuallyExclusive("objects-from-file", "comment-tag")
+	cmd.MarkFlagsMutuallyExclusive("objects-from-file", "exclude-owned-by-extensions")
+	cmd.MarkFlagsMutuallyExclusive("objects-from-file", "exclude-owned-by-extensions-except")
+	if err := cmd.MarkFlagFilename("objects-from-file"); err != nil {
+		log.Error("Failed to mark 'objects-from-file' flag as a filename: %v", err)
+	}
+}
+
+// resolveConnection returns the named connection, matching a unique prefix of its name,
+// or the default connection if name is empty
+func resolveConnection(connName string) (*config.Connection, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to load config")
+	}
+
+	if connName != "" {
+		conn, err := cfg.FindConnection(connName)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug("Using specified connection: %s", conn.Name)
+		return conn, nil
+	}
+
+	conn := cfg.GetDefaultConnection()
+	if conn == nil {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "No connection specified and no default connection found")
+	}
+	log.Debug("Using default connection: %s", conn.Name)
+	return conn, nil
+}
+
+// addTimeoutFlags registers the flags bounding how long a command may keep the database busy
+func addTimeoutFlags(cmd *cobra.Command) {
+	cmd.Flags().Duration("timeout", 0, "Abort the whole operation after this long, e.g. 10m (0 for no limit)")
+	cmd.Flags().Duration("statement-timeout", 0, "Have the server cancel any single query running longer than this, e.g. 30s; the object is recorded as failed (0 for no limit)")
+	cmd.Flags().Duration("connect-timeout", db.DefaultConnectTimeout, "Give up connecting to the database after this long, e.g. 5s, instead of waiting out the OS TCP timeout on an unreachable host (0 for no limit)")
+}
+
+// openFetcher connects to conn with the command's timeouts and version check applied
+func openFetcher(cmd *cobra.Command, conn *config.Connection) (*metadata.Fetcher, error) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	statementTimeout, _ := cmd.Flags().GetDuration("statement-timeout")
+	connectTimeout, _ := cmd.Flags().GetDuration("connect-timeout")
+	if timeout < 0 || statementTimeout < 0 || connectTimeout < 0 {
+		return nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "--timeout, --statement-timeout and --connect-timeout cannot be negative")
+	}
+
+	strictVersion, _ := cmd.Flags().GetBool("strict-version")
+	fetcher, err := metadata.NewFetcher(conn.URL, db.Options{
+		StatementTimeout: statementTimeout,
+		ConnectTimeout:   connectTimeout,
+		StrictVersion:    strictVersion,
+		TLSFiles:         tlsFiles(cmd, conn),
+	})
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to initialize metadata fetcher")
+	}
+	fetcher.SetTimeout(timeout)
+	return fetcher, nil
+}
+
+// addTLSFlags registers the flags naming the certificate and key files of a TLS connection
+func addTLSFlags(cmd *cobra.Command) {
+	cmd.Flags().String("sslrootcert", "", "CA certificate file to verify the server's certificate against (optional)")
+	cmd.Flags().String("sslcert", "", "Client certificate file, for servers requiring mutual TLS (optional)")
+	cmd.Flags().String("sslkey", "", "Private key file of the client certificate; lib/pq requires it to be readable only by its owner (optional)")
+}
+
+// tlsFiles returns the TLS files to connect with: those given as flags, falling back to
+// those stored with the connection
+func tlsFiles(cmd *cobra.Command, conn *config.Connection) db.TLSFiles {
+	files := db.TLSFiles{RootCert: conn.SSLRootCert, Cert: conn.SSLCert, Key: conn.SSLKey}
+	for flag, field := range map[string]*string{"sslrootcert": &files.RootCert, "sslcert": &files.Cert, "sslkey": &files.Key} {
+		if path, _ := cmd.Flags().GetString(flag); path != "" {
+			*field = path
+		}
+	}
+	return files
+}
+
+// selectedSchemas returns the --schema value, falling back to the connection's default schema when the flag is omitted
+func selectedSchemas(cmd *cobra.Command, conn *config.Connection) string {
+	schemasList, _ := cmd.Flags().GetString("schema")
+	return conn.ResolveSchemas(schemasList, cmd.Flags().Changed("schema"))
+}
+
+// filterSchemas returns the schemas of all that match pattern, or all of them when pattern
+// is nil, leaving out those in the comma-separated excludeList
+func filterSchemas(all []string, pattern *regexp.Regexp, excludeList string) []string {
+	excluded := make(map[string]bool)
+	if excludeList != "" {
+		for _, s := range strings.Split(excludeList, ",") {
+			excluded[strings.TrimSpace(s)] = true
+		}
+	}
+	var schemas []string
+	for _, s := range all {
+		if excluded[s] {
+			log.Debug("Excluding schema: %s", s)
+			continue
+		}
+		if pattern != nil && !pattern.MatchString(s) {
+			continue
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas
+}
+
+// selectObjectsFromFile queries exactly the objects listed in an --objects-from-file list.
+// It also returns the listed entries that no object matched.
+func selectObjectsFromFile(path string, fetcher *metadata.Fetcher) ([]types.DBObject, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Failed to open object list: %s", path)
+	}
+	defer file.Close()
+
+	refs, err := types.ParseObjectList(file)
+	if err != nil {
+		return nil, nil, stacktrace.PropagateWithCode(err, config.ErrCodeConfig, "Invalid object list: %s", path)
+	}
+	if len(refs) == 0 {
+		return nil, nil, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Object list %s has no entries", path)
+	}
+	log.Debug("Using %d objects from %s", len(refs), path)
+
+	objects, err := fetcher.QueryObjects(types.QueryOptionsFor(refs))
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Failed to query objects")
+	}
+	objects = types.FilterRefs(refs, objects)
+	return objects, types.MissingRefs(refs, objects), nil
+}
+
+// selectObjects queries the objects chosen by the selection flags on conn.
+// It also returns the exact names requested with --names or --objects-from-file that no object matched.
+func selectObjects(cmd *cobra.Command, fetcher *metadata.Fetcher, conn *config.Connection) ([]types.DBObject, []string, error) {
+	if path, _ := cmd.Flags().GetString("objects-from-file"); path != "" {
+		return selectObjectsFromFile(path, fetcher)
+	}
+
+	opts, err := selectionOptions(cmd, fetcher, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	objects, err := fetcher.QueryObjects(opts)
+	if err != nil {
+		return nil, nil, stacktrace.Propagate(err, "Failed to query objects")
+	}
+	missing := types.MissingNames(opts.Names, objects)
+	if withDependents, _ := cmd.Flags().GetBool("with-dependents"); withDependents {
+		if objects, err = addDependents(fetcher, opts, objects); err != nil {
+			return nil, nil, err
+		}
+	}
+	return objects, missing, nil
+}
+
+// addDependents appends the indexes, constraints and triggers of the tables among objects.
+// They are queried by table rather than by name, so --query and --names only need to match the table.
+func addDependents(fetcher *metadata.Fetcher, opts types.QueryOptions, objects []types.DBObject) ([]types.DBObject, error) {
+	if !types.ContainsAny(opts.Types, types.TypeTable) {
+		return objects, nil
+	}
+
+	var schemas []string
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		if obj.Type == types.TypeTable && !seen[obj.Schema] {
+			seen[obj.Schema] = true
+			schemas = append(schemas, obj.Schema)
+		}
+	}
+	if len(schemas) == 0 {
+		return objects, nil
+	}
+
+	candidates, err := fetcher.QueryObjects(types.QueryOptions{
+		Types:     types.DependentTypes(),
+		Schemas:   schemas,
+		NameRegex: ".*",
+	})
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query table dependents")
+	}
+	dependents := types.DependentsOf(objects, candidates)
+	log.Debug("Adding %d indexes, constraints and triggers of the selected tables", len(dependents))
+	return append(objects, dependents...), nil
+}
+
+// selectionOptions turns the --query, --names, --types, --schema, --comment-tag and
+// --exclude-owned-by-extensions flags into query options, resolving --schema ALL to the
+// database's schemas
+func selectionOptions(cmd *cobra.Command, fetcher *metadata.Fetcher, conn *config.Connection) (types.QueryOptions, error) {
+
+	query, _ := cmd.Flags().GetString("query")
+	namesList, _ := cmd.Flags().GetString("names")
+	typesList, _ := cmd.Flags().GetString("types")
+	schemasList := selectedSchemas(cmd, conn)
+	includeSystemSchemas, _ := cmd.Flags().GetBool("include-system-schemas")
+	excludeSchemasList, _ := cmd.Flags().GetString("exclude-schemas")
+	schemaRegex, _ := cmd.Flags().GetString("schema-regex")
+	includeSystemFunctions, _ := cmd.Flags().GetBool("include-system-functions")
+	commentTag, _ := cmd.Flags().GetString("comment-tag")
+	excludeExtensionMembers, _ := cmd.Flags().GetBool("exclude-owned-by-extensions")
+	extensionExceptionsList, _ := cmd.Flags().GetString("exclude-owned-by-extensions-except")
+
+	var objectTypes []types.ObjectType
+	if typesList == "ALL" {
+		objectTypes = []types.ObjectType{} // Empty slice means all types in our implementation
+		log.Debug("Querying all object types")
+	} else {
+		// Parse comma-separated types
+		for _, t := range strings.Split(typesList, ",") {
+			objType := types.ObjectType(strings.TrimSpace(t))
+			if !metadata.IsValidType(objType) {
+				return types.QueryOptions{}, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid object type: %s. Valid types are: ALL, %s", t, joinTypes(types.ValidTypes()))
+			}
+			objectTypes = append(objectTypes, objType)
+		}
+		log.Debug("Querying specific object types: %v", objectTypes)
+	}
+
+	// Use a special regex that matches everything if query is "ALL"
+	nameRegex := query
+	if query == "ALL" {
+		nameRegex = ".*" // Regex that matches everything
+		log.Debug("Using wildcard regex pattern")
+	} else {
+		log.Debug("Using regex pattern: %s", nameRegex)
+	}
+
+	var names []string
+	if namesList != "" {
+		for _, n := range strings.Split(namesList, ",") {
+			n = strings.TrimSpace(n)
+			if schema, name, ok := strings.Cut(n, "."); !ok || schema == "" || name == "" {
+				return types.QueryOptions{}, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid object name: %s. Names must be schema-qualified (schema.name)", n)
+			}
+			names = append(names, n)
+		}
+		log.Debug("Using exact object names: %v", names)
+	}
+
+	var extensionExceptions []string
+	if extensionExceptionsList != "" {
+		excludeExtensionMembers = true
+		for _, n := range strings.Split(extensionExceptionsList, ",") {
+			n = strings.TrimSpace(n)
+			if schema, name, ok := strings.Cut(n, "."); !ok || schema == "" || name == "" {
+				return types.QueryOptions{}, stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Invalid object name in --exclude-owned-by-extensions-except: %s. Names must be schema-qualified (schema.name)", n)
+			}
+			extensionExceptions = append(extensionExceptions, n)
+		}
+	}
+
+	var schemas []string
+	// Explicit names determine the schemas to search
+	if len(names) > 0 {
+		seen := make(map[string]bool)
+		for _, n := range names {
+			schema, _, _ := strings.Cut(n, ".")
+			if !seen[schema] {
+				seen[schema] = true
+				schemas = append(schemas, schema)
+			}
+		}
+	} else if schemasList == "ALL" || schemaRegex != "" {
+		// Special handling for "ALL" and --schema-regex to fetch all schemas
+		var pattern *regexp.Regexp
+		if schemaRegex != "" {
+			var err error
+			if pattern, err = regexp.Compile(schemaRegex); err != nil {
+				return types.QueryOptions{}, stacktrace.PropagateWithCode(err, config.ErrCodeConfig, "Invalid --schema-regex: %s", schemaRegex)
+			}
+		}
+		allSchemas, err := fetcher.GetAllSchemas(includeSystemSchemas)
+		if err != nil {
+			return types.QueryOptions{}, stacktrace.Propagate(err, "Failed to fetch all schemas")
+		}
+		schemas = filterSchemas(allSchemas, pattern, excludeSchemasList)
+		if pattern == nil {
+			log.Info("Fetching objects from all schemas: %v", schemas)
+		} else if len(schemas) == 0 {
+			// No schemas would fall back to public
+			log.Warn("No schema matches --schema-regex %s", schemaRegex)
+			return types.QueryOptions{}, &exitCodeError{code: exitNoObjects}
+		} else {
+			log.Info("Fetching objects from the schemas matching %s: %v", schemaRegex, schemas)
+		}
+	} else {
+		// Parse comma-separated schemas
+		for _, s := range strings.Split(schemasList, ",") {
+			schemas = append(schemas, strings.TrimSpace(s))
+		}
+	}
+
+	if includeSystemFunctions && len(names) == 0 && !slices.Contains(schemas, "pg_catalog") {
+		schemas = append(schemas, "pg_catalog")
+	}
+
+	// System schemas are only ever queried when asked for, but they are large
+	for _, s := range schemas {
+		if db.IsSystemSchema(s) {
+			log.Warn("Selecting system schema %s; it holds thousands of built-in objects, narrow with --types or --query", s)
+		}
+	}
+
+	return types.QueryOptions{
+		Types:      objectTypes,
+		Schemas:    schemas,
+		NameRegex:  nameRegex,
+		Names:      names,
+		CommentTag: commentTag,
+
+		ExcludeExtensionMembers:   excludeExtensionMembers,
+		ExtensionMemberExceptions: extensionExceptions,
+	}, nil
+}
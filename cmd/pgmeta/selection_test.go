@@ -0,0 +1,47 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/config"
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+	"github.com/spf13/cobra"
+)
+
+func TestFilterSchemas(t *testing.T) {
+	discovered := []string{"app", "public", "tenant_1234", "tenant_42", "tenant_archive", "tenant_7"}
+
+	got := filterSchemas(discovered, regexp.MustCompile(`^tenant_[0-9]+$`), "")
+	if want := []string{"tenant_1234", "tenant_42", "tenant_7"}; !slices.Equal(got, want) {
+		t.Errorf("Expected the regex to select %v, got %v", want, got)
+	}
+
+	// --exclude-schemas still applies to the matching schemas
+	got = filterSchemas(discovered, regexp.MustCompile(`^tenant_[0-9]+$`), "tenant_42, tenant_7")
+	if want := []string{"tenant_1234"}; !slices.Equal(got, want) {
+		t.Errorf("Expected excluded schemas to be skipped, got %v", got)
+	}
+
+	// Without a regex, as with --schema ALL, every schema not excluded is kept
+	got = filterSchemas(discovered, nil, "public")
+	if want := []string{"app", "tenant_1234", "tenant_42", "tenant_archive", "tenant_7"}; !slices.Equal(got, want) {
+		t.Errorf("Expected every schema but public, got %v", got)
+	}
+}
+
+func TestTLSFiles(t *testing.T) {
+	cmd := &cobra.Command{}
+	addTLSFlags(cmd)
+	if err := cmd.Flags().Parse([]string{"--sslcert", "/tmp/override.crt"}); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	conn := &config.Connection{SSLRootCert: "/certs/root.crt", SSLCert: "/certs/client.crt"}
+
+	// A flag overrides the connection's file; the others are kept
+	want := db.TLSFiles{RootCert: "/certs/root.crt", Cert: "/tmp/override.crt"}
+	if got := tlsFiles(cmd, conn); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
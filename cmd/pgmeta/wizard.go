@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/config"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+	"golang.org/x/term"
+)
+
+// runConnectionWizard prompts for each connection parameter, verifies the
+// resulting connection by pinging the database, with tlsFiles, and returns the name and URL
+func runConnectionWizard(name string, tlsFiles db.TLSFiles) (string, string, error) {
+	reader := bufio.NewReader(os.Stdin)
+
+	var err error
+	if name == "" {
+		if name, err = prompt(reader, "Connection name", ""); err != nil {
+			return "", "", err
+		}
+		if name == "" {
+			return "", "", stacktrace.NewErrorWithCode(config.ErrCodeConfig, "Connection name cannot be empty")
+		}
+	}
+
+	var params config.ConnectionParams
+	if params.Host, err = prompt(reader, "Host", "localhost"); err != nil {
+		return "", "", err
+	}
+	if params.Port, err = prompt(reader, "Port", "5432"); err != nil {
+		return "", "", err
+	}
+	if params.Database, err = prompt(reader, "Database", "postgres"); err != nil {
+		return "", "", err
+	}
+	if params.User, err = prompt(reader, "User", "postgres"); err != nil {
+		return "", "", err
+	}
+	if params.Password, err = promptPassword("Password"); err != nil {
+		return "", "", err
+	}
+	if params.SSLMode, err = prompt(reader, "SSL mode", "disable"); err != nil {
+		return "", "", err
+	}
+
+	url := params.URL()
+
+	log.Debug("Validating connection to %s:%s/%s", params.Host, params.Port, params.Database)
+	connector, err := db.New(url, db.Options{ConnectTimeout: db.DefaultConnectTimeout, TLSFiles: tlsFiles})
+	if err != nil {
+		return "", "", stacktrace.Propagate(err, "Failed to validate connection %s", name)
+	}
+	if err := connector.Close(); err != nil {
+		log.Warn("Failed to close validation connection: %v", err)
+	}
+
+	return name, url, nil
+}
+
+// prompt asks for a single line of input, returning defaultValue when the answer is empty
+func prompt(reader *bufio.Reader, label, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Printf("%s [%s]: ", label, defaultValue)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", stacktrace.Propagate(err, "Failed to read %s", label)
+	}
+
+	value := strings.TrimSpace(line)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return value, nil
+}
+
+// promptPassword asks for a secret without echoing it to the terminal
+func promptPassword(label string) (string, error) {
+	fmt.Printf("%s: ", label)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", stacktrace.Propagate(err, "Failed to read %s", label)
+	}
+	return string(password), nil
+}
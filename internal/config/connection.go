@@ -6,6 +6,7 @@ import (
 	neturl "net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/lib/pq"
@@ -15,9 +16,161 @@ import (
 
 // Connection represents a database connection configuration
 type Connection struct {
-	Name      string `json:"name"`
-	URL       string `json:"url"`
-	IsDefault bool   `json:"is_default"`
+	Name          string `json:"name"`
+	URL           string `json:"url"`
+	IsDefault     bool   `json:"is_default"`
+	DefaultSchema string `json:"default_schema,omitempty"`
+	SSLRootCert   string `json:"sslrootcert,omitempty"` // CA certificate verifying the server
+	SSLCert       string `json:"sslcert,omitempty"`     // Client certificate
+	SSLKey        string `json:"sslkey,omitempty"`      // Private key of the client certificate
+}
+
+// ErrCodeConfig marks errors in the configuration or the command line, such as an unknown
+// connection, told apart with stacktrace.GetCode. It is well above the db package's codes.
+const ErrCodeConfig stacktrace.ErrorCode = 100
+
+// fallbackSchema is exported when neither --schema nor a connection default is given
+const fallbackSchema = "public"
+
+// ResolveSchemas returns the schema list to export: the --schema value when it was
+// given explicitly, otherwise the connection's default schema, otherwise public
+func (c Connection) ResolveSchemas(schemas string, explicit bool) string {
+	if explicit {
+		return schemas
+	}
+	if c.DefaultSchema != "" {
+		return c.DefaultSchema
+	}
+	return fallbackSchema
+}
+
+// secretMask replaces passwords when a connection is displayed
+const secretMask = "****"
+
+// MaskedURL returns the stored connection string with the password replaced by a mask.
+// Both key=value connection strings, with quoted values, and postgres:// URLs are supported,
+// whether a URL carries the password in its user info or as a query parameter.
+func (c Connection) MaskedURL() string {
+	if strings.HasPrefix(c.URL, "postgres://") || strings.HasPrefix(c.URL, "postgresql://") {
+		u, err := neturl.Parse(c.URL)
+		if err != nil {
+			// A URL that does not parse cannot be split into its parts, so none of it is shown
+			scheme, _, _ := strings.Cut(c.URL, "://")
+			return scheme + "://" + secretMask
+		}
+		masked := false
+		if u.User != nil {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				u.User = neturl.UserPassword(u.User.Username(), secretMask)
+				masked = true
+			}
+		}
+		// The password may also be given as a query parameter, as in ?password=secret
+		if u.RawQuery != "" {
+			fields := strings.Split(u.RawQuery, "&")
+			for i, field := range fields {
+				key, _, _ := strings.Cut(field, "=")
+				if name, err := neturl.QueryUnescape(key); err != nil || name == "password" {
+					fields[i] = key + "=" + secretMask
+					masked = true
+				}
+			}
+			u.RawQuery = strings.Join(fields, "&")
+		}
+		if !masked {
+			return c.URL
+		}
+		return strings.Replace(u.String(), neturl.QueryEscape(secretMask), secretMask, 1)
+	}
+
+	params, err := parseConnString(c.URL)
+	if err != nil {
+		// Whatever follows the password cannot be told apart from it, so none of it is shown
+		if i := strings.Index(c.URL, "password"); i >= 0 {
+			return c.URL[:i] + "password=" + secretMask
+		}
+		return c.URL
+	}
+	fields := make([]string, 0, len(params))
+	for _, p := range params {
+		if p.key == "password" {
+			fields = append(fields, p.key+"="+secretMask)
+		} else {
+			fields = append(fields, p.key+"="+quoteConnValue(p.value))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// Params returns the non-secret key=value parameters of the stored connection string
+func (c Connection) Params() map[string]string {
+	connStr := c.URL
+	if strings.HasPrefix(connStr, "postgres://") || strings.HasPrefix(connStr, "postgresql://") {
+		parsed, err := pq.ParseURL(connStr)
+		if err != nil {
+			return map[string]string{}
+		}
+		connStr = parsed
+	}
+
+	parsed, err := parseConnString(connStr)
+	if err != nil {
+		return map[string]string{}
+	}
+	params := make(map[string]string)
+	for _, p := range parsed {
+		if p.key != "password" {
+			params[p.key] = p.value
+		}
+	}
+	return params
+}
+
+// NormalizedURL returns the connection's non-secret parameters as a key=value string
+// sorted by key, so equivalent connection strings compare equal however they are written
+// or quoted
+func (c Connection) NormalizedURL() string {
+	params := c.Params()
+	fields := make([]string, 0, len(params))
+	for k, v := range params {
+		fields = append(fields, k+"="+quoteConnValue(v))
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, " ")
+}
+
+// ConnectionParams holds the structured pieces of a connection URL
+type ConnectionParams struct {
+	Host     string
+	Port     string
+	Database string
+	User     string
+	Password string
+	SSLMode  string
+}
+
+// URL assembles the parameters into a postgres:// connection URL,
+// escaping credentials so special characters survive parsing
+func (p ConnectionParams) URL() string {
+	u := &neturl.URL{
+		Scheme: "postgres",
+		Host:   p.Host,
+		Path:   "/" + p.Database,
+	}
+	if p.Port != "" {
+		u.Host = p.Host + ":" + p.Port
+	}
+	if p.User != "" {
+		if p.Password != "" {
+			u.User = neturl.UserPassword(p.User, p.Password)
+		} else {
+			u.User = neturl.User(p.User)
+		}
+	}
+	if p.SSLMode != "" {
+		u.RawQuery = neturl.Values{"sslmode": []string{p.SSLMode}}.Encode()
+	}
+	return u.String()
 }
 
 // Config manages connection configurations
@@ -26,14 +179,45 @@ type Config struct {
 	configPath  string
 }
 
-// LoadConfig loads the configuration from disk
-func LoadConfig() (*Config, error) {
+// configDir returns the directory holding config.json
+func configDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to get home directory")
+		return "", stacktrace.Propagate(err, "Failed to get home directory")
 	}
+	return filepath.Join(homeDir, ".pgmeta"), nil
+}
+
+// ReadConfig loads the configuration without creating the config directory or logging, for
+// callers such as shell completion whose output must stay clean. A missing config file is an
+// empty configuration.
+func ReadConfig() (*Config, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	configPath := filepath.Join(dir, "config.json")
+	cfg := &Config{configPath: configPath}
 
-	configDir := filepath.Join(homeDir, ".pgmeta")
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read config file at %s", configPath)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, stacktrace.PropagateWithCode(err, ErrCodeConfig, "Failed to parse config file: %v", err)
+	}
+	return cfg, nil
+}
+
+// LoadConfig loads the configuration from disk
+func LoadConfig() (*Config, error) {
+	configDir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		return nil, stacktrace.Propagate(err, "Failed to create config directory at %s", configDir)
 	}
@@ -53,7 +237,7 @@ func LoadConfig() (*Config, error) {
 	}
 
 	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to parse config file: %v", err)
+		return nil, stacktrace.PropagateWithCode(err, ErrCodeConfig, "Failed to parse config file: %v", err)
 	}
 
 	log.Debug("Loaded %d connections from config", len(cfg.Connections))
@@ -79,12 +263,12 @@ func (c *Config) Save() error {
 func (c *Config) AddConnection(name, url string, makeDefault bool) error {
 	// Validate name
 	if name == "" {
-		return stacktrace.NewError("Connection name cannot be empty")
+		return stacktrace.NewErrorWithCode(ErrCodeConfig, "Connection name cannot be empty")
 	}
 
 	// Check for duplicate names
 	if c.GetConnection(name) != nil {
-		return stacktrace.NewError("Connection with name '%s' already exists", name)
+		return stacktrace.NewErrorWithCode(ErrCodeConfig, "Connection with name '%s' already exists", name)
 	}
 
 	// Normalize protocol
@@ -111,17 +295,19 @@ func (c *Config) AddConnection(name, url string, makeDefault bool) error {
 		// Convert to connection string
 		connStr, err := pq.ParseURL(url)
 		if err != nil {
-			return stacktrace.Propagate(err, "Invalid connection URL: %s", url)
+			return stacktrace.PropagateWithCode(err, ErrCodeConfig, "Invalid connection URL: %s", url)
 		}
 		url = connStr
 	}
 
 	// Ensure required parameters
+	parsed, err := parseConnString(url)
+	if err != nil {
+		return stacktrace.Propagate(err, "Invalid connection string")
+	}
 	params := make(map[string]string)
-	for _, param := range strings.Split(url, " ") {
-		if parts := strings.Split(param, "="); len(parts) == 2 {
-			params[parts[0]] = parts[1]
-		}
+	for _, p := range parsed {
+		params[p.key] = p.value
 	}
 
 	// Force IPv4
@@ -143,10 +329,18 @@ func (c *Config) AddConnection(name, url string, makeDefault bool) error {
 		if k != "password" {
 			log.Debug("Connection parameter %s=%s", k, v)
 		}
-		connParams = append(connParams, fmt.Sprintf("%s=%s", k, v))
+		connParams = append(connParams, fmt.Sprintf("%s=%s", k, quoteConnValue(v)))
 	}
 	url = strings.Join(connParams, " ")
 
+	// The same database under two names is allowed, but usually a mistake
+	added := Connection{Name: name, URL: url}
+	for _, existing := range c.Connections {
+		if existing.NormalizedURL() == added.NormalizedURL() {
+			log.Warn("Connection '%s' points at the same database as '%s'", name, existing.Name)
+		}
+	}
+
 	// If this is the first connection, make it default
 	if len(c.Connections) == 0 {
 		makeDefault = true
@@ -160,11 +354,8 @@ func (c *Config) AddConnection(name, url string, makeDefault bool) error {
 		}
 	}
 
-	c.Connections = append(c.Connections, Connection{
-		Name:      name,
-		URL:       url,
-		IsDefault: makeDefault,
-	})
+	added.IsDefault = makeDefault
+	c.Connections = append(c.Connections, added)
 
 	log.Info("Added connection '%s'%s", name, map[bool]string{true: " (default)", false: ""}[makeDefault])
 	return c.Save()
@@ -206,7 +397,7 @@ func (c *Config) DeleteConnection(name string) error {
 			return c.Save()
 		}
 	}
-	return stacktrace.NewError("Connection not found: %s", name)
+	return stacktrace.NewErrorWithCode(ErrCodeConfig, "Connection not found: %s", name)
 }
 
 // SetDefaultConnection sets a connection as the default
@@ -223,12 +414,76 @@ func (c *Config) SetDefaultConnection(name string) error {
 	}
 
 	if !found {
-		return stacktrace.NewError("Connection not found: %s", name)
+		return stacktrace.NewErrorWithCode(ErrCodeConfig, "Connection not found: %s", name)
+	}
+
+	return c.Save()
+}
+
+// SetConnectionDefaultSchema sets the schema exported from a connection when --schema is omitted.
+// An empty schema restores the public default.
+func (c *Config) SetConnectionDefaultSchema(name, schema string) error {
+	for i := range c.Connections {
+		if c.Connections[i].Name == name {
+			c.Connections[i].DefaultSchema = strings.TrimSpace(schema)
+			log.Info("Set default schema of '%s' to '%s'", name, c.Connections[i].ResolveSchemas("", false))
+			return c.Save()
+		}
 	}
+	return stacktrace.NewErrorWithCode(ErrCodeConfig, "Connection not found: %s", name)
+}
 
+// SetConnectionTLS sets the certificate and key files used to connect with TLS, stored as
+// absolute paths so the connection works from any directory. Empty paths are left unset.
+func (c *Config) SetConnectionTLS(name, rootCert, cert, key string) error {
+	var conn *Connection
+	for i := range c.Connections {
+		if c.Connections[i].Name == name {
+			conn = &c.Connections[i]
+		}
+	}
+	if conn == nil {
+		return stacktrace.NewErrorWithCode(ErrCodeConfig, "Connection not found: %s", name)
+	}
+	for _, f := range []struct {
+		path  string
+		field *string
+	}{{rootCert, &conn.SSLRootCert}, {cert, &conn.SSLCert}, {key, &conn.SSLKey}} {
+		if f.path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(f.path)
+		if err != nil {
+			return stacktrace.PropagateWithCode(err, ErrCodeConfig, "Invalid path: %s", f.path)
+		}
+		*f.field = abs
+	}
+	log.Info("Set the TLS files of '%s'", name)
 	return c.Save()
 }
 
+// DuplicateConnections groups connections whose normalized URLs match, keeping only groups
+// of two or more. Groups and the connections within them keep their configured order.
+func (c *Config) DuplicateConnections() [][]Connection {
+	var order []string
+	groups := make(map[string][]Connection)
+	for _, conn := range c.Connections {
+		key := conn.NormalizedURL()
+		if _, seen := groups[key]; !seen {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], conn)
+	}
+
+	var duplicates [][]Connection
+	for _, key := range order {
+		if len(groups[key]) > 1 {
+			duplicates = append(duplicates, groups[key])
+		}
+	}
+	return duplicates
+}
+
 // GetConnection retrieves a connection by name
 func (c *Config) GetConnection(name string) *Connection {
 	for _, conn := range c.Connections {
@@ -238,3 +493,31 @@ func (c *Config) GetConnection(name string) *Connection {
 	}
 	return nil
 }
+
+// FindConnection retrieves a connection by name, or by a prefix of its name when no name
+// matches exactly and exactly one connection starts with it. An ambiguous prefix is an
+// error listing the candidates.
+func (c *Config) FindConnection(name string) (*Connection, error) {
+	if conn := c.GetConnection(name); conn != nil {
+		return conn, nil
+	}
+
+	var candidates []string
+	var match *Connection
+	for i, conn := range c.Connections {
+		if strings.HasPrefix(conn.Name, name) {
+			candidates = append(candidates, conn.Name)
+			match = &c.Connections[i]
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, stacktrace.NewErrorWithCode(ErrCodeConfig, "Connection not found: %s", name)
+	case 1:
+		log.Debug("Connection %s matched by prefix %s", match.Name, name)
+		return match, nil
+	default:
+		sort.Strings(candidates)
+		return nil, stacktrace.NewErrorWithCode(ErrCodeConfig, "Connection name %s is ambiguous; it matches %s", name, strings.Join(candidates, ", "))
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/palantir/stacktrace"
+)
+
+// connParam is one key=value setting of a connection string
+type connParam struct {
+	key   string
+	value string
+}
+
+// parseConnString splits a key=value connection string into its settings, in order, with
+// libpq's quoting rules: spaces may surround the =, a value in single quotes may hold
+// spaces, and a backslash takes the next character literally.
+func parseConnString(connStr string) ([]connParam, error) {
+	var params []connParam
+	s := []rune(connStr)
+	i := 0
+	skipSpaces := func() {
+		for i < len(s) && unicode.IsSpace(s[i]) {
+			i++
+		}
+	}
+	for {
+		skipSpaces()
+		if i == len(s) {
+			return params, nil
+		}
+
+		start := i
+		for i < len(s) && s[i] != '=' && !unicode.IsSpace(s[i]) {
+			i++
+		}
+		key := string(s[start:i])
+		skipSpaces()
+		if key == "" || i == len(s) || s[i] != '=' {
+			return nil, stacktrace.NewErrorWithCode(ErrCodeConfig, "Missing = after %q in connection string", key)
+		}
+		i++
+		skipSpaces()
+
+		var value strings.Builder
+		if i < len(s) && s[i] == '\'' {
+			i++
+			for {
+				if i == len(s) {
+					return nil, stacktrace.NewErrorWithCode(ErrCodeConfig, "Unterminated quoted value of %s in connection string", key)
+				}
+				if s[i] == '\'' {
+					i++
+					break
+				}
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteRune(s[i])
+				i++
+			}
+		} else {
+			for i < len(s) && !unicode.IsSpace(s[i]) {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteRune(s[i])
+				i++
+			}
+		}
+		params = append(params, connParam{key: key, value: value.String()})
+	}
+}
+
+// quoteConnValue quotes a connection string value when it is empty or holds a space, quote
+// or backslash, so parseConnString reads it back unchanged
+func quoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -79,6 +79,16 @@ func EnableDebugMode() {
 	}
 }
 
+// RedirectToStderr sends debug, info and warning messages to stderr so stdout
+// can carry program output such as a streamed export
+func RedirectToStderr() {
+	if stdLogger, ok := defaultLogger.(*StandardLogger); ok {
+		stdLogger.debugLogger.SetOutput(os.Stderr)
+		stdLogger.infoLogger.SetOutput(os.Stderr)
+		stdLogger.warnLogger.SetOutput(os.Stderr)
+	}
+}
+
 // Debug logs a debug message using the default logger
 func Debug(format string, args ...interface{}) {
 	defaultLogger.Debug(format, args...)
@@ -151,6 +151,24 @@ func TestEnableDebugMode(t *testing.T) {
 	}
 }
 
+func TestRedirectToStderr(t *testing.T) {
+	logger := NewStandardLogger(true)
+	SetDefaultLogger(logger)
+
+	RedirectToStderr()
+
+	for name, l := range map[string]*log.Logger{
+		"debug": logger.debugLogger,
+		"info":  logger.infoLogger,
+		"warn":  logger.warnLogger,
+		"error": logger.errorLogger,
+	} {
+		if l.Writer() != os.Stderr {
+			t.Errorf("Expected %s logger to write to stderr", name)
+		}
+	}
+}
+
 // mockLogger implements the Logger interface for testing
 type mockLogger struct {
 	debugCalled bool
@@ -0,0 +1,342 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// commentKey identifies a commented catalog entry. Constraints, triggers, policies and rules
+// are only unique per table, so their table is part of the key; database-level entries have
+// no schema.
+type commentKey struct {
+	kind   string
+	schema string
+	table  string
+	name   string
+}
+
+// buildCommentTagQuery creates the SQL query for every object in the given schemas, and every
+// language, publication and subscription, whose comment contains the tag in $2. Comments live
+// in pg_description, except those on subscriptions, which are shared across databases.
+func buildCommentTagQuery() string {
+	return strings.TrimSpace(`
+		SELECT 'relation', n.nspname, '', c.relname
+		FROM pg_description d
+		JOIN pg_class c ON d.classoid = 'pg_class'::regclass AND d.objoid = c.oid AND d.objsubid = 0
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = ANY($1) AND strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'routine', n.nspname, '', p.proname
+		FROM pg_description d
+		JOIN pg_proc p ON d.classoid = 'pg_proc'::regclass AND d.objoid = p.oid
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = ANY($1) AND strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'constraint', n.nspname, COALESCE(t.relname, ''), con.conname
+		FROM pg_description d
+		JOIN pg_constraint con ON d.classoid = 'pg_constraint'::regclass AND d.objoid = con.oid
+		JOIN pg_namespace n ON n.oid = con.connamespace
+		LEFT JOIN pg_class t ON t.oid = con.conrelid
+		WHERE n.nspname = ANY($1) AND strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'trigger', n.nspname, t.relname, tg.tgname
+		FROM pg_description d
+		JOIN pg_trigger tg ON d.classoid = 'pg_trigger'::regclass AND d.objoid = tg.oid
+		JOIN pg_class t ON t.oid = tg.tgrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = ANY($1) AND strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'policy', n.nspname, t.relname, pol.polname
+		FROM pg_description d
+		JOIN pg_policy pol ON d.classoid = 'pg_policy'::regclass AND d.objoid = pol.oid
+		JOIN pg_class t ON t.oid = pol.polrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = ANY($1) AND strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'rule', n.nspname, t.relname, r.rulename
+		FROM pg_description d
+		JOIN pg_rewrite r ON d.classoid = 'pg_rewrite'::regclass AND d.objoid = r.oid
+		JOIN pg_class t ON t.oid = r.ev_class
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = ANY($1) AND strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'statistics', n.nspname, '', s.stxname
+		FROM pg_description d
+		JOIN pg_statistic_ext s ON d.classoid = 'pg_statistic_ext'::regclass AND d.objoid = s.oid
+		JOIN pg_namespace n ON n.oid = s.stxnamespace
+		WHERE n.nspname = ANY($1) AND strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'extension', n.nspname, '', e.extname
+		FROM pg_description d
+		JOIN pg_extension e ON d.classoid = 'pg_extension'::regclass AND d.objoid = e.oid
+		JOIN pg_namespace n ON n.oid = e.extnamespace
+		WHERE n.nspname = ANY($1) AND strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'language', '', '', l.lanname
+		FROM pg_description d
+		JOIN pg_language l ON d.classoid = 'pg_language'::regclass AND d.objoid = l.oid
+		WHERE strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'publication', '', '', p.pubname
+		FROM pg_description d
+		JOIN pg_publication p ON d.classoid = 'pg_publication'::regclass AND d.objoid = p.oid
+		WHERE strpos(d.description, $2) > 0
+		UNION ALL
+		SELECT 'subscription', '', '', s.subname
+		FROM pg_shdescription d
+		JOIN pg_subscription s ON d.classoid = 'pg_subscription'::regclass AND d.objoid = s.oid
+		WHERE strpos(d.description, $2) > 0
+	`)
+}
+
+// commentLookupKey returns the comment tag query entry that carries obj's comment
+func commentLookupKey(obj types.DBObject) commentKey {
+	switch obj.Type {
+	case types.TypeTable, types.TypeView, types.TypeMaterializedView, types.TypeSequence, types.TypeIndex:
+		return commentKey{kind: "relation", schema: obj.Schema, name: obj.Name}
+	case types.TypeFunction, types.TypeProcedure, types.TypeAggregate, types.TypeWindowFunction:
+		return commentKey{kind: "routine", schema: obj.Schema, name: obj.Name}
+	case types.TypeConstraint, types.TypeTrigger, types.TypePolicy, types.TypeRule:
+		return commentKey{kind: string(obj.Type), schema: obj.Schema, table: obj.TableName, name: obj.Name}
+	case types.TypeLanguage, types.TypePublication, types.TypeSubscription:
+		return commentKey{kind: string(obj.Type), name: obj.Name}
+	}
+	return commentKey{kind: string(obj.Type), schema: obj.Schema, name: obj.Name}
+}
+
+// filterByCommentTag keeps the objects whose comment contains tag, looked up for all of
+// them with a single catalog query
+func (c *Connector) filterByCommentTag(ctx context.Context, objects []types.DBObject, schemas []string, tag string) ([]types.DBObject, error) {
+	rows, err := c.db.QueryContext(ctx, buildCommentTagQuery(), pq.Array(schemas), tag)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query comments tagged %q", tag)
+	}
+	defer rows.Close()
+
+	tagged := make(map[commentKey]bool)
+	for rows.Next() {
+		var key commentKey
+		if err := rows.Scan(&key.kind, &key.schema, &key.table, &key.name); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan tagged comment row")
+		}
+		tagged[key] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read comments tagged %q", tag)
+	}
+
+	kept := make([]types.DBObject, 0, len(objects))
+	for _, obj := range objects {
+		if tagged[commentLookupKey(obj)] {
+			kept = append(kept, obj)
+		}
+	}
+	log.Debug("%d of %d objects have a comment tagged %q", len(kept), len(objects), tag)
+	return kept, nil
+}
+
+// buildDatabaseCommentsQuery creates the SQL query for the comment on the current database,
+// which is shared across databases and so lives in pg_shdescription, and the comments on
+// the given schemas
+func buildDatabaseCommentsQuery() string {
+	return strings.TrimSpace(`
+		SELECT 'database', db.datname, d.description
+		FROM pg_database db
+		JOIN pg_shdescription d ON d.classoid = 'pg_database'::regclass AND d.objoid = db.oid
+		WHERE db.datname = current_database()
+		UNION ALL
+		SELECT 'schema', n.nspname, d.description
+		FROM pg_namespace n
+		JOIN pg_description d ON d.classoid = 'pg_namespace'::regclass AND d.objoid = n.oid AND d.objsubid = 0
+		WHERE n.nspname = ANY($1)
+	`)
+}
+
+// FetchDatabaseComments returns the COMMENT ON DATABASE statement restoring the current
+// database's comment, empty when it has none, and the COMMENT ON SCHEMA statement of each
+// of schemas that has a comment
+func (c *Connector) FetchDatabaseComments(ctx context.Context, schemas []string) (string, map[string]string, error) {
+	rows, err := c.db.QueryContext(ctx, buildDatabaseCommentsQuery(), pq.Array(schemas))
+	if err != nil {
+		return "", nil, stacktrace.Propagate(err, "Failed to query database and schema comments")
+	}
+	defer rows.Close()
+
+	var database string
+	schemaComments := make(map[string]string)
+	for rows.Next() {
+		var kind, name, comment string
+		if err := rows.Scan(&kind, &name, &comment); err != nil {
+			return "", nil, stacktrace.Propagate(err, "Failed to scan comment row")
+		}
+		statement := fmt.Sprintf("COMMENT ON %s %s IS %s;\n", strings.ToUpper(kind), quoteIdent(name), quoteLiteral(comment))
+		if kind == "database" {
+			database = statement
+		} else {
+			schemaComments[name] = statement
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, stacktrace.Propagate(err, "Failed to read database and schema comments")
+	}
+	return database, schemaComments, nil
+}
+
+// buildObjectCommentsQuery creates the SQL query for the comments on every object in the
+// given schemas, and every language, publication and subscription. Each row names the
+// object like the comment tag query does, followed by the keyword COMMENT ON uses for it,
+// a detail completing its reference (a column's name, a routine's arguments), a position
+// ordering a relation's comment before its columns', and the comment itself.
+func buildObjectCommentsQuery() string {
+	return strings.TrimSpace(`
+		SELECT 'relation', n.nspname, '', c.relname,
+			CASE c.relkind
+				WHEN 'v' THEN 'VIEW'
+				WHEN 'm' THEN 'MATERIALIZED VIEW'
+				WHEN 'S' THEN 'SEQUENCE'
+				WHEN 'i' THEN 'INDEX'
+				WHEN 'I' THEN 'INDEX'
+				WHEN 'f' THEN 'FOREIGN TABLE'
+				ELSE 'TABLE'
+			END,
+			COALESCE(a.attname, ''), d.objsubid, d.description
+		FROM pg_description d
+		JOIN pg_class c ON d.classoid = 'pg_class'::regclass AND d.objoid = c.oid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attribute a ON d.objsubid > 0 AND a.attrelid = c.oid AND a.attnum = d.objsubid
+		WHERE n.nspname = ANY($1) AND c.relkind IN ('r', 'p', 'v', 'm', 'S', 'i', 'I', 'f')
+		UNION ALL
+		SELECT 'routine', n.nspname, '', p.proname,
+			CASE p.prokind WHEN 'p' THEN 'PROCEDURE' WHEN 'a' THEN 'AGGREGATE' ELSE 'FUNCTION' END,
+			pg_get_function_identity_arguments(p.oid), 0, d.description
+		FROM pg_description d
+		JOIN pg_proc p ON d.classoid = 'pg_proc'::regclass AND d.objoid = p.oid
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'constraint', n.nspname, t.relname, con.conname, 'CONSTRAINT', '', 0, d.description
+		FROM pg_description d
+		JOIN pg_constraint con ON d.classoid = 'pg_constraint'::regclass AND d.objoid = con.oid
+		JOIN pg_namespace n ON n.oid = con.connamespace
+		JOIN pg_class t ON t.oid = con.conrelid
+		WHERE n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'trigger', n.nspname, t.relname, tg.tgname, 'TRIGGER', '', 0, d.description
+		FROM pg_description d
+		JOIN pg_trigger tg ON d.classoid = 'pg_trigger'::regclass AND d.objoid = tg.oid
+		JOIN pg_class t ON t.oid = tg.tgrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'policy', n.nspname, t.relname, pol.polname, 'POLICY', '', 0, d.description
+		FROM pg_description d
+		JOIN pg_policy pol ON d.classoid = 'pg_policy'::regclass AND d.objoid = pol.oid
+		JOIN pg_class t ON t.oid = pol.polrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'rule', n.nspname, t.relname, r.rulename, 'RULE', '', 0, d.description
+		FROM pg_description d
+		JOIN pg_rewrite r ON d.classoid = 'pg_rewrite'::regclass AND d.objoid = r.oid
+		JOIN pg_class t ON t.oid = r.ev_class
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'statistics', n.nspname, '', s.stxname, 'STATISTICS', '', 0, d.description
+		FROM pg_description d
+		JOIN pg_statistic_ext s ON d.classoid = 'pg_statistic_ext'::regclass AND d.objoid = s.oid
+		JOIN pg_namespace n ON n.oid = s.stxnamespace
+		WHERE n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'extension', n.nspname, '', e.extname, 'EXTENSION', '', 0, d.description
+		FROM pg_description d
+		JOIN pg_extension e ON d.classoid = 'pg_extension'::regclass AND d.objoid = e.oid
+		JOIN pg_namespace n ON n.oid = e.extnamespace
+		WHERE n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'language', '', '', l.lanname, 'LANGUAGE', '', 0, d.description
+		FROM pg_description d
+		JOIN pg_language l ON d.classoid = 'pg_language'::regclass AND d.objoid = l.oid
+		UNION ALL
+		SELECT 'publication', '', '', p.pubname, 'PUBLICATION', '', 0, d.description
+		FROM pg_description d
+		JOIN pg_publication p ON d.classoid = 'pg_publication'::regclass AND d.objoid = p.oid
+		UNION ALL
+		SELECT 'subscription', '', '', s.subname, 'SUBSCRIPTION', '', 0, d.description
+		FROM pg_shdescription d
+		JOIN pg_subscription s ON d.classoid = 'pg_subscription'::regclass AND d.objoid = s.oid
+		ORDER BY 1, 2, 3, 4, 7, 6
+	`)
+}
+
+// commentStatement renders the COMMENT ON statement restoring comment on the object
+// identified by key, keyword and detail, as returned by the object comments query
+func commentStatement(key commentKey, keyword, detail, comment string) string {
+	var target string
+	switch key.kind {
+	case "relation":
+		target = keyword + " " + quoteIdent(key.schema) + "." + quoteIdent(key.name)
+		if detail != "" {
+			target = "COLUMN " + quoteIdent(key.schema) + "." + quoteIdent(key.name) + "." + quoteIdent(detail)
+		}
+	case "routine":
+		target = keyword + " " + quoteIdent(key.schema) + "." + quoteIdent(key.name) + "(" + detail + ")"
+	case "constraint", "trigger", "policy", "rule":
+		target = keyword + " " + quoteIdent(key.name) + " ON " + quoteIdent(key.schema) + "." + quoteIdent(key.table)
+	case "statistics":
+		target = keyword + " " + quoteIdent(key.schema) + "." + quoteIdent(key.name)
+	default:
+		target = keyword + " " + quoteIdent(key.name)
+	}
+	return fmt.Sprintf("COMMENT ON %s IS %s;\n", target, quoteLiteral(comment))
+}
+
+// FetchObjectComments returns, for each of objects, the COMMENT ON statements restoring
+// its comment and, for a relation, the comments on its columns. An object without a
+// comment gets an empty string. All comments are read with a single catalog query.
+func (c *Connector) FetchObjectComments(ctx context.Context, objects []types.DBObject) ([]string, error) {
+	var schemas []string
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		switch obj.Type {
+		case types.TypeLanguage, types.TypePublication, types.TypeSubscription:
+			continue
+		}
+		if !seen[obj.Schema] {
+			seen[obj.Schema] = true
+			schemas = append(schemas, obj.Schema)
+		}
+	}
+
+	rows, err := c.db.QueryContext(ctx, buildObjectCommentsQuery(), pq.Array(schemas))
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query object comments")
+	}
+	defer rows.Close()
+
+	statements := make(map[commentKey]string)
+	for rows.Next() {
+		var key commentKey
+		var keyword, detail, comment string
+		var position int
+		if err := rows.Scan(&key.kind, &key.schema, &key.table, &key.name, &keyword, &detail, &position, &comment); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan object comment row")
+		}
+		statements[key] += commentStatement(key, keyword, detail, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read object comments")
+	}
+
+	comments := make([]string, len(objects))
+	for i, obj := range objects {
+		comments[i] = statements[commentLookupKey(obj)]
+	}
+	return comments, nil
+}
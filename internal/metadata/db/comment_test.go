@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestFilterByCommentTag(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildCommentTagQuery(): {rows: [][]driver.Value{
+			{"relation", "public", "", "users"},
+			{"routine", "public", "", "tag"},
+			{"constraint", "public", "orders", "orders_total_check"},
+			{"publication", "", "", "changes"},
+		}},
+	})
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeTable, Schema: "public", Name: "audit_log"},
+		{Type: types.TypeFunction, Schema: "public", Name: "tag"},
+		{Type: types.TypeConstraint, Schema: "public", Name: "orders_total_check", TableName: "orders"},
+		// Constraint names are only unique per table, so the same name on another table is untagged
+		{Type: types.TypeConstraint, Schema: "public", Name: "orders_total_check", TableName: "orders_archive"},
+		{Type: types.TypePublication, Schema: "postgres", Name: "changes"},
+	}
+
+	kept, err := connector.filterByCommentTag(context.Background(), objects, []string{"public"}, "pgmeta:export")
+	if err != nil {
+		t.Fatalf("filterByCommentTag failed: %v", err)
+	}
+
+	want := []types.DBObject{objects[0], objects[2], objects[3], objects[5]}
+	if len(kept) != len(want) {
+		t.Fatalf("Expected %d tagged objects, got %v", len(want), kept)
+	}
+	for i := range want {
+		if kept[i] != want[i] {
+			t.Errorf("Expected %+v at %d, got %+v", want[i], i, kept[i])
+		}
+	}
+}
+
+func TestFetchDatabaseComments(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildDatabaseCommentsQuery(): {rows: [][]driver.Value{
+			{"database", "Shop", "Orders and billing. Owner: data team"},
+			{"schema", "public", "Customer-facing tables"},
+			{"schema", "billing", "Owned by finance's team"},
+		}},
+	})
+
+	database, schemas, err := connector.FetchDatabaseComments(context.Background(), []string{"public", "billing", "audit"})
+	if err != nil {
+		t.Fatalf("FetchDatabaseComments failed: %v", err)
+	}
+	if expected := `COMMENT ON DATABASE "Shop" IS 'Orders and billing. Owner: data team';` + "\n"; database != expected {
+		t.Errorf("Expected database comment %q, got %q", expected, database)
+	}
+	expected := map[string]string{
+		"public":  "COMMENT ON SCHEMA public IS 'Customer-facing tables';\n",
+		"billing": "COMMENT ON SCHEMA billing IS 'Owned by finance''s team';\n",
+	}
+	if len(schemas) != len(expected) {
+		t.Fatalf("Expected comments on %d schemas, got %v", len(expected), schemas)
+	}
+	for schema, comment := range expected {
+		if schemas[schema] != comment {
+			t.Errorf("Expected %s comment %q, got %q", schema, comment, schemas[schema])
+		}
+	}
+}
+
+func TestFetchObjectComments(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildObjectCommentsQuery(): {rows: [][]driver.Value{
+			{"constraint", "public", "orders", "orders_total_check", "CONSTRAINT", "", int64(0), "Totals can't be negative"},
+			{"relation", "public", "", "Users", "TABLE", "", int64(0), "Registered users"},
+			{"relation", "public", "", "Users", "TABLE", "email", int64(2), "Login address"},
+			{"routine", "public", "", "tag", "FUNCTION", "name text", int64(0), "Tags a row"},
+			{"publication", "", "", "changes", "PUBLICATION", "", int64(0), "Replicated tables"},
+		}},
+	})
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "Users"},
+		{Type: types.TypeTable, Schema: "public", Name: "audit_log"},
+		{Type: types.TypeFunction, Schema: "public", Name: "tag"},
+		{Type: types.TypeConstraint, Schema: "public", Name: "orders_total_check", TableName: "orders"},
+		{Type: types.TypePublication, Schema: "postgres", Name: "changes"},
+	}
+
+	comments, err := connector.FetchObjectComments(context.Background(), objects)
+	if err != nil {
+		t.Fatalf("FetchObjectComments failed: %v", err)
+	}
+	want := []string{
+		`COMMENT ON TABLE public."Users" IS 'Registered users';` + "\n" +
+			`COMMENT ON COLUMN public."Users".email IS 'Login address';` + "\n",
+		"",
+		"COMMENT ON FUNCTION public.tag(name text) IS 'Tags a row';\n",
+		"COMMENT ON CONSTRAINT orders_total_check ON public.orders IS 'Totals can''t be negative';\n",
+		"COMMENT ON PUBLICATION changes IS 'Replicated tables';\n",
+	}
+	if len(comments) != len(want) {
+		t.Fatalf("Expected %d comments, got %v", len(want), comments)
+	}
+	for i := range want {
+		if comments[i] != want[i] {
+			t.Errorf("Expected comments of %s %q, got %q", objects[i].Name, want[i], comments[i])
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestFetchConcurrentlyAfterDeadline(t *testing.T) {
+	counter := newScriptedDriver(nil)
+	connector := counter.connector(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	objects := []types.DBObject{
+		{Type: types.TypeView, Schema: "public", Name: "a"},
+		{Type: types.TypeView, Schema: "public", Name: "b"},
+	}
+	_, failed, err := connector.FetchObjectsDefinitionsConcurrently(ctx, objects, 2)
+	if err == nil {
+		t.Error("Expected an expired context to fail the whole fetch")
+	}
+	if len(failed) != len(objects) {
+		t.Errorf("Expected every object to be recorded as failed, got %v", failed)
+	}
+	if got := counter.queryCount(); got != 0 {
+		t.Errorf("Expected no queries after the context expired, got %d", got)
+	}
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+)
+
+// connectionShare is the fraction of the server's free connection slots a fetch may use,
+// leaving the rest to other clients of a shared database
+const connectionShare = 0.5
+
+// buildConnectionUsageQuery creates the SQL query for max_connections, the slots reserved
+// for superusers and the number of connections currently open
+func buildConnectionUsageQuery() string {
+	return strings.TrimSpace(`
+		SELECT
+			current_setting('max_connections')::int,
+			current_setting('superuser_reserved_connections')::int,
+			(SELECT count(*) FROM pg_stat_activity)
+	`)
+}
+
+// safeConcurrency returns the largest fetch concurrency that stays within connectionShare
+// of the free connection slots, and never less than 1
+func safeConcurrency(maxConnections, reserved, inUse int) int {
+	free := maxConnections - reserved - inUse
+	return max(int(float64(free)*connectionShare), 1)
+}
+
+// ClampConcurrency lowers requested to what the server's free connection slots can safely
+// absorb, with a warning. If the connection usage cannot be read, requested is returned unchanged.
+func (c *Connector) ClampConcurrency(ctx context.Context, requested int) int {
+	var maxConnections, reserved, inUse int
+	err := c.db.QueryRowContext(ctx, buildConnectionUsageQuery()).Scan(&maxConnections, &reserved, &inUse)
+	if err != nil {
+		log.Warn("Could not read the server's connection usage, keeping a concurrency of %d: %v", requested, err)
+		return requested
+	}
+
+	limit := safeConcurrency(maxConnections, reserved, inUse)
+	if requested <= limit {
+		return requested
+	}
+	log.Warn("Concurrency %d is more than the server can spare (max_connections %d, %d in use); using %d instead. Pass --force-concurrency to keep %d",
+		requested, maxConnections, inUse, limit, requested)
+	return limit
+}
+
+// WarmUpPool opens concurrency connections at once and pings each, holding every one until
+// all have answered, so a server or firewall that cannot take the concurrency a fetch will
+// use is reported before any object is fetched. Beyond the pool's own limit fetches wait for
+// a free connection, so only that many are opened.
+func (c *Connector) WarmUpPool(ctx context.Context, concurrency int) error {
+	target := concurrency
+	if limit := c.db.Stats().MaxOpenConnections; limit > 0 && target > limit {
+		log.Warn("Concurrency %d is more than the %d connections of the pool; the other fetches wait for a free connection", concurrency, limit)
+		target = limit
+	}
+
+	conns := make([]*sql.Conn, target)
+	errs := make([]error, target)
+	var wg sync.WaitGroup
+	for i := range target {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := c.db.Conn(ctx)
+			if err == nil {
+				conns[i] = conn
+				err = conn.PingContext(ctx)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	opened := 0
+	var firstErr error
+	for i, conn := range conns {
+		if conn != nil {
+			conn.Close()
+		}
+		if errs[i] == nil {
+			opened++
+		} else if firstErr == nil {
+			firstErr = errs[i]
+		}
+	}
+	if firstErr != nil {
+		return stacktrace.Propagate(firstErr, "Only %d of %d connections could be opened; lower the concurrency or check the server's max_connections", opened, target)
+	}
+	log.Debug("Warmed up %d connections", target)
+	return nil
+}
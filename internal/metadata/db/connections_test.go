@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSafeConcurrency(t *testing.T) {
+	tests := []struct {
+		name                            string
+		maxConnections, reserved, inUse int
+		expected                        int
+	}{
+		{"idle server", 100, 3, 1, 48},
+		{"busy server", 100, 3, 90, 3},
+		{"full server", 100, 3, 97, 1},
+		{"over subscribed", 20, 3, 40, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := safeConcurrency(tt.maxConnections, tt.reserved, tt.inUse); got != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClampConcurrency(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildConnectionUsageQuery(): {row: []driver.Value{int64(100), int64(3), int64(57)}},
+	})
+
+	if got := connector.ClampConcurrency(context.Background(), 100); got != 20 {
+		t.Errorf("Expected a concurrency of 100 to be clamped to 20, got %d", got)
+	}
+	if got := connector.ClampConcurrency(context.Background(), 10); got != 10 {
+		t.Errorf("Expected a concurrency within the limit to be kept, got %d", got)
+	}
+}
+
+func TestClampConcurrencyUnknownUsage(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildConnectionUsageQuery(): {err: errors.New("permission denied")},
+	})
+	if got := connector.ClampConcurrency(context.Background(), 100); got != 100 {
+		t.Errorf("Expected the requested concurrency when usage is unknown, got %d", got)
+	}
+}
+
+// newLimitedConnector returns a connector whose pool can open only limit connections
+func newLimitedConnector(t *testing.T, limit int) *Connector {
+	t.Helper()
+	d := newScriptedDriver(nil)
+	d.connLimit = limit
+	return d.connector(t)
+}
+
+func TestWarmUpPool(t *testing.T) {
+	t.Run("limit reached", func(t *testing.T) {
+		err := newLimitedConnector(t, 3).WarmUpPool(context.Background(), 5)
+		if err == nil || !strings.Contains(err.Error(), "Only 3 of 5 connections") {
+			t.Fatalf("Expected the warmup to report 3 of 5 connections, got %v", err)
+		}
+	})
+	t.Run("enough connections", func(t *testing.T) {
+		if err := newLimitedConnector(t, 5).WarmUpPool(context.Background(), 5); err != nil {
+			t.Errorf("Expected a pool that can reach the concurrency to warm up, got %v", err)
+		}
+	})
+}
+
+func TestWarmUpPoolCappedByPoolSize(t *testing.T) {
+	// Fetches beyond the pool's limit wait for a connection instead of opening one
+	connector := newLimitedConnector(t, 4)
+	connector.db.SetMaxOpenConns(4)
+	if err := connector.WarmUpPool(context.Background(), 10); err != nil {
+		t.Errorf("Expected the warmup to stop at the pool size, got %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/palantir/stacktrace"
@@ -14,28 +15,80 @@ import (
 	"github.com/skamensky/pgmeta/internal/metadata/types"
 )
 
+// DefaultMaxDefinitionSize is the default cap on a single object definition in bytes
+const DefaultMaxDefinitionSize = 10 * 1024 * 1024
+
+// DefaultFetchConcurrency is the default number of definitions fetched at once. Each
+// concurrent fetch holds a database connection, so this is kept well below max_connections.
+const DefaultFetchConcurrency = 10
+
+// DefaultConnectTimeout bounds how long connecting to an unreachable server may take
+const DefaultConnectTimeout = 10 * time.Second
+
 // Connector handles database connections
 type Connector struct {
 	db *sql.DB
+
+	maxDefinitionSize int  // Definitions larger than this many bytes are rejected or truncated; 0 disables the check
+	truncateOversized bool // Truncate oversized definitions with a warning instead of failing the object
+
+	sequenceCurrentValue bool // Append a setval to sequence definitions so they resume at their current value
+
+	identitySequences bool // List sequences owned by identity columns as standalone sequences
+
+	definitionSource string // Where table and view definitions are read from; see DefinitionSources
+
+	objectTimeout time.Duration // Limit on fetching a single definition; 0 for none
+
+	normalizeDefaults bool // Drop redundant casts from column defaults in table definitions
+
+	serverVersionNum int // server_version_num, read when connecting; 0 if unknown
+
+	failuresMu sync.Mutex
+	failures   map[types.ObjectKey]FailureKind // Why each failed definition could not be fetched
+
+	timingsMu sync.Mutex
+	profiling bool           // Time each definition fetched concurrently
+	timings   []ObjectTiming // How long each definition took to fetch while profiling
 }
 
-// New creates a new database connector
-func New(dbURL string) (*Connector, error) {
+// Options configures how New connects to the database
+type Options struct {
+	// StatementTimeout, when positive, is set as the statement_timeout of every session,
+	// so the server aborts any single query that runs longer
+	StatementTimeout time.Duration
+	// ConnectTimeout, when positive, bounds each connection attempt and the initial ping, so
+	// an unreachable host fails fast instead of waiting out the operating system's TCP timeout
+	ConnectTimeout time.Duration
+	// StrictVersion makes an unsupported server version an error instead of a warning
+	StrictVersion bool
+	// TLSFiles are added to the connection string once they are found readable
+	TLSFiles TLSFiles
+}
+
+// New creates a new database connector configured by opts
+func New(dbURL string, opts Options) (*Connector, error) {
 	// Use lib/pq's built-in URL parser
 	connStr := dbURL
 	if matched, _ := regexp.MatchString(`^postgres(ql)?://`, dbURL); matched {
 		log.Debug("Converting URL to connection string: %s", dbURL)
 		parsedURL, err := pq.ParseURL(dbURL)
 		if err != nil {
-			return nil, stacktrace.Propagate(err, "Failed to parse database URL: %s", dbURL)
+			return nil, connectionError(err, "", "Failed to parse database URL: %s", dbURL)
 		}
 		connStr = parsedURL
 	}
+	connStr = withStatementTimeout(connStr, opts.StatementTimeout)
+	connStr = withConnectTimeout(connStr, opts.ConnectTimeout)
+	connStr, err := withTLSFiles(connStr, opts.TLSFiles)
+	if err != nil {
+		return nil, err
+	}
 
 	// Open database connection
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to open database connection with connection string")
+		return nil, connectionError(err, "", "Failed to open database connection with connection string")
 	}
 
 	// Set reasonable defaults
@@ -43,13 +96,78 @@ func New(dbURL string) (*Connector, error) {
 	db.SetMaxIdleConns(5)
 
 	// Try to ping the database
-	if err := db.Ping(); err != nil {
+	pingCtx := context.Background()
+	if opts.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		pingCtx, cancel = context.WithTimeout(pingCtx, opts.ConnectTimeout)
+		defer cancel()
+	}
+	if err := db.PingContext(pingCtx); err != nil {
 		db.Close()
-		return nil, stacktrace.Propagate(err, "Failed to connect to database")
+		if pingCtx.Err() == context.DeadlineExceeded {
+			msg := fmt.Sprintf("Timed out connecting to the database after %s; check the host and port, or raise --connect-timeout", opts.ConnectTimeout)
+			return nil, connectionError(err, msg, "Failed to connect to database")
+		}
+		return nil, connectionError(err, "", "Failed to connect to database")
 	}
 
 	log.Info("Successfully connected to database")
-	return &Connector{db: db}, nil
+	connector := &Connector{db: db, maxDefinitionSize: DefaultMaxDefinitionSize, definitionSource: DefinitionSourcePgCatalog}
+	if err := connector.checkServerVersion(context.Background(), opts.StrictVersion); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return connector, nil
+}
+
+// withStatementTimeout adds statement_timeout to a key/value connection string. lib/pq
+// sends unrecognized keys as run-time parameters when each connection starts, so unlike
+// a SET it applies to every connection in the pool.
+func withStatementTimeout(connStr string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return connStr
+	}
+	// statement_timeout is in milliseconds; round up so a sub-millisecond timeout isn't 0 (disabled)
+	ms := (timeout + time.Millisecond - 1) / time.Millisecond
+	return strings.TrimSpace(connStr + fmt.Sprintf(" statement_timeout=%d", ms))
+}
+
+// withConnectTimeout adds connect_timeout to a key/value connection string, bounding how
+// long lib/pq waits for each new connection of the pool
+func withConnectTimeout(connStr string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return connStr
+	}
+	// connect_timeout is in whole seconds; round up so a sub-second timeout isn't 0 (no limit)
+	seconds := (timeout + time.Second - 1) / time.Second
+	return strings.TrimSpace(connStr + fmt.Sprintf(" connect_timeout=%d", seconds))
+}
+
+// SetMaxDefinitionSize caps the size of fetched definitions. Oversized definitions are
+// truncated with a warning if truncate is true, otherwise the fetch fails. A limit of 0 disables the check.
+func (c *Connector) SetMaxDefinitionSize(limit int, truncate bool) {
+	c.maxDefinitionSize = limit
+	c.truncateOversized = truncate
+}
+
+// SetSequenceCurrentValue makes sequence definitions end with a setval call restoring
+// each sequence's current value, producing a snapshot of the database's state
+func (c *Connector) SetSequenceCurrentValue(enabled bool) {
+	c.sequenceCurrentValue = enabled
+}
+
+// SetIdentitySequences controls whether sequences backing identity columns are listed as
+// standalone sequences. They are left out by default: the column's GENERATED ... AS IDENTITY
+// clause recreates them, so a separate CREATE SEQUENCE would be redundant.
+func (c *Connector) SetIdentitySequences(enabled bool) {
+	c.identitySequences = enabled
+}
+
+// SetObjectTimeout limits how long FetchObjectsDefinitionsConcurrently spends on any one
+// object. An object that takes longer is abandoned and reported as failed while the others
+// carry on. A timeout of 0 means no limit.
+func (c *Connector) SetObjectTimeout(timeout time.Duration) {
+	c.objectTimeout = timeout
 }
 
 // Close closes the database connection
@@ -63,6 +181,11 @@ func (c *Connector) Close() error {
 
 // QueryObjects retrieves database objects matching the query options
 func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) ([]types.DBObject, error) {
+	// A known set of objects is resolved directly instead of listing whole schemas
+	if len(opts.OIDs) > 0 {
+		return c.queryObjectsByOID(ctx, opts.OIDs)
+	}
+
 	// Ensure we have at least one schema to work with
 	if len(opts.Schemas) == 0 {
 		opts.Schemas = []string{"public"}
@@ -73,17 +196,17 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		return nil, stacktrace.Propagate(err, "Invalid regex pattern: %s", opts.NameRegex)
 	}
 
+	filter := newNameFilter(pattern, opts.Names)
+
 	var objects []types.DBObject
 
-	// First let's verify all schemas exist
-	for _, schema := range opts.Schemas {
-		exists, err := c.schemaExists(ctx, schema)
-		if err != nil {
-			return nil, stacktrace.Propagate(err, "Failed to check if schema exists: %s", schema)
-		}
-		if !exists {
-			return nil, stacktrace.NewError("Schema does not exist: %s", schema)
-		}
+	// First let's verify all schemas exist with a single round trip
+	existing, err := c.existingSchemas(ctx, opts.Schemas)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to check if schemas exist: %v", opts.Schemas)
+	}
+	if missing := missingSchemas(opts.Schemas, existing); len(missing) > 0 {
+		return nil, stacktrace.Propagate(&SchemaNotFoundError{Schemas: missing}, "Failed to query objects")
 	}
 
 	// Loop through each schema and collect objects
@@ -93,7 +216,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query tables and views
 		if types.ContainsAny(opts.Types, types.TypeTable, types.TypeView) {
 			log.Debug("Querying tables and views in schema %s", schema)
-			tables, err := c.queryTablesAndViews(ctx, schema, pattern)
+			tables, err := c.queryTablesAndViews(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -103,7 +226,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query functions
 		if types.ContainsAny(opts.Types, types.TypeFunction) {
 			log.Debug("Querying functions in schema %s", schema)
-			functions, err := c.queryFunctions(ctx, schema, pattern)
+			functions, err := c.queryFunctions(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -113,7 +236,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query triggers
 		if types.ContainsAny(opts.Types, types.TypeTrigger) {
 			log.Debug("Querying triggers in schema %s", schema)
-			triggers, err := c.queryTriggers(ctx, schema, pattern)
+			triggers, err := c.queryTriggers(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -123,7 +246,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query indexes
 		if types.ContainsAny(opts.Types, types.TypeIndex) {
 			log.Debug("Querying indexes in schema %s", schema)
-			indexes, err := c.queryIndexes(ctx, schema, pattern)
+			indexes, err := c.queryIndexes(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -133,7 +256,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query constraints
 		if types.ContainsAny(opts.Types, types.TypeConstraint) {
 			log.Debug("Querying constraints in schema %s", schema)
-			constraints, err := c.queryConstraints(ctx, schema, pattern)
+			constraints, err := c.queryConstraints(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -143,7 +266,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query sequences
 		if types.ContainsAny(opts.Types, types.TypeSequence) {
 			log.Debug("Querying sequences in schema %s", schema)
-			sequences, err := c.querySequences(ctx, schema, pattern)
+			sequences, err := c.querySequences(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -153,7 +276,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query materialized views
 		if types.ContainsAny(opts.Types, types.TypeMaterializedView) {
 			log.Debug("Querying materialized views in schema %s", schema)
-			matViews, err := c.queryMaterializedViews(ctx, schema, pattern)
+			matViews, err := c.queryMaterializedViews(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -163,17 +286,27 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query policies
 		if types.ContainsAny(opts.Types, types.TypePolicy) {
 			log.Debug("Querying policies in schema %s", schema)
-			policies, err := c.queryPolicies(ctx, schema, pattern)
+			policies, err := c.queryPolicies(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
 			objects = append(objects, policies...)
 		}
 
+		// Query extended statistics
+		if types.ContainsAny(opts.Types, types.TypeStatistics) {
+			log.Debug("Querying extended statistics in schema %s", schema)
+			statistics, err := c.queryStatistics(ctx, schema, filter)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, statistics...)
+		}
+
 		// Query extensions
 		if types.ContainsAny(opts.Types, types.TypeExtension) {
 			log.Debug("Querying extensions in schema %s", schema)
-			extensions, err := c.queryExtensions(ctx, schema, pattern)
+			extensions, err := c.queryExtensions(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -183,7 +316,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query procedures
 		if types.ContainsAny(opts.Types, types.TypeProcedure) {
 			log.Debug("Querying procedures in schema %s", schema)
-			procedures, err := c.queryProcedures(ctx, schema, pattern)
+			procedures, err := c.queryProcedures(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -193,7 +326,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query rules
 		if types.ContainsAny(opts.Types, types.TypeRule) {
 			log.Debug("Querying rules in schema %s", schema)
-			rules, err := c.queryRules(ctx, schema, pattern)
+			rules, err := c.queryRules(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
@@ -203,12 +336,22 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 		// Query aggregates
 		if types.ContainsAny(opts.Types, types.TypeAggregate) {
 			log.Debug("Querying aggregates in schema %s", schema)
-			aggregates, err := c.queryAggregates(ctx, schema, pattern)
+			aggregates, err := c.queryAggregates(ctx, schema, filter)
 			if err != nil {
 				return nil, err
 			}
 			objects = append(objects, aggregates...)
 		}
+
+		// Query window functions
+		if types.ContainsAny(opts.Types, types.TypeWindowFunction) {
+			log.Debug("Querying window functions in schema %s", schema)
+			windowFunctions, err := c.queryWindowFunctions(ctx, schema, filter)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, windowFunctions...)
+		}
 	}
 
 	// Query database-level objects (outside of schema loop)
@@ -217,7 +360,7 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 	// Query publications
 	if types.ContainsAny(opts.Types, types.TypePublication) {
 		log.Debug("Querying publications")
-		publications, err := c.queryPublications(ctx, pattern)
+		publications, err := c.queryPublications(ctx, filter)
 		if err != nil {
 			return nil, err
 		}
@@ -227,29 +370,61 @@ func (c *Connector) QueryObjects(ctx context.Context, opts types.QueryOptions) (
 	// Query subscriptions
 	if types.ContainsAny(opts.Types, types.TypeSubscription) {
 		log.Debug("Querying subscriptions")
-		subscriptions, err := c.querySubscriptions(ctx, pattern)
+		subscriptions, err := c.querySubscriptions(ctx, filter)
 		if err != nil {
 			return nil, err
 		}
 		objects = append(objects, subscriptions...)
 	}
 
+	// Query procedural languages
+	if types.ContainsAny(opts.Types, types.TypeLanguage) {
+		log.Debug("Querying languages")
+		languages, err := c.queryLanguages(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, languages...)
+	}
+
+	if opts.ExcludeExtensionMembers {
+		objects, err = c.excludeExtensionMembers(ctx, objects, opts.Schemas, opts.ExtensionMemberExceptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.CommentTag != "" {
+		objects, err = c.filterByCommentTag(ctx, objects, opts.Schemas, opts.CommentTag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	log.Info("Found %d database objects matching criteria", len(objects))
 	return objects, nil
 }
 
-// queryTablesAndViews queries tables and views from the database
-func (c *Connector) queryTablesAndViews(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
-	query := `
+// buildTablesAndViewsQuery returns the query listing the tables and views of a schema.
+// Temporary tables only exist for the session that created them, so they are never listed.
+func buildTablesAndViewsQuery() string {
+	return strings.TrimSpace(`
 		SELECT 
-			CASE WHEN table_type = 'BASE TABLE' THEN 'table' ELSE 'view' END as type,
-			table_schema,
-			table_name
-		FROM information_schema.tables 
-		WHERE table_schema = ($1)::text
-		AND table_type IN ('BASE TABLE', 'VIEW')
-	`
-	rows, err := c.db.QueryContext(ctx, query, schema)
+			CASE WHEN t.table_type = 'BASE TABLE' THEN 'table' ELSE 'view' END as type,
+			t.table_schema,
+			t.table_name
+		FROM information_schema.tables t
+		JOIN pg_namespace n ON n.nspname = t.table_schema
+		JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = t.table_name
+		WHERE t.table_schema = ($1)::text
+		AND t.table_type IN ('BASE TABLE', 'VIEW')
+		AND c.relpersistence <> 't'
+	`)
+}
+
+// queryTablesAndViews queries tables and views from the database
+func (c *Connector) queryTablesAndViews(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
+	rows, err := c.db.QueryContext(ctx, buildTablesAndViewsQuery(), schema)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Failed to query tables and views in schema: %s", schema)
 	}
@@ -263,7 +438,7 @@ func (c *Connector) queryTablesAndViews(ctx context.Context, schema string, patt
 			return nil, stacktrace.Propagate(err, "Failed to scan table/view row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
@@ -271,7 +446,7 @@ func (c *Connector) queryTablesAndViews(ctx context.Context, schema string, patt
 }
 
 // queryFunctions queries functions from the database
-func (c *Connector) queryFunctions(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) queryFunctions(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'function' as type,
@@ -296,7 +471,7 @@ func (c *Connector) queryFunctions(ctx context.Context, schema string, pattern *
 			return nil, stacktrace.Propagate(err, "Failed to scan function row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
@@ -304,7 +479,7 @@ func (c *Connector) queryFunctions(ctx context.Context, schema string, pattern *
 }
 
 // queryAggregates queries aggregates from the database
-func (c *Connector) queryAggregates(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) queryAggregates(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'aggregate' as type,
@@ -329,15 +504,53 @@ func (c *Connector) queryAggregates(ctx context.Context, schema string, pattern
 			return nil, stacktrace.Propagate(err, "Failed to scan aggregate row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// queryWindowFunctions queries window functions from the database
+func (c *Connector) queryWindowFunctions(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
+	rows, err := c.db.QueryContext(ctx, buildWindowFunctionsQuery(), schema)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query window functions in schema: %s", schema)
+	}
+	defer rows.Close()
+
+	var objects []types.DBObject
+	for rows.Next() {
+		var obj types.DBObject
+		var typeStr string
+		if err := rows.Scan(&typeStr, &obj.Schema, &obj.Name); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan window function row")
+		}
+		obj.Type = types.ObjectType(typeStr)
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
 	return objects, nil
 }
 
+// buildWindowFunctionsQuery creates the SQL query listing window functions.
+// Window functions have prokind = 'w' and are neither normal functions nor aggregates.
+func buildWindowFunctionsQuery() string {
+	return strings.TrimSpace(`
+		SELECT 
+			'window_function' as type,
+			n.nspname as schema,
+			p.proname as name
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = ($1)::text
+		AND p.prokind = 'w'
+	`)
+}
+
 // queryTriggers queries triggers from the database
-func (c *Connector) queryTriggers(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) queryTriggers(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'trigger' as type,
@@ -364,7 +577,7 @@ func (c *Connector) queryTriggers(ctx context.Context, schema string, pattern *r
 			return nil, stacktrace.Propagate(err, "Failed to scan trigger row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
@@ -372,21 +585,8 @@ func (c *Connector) queryTriggers(ctx context.Context, schema string, pattern *r
 }
 
 // queryIndexes queries indexes from the database
-func (c *Connector) queryIndexes(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
-	query := `
-		SELECT 
-			'index' as type,
-			n.nspname as schema,
-			c.relname as name,
-			t.relname as table_name
-		FROM pg_index i
-		JOIN pg_class c ON c.oid = i.indexrelid
-		JOIN pg_class t ON t.oid = i.indrelid
-		JOIN pg_namespace n ON n.oid = c.relnamespace
-		WHERE n.nspname = ($1)::text
-		AND t.relkind = 'r'
-	`
-	rows, err := c.db.QueryContext(ctx, query, schema)
+func (c *Connector) queryIndexes(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
+	rows, err := c.db.QueryContext(ctx, buildIndexesQuery(), schema)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Failed to query indexes in schema: %s", schema)
 	}
@@ -400,29 +600,44 @@ func (c *Connector) queryIndexes(ctx context.Context, schema string, pattern *re
 			return nil, stacktrace.Propagate(err, "Failed to scan index row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
 	return objects, nil
 }
 
-// queryConstraints queries constraints from the database
-func (c *Connector) queryConstraints(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
-	query := `
+// buildIndexesQuery creates the SQL query listing indexes with the table each belongs to.
+// Indexes on partitioned tables are listed under the partitioned table. The partition
+// indexes PostgreSQL creates for them are skipped, because recreating the parent index
+// recreates them; indexes created on a single partition are listed under that partition.
+// Indexes backing a constraint are skipped too, since the table definition declares it.
+func buildIndexesQuery() string {
+	return strings.TrimSpace(`
 		SELECT 
-			'constraint' as type,
+			'index' as type,
 			n.nspname as schema,
-			c.conname as name,
-			rel.relname as table_name,
-			pg_get_constraintdef(c.oid) as definition
-		FROM pg_constraint c
-		JOIN pg_class rel ON rel.oid = c.conrelid
-		JOIN pg_namespace n ON n.oid = rel.relnamespace
+			c.relname as name,
+			t.relname as table_name
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
 		WHERE n.nspname = ($1)::text
-		AND c.contype IN ('p', 'f', 'u', 'c')  -- primary, foreign, unique, check
-	`
-	rows, err := c.db.QueryContext(ctx, query, schema)
+		AND t.relkind IN ('r', 'p')
+		AND NOT EXISTS (SELECT 1 FROM pg_inherits inh WHERE inh.inhrelid = i.indexrelid)
+		-- Primary key, unique and exclusion constraints create their index themselves. A foreign
+		-- key's conindid is the referenced table's index, which is left alone.
+		AND NOT EXISTS (
+			SELECT 1 FROM pg_constraint con
+			WHERE con.conindid = i.indexrelid AND con.contype IN ('p', 'u', 'x')
+		)
+	`)
+}
+
+// queryConstraints queries constraints from the database
+func (c *Connector) queryConstraints(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
+	rows, err := c.db.QueryContext(ctx, buildConstraintsQuery(), schema)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Failed to query constraints in schema: %s", schema)
 	}
@@ -436,13 +651,37 @@ func (c *Connector) queryConstraints(ctx context.Context, schema string, pattern
 			return nil, stacktrace.Propagate(err, "Failed to scan constraint row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
 	return objects, nil
 }
 
+// buildConstraintsQuery creates the SQL query listing table constraints.
+// pg_get_constraintdef renders exclusion constraints in full, including the
+// index method (e.g. USING gist) and each element's WITH operator, and keeps
+// DEFERRABLE/INITIALLY DEFERRED and NOT VALID attributes. Only constraints declared
+// on the table itself are listed: the copies an inheritance child or a partition gets
+// from its parent (conislocal false, coninhcount > 0) are exported once, with the parent.
+// A CHECK constraint the parent keeps to itself is rendered with NO INHERIT.
+func buildConstraintsQuery() string {
+	return strings.TrimSpace(`
+		SELECT 
+			'constraint' as type,
+			n.nspname as schema,
+			c.conname as name,
+			rel.relname as table_name,
+			pg_get_constraintdef(c.oid, true) as definition
+		FROM pg_constraint c
+		JOIN pg_class rel ON rel.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = rel.relnamespace
+		WHERE n.nspname = ($1)::text
+		AND c.contype IN ('p', 'f', 'u', 'c', 'x')  -- primary, foreign, unique, check, exclusion
+		AND c.conislocal
+	`)
+}
+
 // FetchObjectDefinition fetches the SQL definition for a database object
 func (c *Connector) FetchObjectDefinition(ctx context.Context, obj *types.DBObject) error {
 	// If we already have the definition (like for constraints), return early
@@ -450,50 +689,27 @@ func (c *Connector) FetchObjectDefinition(ctx context.Context, obj *types.DBObje
 		return nil
 	}
 
+	if err := c.fetchObjectDefinition(ctx, obj); err != nil {
+		return definitionError(obj, err)
+	}
+	return nil
+}
+
+// fetchObjectDefinition queries the catalog for an object's definition
+func (c *Connector) fetchObjectDefinition(ctx context.Context, obj *types.DBObject) error {
 	log.Debug("Fetching definition for %s %s.%s", obj.Type, obj.Schema, obj.Name)
 	var query string
 	var args []interface{}
 
 	switch obj.Type {
 	case types.TypeTable:
-		query = buildTableDefinitionQuery()
-		args = []interface{}{obj.Schema, obj.Name}
+		return c.fetchTableDefinition(ctx, obj)
 	case types.TypeView:
-		query = `
-			SELECT COALESCE(
-				-- Try information_schema.views first
-				(SELECT 'CREATE OR REPLACE VIEW ' || quote_ident($1) || '.' || quote_ident($2) || ' AS' || E'\n' ||
-					view_definition
-				FROM information_schema.views
-				WHERE table_schema = $1 AND table_name = $2),
-				-- Fall back to pg_get_viewdef for system/extension views
-				(SELECT 'CREATE OR REPLACE VIEW ' || quote_ident($1) || '.' || quote_ident($2) || ' AS' || E'\n' ||
-					pg_get_viewdef(quote_ident($1) || '.' || quote_ident($2), true)
-				FROM pg_class c
-				JOIN pg_namespace n ON n.oid = c.relnamespace
-				WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind = 'v')
-			);
-		`
-		args = []interface{}{obj.Schema, obj.Name}
+		return c.fetchViewDefinition(ctx, obj)
 	case types.TypeFunction:
-		query = `
-			SELECT pg_get_functiondef(p.oid)
-			FROM pg_proc p
-			JOIN pg_namespace n ON n.oid = p.pronamespace
-			WHERE n.nspname = $1 AND p.proname = $2;
-		`
-		args = []interface{}{obj.Schema, obj.Name}
+		return c.fetchFunctionDefinition(ctx, obj)
 	case types.TypeTrigger:
-		query = `
-			SELECT pg_get_triggerdef(t.oid)
-			FROM pg_trigger t
-			JOIN pg_class c ON t.tgrelid = c.oid
-			JOIN pg_namespace n ON c.relnamespace = n.oid
-			WHERE n.nspname = $1 
-			AND t.tgname = $2
-			AND NOT t.tgisinternal;
-		`
-		args = []interface{}{obj.Schema, obj.Name}
+		return c.fetchTriggerDefinition(ctx, obj)
 	case types.TypeIndex:
 		query = `
 			SELECT pg_get_indexdef(i.indexrelid)
@@ -504,69 +720,12 @@ func (c *Connector) FetchObjectDefinition(ctx context.Context, obj *types.DBObje
 		`
 		args = []interface{}{obj.Schema, obj.Name}
 	case types.TypeSequence:
-		query = `
-			SELECT 
-				'CREATE SEQUENCE ' || quote_ident($1) || '.' || quote_ident($2) || E'\n' ||
-				CASE WHEN s.increment::bigint <> 1 THEN '    INCREMENT BY ' || s.increment || E'\n' ELSE '' END ||
-				'    START WITH ' || s.start_value || E'\n' ||
-				'    MINVALUE ' || s.minimum_value || E'\n' ||
-				'    MAXVALUE ' || s.maximum_value || E'\n' ||
-				CASE WHEN NOT s.cycle_option='YES' THEN '    NO' ELSE '' END || ' CYCLE;'
-			FROM information_schema.sequences s
-			WHERE s.sequence_schema = $1 AND s.sequence_name = $2;
-		`
-		args = []interface{}{obj.Schema, obj.Name}
+		return c.fetchSequenceDefinition(ctx, obj)
 	case types.TypeMaterializedView:
-		query = `
-			SELECT 'CREATE MATERIALIZED VIEW ' || quote_ident($1) || '.' || quote_ident($2) || ' AS' || E'\n' || 
-				pg_get_viewdef(c.oid, true)
-			FROM pg_class c
-			JOIN pg_namespace n ON n.oid = c.relnamespace
-			WHERE c.relkind = 'm'
-			AND n.nspname = $1 AND c.relname = $2;
-		`
-		args = []interface{}{obj.Schema, obj.Name}
+		return c.fetchMaterializedViewDefinition(ctx, obj)
 	case types.TypePolicy:
-		query = `
-			WITH policy_info AS (
-				SELECT 
-					pol.polname AS name,
-					c.relname AS table_name,
-					n.nspname AS schema_name,
-					CASE pol.polcmd
-						WHEN 'r' THEN 'SELECT'
-						WHEN 'a' THEN 'INSERT'
-						WHEN 'w' THEN 'UPDATE'
-						WHEN 'd' THEN 'DELETE'
-						WHEN '*' THEN 'ALL'
-					END AS command,
-					pg_get_expr(pol.polqual, pol.polrelid) AS using_expr,
-					pg_get_expr(pol.polwithcheck, pol.polrelid) AS check_expr,
-					ARRAY(
-						SELECT pg_get_userbyid(member)
-						FROM unnest(pol.polroles) AS member
-					) AS roles
-				FROM pg_policy pol
-				JOIN pg_class c ON pol.polrelid = c.oid
-				JOIN pg_namespace n ON c.relnamespace = n.oid
-				WHERE n.nspname = $1 AND pol.polname = $2
-			)
-			SELECT 
-				'CREATE POLICY ' || quote_ident(name) || ' ON ' || 
-				quote_ident(schema_name) || '.' || quote_ident(table_name) || 
-				' FOR ' || command || 
-				' TO ' || (
-					CASE 
-						WHEN array_position(roles, 'public') IS NOT NULL THEN 'PUBLIC'
-						ELSE array_to_string(roles, ', ')
-					END
-				) ||
-				CASE WHEN using_expr IS NOT NULL THEN E'\n  USING (' || using_expr || ')' ELSE '' END ||
-				CASE WHEN check_expr IS NOT NULL THEN E'\n  WITH CHECK (' || check_expr || ')' ELSE '' END ||
-				';'
-			FROM policy_info;
-		`
-		args = []interface{}{obj.Schema, obj.Name}
+		query = buildPolicyDefinitionQuery()
+		args = []interface{}{obj.Schema, obj.Name, obj.TableName}
 	case types.TypeExtension:
 		query = `
 			SELECT 'CREATE EXTENSION IF NOT EXISTS ' || quote_ident(extname) || ';'
@@ -575,14 +734,7 @@ func (c *Connector) FetchObjectDefinition(ctx context.Context, obj *types.DBObje
 		`
 		args = []interface{}{obj.Name}
 	case types.TypeProcedure:
-		query = `
-			SELECT pg_get_functiondef(p.oid)
-			FROM pg_proc p
-			JOIN pg_namespace n ON n.oid = p.pronamespace
-			WHERE p.prokind = 'p'
-			AND n.nspname = $1 AND p.proname = $2;
-		`
-		args = []interface{}{obj.Schema, obj.Name}
+		return c.fetchRoutineDefinition(ctx, obj, "p")
 	case types.TypePublication:
 		query = `
 			SELECT 
@@ -619,16 +771,15 @@ func (c *Connector) FetchObjectDefinition(ctx context.Context, obj *types.DBObje
 			FROM sub_details;
 		`
 		args = []interface{}{obj.Name}
-	case types.TypeRule:
-		query = `
-			SELECT pg_get_ruledef(r.oid)
-			FROM pg_rewrite r
-			JOIN pg_class c ON r.ev_class = c.oid
-			JOIN pg_namespace n ON c.relnamespace = n.oid
-			WHERE r.rulename != '_RETURN'
-			AND n.nspname = $1 AND r.rulename = $2;
-		`
+	case types.TypeLanguage:
+		query = buildLanguageDefinitionQuery()
+		args = []interface{}{obj.Name}
+	case types.TypeStatistics:
+		query = buildStatisticsDefinitionQuery()
 		args = []interface{}{obj.Schema, obj.Name}
+	case types.TypeRule:
+		query = buildRuleDefinitionQuery()
+		args = []interface{}{obj.Schema, obj.Name, obj.TableName}
 	case types.TypeAggregate:
 		query = `
 			SELECT format(
@@ -646,6 +797,8 @@ func (c *Connector) FetchObjectDefinition(ctx context.Context, obj *types.DBObje
 			AND p.prokind = 'a';
 		`
 		args = []interface{}{obj.Schema, obj.Name}
+	case types.TypeWindowFunction:
+		return c.fetchRoutineDefinition(ctx, obj, "w")
 	default:
 		return stacktrace.NewError("Unsupported object type: %s", obj.Type)
 	}
@@ -654,23 +807,353 @@ func (c *Connector) FetchObjectDefinition(ctx context.Context, obj *types.DBObje
 	err := c.db.QueryRowContext(ctx, query, args...).Scan(&definition)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return stacktrace.NewError("No definition found for %s.%s of type %s", obj.Schema, obj.Name, obj.Type)
+			return noDefinitionError(obj)
 		}
 		return stacktrace.Propagate(err, "Database error when fetching definition for %s.%s", obj.Schema, obj.Name)
 	}
 
 	if !definition.Valid {
-		return stacktrace.NewError("Definition is NULL for %s.%s of type %s", obj.Schema, obj.Name, obj.Type)
+		return nullDefinitionError(obj)
 	}
 
 	obj.Definition = definition.String
+	return c.enforceDefinitionSize(obj)
+}
+
+// buildPolicyDefinitionQuery creates the SQL query for a policy's CREATE POLICY statement.
+// Policy names are only unique within a table, so the table is matched too.
+func buildPolicyDefinitionQuery() string {
+	return strings.TrimSpace(`
+		WITH policy_info AS (
+			SELECT 
+				pol.polname AS name,
+				c.relname AS table_name,
+				n.nspname AS schema_name,
+				CASE pol.polcmd
+					WHEN 'r' THEN 'SELECT'
+					WHEN 'a' THEN 'INSERT'
+					WHEN 'w' THEN 'UPDATE'
+					WHEN 'd' THEN 'DELETE'
+					WHEN '*' THEN 'ALL'
+				END AS command,
+				pg_get_expr(pol.polqual, pol.polrelid) AS using_expr,
+				pg_get_expr(pol.polwithcheck, pol.polrelid) AS check_expr,
+				ARRAY(
+					SELECT pg_get_userbyid(member)
+					FROM unnest(pol.polroles) AS member
+				) AS roles
+			FROM pg_policy pol
+			JOIN pg_class c ON pol.polrelid = c.oid
+			JOIN pg_namespace n ON c.relnamespace = n.oid
+			WHERE n.nspname = $1 AND pol.polname = $2 AND c.relname = $3
+		)
+		SELECT 
+			'CREATE POLICY ' || quote_ident(name) || ' ON ' || 
+			quote_ident(schema_name) || '.' || quote_ident(table_name) || 
+			' FOR ' || command || 
+			' TO ' || (
+				CASE 
+					WHEN array_position(roles, 'public') IS NOT NULL THEN 'PUBLIC'
+					ELSE array_to_string(roles, ', ')
+				END
+			) ||
+			CASE WHEN using_expr IS NOT NULL THEN E'\n  USING (' || using_expr || ')' ELSE '' END ||
+			CASE WHEN check_expr IS NOT NULL THEN E'\n  WITH CHECK (' || check_expr || ')' ELSE '' END ||
+			';'
+		FROM policy_info
+	`)
+}
+
+// buildRuleDefinitionQuery creates the SQL query for a rule's definition. Rule names are
+// only unique within a table or view, so it is matched too.
+func buildRuleDefinitionQuery() string {
+	return strings.TrimSpace(`
+		SELECT pg_get_ruledef(r.oid)
+		FROM pg_rewrite r
+		JOIN pg_class c ON r.ev_class = c.oid
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+		WHERE r.rulename != '_RETURN'
+		AND n.nspname = $1 AND r.rulename = $2 AND c.relname = $3
+	`)
+}
+
+// buildTriggerDefinitionQuery creates the SQL query for a trigger's definition, its
+// table and its firing state, which pg_get_triggerdef leaves out. Trigger names are only
+// unique within a table, so the table is matched too.
+func buildTriggerDefinitionQuery() string {
+	return strings.TrimSpace(`
+		SELECT pg_get_triggerdef(t.oid), c.relname, t.tgenabled
+		FROM pg_trigger t
+		JOIN pg_class c ON t.tgrelid = c.oid
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+		WHERE n.nspname = $1
+		AND t.tgname = $2
+		AND c.relname = $3
+		AND NOT t.tgisinternal
+	`)
+}
+
+// triggerDefinition appends the ALTER TABLE statement restoring a trigger's firing state
+// to its definition. Triggers fire by default ('O'); 'D' is disabled, and 'R' and 'A' fire
+// only in replica mode or in every mode.
+func triggerDefinition(definition, schema, table, name, enabled string) string {
+	var action string
+	switch enabled {
+	case "D":
+		action = "DISABLE TRIGGER"
+	case "R":
+		action = "ENABLE REPLICA TRIGGER"
+	case "A":
+		action = "ENABLE ALWAYS TRIGGER"
+	default:
+		return definition
+	}
+	definition = strings.TrimRight(definition, "\n")
+	if !strings.HasSuffix(definition, ";") {
+		definition += ";"
+	}
+	return fmt.Sprintf("%s\nALTER TABLE %s.%s %s %s;\n",
+		definition, quoteIdent(schema), quoteIdent(table), action, quoteIdent(name))
+}
+
+// fetchTriggerDefinition fetches a trigger's definition, followed by the statement that
+// restores its firing state when it is not enabled the default way
+func (c *Connector) fetchTriggerDefinition(ctx context.Context, obj *types.DBObject) error {
+	var definition, table, enabled string
+	err := c.db.QueryRowContext(ctx, buildTriggerDefinitionQuery(), obj.Schema, obj.Name, obj.TableName).Scan(&definition, &table, &enabled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return noDefinitionError(obj)
+		}
+		return stacktrace.Propagate(err, "Database error when fetching definition for %s.%s", obj.Schema, obj.Name)
+	}
+
+	obj.Definition = triggerDefinition(definition, obj.Schema, table, obj.Name, enabled)
+	return c.enforceDefinitionSize(obj)
+}
+
+// matViewInfo holds what is needed to recreate a materialized view
+type matViewInfo struct {
+	schema    string
+	name      string
+	query     string
+	options   string // storage parameters, comma separated; empty when none are set
+	populated bool
+}
+
+// buildMaterializedViewDefinitionQuery creates the SQL query for a materialized view's
+// query, storage parameters and whether it has been populated
+func buildMaterializedViewDefinitionQuery() string {
+	return strings.TrimSpace(`
+		SELECT
+			pg_get_viewdef(c.oid, true),
+			COALESCE(array_to_string(c.reloptions, ', '), ''),
+			c.relispopulated
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'm'
+		AND n.nspname = $1 AND c.relname = $2
+	`)
+}
+
+// materializedViewDefinition renders a complete CREATE MATERIALIZED VIEW statement.
+// Unpopulated materialized views are created WITH NO DATA so replaying the export
+// doesn't run a query the source database never ran.
+func materializedViewDefinition(mv matViewInfo) string {
+	var b strings.Builder
+	b.WriteString("CREATE MATERIALIZED VIEW " + quoteIdent(mv.schema) + "." + quoteIdent(mv.name))
+	if mv.options != "" {
+		b.WriteString(" WITH (" + mv.options + ")")
+	}
+	b.WriteString(" AS\n")
+	b.WriteString(strings.TrimRight(strings.TrimSpace(mv.query), ";"))
+	if mv.populated {
+		b.WriteString("\nWITH DATA;")
+	} else {
+		b.WriteString("\nWITH NO DATA;")
+	}
+	return b.String()
+}
+
+// fetchMaterializedViewDefinition fetches a materialized view and renders its definition
+func (c *Connector) fetchMaterializedViewDefinition(ctx context.Context, obj *types.DBObject) error {
+	mv := matViewInfo{schema: obj.Schema, name: obj.Name}
+	var query sql.NullString
+	err := c.db.QueryRowContext(ctx, buildMaterializedViewDefinitionQuery(), obj.Schema, obj.Name).Scan(
+		&query, &mv.options, &mv.populated)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return noDefinitionError(obj)
+		}
+		return stacktrace.Propagate(err, "Database error when fetching definition for %s.%s", obj.Schema, obj.Name)
+	}
+	// pg_get_viewdef returns NULL for a materialized view dropped while it was being read
+	if !query.Valid {
+		return nullDefinitionError(obj)
+	}
+	mv.query = query.String
+
+	obj.Definition = materializedViewDefinition(mv)
+	return c.enforceDefinitionSize(obj)
+}
+
+// sequenceInfo holds the pg_sequence parameters of a sequence
+type sequenceInfo struct {
+	schema    string
+	name      string
+	dataType  string
+	increment int64
+	minValue  int64
+	maxValue  int64
+	start     int64
+	cache     int64
+	cycle     bool
+	ownedBy   string // The schema.table.column owning the sequence, as a serial column does; empty if none
+}
+
+// buildSequenceDefinitionQuery creates the SQL query for a sequence's parameters and the
+// column owning it, if any. pg_sequence (PostgreSQL 10+) is used because
+// information_schema.sequences lacks the cache size.
+func buildSequenceDefinitionQuery() string {
+	return strings.TrimSpace(`
+		SELECT
+			format_type(s.seqtypid, NULL),
+			s.seqincrement,
+			s.seqmin,
+			s.seqmax,
+			s.seqstart,
+			s.seqcache,
+			s.seqcycle,
+			(
+				SELECT quote_ident(tn.nspname) || '.' || quote_ident(t.relname) || '.' || quote_ident(a.attname)
+				FROM pg_depend d
+				JOIN pg_class t ON t.oid = d.refobjid
+				JOIN pg_namespace tn ON tn.oid = t.relnamespace
+				JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+				WHERE d.classid = 'pg_class'::regclass
+				AND d.objid = c.oid
+				AND d.refclassid = 'pg_class'::regclass
+				AND d.deptype = 'a'
+			) as owned_by
+		FROM pg_sequence s
+		JOIN pg_class c ON c.oid = s.seqrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2
+	`)
+}
+
+// sequenceDefinition renders a complete CREATE SEQUENCE statement. A sequence owned by a
+// column is marked as such, since its table's definition restores the ownership.
+func sequenceDefinition(seq sequenceInfo) string {
+	cycle := "NO CYCLE"
+	if seq.cycle {
+		cycle = "CYCLE"
+	}
+	header := ""
+	if seq.ownedBy != "" {
+		header = fmt.Sprintf("-- Owned by column %s, like a serial column's sequence; the table's definition restores the ownership\n", seq.ownedBy)
+	}
+	return header + fmt.Sprintf("CREATE SEQUENCE %s.%s\n"+
+		"    AS %s\n"+
+		"    INCREMENT BY %d\n"+
+		"    MINVALUE %d\n"+
+		"    MAXVALUE %d\n"+
+		"    START WITH %d\n"+
+		"    CACHE %d\n"+
+		"    %s;",
+		quoteIdent(seq.schema), quoteIdent(seq.name), seq.dataType,
+		seq.increment, seq.minValue, seq.maxValue, seq.start, seq.cache, cycle)
+}
+
+// fetchSequenceDefinition fetches a sequence's parameters and renders its definition,
+// followed by its current value if requested
+func (c *Connector) fetchSequenceDefinition(ctx context.Context, obj *types.DBObject) error {
+	seq := sequenceInfo{schema: obj.Schema, name: obj.Name}
+	var ownedBy sql.NullString
+	err := c.db.QueryRowContext(ctx, buildSequenceDefinitionQuery(), obj.Schema, obj.Name).Scan(
+		&seq.dataType, &seq.increment, &seq.minValue, &seq.maxValue, &seq.start, &seq.cache, &seq.cycle, &ownedBy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return noDefinitionError(obj)
+		}
+		return stacktrace.Propagate(err, "Database error when fetching definition for %s.%s", obj.Schema, obj.Name)
+	}
+
+	seq.ownedBy = ownedBy.String
+	obj.Definition = sequenceDefinition(seq)
+	if c.sequenceCurrentValue {
+		if err := c.appendSequenceCurrentValue(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return c.enforceDefinitionSize(obj)
+}
+
+// appendSequenceCurrentValue adds a setval statement for the sequence's last value.
+// Sequences that were never used keep just their definition, which already starts at the right value.
+func (c *Connector) appendSequenceCurrentValue(ctx context.Context, obj *types.DBObject) error {
+	var lastValue sql.NullInt64
+	err := c.db.QueryRowContext(ctx, buildSequenceValueQuery(), obj.Schema, obj.Name).Scan(&lastValue)
+	if err != nil && err != sql.ErrNoRows {
+		return stacktrace.Propagate(err, "Failed to fetch current value of sequence %s.%s", obj.Schema, obj.Name)
+	}
+	if lastValue.Valid {
+		obj.Definition = withSequenceValue(obj.Definition, obj.Schema, obj.Name, lastValue.Int64)
+	}
+	return nil
+}
+
+// buildSequenceValueQuery creates the SQL query for a sequence's current value.
+// pg_sequences reports a NULL last_value for sequences nextval was never called on.
+func buildSequenceValueQuery() string {
+	return strings.TrimSpace(`
+		SELECT last_value
+		FROM pg_sequences
+		WHERE schemaname = $1 AND sequencename = $2
+	`)
+}
+
+// plainIdentifier matches identifiers that quote_ident leaves unquoted
+var plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// quoteIdent quotes an identifier the way PostgreSQL's quote_ident does, ignoring keywords
+func quoteIdent(name string) string {
+	if plainIdentifier.MatchString(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// withSequenceValue appends a setval call to a sequence definition so the next
+// nextval returns lastValue+1, as it would have on the source database
+func withSequenceValue(definition, schema, name string, lastValue int64) string {
+	qualified := quoteIdent(schema) + "." + quoteIdent(name)
+	literal := "'" + strings.ReplaceAll(qualified, "'", "''") + "'"
+	return strings.TrimRight(definition, "\n") + "\n" + fmt.Sprintf("SELECT setval(%s, %d, true);", literal, lastValue) + "\n"
+}
+
+// enforceDefinitionSize applies the max definition size to a fetched definition
+func (c *Connector) enforceDefinitionSize(obj *types.DBObject) error {
+	if c.maxDefinitionSize <= 0 || len(obj.Definition) <= c.maxDefinitionSize {
+		return nil
+	}
+
+	size := len(obj.Definition)
+	if !c.truncateOversized {
+		obj.Definition = ""
+		return stacktrace.NewError("Definition for %s.%s of type %s is %d bytes, exceeding the limit of %d bytes",
+			obj.Schema, obj.Name, obj.Type, size, c.maxDefinitionSize)
+	}
+
+	log.Warn("Truncating definition for %s %s.%s from %d to %d bytes", obj.Type, obj.Schema, obj.Name, size, c.maxDefinitionSize)
+	obj.Definition = obj.Definition[:c.maxDefinitionSize]
 	return nil
 }
 
 // FetchObjectsDefinitionsConcurrently fetches definitions for multiple objects concurrently
-func (c *Connector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []string, error) {
+func (c *Connector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
 	if concurrency <= 0 {
-		concurrency = 10 // Default concurrency if invalid value provided
+		concurrency = DefaultFetchConcurrency
 	}
 
 	log.Info("Fetching definitions concurrently for %d objects with concurrency %d", len(objects), concurrency)
@@ -679,7 +1162,7 @@ func (c *Connector) FetchObjectsDefinitionsConcurrently(ctx context.Context, obj
 	copy(results, objects) // Make a copy of the objects to avoid modifying the original slice
 
 	var failedMutex sync.Mutex
-	failedObjects := make([]string, 0)
+	failedObjects := make([]types.ObjectKey, 0)
 
 	// Create a semaphore using a channel to limit concurrency
 	sem := make(chan struct{}, concurrency)
@@ -705,13 +1188,31 @@ func (c *Connector) FetchObjectsDefinitionsConcurrently(ctx context.Context, obj
 				<-sem
 			}()
 
+			// The per-object clock starts once the object has a connection slot
+			objCtx := ctx
+			if c.objectTimeout > 0 {
+				var cancel context.CancelFunc
+				objCtx, cancel = context.WithTimeout(ctx, c.objectTimeout)
+				defer cancel()
+			}
+
 			// Fetch the definition for this object
-			err := c.FetchObjectDefinition(ctx, &results[idx])
+			start := time.Now()
+			err := c.fetchDefinitionRetryingMissing(objCtx, &results[idx])
+			c.recordTiming(results[idx].Key(), time.Since(start))
 			if err != nil {
 				failedMutex.Lock()
-				failedObjects = append(failedObjects, fmt.Sprintf("%s.%s", results[idx].Schema, results[idx].Name))
+				failedObjects = append(failedObjects, results[idx].Key())
 				failedMutex.Unlock()
-				log.Warn("Failed to fetch definition for %s %s.%s: %v", results[idx].Type, results[idx].Schema, results[idx].Name, err)
+				obj := results[idx]
+				if ctx.Err() == nil && objCtx.Err() == context.DeadlineExceeded {
+					c.recordFailure(obj.Key(), FailureTimeout)
+					log.Warn("Gave up fetching definition for %s %s.%s after the per-object timeout of %s", obj.Type, obj.Schema, obj.Name, c.objectTimeout)
+				} else {
+					kind := ClassifyFetchError(err)
+					c.recordFailure(obj.Key(), kind)
+					log.Warn("Failed to fetch definition for %s %s.%s (%s): %v", obj.Type, obj.Schema, obj.Name, kind, err)
+				}
 			}
 		}(i)
 	}
@@ -719,85 +1220,49 @@ func (c *Connector) FetchObjectsDefinitionsConcurrently(ctx context.Context, obj
 	// Wait for all goroutines to finish
 	wg.Wait()
 
+	// Past the deadline every remaining fetch fails, so the results are not worth using
+	if err := ctx.Err(); err != nil {
+		return results, failedObjects, stacktrace.Propagate(err, "Fetching definitions was interrupted after %d failures", len(failedObjects))
+	}
 	return results, failedObjects, nil
 }
 
-// buildTableDefinitionQuery creates the SQL query for table definition
-func buildTableDefinitionQuery() string {
+// buildTableDefinitionQuery creates the SQL query for table definition, reading the
+// columns from the given DefinitionSource. Generated columns are only looked for on servers
+// of serverVersionNum that have them.
+// Foreign keys are left out: they may reference tables created later, so they are fetched
+// separately with buildForeignKeysQuery.
+func buildTableDefinitionQuery(source string, serverVersionNum int) string {
+	columns := catalogColumnsCTE(serverVersionNum)
+	if source == DefinitionSourceInformationSchema {
+		columns = informationSchemaColumnsCTE(serverVersionNum)
+	}
 	return strings.TrimSpace(`
-		WITH columns AS (
-			SELECT 
-				column_name,
-				data_type,
-				CASE 
-					WHEN character_maximum_length IS NOT NULL THEN '(' || character_maximum_length || ')'
-					WHEN numeric_precision IS NOT NULL THEN '(' || numeric_precision || 
-						CASE WHEN numeric_scale IS NOT NULL THEN ',' || numeric_scale ELSE '' END || ')'
-					ELSE ''
-				END as size,
-				is_nullable,
-				column_default
-			FROM information_schema.columns 
-			WHERE table_schema = $1 AND table_name = $2
-			ORDER BY ordinal_position
-		),
-		foreign_keys AS (
-			SELECT DISTINCT
-				kcu.column_name,
-				'constraint ' || 
-				'fk_tbl_' || ccu.table_name || '_col_' || kcu.column_name || 
-				' references ' || 
-				quote_ident(ccu.table_schema) || '.' || quote_ident(ccu.table_name) ||
-				CASE
-					WHEN rc.delete_rule = 'CASCADE' THEN ' on delete cascade'
-					WHEN rc.delete_rule = 'SET NULL' THEN ' on delete set null'
-					WHEN rc.delete_rule = 'SET DEFAULT' THEN ' on delete set default'
-					WHEN rc.delete_rule = 'RESTRICT' THEN ' on delete restrict'
-					ELSE ''
-				END as fk_definition,
-				tc.constraint_name
-			FROM information_schema.table_constraints tc
-			JOIN information_schema.key_column_usage kcu
-				ON tc.constraint_name = kcu.constraint_name
-				AND tc.table_schema = kcu.table_schema
-				AND tc.table_name = kcu.table_name
-			JOIN information_schema.constraint_column_usage ccu
-				ON ccu.constraint_name = tc.constraint_name
-				AND ccu.constraint_schema = tc.constraint_schema
-			JOIN information_schema.referential_constraints rc
-				ON tc.constraint_name = rc.constraint_name
-				AND tc.constraint_schema = rc.constraint_schema
-			WHERE tc.constraint_type = 'FOREIGN KEY'
-			AND tc.table_schema = $1
-			AND tc.table_name = $2
-		),
-		fk_by_column AS (
-			SELECT
-				column_name,
-				string_agg(DISTINCT ' ' || fk_definition, ' ') as all_fk_definitions
-			FROM foreign_keys
-			GROUP BY column_name
-		),
+		WITH ` + columns + `,
 		constraints AS (
 			SELECT 
-				pg_get_constraintdef(c.oid) as definition
+				pg_get_constraintdef(c.oid, true) as definition
 			FROM pg_constraint c
 			JOIN pg_namespace n ON n.oid = c.connamespace
 			WHERE n.nspname = $1 
 			AND c.conrelid::regclass::text = quote_ident($1) || '.' || quote_ident($2)
-			AND c.contype != 'f' -- Exclude foreign keys as we handle them separately
+			AND c.contype != 'f' -- Foreign keys are added once every table exists
 		)
 		SELECT 
-			'CREATE TABLE ' || quote_ident($1) || '.' || quote_ident($2) || ' (' || E'\n' ||
+			-- Unlogged tables must stay unlogged when restored
+			CASE WHEN EXISTS (
+				SELECT 1
+				FROM pg_class rel
+				JOIN pg_namespace n ON n.oid = rel.relnamespace
+				WHERE n.nspname = $1
+				AND rel.relname = $2
+				AND rel.relpersistence = 'u'
+			) THEN 'CREATE UNLOGGED TABLE ' ELSE 'CREATE TABLE ' END ||
+			quote_ident($1) || '.' || quote_ident($2) || ' (' || E'\n' ||
 			(SELECT string_agg(
-				'    ' || quote_ident(c.column_name) || ' ' || c.data_type || c.size || 
+				'    ' || quote_ident(c.column_name) || ' ' || c.data_type || c.size || c.collation ||
 				CASE WHEN c.is_nullable = 'NO' THEN ' NOT NULL' ELSE '' END ||
-				CASE WHEN c.column_default IS NOT NULL THEN ' DEFAULT ' || c.column_default ELSE '' END ||
-				COALESCE((
-					SELECT all_fk_definitions
-					FROM fk_by_column fk
-					WHERE fk.column_name = c.column_name
-				), ''),
+				c.default_clause,
 				E',\n'
 			) FROM columns c) ||
 			COALESCE((
@@ -809,31 +1274,180 @@ func buildTableDefinitionQuery() string {
 	`)
 }
 
-// schemaExists checks if the given schema exists in the database
-func (c *Connector) schemaExists(ctx context.Context, schema string) (bool, error) {
-	query := `
-		SELECT EXISTS (
-			SELECT 1 FROM information_schema.schemata 
-			WHERE schema_name = ($1)::text
-		);
-	`
-	var exists bool
-	err := c.db.QueryRowContext(ctx, query, schema).Scan(&exists)
+// informationSchemaColumnsCTE reads a table's columns from information_schema.columns.
+// Generated columns come from pg_attribute because information_schema does not expose
+// whether they are STORED or VIRTUAL; servers before PostgreSQL 12 have none.
+func informationSchemaColumnsCTE(serverVersionNum int) string {
+	generated := `generated AS (
+			SELECT NULL::name as attname, NULL::"char" as attgenerated, NULL::text as expression
+			WHERE false
+		)`
+	if hasGeneratedColumns(serverVersionNum) {
+		generated = `generated AS (
+			SELECT 
+				a.attname,
+				a.attgenerated,
+				pg_get_expr(d.adbin, d.adrelid) as expression
+			FROM pg_attribute a
+			JOIN pg_class rel ON rel.oid = a.attrelid
+			JOIN pg_namespace n ON n.oid = rel.relnamespace
+			JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+			WHERE n.nspname = $1
+			AND rel.relname = $2
+			AND a.attgenerated <> ''
+		)`
+	}
+	return generated + `,
+		columns AS (
+			SELECT 
+				column_name,
+				data_type,
+				CASE 
+					WHEN character_maximum_length IS NOT NULL THEN '(' || character_maximum_length || ')'
+					WHEN numeric_precision IS NOT NULL THEN '(' || numeric_precision || 
+						CASE WHEN numeric_scale IS NOT NULL THEN ',' || numeric_scale ELSE '' END || ')'
+					ELSE ''
+				END as size,
+				is_nullable,
+				CASE
+					-- Identity columns own an implicit sequence, so emit its options inline
+					WHEN is_identity = 'YES' THEN ' GENERATED ' || identity_generation || ' AS IDENTITY (' ||
+						'START WITH ' || identity_start ||
+						' INCREMENT BY ' || identity_increment ||
+						' MINVALUE ' || identity_minimum ||
+						' MAXVALUE ' || identity_maximum ||
+						CASE WHEN identity_cycle = 'YES' THEN ' CYCLE' ELSE ' NO CYCLE' END || ')'
+					-- Generated columns keep their expression instead of a plain DEFAULT
+					WHEN g.expression IS NOT NULL THEN ' GENERATED ALWAYS AS (' || g.expression || ')' ||
+						CASE WHEN g.attgenerated = 's' THEN ' STORED' ELSE ' VIRTUAL' END
+					WHEN column_default IS NOT NULL THEN ' DEFAULT ' || column_default
+					ELSE ''
+				END as default_clause,
+				-- NULL when the column uses its type's default collation
+				CASE WHEN collation_name IS NOT NULL 
+					THEN ' COLLATE ' || quote_ident(collation_schema) || '.' || quote_ident(collation_name)
+					ELSE ''
+				END as collation
+			FROM information_schema.columns 
+			LEFT JOIN generated g ON g.attname = column_name
+			WHERE table_schema = $1 AND table_name = $2
+			ORDER BY ordinal_position
+		)`
+}
+
+// catalogColumnsCTE reads a table's columns from pg_attribute. format_type renders each
+// type as it would be declared, including arrays, domains, enums and type modifiers.
+// Generated columns are only looked for on servers from PostgreSQL 12 on.
+func catalogColumnsCTE(serverVersionNum int) string {
+	generated := ""
+	if hasGeneratedColumns(serverVersionNum) {
+		generated = `
+					-- Generated columns keep their expression instead of a plain DEFAULT
+					WHEN a.attgenerated <> '' THEN ' GENERATED ALWAYS AS (' || pg_get_expr(d.adbin, d.adrelid) || ')' ||
+						CASE WHEN a.attgenerated = 's' THEN ' STORED' ELSE ' VIRTUAL' END`
+	}
+	return `columns AS (
+			SELECT 
+				a.attname as column_name,
+				format_type(a.atttypid, a.atttypmod) as data_type,
+				'' as size,
+				CASE WHEN a.attnotnull THEN 'NO' ELSE 'YES' END as is_nullable,
+				CASE
+					-- Identity columns own an implicit sequence, so emit its options inline
+					WHEN a.attidentity <> '' THEN ' GENERATED ' ||
+						CASE a.attidentity WHEN 'a' THEN 'ALWAYS' ELSE 'BY DEFAULT' END || ' AS IDENTITY (' ||
+						'START WITH ' || s.seqstart ||
+						' INCREMENT BY ' || s.seqincrement ||
+						' MINVALUE ' || s.seqmin ||
+						' MAXVALUE ' || s.seqmax ||
+						CASE WHEN s.seqcycle THEN ' CYCLE' ELSE ' NO CYCLE' END || ')'` + generated + `
+					WHEN d.adbin IS NOT NULL THEN ' DEFAULT ' || pg_get_expr(d.adbin, d.adrelid)
+					ELSE ''
+				END as default_clause,
+				-- Only a collation that differs from the type's default is declared
+				CASE WHEN a.attcollation <> 0 AND a.attcollation <> t.typcollation
+					THEN ' COLLATE ' || quote_ident(cn.nspname) || '.' || quote_ident(co.collname)
+					ELSE ''
+				END as collation
+			FROM pg_attribute a
+			JOIN pg_class rel ON rel.oid = a.attrelid
+			JOIN pg_namespace n ON n.oid = rel.relnamespace
+			JOIN pg_type t ON t.oid = a.atttypid
+			LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+			LEFT JOIN pg_collation co ON co.oid = a.attcollation
+			LEFT JOIN pg_namespace cn ON cn.oid = co.collnamespace
+			LEFT JOIN pg_sequence s ON a.attidentity <> ''
+				AND s.seqrelid = pg_get_serial_sequence(quote_ident($1) || '.' || quote_ident($2), a.attname)::regclass
+			WHERE n.nspname = $1
+			AND rel.relname = $2
+			AND a.attnum > 0
+			AND NOT a.attisdropped
+			ORDER BY a.attnum
+		)`
+}
+
+// ServerInfo returns the server version, encoding and database collation
+func (c *Connector) ServerInfo(ctx context.Context) (types.ServerInfo, error) {
+	var info types.ServerInfo
+	err := c.db.QueryRowContext(ctx, buildServerInfoQuery()).Scan(&info.Version, &info.Encoding, &info.Collation)
 	if err != nil {
-		return false, stacktrace.Propagate(err, "Failed to check if schema exists: %s", schema)
+		return types.ServerInfo{}, stacktrace.Propagate(err, "Failed to query server info")
 	}
-	return exists, nil
+	return info, nil
+}
+
+// buildServerInfoQuery creates the SQL query for server version, encoding and collation.
+// The collation comes from pg_database because lc_collate is no longer a setting in PostgreSQL 16+.
+func buildServerInfoQuery() string {
+	return strings.TrimSpace(`
+		SELECT 
+			current_setting('server_version'),
+			current_setting('server_encoding'),
+			datcollate
+		FROM pg_database
+		WHERE datname = current_database();
+	`)
 }
 
-// GetAllSchemas returns a list of all schemas in the database
-func (c *Connector) GetAllSchemas(ctx context.Context) ([]string, error) {
+// existingSchemas returns which of the given schemas exist in the database
+func (c *Connector) existingSchemas(ctx context.Context, schemas []string) (map[string]bool, error) {
 	query := `
 		SELECT schema_name
-		FROM information_schema.schemata
-		WHERE schema_name NOT LIKE 'pg_%'
-		AND schema_name != 'information_schema'
-		ORDER BY schema_name;
+		FROM information_schema.schemata 
+		WHERE schema_name = ANY($1);
 	`
+	rows, err := c.db.QueryContext(ctx, query, pq.Array(schemas))
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query schemas")
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool, len(schemas))
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan schema row")
+		}
+		existing[schema] = true
+	}
+	return existing, rows.Err()
+}
+
+// missingSchemas returns the requested schemas that are not in the existing set, in request order
+func missingSchemas(requested []string, existing map[string]bool) []string {
+	var missing []string
+	for _, schema := range requested {
+		if !existing[schema] {
+			missing = append(missing, schema)
+		}
+	}
+	return missing
+}
+
+// GetAllSchemas returns a list of all schemas in the database.
+// System schemas (pg_* and information_schema) are excluded unless includeSystem is true.
+func (c *Connector) GetAllSchemas(ctx context.Context, includeSystem bool) ([]string, error) {
+	query := buildAllSchemasQuery(includeSystem)
 	rows, err := c.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, stacktrace.Propagate(err, "Failed to query schemas")
@@ -851,8 +1465,95 @@ func (c *Connector) GetAllSchemas(ctx context.Context) ([]string, error) {
 	return schemas, nil
 }
 
+// buildDatabasesQuery creates the SQL query listing the databases that can be exported:
+// templates and databases that refuse connections are left out
+func buildDatabasesQuery() string {
+	return strings.TrimSpace(`
+		SELECT datname
+		FROM pg_database
+		WHERE NOT datistemplate AND datallowconn
+		ORDER BY datname
+	`)
+}
+
+// ListDatabases returns the names of the databases on the server that can be connected
+// to and exported, sorted by name
+func (c *Connector) ListDatabases(ctx context.Context) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, buildDatabasesQuery())
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query databases")
+	}
+	defer rows.Close()
+
+	var databases []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan database row")
+		}
+		databases = append(databases, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read databases")
+	}
+	return databases, nil
+}
+
+// IsSystemSchema reports whether schema is one of PostgreSQL's own schemas
+// (pg_catalog, pg_toast and the other pg_* schemas, or information_schema)
+func IsSystemSchema(schema string) bool {
+	return strings.HasPrefix(schema, "pg_") || schema == "information_schema"
+}
+
+// buildAllSchemasQuery creates the SQL query listing schemas, optionally including system schemas
+func buildAllSchemasQuery(includeSystem bool) string {
+	filter := `
+		WHERE schema_name NOT LIKE 'pg_%'
+		AND schema_name != 'information_schema'`
+	if includeSystem {
+		// pg_toast and the per-session temp schemas hold no exportable definitions
+		filter = `
+		WHERE schema_name NOT LIKE 'pg_toast%'
+		AND schema_name NOT LIKE 'pg_temp_%'`
+	}
+	return strings.TrimSpace(`
+		SELECT schema_name
+		FROM information_schema.schemata` + filter + `
+		ORDER BY schema_name;
+	`)
+}
+
 // querySequences queries sequences from the database
-func (c *Connector) querySequences(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) querySequences(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
+	rows, err := c.db.QueryContext(ctx, buildSequencesQuery(c.identitySequences), schema)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query sequences in schema: %s", schema)
+	}
+	defer rows.Close()
+
+	var objects []types.DBObject
+	for rows.Next() {
+		var obj types.DBObject
+		var typeStr string
+		var tableName sql.NullString
+		if err := rows.Scan(&typeStr, &obj.Schema, &obj.Name, &tableName); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan sequence row")
+		}
+		obj.Type = types.ObjectType(typeStr)
+		if tableName.Valid {
+			obj.TableName = tableName.String
+		}
+		if filter.matches(obj.Schema, obj.Name) {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// buildSequencesQuery creates the SQL query listing sequences and their owning tables.
+// Sequences owned by identity columns, found through their internal pg_depend entry, are
+// left out unless includeIdentity is set.
+func buildSequencesQuery(includeIdentity bool) string {
 	query := `
 		SELECT 
 			'sequence' as type,
@@ -878,33 +1579,24 @@ func (c *Connector) querySequences(ctx context.Context, schema string, pattern *
 		) t USING(sequence_schema, sequence_name)
 		WHERE sequence_schema = ($1)::text
 	`
-	rows, err := c.db.QueryContext(ctx, query, schema)
-	if err != nil {
-		return nil, stacktrace.Propagate(err, "Failed to query sequences in schema: %s", schema)
+	if !includeIdentity {
+		query += `
+		-- Identity sequences are implicit in their column's GENERATED ... AS IDENTITY clause
+		AND NOT EXISTS (
+			SELECT 1
+			FROM pg_class seq
+			JOIN pg_namespace seq_n ON seq_n.oid = seq.relnamespace
+			JOIN pg_depend dep ON dep.objid = seq.oid
+			WHERE seq_n.nspname = s.sequence_schema
+			AND seq.relname = s.sequence_name
+			AND dep.deptype = 'i'
+		)`
 	}
-	defer rows.Close()
-
-	var objects []types.DBObject
-	for rows.Next() {
-		var obj types.DBObject
-		var typeStr string
-		var tableName sql.NullString
-		if err := rows.Scan(&typeStr, &obj.Schema, &obj.Name, &tableName); err != nil {
-			return nil, stacktrace.Propagate(err, "Failed to scan sequence row")
-		}
-		obj.Type = types.ObjectType(typeStr)
-		if tableName.Valid {
-			obj.TableName = tableName.String
-		}
-		if pattern.MatchString(obj.Name) {
-			objects = append(objects, obj)
-		}
-	}
-	return objects, nil
+	return strings.TrimSpace(query)
 }
 
 // queryMaterializedViews queries materialized views from the database
-func (c *Connector) queryMaterializedViews(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) queryMaterializedViews(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'materialized_view' as type,
@@ -929,7 +1621,7 @@ func (c *Connector) queryMaterializedViews(ctx context.Context, schema string, p
 			return nil, stacktrace.Propagate(err, "Failed to scan materialized view row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
@@ -937,7 +1629,7 @@ func (c *Connector) queryMaterializedViews(ctx context.Context, schema string, p
 }
 
 // queryPolicies queries row-level security policies from the database
-func (c *Connector) queryPolicies(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) queryPolicies(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'policy' as type,
@@ -963,15 +1655,68 @@ func (c *Connector) queryPolicies(ctx context.Context, schema string, pattern *r
 			return nil, stacktrace.Propagate(err, "Failed to scan policy row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
 	return objects, nil
 }
 
+// queryStatistics queries extended statistics objects from the database
+func (c *Connector) queryStatistics(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
+	rows, err := c.db.QueryContext(ctx, buildStatisticsQuery(), schema)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query extended statistics in schema: %s", schema)
+	}
+	defer rows.Close()
+
+	var objects []types.DBObject
+	for rows.Next() {
+		var obj types.DBObject
+		var typeStr string
+		var tableName sql.NullString
+		if err := rows.Scan(&typeStr, &obj.Schema, &obj.Name, &tableName); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan extended statistics row")
+		}
+		obj.Type = types.ObjectType(typeStr)
+		obj.TableName = tableName.String
+		if filter.matches(obj.Schema, obj.Name) {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// buildStatisticsQuery creates the SQL query listing the extended statistics objects of a
+// schema. The table is only set when it is in the same schema, since statistics are
+// exported under their table's directory.
+func buildStatisticsQuery() string {
+	return strings.TrimSpace(`
+		SELECT
+			'statistics' as type,
+			n.nspname as schema,
+			s.stxname as name,
+			CASE WHEN c.relnamespace = s.stxnamespace THEN c.relname END as table_name
+		FROM pg_statistic_ext s
+		JOIN pg_namespace n ON n.oid = s.stxnamespace
+		JOIN pg_class c ON c.oid = s.stxrelid
+		WHERE n.nspname = ($1)::text
+	`)
+}
+
+// buildStatisticsDefinitionQuery creates the SQL query for an extended statistics object's
+// CREATE STATISTICS statement, with its kinds, columns or expressions and table
+func buildStatisticsDefinitionQuery() string {
+	return strings.TrimSpace(`
+		SELECT pg_get_statisticsobjdef(s.oid) || ';'
+		FROM pg_statistic_ext s
+		JOIN pg_namespace n ON n.oid = s.stxnamespace
+		WHERE n.nspname = $1 AND s.stxname = $2
+	`)
+}
+
 // queryExtensions queries extensions from the database
-func (c *Connector) queryExtensions(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) queryExtensions(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'extension' as type,
@@ -995,7 +1740,7 @@ func (c *Connector) queryExtensions(ctx context.Context, schema string, pattern
 			return nil, stacktrace.Propagate(err, "Failed to scan extension row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
@@ -1003,7 +1748,7 @@ func (c *Connector) queryExtensions(ctx context.Context, schema string, pattern
 }
 
 // queryProcedures queries procedures from the database (PostgreSQL 11+)
-func (c *Connector) queryProcedures(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) queryProcedures(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'procedure' as type,
@@ -1028,7 +1773,7 @@ func (c *Connector) queryProcedures(ctx context.Context, schema string, pattern
 			return nil, stacktrace.Propagate(err, "Failed to scan procedure row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
@@ -1036,7 +1781,7 @@ func (c *Connector) queryProcedures(ctx context.Context, schema string, pattern
 }
 
 // queryPublications queries logical replication publications
-func (c *Connector) queryPublications(ctx context.Context, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) queryPublications(ctx context.Context, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'publication' as type,
@@ -1058,7 +1803,7 @@ func (c *Connector) queryPublications(ctx context.Context, pattern *regexp.Regex
 			return nil, stacktrace.Propagate(err, "Failed to scan publication row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
@@ -1066,7 +1811,7 @@ func (c *Connector) queryPublications(ctx context.Context, pattern *regexp.Regex
 }
 
 // querySubscriptions queries logical replication subscriptions
-func (c *Connector) querySubscriptions(ctx context.Context, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) querySubscriptions(ctx context.Context, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'subscription' as type,
@@ -1088,15 +1833,74 @@ func (c *Connector) querySubscriptions(ctx context.Context, pattern *regexp.Rege
 			return nil, stacktrace.Propagate(err, "Failed to scan subscription row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+// queryLanguages queries procedural languages, skipping the built-in internal, c and sql
+func (c *Connector) queryLanguages(ctx context.Context, filter *nameFilter) ([]types.DBObject, error) {
+	rows, err := c.db.QueryContext(ctx, buildLanguagesQuery())
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query languages")
+	}
+	defer rows.Close()
+
+	var objects []types.DBObject
+	for rows.Next() {
+		var obj types.DBObject
+		var typeStr string
+		if err := rows.Scan(&typeStr, &obj.Schema, &obj.Name); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan language row")
+		}
+		obj.Type = types.ObjectType(typeStr)
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
 	return objects, nil
 }
 
+// buildLanguagesQuery creates the SQL query listing the procedural languages not created by an extension
+func buildLanguagesQuery() string {
+	return strings.TrimSpace(`
+		SELECT
+			'language' as type,
+			'postgres' as schema, -- Using 'postgres' as a placeholder for database-level objects
+			l.lanname as name
+		FROM pg_language l
+		WHERE l.lanname NOT IN ('internal', 'c', 'sql')
+		-- Languages created by an extension, plpgsql included, come back with CREATE EXTENSION
+		AND NOT EXISTS (
+			SELECT 1 FROM pg_depend d
+			WHERE d.classid = 'pg_language'::regclass
+			AND d.objid = l.oid
+			AND d.deptype = 'e'
+		)
+	`)
+}
+
+// buildLanguageDefinitionQuery creates the SQL query for a procedural language's
+// CREATE LANGUAGE statement. Untrusted languages such as plpython3u use the plain form;
+// the handler, inline and validator functions are schema-qualified.
+func buildLanguageDefinitionQuery() string {
+	return strings.TrimSpace(`
+		SELECT
+			CASE WHEN l.lanpltrusted THEN 'CREATE TRUSTED PROCEDURAL LANGUAGE ' ELSE 'CREATE LANGUAGE ' END ||
+			quote_ident(l.lanname) ||
+			' HANDLER ' || l.lanplcallfoid::regproc::text ||
+			CASE WHEN l.laninline <> 0 THEN ' INLINE ' || l.laninline::regproc::text ELSE '' END ||
+			CASE WHEN l.lanvalidator <> 0 THEN ' VALIDATOR ' || l.lanvalidator::regproc::text ELSE '' END ||
+			';'
+		FROM pg_language l
+		WHERE l.lanname = $1
+	`)
+}
+
 // queryRules queries rewrite rules from the database
-func (c *Connector) queryRules(ctx context.Context, schema string, pattern *regexp.Regexp) ([]types.DBObject, error) {
+func (c *Connector) queryRules(ctx context.Context, schema string, filter *nameFilter) ([]types.DBObject, error) {
 	query := `
 		SELECT 
 			'rule' as type,
@@ -1123,7 +1927,7 @@ func (c *Connector) queryRules(ctx context.Context, schema string, pattern *rege
 			return nil, stacktrace.Propagate(err, "Failed to scan rule row")
 		}
 		obj.Type = types.ObjectType(typeStr)
-		if pattern.MatchString(obj.Name) {
+		if filter.matches(obj.Schema, obj.Name) {
 			objects = append(objects, obj)
 		}
 	}
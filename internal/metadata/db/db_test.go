@@ -2,10 +2,12 @@ package db
 
 import (
 	"context"
-	"fmt"
+	"database/sql/driver"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/palantir/stacktrace"
 	"github.com/skamensky/pgmeta/internal/metadata/types"
@@ -108,9 +110,9 @@ func (c *Connector) mockFetchObjectDefinition(ctx context.Context, obj *types.DB
 }
 
 // Mock implementation for FetchObjectsDefinitionsConcurrently
-func (c *Connector) mockFetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []string, error) {
+func (c *Connector) mockFetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
 	results := make([]types.DBObject, len(objects))
-	failedObjects := make([]string, 0)
+	failedObjects := make([]types.ObjectKey, 0)
 
 	// For valid objects, set their definitions to a mock value and return success
 	// For invalid objects, add them to the failedObjects list
@@ -120,7 +122,7 @@ func (c *Connector) mockFetchObjectsDefinitionsConcurrently(ctx context.Context,
 		// Call FetchObjectDefinition for each object
 		err := c.mockFetchObjectDefinition(ctx, &results[i])
 		if err != nil {
-			failedObjects = append(failedObjects, fmt.Sprintf("%s.%s", obj.Schema, obj.Name))
+			failedObjects = append(failedObjects, obj.Key())
 		}
 	}
 
@@ -234,6 +236,20 @@ func TestQueryMultipleSchemas(t *testing.T) {
 	}
 }
 
+// Test that missing schemas are detected from the batched existence check
+func TestMissingSchemas(t *testing.T) {
+	existing := map[string]bool{"public": true, "app": true}
+
+	missing := missingSchemas([]string{"public", "non_existent", "app", "other"}, existing)
+	if len(missing) != 2 || missing[0] != "non_existent" || missing[1] != "other" {
+		t.Errorf("Expected [non_existent other], got %v", missing)
+	}
+
+	if missing := missingSchemas([]string{"public", "app"}, existing); len(missing) != 0 {
+		t.Errorf("Expected no missing schemas, got %v", missing)
+	}
+}
+
 // Test GetAllSchemas function
 func TestGetAllSchemas(t *testing.T) {
 	// Create a mock connector
@@ -268,6 +284,61 @@ func TestGetAllSchemas(t *testing.T) {
 	}
 }
 
+// Test the buildAllSchemasQuery function
+func TestIsSystemSchema(t *testing.T) {
+	for _, schema := range []string{"pg_catalog", "pg_toast", "information_schema"} {
+		if !IsSystemSchema(schema) {
+			t.Errorf("Expected %s to be a system schema", schema)
+		}
+	}
+	for _, schema := range []string{"public", "app", "pgmeta", "information"} {
+		if IsSystemSchema(schema) {
+			t.Errorf("Expected %s not to be a system schema", schema)
+		}
+	}
+}
+
+func TestBuildAllSchemasQuery(t *testing.T) {
+	// By default system schemas are excluded
+	query := buildAllSchemasQuery(false)
+	for _, part := range []string{"NOT LIKE 'pg_%'", "!= 'information_schema'"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected default query to contain '%s', got: %s", part, query)
+		}
+	}
+
+	// Including system schemas keeps pg_catalog and information_schema but still skips toast/temp schemas
+	query = buildAllSchemasQuery(true)
+	if strings.Contains(query, "NOT LIKE 'pg_%'") || strings.Contains(query, "information_schema'") {
+		t.Errorf("Expected system schemas to be included, got: %s", query)
+	}
+	for _, part := range []string{"NOT LIKE 'pg_toast%'", "NOT LIKE 'pg_temp_%'"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', got: %s", part, query)
+		}
+	}
+}
+
+func TestListDatabases(t *testing.T) {
+	query := buildDatabasesQuery()
+	for _, part := range []string{"NOT datistemplate", "datallowconn"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', got: %s", part, query)
+		}
+	}
+
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		query: {rows: [][]driver.Value{{"analytics"}, {"app"}, {"postgres"}}},
+	})
+	databases, err := connector.ListDatabases(context.Background())
+	if err != nil {
+		t.Fatalf("ListDatabases failed: %v", err)
+	}
+	if want := []string{"analytics", "app", "postgres"}; !slices.Equal(databases, want) {
+		t.Errorf("Expected %v, got %v", want, databases)
+	}
+}
+
 // Test FetchObjectDefinition error handling
 func TestFetchObjectDefinitionError(t *testing.T) {
 	// Create a mock connector
@@ -313,6 +384,49 @@ func TestFetchObjectDefinitionError(t *testing.T) {
 	}
 }
 
+// Test that oversized definitions are rejected or truncated
+func TestEnforceDefinitionSize(t *testing.T) {
+	connector := createMockConnector()
+	connector.SetMaxDefinitionSize(16, false)
+
+	// A definition within the limit is left untouched
+	obj := &types.DBObject{Type: types.TypeView, Schema: "public", Name: "small", Definition: "SELECT 1;"}
+	if err := connector.enforceDefinitionSize(obj); err != nil {
+		t.Errorf("Expected no error for small definition, got: %v", err)
+	}
+
+	// An oversized definition fails when not truncating
+	oversized := strings.Repeat("x", 64)
+	obj = &types.DBObject{Type: types.TypeView, Schema: "public", Name: "huge", Definition: oversized}
+	err := connector.enforceDefinitionSize(obj)
+	if err == nil {
+		t.Fatal("Expected error for oversized definition, got nil")
+	}
+	if !strings.Contains(err.Error(), "exceeding the limit of 16 bytes") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+	if obj.Definition != "" {
+		t.Error("Expected oversized definition to be discarded")
+	}
+
+	// With truncation the definition is cut to the limit
+	connector.SetMaxDefinitionSize(16, true)
+	obj = &types.DBObject{Type: types.TypeView, Schema: "public", Name: "huge", Definition: oversized}
+	if err := connector.enforceDefinitionSize(obj); err != nil {
+		t.Errorf("Expected no error when truncating, got: %v", err)
+	}
+	if len(obj.Definition) != 16 {
+		t.Errorf("Expected definition truncated to 16 bytes, got %d", len(obj.Definition))
+	}
+
+	// A limit of 0 disables the check
+	connector.SetMaxDefinitionSize(0, false)
+	obj = &types.DBObject{Type: types.TypeView, Schema: "public", Name: "huge", Definition: oversized}
+	if err := connector.enforceDefinitionSize(obj); err != nil {
+		t.Errorf("Expected no error with check disabled, got: %v", err)
+	}
+}
+
 // Test that object with existing definition is not re-fetched
 func TestFetchObjectDefinitionWithExistingDefinition(t *testing.T) {
 	// Create a mock connector
@@ -342,7 +456,7 @@ func TestFetchObjectDefinitionWithExistingDefinition(t *testing.T) {
 
 // Test the buildTableDefinitionQuery function
 func TestBuildTableDefinitionQuery(t *testing.T) {
-	query := buildTableDefinitionQuery()
+	query := buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0)
 
 	// Check that the query contains the expected parts
 	expectedParts := []string{
@@ -350,8 +464,6 @@ func TestBuildTableDefinitionQuery(t *testing.T) {
 		"quote_ident($1)",
 		"quote_ident($2)",
 		"quote_ident(c.column_name)",
-		"quote_ident(ccu.table_schema)",
-		"quote_ident(ccu.table_name)",
 	}
 
 	for _, part := range expectedParts {
@@ -373,6 +485,626 @@ func TestBuildTableDefinitionQuery(t *testing.T) {
 	}
 }
 
+// Test that non-default column collations are emitted from information_schema
+func TestBuildTableDefinitionQueryCollation(t *testing.T) {
+	query := buildTableDefinitionQuery(DefinitionSourceInformationSchema, 0)
+
+	// e.g. name text COLLATE "pg_catalog"."C" must keep its collation
+	expectedParts := []string{
+		"collation_name IS NOT NULL",
+		"' COLLATE ' || quote_ident(collation_schema) || '.' || quote_ident(collation_name)",
+		"c.data_type || c.size || c.collation",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', but it doesn't", part)
+		}
+	}
+
+	// The COLLATE clause must come before NOT NULL and DEFAULT
+	collateIdx := strings.Index(query, "c.collation ||")
+	notNullIdx := strings.Index(query, "' NOT NULL'")
+	if collateIdx < 0 || notNullIdx < 0 || collateIdx > notNullIdx {
+		t.Error("Expected COLLATE clause to precede NOT NULL in column definitions")
+	}
+}
+
+// Test that generated columns keep their generation expression with information_schema
+func TestBuildTableDefinitionQueryGeneratedColumns(t *testing.T) {
+	query := buildTableDefinitionQuery(DefinitionSourceInformationSchema, 0)
+
+	// e.g. total numeric GENERATED ALWAYS AS (price * qty) STORED
+	expectedParts := []string{
+		"a.attgenerated <> ''",
+		"pg_get_expr(d.adbin, d.adrelid)",
+		"' GENERATED ALWAYS AS (' || g.expression || ')'",
+		"' STORED'",
+		"LEFT JOIN generated g ON g.attname = column_name",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', but it doesn't", part)
+		}
+	}
+
+	// The generation expression takes precedence over a plain DEFAULT
+	generatedIdx := strings.Index(query, "WHEN g.expression IS NOT NULL")
+	defaultIdx := strings.Index(query, "WHEN column_default IS NOT NULL")
+	if generatedIdx < 0 || defaultIdx < 0 || generatedIdx > defaultIdx {
+		t.Error("Expected generated expression to be checked before column_default")
+	}
+}
+
+// pg_attribute.attgenerated only exists from PostgreSQL 12, so older servers must not be asked for it
+func TestGeneratedColumnsQueriesByVersion(t *testing.T) {
+	queries := func(versionNum int) map[string]string {
+		return map[string]string{
+			"pg_catalog table":         buildTableDefinitionQuery(DefinitionSourcePgCatalog, versionNum),
+			"information_schema table": buildTableDefinitionQuery(DefinitionSourceInformationSchema, versionNum),
+			"column defaults":          buildColumnDefaultsQuery(versionNum),
+		}
+	}
+	for name, query := range queries(110000) {
+		if strings.Contains(query, "a.attgenerated") {
+			t.Errorf("Expected the %s query for PostgreSQL 11 not to read attgenerated, got: %s", name, query)
+		}
+	}
+	for _, versionNum := range []int{120000, 0} {
+		for name, query := range queries(versionNum) {
+			if !strings.Contains(query, "a.attgenerated") {
+				t.Errorf("Expected the %s query for version %d to read attgenerated, got: %s", name, versionNum, query)
+			}
+		}
+	}
+	// The information_schema query still joins an empty generated CTE
+	if query := buildTableDefinitionQuery(DefinitionSourceInformationSchema, 110000); !strings.Contains(query, "LEFT JOIN generated g ON g.attname = column_name") {
+		t.Errorf("Expected the PostgreSQL 11 query to keep the generated join, got: %s", query)
+	}
+}
+
+// Test that identity columns are emitted with their identity clause with information_schema
+func TestBuildTableDefinitionQueryIdentityColumns(t *testing.T) {
+	query := buildTableDefinitionQuery(DefinitionSourceInformationSchema, 0)
+
+	// identity_generation is either 'ALWAYS' or 'BY DEFAULT', so both forms
+	// render as GENERATED ALWAYS AS IDENTITY / GENERATED BY DEFAULT AS IDENTITY
+	expectedParts := []string{
+		"WHEN is_identity = 'YES'",
+		"' GENERATED ' || identity_generation || ' AS IDENTITY ('",
+		"'START WITH ' || identity_start",
+		"' INCREMENT BY ' || identity_increment",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', but it doesn't", part)
+		}
+	}
+
+	// Identity takes precedence over any default
+	identityIdx := strings.Index(query, "WHEN is_identity = 'YES'")
+	defaultIdx := strings.Index(query, "WHEN column_default IS NOT NULL")
+	if identityIdx < 0 || defaultIdx < 0 || identityIdx > defaultIdx {
+		t.Error("Expected identity clause to be checked before column_default")
+	}
+}
+
+// Test that identity sequences are not listed as standalone sequences
+func TestBuildSequencesQueryExcludesIdentity(t *testing.T) {
+	query := buildSequencesQuery(false)
+
+	if !strings.Contains(query, "dep.deptype = 'i'") || !strings.Contains(query, "AND NOT EXISTS (") {
+		t.Errorf("Expected sequences query to exclude identity sequences, got: %s", query)
+	}
+
+	// Asking for identity sequences drops the exclusion
+	if included := buildSequencesQuery(true); strings.Contains(included, "AND NOT EXISTS (") {
+		t.Errorf("Expected sequences query to list identity sequences, got: %s", included)
+	}
+
+	// Sequences owned by serial columns are still attached to their table
+	if !strings.Contains(query, "d.deptype = 'a'") {
+		t.Error("Expected sequences query to keep resolving owning tables")
+	}
+}
+
+func TestQuerySequencesIdentity(t *testing.T) {
+	serial := []driver.Value{"sequence", "public", "orders_id_seq", "orders"}
+	identity := []driver.Value{"sequence", "public", "orders_ref_seq", nil}
+	conn := newScriptedConnector(t, map[string]scriptedResult{
+		buildSequencesQuery(false): {rows: [][]driver.Value{serial}},
+		buildSequencesQuery(true):  {rows: [][]driver.Value{serial, identity}},
+	})
+	all := newNameFilter(regexp.MustCompile(".*"), nil)
+
+	objects, err := conn.querySequences(context.Background(), "public", all)
+	if err != nil {
+		t.Fatalf("querySequences failed: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Name != "orders_id_seq" {
+		t.Errorf("Expected only the serial's sequence by default, got %+v", objects)
+	}
+
+	conn.SetIdentitySequences(true)
+	objects, err = conn.querySequences(context.Background(), "public", all)
+	if err != nil {
+		t.Fatalf("querySequences failed: %v", err)
+	}
+	if len(objects) != 2 || objects[1].Name != "orders_ref_seq" {
+		t.Errorf("Expected the identity sequence to be listed too, got %+v", objects)
+	}
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	tests := []struct {
+		connStr  string
+		timeout  time.Duration
+		expected string
+	}{
+		{"host=localhost dbname=app", 30 * time.Second, "host=localhost dbname=app statement_timeout=30000"},
+		// Sub-millisecond timeouts round up instead of disabling the timeout
+		{"host=localhost", 100 * time.Microsecond, "host=localhost statement_timeout=1"},
+		{"host=localhost", 0, "host=localhost"},
+		{"", time.Second, "statement_timeout=1000"},
+	}
+	for _, tt := range tests {
+		if got := withStatementTimeout(tt.connStr, tt.timeout); got != tt.expected {
+			t.Errorf("withStatementTimeout(%q, %v) = %q, expected %q", tt.connStr, tt.timeout, got, tt.expected)
+		}
+	}
+}
+
+func TestWithConnectTimeout(t *testing.T) {
+	tests := []struct {
+		connStr  string
+		timeout  time.Duration
+		expected string
+	}{
+		{"host=localhost dbname=app", 10 * time.Second, "host=localhost dbname=app connect_timeout=10"},
+		// Sub-second timeouts round up instead of disabling the timeout
+		{"host=localhost", 1500 * time.Millisecond, "host=localhost connect_timeout=2"},
+		{"host=localhost", 0, "host=localhost"},
+	}
+	for _, tt := range tests {
+		if got := withConnectTimeout(tt.connStr, tt.timeout); got != tt.expected {
+			t.Errorf("withConnectTimeout(%q, %v) = %q, expected %q", tt.connStr, tt.timeout, got, tt.expected)
+		}
+	}
+}
+
+func TestNewConnectTimeout(t *testing.T) {
+	// A non-routable address, where connecting hangs until a timeout unless the network
+	// rejects it outright
+	const blackhole = "host=10.255.255.1 port=5432 dbname=app user=pgmeta sslmode=disable"
+	start := time.Now()
+	_, err := New(blackhole, Options{ConnectTimeout: time.Second})
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("Expected connecting to a blackhole address to fail")
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("Expected the connection to give up after about a second, took %v", elapsed)
+	}
+	if stacktrace.GetCode(err) != ErrCodeConnection {
+		t.Errorf("Expected a connection error, got code %v: %v", stacktrace.GetCode(err), err)
+	}
+}
+
+func TestSequenceDefinition(t *testing.T) {
+	// A bigint cycling sequence with a non-default cache
+	got := sequenceDefinition(sequenceInfo{
+		schema:    "public",
+		name:      "order_numbers",
+		dataType:  "bigint",
+		increment: 5,
+		minValue:  1,
+		maxValue:  9223372036854775807,
+		start:     1000,
+		cache:     20,
+		cycle:     true,
+	})
+	expected := "CREATE SEQUENCE public.order_numbers\n" +
+		"    AS bigint\n" +
+		"    INCREMENT BY 5\n" +
+		"    MINVALUE 1\n" +
+		"    MAXVALUE 9223372036854775807\n" +
+		"    START WITH 1000\n" +
+		"    CACHE 20\n" +
+		"    CYCLE;"
+	if got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// Non-cycling sequences get a clean NO CYCLE clause, and names are quoted when needed
+	got = sequenceDefinition(sequenceInfo{schema: "App", name: "ids", dataType: "integer", increment: -1, minValue: -2147483648, maxValue: -1, start: -1, cache: 1})
+	if !strings.HasPrefix(got, `CREATE SEQUENCE "App".ids`) || !strings.Contains(got, "    AS integer\n") || !strings.HasSuffix(got, "\n    NO CYCLE;") {
+		t.Errorf("Unexpected definition for descending sequence:\n%s", got)
+	}
+}
+
+// Test that a serial column's sequence is marked as owned by its column
+func TestOwnedSequenceDefinition(t *testing.T) {
+	got := sequenceDefinition(sequenceInfo{
+		schema: "public", name: "orders_id_seq", dataType: "integer",
+		increment: 1, minValue: 1, maxValue: 2147483647, start: 1, cache: 1,
+		ownedBy: "public.orders.id",
+	})
+	if !strings.HasPrefix(got, "-- Owned by column public.orders.id, like a serial column's sequence;") {
+		t.Errorf("Expected the sequence to be marked as owned by public.orders.id, got:\n%s", got)
+	}
+	if !strings.Contains(got, "\nCREATE SEQUENCE public.orders_id_seq\n") {
+		t.Errorf("Expected the CREATE SEQUENCE statement after the marker, got:\n%s", got)
+	}
+}
+
+func TestBuildSequenceDefinitionQuery(t *testing.T) {
+	query := buildSequenceDefinitionQuery()
+	for _, column := range []string{"format_type(s.seqtypid, NULL)", "s.seqcache", "s.seqcycle", "FROM pg_sequence s", "as owned_by"} {
+		if !strings.Contains(query, column) {
+			t.Errorf("Expected sequence definition query to contain %q, got: %s", column, query)
+		}
+	}
+}
+
+func TestBuildLanguagesQuery(t *testing.T) {
+	query := buildLanguagesQuery()
+	if !strings.Contains(query, "FROM pg_language l") || !strings.Contains(query, "l.lanname NOT IN ('internal', 'c', 'sql')") {
+		t.Errorf("Expected languages query to list pg_language without the built-in languages, got: %s", query)
+	}
+	// plpgsql and languages such as plpython3u belong to an extension and would fail to replay
+	for _, part := range []string{"AND NOT EXISTS (", "d.classid = 'pg_language'::regclass", "d.objid = l.oid", "d.deptype = 'e'"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected languages query to exclude extension-owned languages with %q, got: %s", part, query)
+		}
+	}
+
+	definition := buildLanguageDefinitionQuery()
+	for _, part := range []string{"'CREATE TRUSTED PROCEDURAL LANGUAGE '", "'CREATE LANGUAGE '", "' HANDLER '", "' INLINE '", "' VALIDATOR '"} {
+		if !strings.Contains(definition, part) {
+			t.Errorf("Expected language definition query to contain %q, got: %s", part, definition)
+		}
+	}
+}
+
+func TestBuildStatisticsQuery(t *testing.T) {
+	query := buildStatisticsQuery()
+	for _, part := range []string{"FROM pg_statistic_ext s", "s.stxname as name", "CASE WHEN c.relnamespace = s.stxnamespace THEN c.relname END"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected statistics query to contain %q, got: %s", part, query)
+		}
+	}
+	if !strings.Contains(buildStatisticsDefinitionQuery(), "pg_get_statisticsobjdef(s.oid)") {
+		t.Error("Expected statistics definitions to be rendered with pg_get_statisticsobjdef")
+	}
+}
+
+func TestWithSequenceValue(t *testing.T) {
+	definition := "CREATE SEQUENCE public.users_id_seq\n    START WITH 1\n    NO CYCLE;\n"
+
+	// A mock current value of 42 makes the next nextval return 43
+	got := withSequenceValue(definition, "public", "users_id_seq", 42)
+	expected := "CREATE SEQUENCE public.users_id_seq\n    START WITH 1\n    NO CYCLE;\nSELECT setval('public.users_id_seq', 42, true);\n"
+	if got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// Names that need quoting are quoted inside the regclass literal
+	got = withSequenceValue("CREATE SEQUENCE x;", "App", "it's_seq", -5)
+	if !strings.HasSuffix(got, `SELECT setval('"App"."it''s_seq"', -5, true);`+"\n") {
+		t.Errorf("Unexpected setval for quoted names: %s", got)
+	}
+}
+
+func TestBuildSequenceValueQuery(t *testing.T) {
+	query := buildSequenceValueQuery()
+	if !strings.Contains(query, "last_value") || !strings.Contains(query, "FROM pg_sequences") {
+		t.Errorf("Expected sequence value query to read last_value from pg_sequences, got: %s", query)
+	}
+}
+
+// Test that foreign keys are left for the statements run once every table exists
+func TestBuildTableDefinitionQueryOmitsForeignKeys(t *testing.T) {
+	query := buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0)
+	if !strings.Contains(query, "c.contype != 'f'") || strings.Contains(query, "contype = 'f'") {
+		t.Errorf("Expected the table definition to leave out foreign keys, got: %s", query)
+	}
+}
+
+// Test the buildServerInfoQuery function
+func TestBuildServerInfoQuery(t *testing.T) {
+	query := buildServerInfoQuery()
+
+	expectedParts := []string{
+		"current_setting('server_version')",
+		"current_setting('server_encoding')",
+		"datcollate",
+		"datname = current_database()",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', but it doesn't", part)
+		}
+	}
+
+	// lc_collate was removed as a setting in PostgreSQL 16
+	if strings.Contains(query, "lc_collate") {
+		t.Error("Query should not rely on the lc_collate setting")
+	}
+}
+
+// Test that each definition source reads table columns and views from its own catalog
+func TestDefinitionSourceQueries(t *testing.T) {
+	catalogTable := buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0)
+	for _, part := range []string{"format_type(a.atttypid, a.atttypmod)", "FROM pg_attribute a", "a.attidentity <> ''", "NOT a.attisdropped"} {
+		if !strings.Contains(catalogTable, part) {
+			t.Errorf("Expected the pg_catalog table query to contain '%s'", part)
+		}
+	}
+	if strings.Contains(catalogTable, "information_schema") {
+		t.Error("Expected the pg_catalog table query not to read information_schema")
+	}
+	if !strings.Contains(buildTableDefinitionQuery(DefinitionSourceInformationSchema, 0), "FROM information_schema.columns") {
+		t.Error("Expected the information_schema table query to read information_schema.columns")
+	}
+
+	// information_schema.views yields a NULL view_definition for views the role doesn't
+	// own, so the default never consults it
+	catalogView := buildViewDefinitionQuery(DefinitionSourcePgCatalog)
+	if !strings.Contains(catalogView, "pg_get_viewdef(c.oid, true)") || strings.Contains(catalogView, "information_schema") {
+		t.Errorf("Expected the pg_catalog view query to use only pg_get_viewdef, got: %s", catalogView)
+	}
+	infoView := buildViewDefinitionQuery(DefinitionSourceInformationSchema)
+	if !strings.Contains(infoView, "FROM information_schema.views") || strings.Contains(infoView, "pg_get_viewdef") {
+		t.Errorf("Expected the information_schema view query to use only information_schema.views, got: %s", infoView)
+	}
+}
+
+// Test that FetchObjectDefinition runs the query of the chosen source
+func TestFetchObjectDefinitionSource(t *testing.T) {
+	for _, source := range DefinitionSources() {
+		t.Run(source, func(t *testing.T) {
+			results := make(map[string]scriptedResult)
+			for _, s := range DefinitionSources() {
+				results[buildTableDefinitionQuery(s, 0)] = scriptedResult{row: []driver.Value{"-- table from " + s}}
+				results[buildViewDefinitionQuery(s)] = scriptedResult{row: []driver.Value{"-- view from " + s}}
+			}
+			connector := newScriptedConnector(t, results)
+			connector.SetDefinitionSource(source)
+
+			for _, objType := range []types.ObjectType{types.TypeTable, types.TypeView} {
+				obj := &types.DBObject{Type: objType, Schema: "public", Name: "users"}
+				if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+					t.Fatalf("FetchObjectDefinition failed: %v", err)
+				}
+				if expected := "-- " + string(objType) + " from " + source; obj.Definition != expected {
+					t.Errorf("Expected %q, got %q", expected, obj.Definition)
+				}
+			}
+		})
+	}
+}
+
+// Test that a view whose definition information_schema hides is rendered with pg_get_viewdef
+func TestFetchViewDefinitionHiddenByInformationSchema(t *testing.T) {
+	const viewdef = "CREATE OR REPLACE VIEW public.totals AS\n SELECT 1 AS total;"
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildViewDefinitionQuery(DefinitionSourceInformationSchema): {row: []driver.Value{nil}},
+		buildViewDefinitionQuery(DefinitionSourcePgCatalog):         {row: []driver.Value{viewdef}},
+	})
+	connector.SetDefinitionSource(DefinitionSourceInformationSchema)
+
+	obj := &types.DBObject{Type: types.TypeView, Schema: "public", Name: "totals"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("Expected the pg_get_viewdef fallback to succeed, got %v", err)
+	}
+	if obj.Definition != viewdef {
+		t.Errorf("Expected the pg_get_viewdef definition, got %q", obj.Definition)
+	}
+
+	// With pg_catalog there is nothing to fall back to
+	connector = newScriptedConnector(t, map[string]scriptedResult{
+		buildViewDefinitionQuery(DefinitionSourcePgCatalog): {row: []driver.Value{nil}},
+	})
+	obj = &types.DBObject{Type: types.TypeView, Schema: "public", Name: "totals"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); stacktrace.GetCode(err) != ErrCodeNullDefinition {
+		t.Errorf("Expected a NULL definition error, got %v", err)
+	}
+}
+
+func TestBuildTableStatsQuery(t *testing.T) {
+	query := buildTableStatsQuery()
+	for _, part := range []string{"c.reltuples::bigint", "pg_total_relation_size(c.oid)", "c.reltoastrelid", "LIKE 'autovacuum\\_%'", "LEFT JOIN pg_stat_user_tables s", "c.relkind IN ('r', 'p')"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected table stats query to contain %q, got: %s", part, query)
+		}
+	}
+}
+
+func TestTriggerDefinition(t *testing.T) {
+	const create = "CREATE TRIGGER audit AFTER INSERT ON public.users FOR EACH ROW EXECUTE FUNCTION audit_fn()"
+	tests := []struct {
+		enabled  string
+		expected string
+	}{
+		{"O", create},
+		{"D", create + ";\nALTER TABLE public.users DISABLE TRIGGER audit;\n"},
+		{"R", create + ";\nALTER TABLE public.users ENABLE REPLICA TRIGGER audit;\n"},
+		{"A", create + ";\nALTER TABLE public.users ENABLE ALWAYS TRIGGER audit;\n"},
+	}
+	for _, tt := range tests {
+		if got := triggerDefinition(create, "public", "users", "audit", tt.enabled); got != tt.expected {
+			t.Errorf("tgenabled %q: expected:\n%s\ngot:\n%s", tt.enabled, tt.expected, got)
+		}
+	}
+
+	// Names that need quoting are quoted in the ALTER statement
+	got := triggerDefinition("CREATE TRIGGER x", "App", "Orders", "Audit Log", "D")
+	if !strings.HasSuffix(got, "ALTER TABLE \"App\".\"Orders\" DISABLE TRIGGER \"Audit Log\";\n") {
+		t.Errorf("Expected quoted identifiers, got:\n%s", got)
+	}
+}
+
+func TestFetchDisabledTrigger(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTriggerDefinitionQuery(): {row: []driver.Value{
+			"CREATE TRIGGER audit AFTER INSERT ON public.users FOR EACH ROW EXECUTE FUNCTION audit_fn()", "users", "D",
+		}},
+	})
+
+	obj := &types.DBObject{Type: types.TypeTrigger, Schema: "public", Name: "audit", TableName: "users"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	if !strings.Contains(obj.Definition, "\nALTER TABLE public.users DISABLE TRIGGER audit;") {
+		t.Errorf("Expected the disabled trigger to be disabled again after it is created, got:\n%s", obj.Definition)
+	}
+}
+
+// Test that triggers, policies and rules sharing a name on two tables each get their own
+// table's definition
+func TestFetchSameNamedTableObjects(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTriggerDefinitionQuery(): {byArgs: map[string]scriptedResult{
+			"public,audit,users":  {row: []driver.Value{"CREATE TRIGGER audit AFTER INSERT ON public.users FOR EACH ROW EXECUTE FUNCTION audit_fn()", "users", "O"}},
+			"public,audit,orders": {row: []driver.Value{"CREATE TRIGGER audit AFTER INSERT ON public.orders FOR EACH ROW EXECUTE FUNCTION audit_fn()", "orders", "O"}},
+		}},
+		buildPolicyDefinitionQuery(): {byArgs: map[string]scriptedResult{
+			"public,owner_only,users":  {row: []driver.Value{"CREATE POLICY owner_only ON public.users FOR ALL TO PUBLIC;"}},
+			"public,owner_only,orders": {row: []driver.Value{"CREATE POLICY owner_only ON public.orders FOR ALL TO PUBLIC;"}},
+		}},
+		buildRuleDefinitionQuery(): {byArgs: map[string]scriptedResult{
+			"public,no_delete,users":  {row: []driver.Value{"CREATE RULE no_delete AS ON DELETE TO public.users DO INSTEAD NOTHING;"}},
+			"public,no_delete,orders": {row: []driver.Value{"CREATE RULE no_delete AS ON DELETE TO public.orders DO INSTEAD NOTHING;"}},
+		}},
+	})
+
+	for _, objType := range []types.ObjectType{types.TypeTrigger, types.TypePolicy, types.TypeRule} {
+		name := map[types.ObjectType]string{types.TypeTrigger: "audit", types.TypePolicy: "owner_only", types.TypeRule: "no_delete"}[objType]
+		for _, table := range []string{"users", "orders"} {
+			obj := &types.DBObject{Type: objType, Schema: "public", Name: name, TableName: table}
+			if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+				t.Fatalf("FetchObjectDefinition failed for %s %s on %s: %v", objType, name, table, err)
+			}
+			if !strings.Contains(obj.Definition, " public."+table+" ") {
+				t.Errorf("Expected the %s %s of %s, got:\n%s", objType, name, table, obj.Definition)
+			}
+		}
+	}
+}
+
+func TestMaterializedViewDefinition(t *testing.T) {
+	// An unpopulated materialized view with storage parameters
+	got := materializedViewDefinition(matViewInfo{
+		schema:  "reporting",
+		name:    "daily_totals",
+		query:   " SELECT orders.day,\n    sum(orders.total) AS total\n   FROM orders\n  GROUP BY orders.day;",
+		options: "fillfactor=70, autovacuum_enabled=false",
+	})
+	expected := "CREATE MATERIALIZED VIEW reporting.daily_totals WITH (fillfactor=70, autovacuum_enabled=false) AS\n" +
+		"SELECT orders.day,\n    sum(orders.total) AS total\n   FROM orders\n  GROUP BY orders.day\n" +
+		"WITH NO DATA;"
+	if got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// A populated materialized view without storage parameters
+	got = materializedViewDefinition(matViewInfo{schema: "public", name: "Totals", query: " SELECT 1;", populated: true})
+	if expected := "CREATE MATERIALIZED VIEW public.\"Totals\" AS\nSELECT 1\nWITH DATA;"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestBuildMaterializedViewDefinitionQuery(t *testing.T) {
+	query := buildMaterializedViewDefinitionQuery()
+	for _, column := range []string{"pg_get_viewdef(c.oid, true)", "c.reloptions", "c.relispopulated", "c.relkind = 'm'"} {
+		if !strings.Contains(query, column) {
+			t.Errorf("Expected materialized view definition query to contain %q, got: %s", column, query)
+		}
+	}
+}
+
+// Test the buildWindowFunctionsQuery function
+func TestBuildWindowFunctionsQuery(t *testing.T) {
+	query := buildWindowFunctionsQuery()
+
+	// Window functions are identified by prokind = 'w'
+	if !strings.Contains(query, "p.prokind = 'w'") {
+		t.Errorf("Expected query to filter on prokind = 'w', got: %s", query)
+	}
+
+	// Rows must be reported as their own object type
+	if !strings.Contains(query, "'"+string(types.TypeWindowFunction)+"' as type") {
+		t.Errorf("Expected query to select type '%s', got: %s", types.TypeWindowFunction, query)
+	}
+}
+
+// Test that temporary tables are never listed and unlogged tables keep UNLOGGED
+func TestTablePersistence(t *testing.T) {
+	if !strings.Contains(buildTablesAndViewsQuery(), "c.relpersistence <> 't'") {
+		t.Error("Expected temporary tables to be excluded from the table listing")
+	}
+
+	query := buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0)
+	for _, part := range []string{"rel.relpersistence = 'u'", "THEN 'CREATE UNLOGGED TABLE ' ELSE 'CREATE TABLE ' END"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', got: %s", part, query)
+		}
+	}
+}
+
+// Test that exclusion constraints are listed alongside the other constraint kinds
+func TestBuildConstraintsQuery(t *testing.T) {
+	query := buildConstraintsQuery()
+
+	if !strings.Contains(query, "c.contype IN ('p', 'f', 'u', 'c', 'x')") {
+		t.Errorf("Expected query to include exclusion constraints (contype 'x'), got: %s", query)
+	}
+
+	// pg_get_constraintdef renders EXCLUDE USING gist (... WITH &&) verbatim
+	if !strings.Contains(query, "pg_get_constraintdef(c.oid, true) as definition") {
+		t.Errorf("Expected query to render definitions with pg_get_constraintdef, got: %s", query)
+	}
+}
+
+// Test that indexes created by a primary key, unique or exclusion constraint are not listed,
+// since replaying them after the table definition would fail
+func TestBuildIndexesQuerySkipsConstraintIndexes(t *testing.T) {
+	query := buildIndexesQuery()
+	if !strings.Contains(query, "con.conindid = i.indexrelid AND con.contype IN ('p', 'u', 'x')") {
+		t.Errorf("Expected constraint indexes to be skipped, got: %s", query)
+	}
+}
+
+// Test that partitions only list the indexes and constraints declared on them
+func TestPartitionLocalIndexesAndConstraints(t *testing.T) {
+	indexes := buildIndexesQuery()
+	if !strings.Contains(indexes, "t.relkind IN ('r', 'p')") {
+		t.Errorf("Expected indexes on partitioned tables to be listed, got: %s", indexes)
+	}
+	if !strings.Contains(indexes, "NOT EXISTS (SELECT 1 FROM pg_inherits inh WHERE inh.inhrelid = i.indexrelid)") {
+		t.Errorf("Expected partition copies of a parent index to be skipped, got: %s", indexes)
+	}
+
+	if !strings.Contains(buildConstraintsQuery(), "AND c.conislocal") {
+		t.Error("Expected constraints inherited from a parent table to be skipped")
+	}
+}
+
+// Test that every constraint rendering uses the pretty-printed form, which keeps
+// deferrability and NOT VALID attributes
+func TestConstraintDefinitionsArePretty(t *testing.T) {
+	for name, query := range map[string]string{
+		"constraints": buildConstraintsQuery(),
+		"table":       buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0),
+	} {
+		if !strings.Contains(query, "pg_get_constraintdef(c.oid, true)") {
+			t.Errorf("Expected %s query to call pg_get_constraintdef(c.oid, true)", name)
+		}
+		if strings.Contains(query, "pg_get_constraintdef(c.oid)") {
+			t.Errorf("Expected %s query not to call pg_get_constraintdef without the pretty flag", name)
+		}
+	}
+}
+
 // Test the FetchObjectsDefinitionsConcurrently function
 func TestFetchObjectsDefinitionsConcurrently(t *testing.T) {
 	// Create a mock connector
@@ -421,3 +1153,32 @@ func TestFetchObjectsDefinitionsConcurrently(t *testing.T) {
 		t.Errorf("Object with existing definition changed unexpectedly to: %s", results[2].Definition)
 	}
 }
+
+// Test that an object slower than the per-object timeout fails alone
+func TestFetchObjectsDefinitionsObjectTimeout(t *testing.T) {
+	createTable := "CREATE TABLE public.users (\n    id integer\n);"
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0): {row: []driver.Value{createTable}},
+		buildViewDefinitionQuery(DefinitionSourcePgCatalog):     {row: []driver.Value{"SELECT 1;"}, delay: time.Minute},
+	})
+	connector.SetObjectTimeout(50 * time.Millisecond)
+
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeView, Schema: "public", Name: "slow_report"},
+	}
+	start := time.Now()
+	results, failed, err := connector.FetchObjectsDefinitionsConcurrently(context.Background(), objects, 2)
+	if err != nil {
+		t.Fatalf("Expected the run to survive a slow object, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the slow object to be abandoned after its timeout, took %s", elapsed)
+	}
+	if len(failed) != 1 || failed[0] != objects[1].Key() {
+		t.Errorf("Expected only the slow view to fail, got %v", failed)
+	}
+	if results[0].Definition != createTable {
+		t.Errorf("Expected the table definition to be fetched, got:\n%s", results[0].Definition)
+	}
+}
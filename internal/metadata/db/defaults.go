@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// columnDefault is a column's DEFAULT expression as pg_get_expr renders it
+type columnDefault struct {
+	name       string
+	columnType string // format_type of the column, including its type modifier
+	expression string
+}
+
+// SetNormalizeDefaults makes table definitions drop casts from column defaults that the
+// column's type makes redundant, such as 'active'::character varying on a varchar column.
+// This is purely cosmetic: the normalized default evaluates to the same value.
+func (c *Connector) SetNormalizeDefaults(enabled bool) {
+	c.normalizeDefaults = enabled
+}
+
+// buildColumnDefaultsQuery creates the SQL query for the defaults of a table's columns.
+// Generated columns are left out on servers of serverVersionNum that have them, since their
+// expression is not a default.
+func buildColumnDefaultsQuery(serverVersionNum int) string {
+	notGenerated := ""
+	if hasGeneratedColumns(serverVersionNum) {
+		notGenerated = "AND a.attgenerated = ''"
+	}
+	return strings.TrimSpace(`
+		SELECT a.attname, format_type(a.atttypid, a.atttypmod), pg_get_expr(d.adbin, d.adrelid)
+		FROM pg_attrdef d
+		JOIN pg_attribute a ON a.attrelid = d.adrelid AND a.attnum = d.adnum
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2
+		` + notGenerated + `
+		AND NOT a.attisdropped
+		ORDER BY a.attnum
+	`)
+}
+
+// typeModifier matches the modifier of a type name, such as the (40) of character varying(40)
+var typeModifier = regexp.MustCompile(`\([^)]*\)`)
+
+// nextvalDefault matches the default of a serial column, nextval('seq'::regclass)
+var nextvalDefault = regexp.MustCompile(`^nextval\(('(?:[^']|'')*')::regclass\)$`)
+
+// normalizeDefault drops a cast from a column default when it adds nothing: a string literal
+// cast to the column's own type, which the literal is coerced to anyway, or the regclass cast
+// of nextval's argument. Any other expression is returned unchanged.
+func normalizeDefault(expression, columnType string) string {
+	if m := nextvalDefault.FindStringSubmatch(expression); m != nil {
+		return "nextval(" + m[1] + ")"
+	}
+
+	literal, castType, ok := splitLiteralCast(expression)
+	if !ok {
+		return expression
+	}
+	// Casts leave out type modifiers, and assigning to the column applies them regardless
+	if typeModifier.ReplaceAllString(castType, "") != typeModifier.ReplaceAllString(columnType, "") {
+		return expression
+	}
+	return literal
+}
+
+// splitLiteralCast splits an expression that is exactly one string literal and a cast,
+// such as 'active'::text, into the quoted literal and the type name
+func splitLiteralCast(expression string) (literal, castType string, ok bool) {
+	if !strings.HasPrefix(expression, "'") {
+		return "", "", false
+	}
+	for i := 1; i < len(expression); i++ {
+		if expression[i] != '\'' {
+			continue
+		}
+		if i+1 < len(expression) && expression[i+1] == '\'' {
+			i++ // A doubled quote inside the literal
+			continue
+		}
+		castType, ok = strings.CutPrefix(expression[i+1:], "::")
+		if !ok || castType == "" || strings.Contains(castType, "::") {
+			return "", "", false
+		}
+		return expression[:i+1], castType, true
+	}
+	return "", "", false
+}
+
+// fetchColumnDefaults returns the defaults of a table's columns
+func (c *Connector) fetchColumnDefaults(ctx context.Context, obj *types.DBObject) ([]columnDefault, error) {
+	rows, err := c.db.QueryContext(ctx, buildColumnDefaultsQuery(c.serverVersionNum), obj.Schema, obj.Name)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query column defaults of %s.%s", obj.Schema, obj.Name)
+	}
+	defer rows.Close()
+
+	var defaults []columnDefault
+	for rows.Next() {
+		var d columnDefault
+		if err := rows.Scan(&d.name, &d.columnType, &d.expression); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan column defaults of %s.%s", obj.Schema, obj.Name)
+		}
+		defaults = append(defaults, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error iterating column defaults of %s.%s", obj.Schema, obj.Name)
+	}
+	return defaults, nil
+}
+
+// normalizeTableDefaults rewrites the DEFAULT clauses of a CREATE TABLE statement with
+// normalizeDefault. Each column is declared on its own line ending in its default, so only
+// a line declaring that column and ending in exactly that default is changed.
+func normalizeTableDefaults(definition string, defaults []columnDefault) string {
+	lines := strings.Split(definition, "\n")
+	for _, d := range defaults {
+		normalized := normalizeDefault(d.expression, d.columnType)
+		if normalized == d.expression {
+			continue
+		}
+		prefix := "    " + quoteIdent(d.name) + " "
+		for i, line := range lines {
+			if !strings.HasPrefix(line, prefix) {
+				continue
+			}
+			body, comma := strings.CutSuffix(line, ",")
+			if rest, found := strings.CutSuffix(body, " DEFAULT "+d.expression); found {
+				lines[i] = rest + " DEFAULT " + normalized
+				if comma {
+					lines[i] += ","
+				}
+			}
+			break
+		}
+	}
+	return strings.Join(lines, "\n")
+}
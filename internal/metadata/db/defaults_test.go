@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestNormalizeDefault(t *testing.T) {
+	tests := []struct {
+		expression string
+		columnType string
+		expected   string
+	}{
+		// Redundant: the literal is coerced to the column's type anyway
+		{"'active'::character varying", "character varying(20)", "'active'"},
+		{"'it''s'::text", "text", "'it''s'"},
+		{"'{}'::text[]", "text[]", "'{}'"},
+		{"'-1'::integer", "integer", "'-1'"},
+		{"nextval('orders_id_seq'::regclass)", "integer", "nextval('orders_id_seq')"},
+		{`nextval('"Billing".ids'::regclass)`, "bigint", `nextval('"Billing".ids')`},
+		// Not redundant: the cast is to another type, or part of a larger expression
+		{"'2024-01-01'::date", "timestamp without time zone", "'2024-01-01'::date"},
+		{"'x'::bpchar", "character(1)", "'x'::bpchar"},
+		{"('a'::text || 'b'::text)", "text", "('a'::text || 'b'::text)"},
+		{"'a'::text || 'b'", "text", "'a'::text || 'b'"},
+		{"'1 day'::interval::text", "text", "'1 day'::interval::text"},
+		{"now()::date", "date", "now()::date"},
+		{"CURRENT_TIMESTAMP", "timestamp with time zone", "CURRENT_TIMESTAMP"},
+		{"0", "integer", "0"},
+		{"nextval('a'::regclass) + 1", "integer", "nextval('a'::regclass) + 1"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeDefault(tt.expression, tt.columnType); got != tt.expected {
+			t.Errorf("normalizeDefault(%q, %q) = %q, expected %q", tt.expression, tt.columnType, got, tt.expected)
+		}
+	}
+}
+
+func TestFetchTableDefinitionNormalizeDefaults(t *testing.T) {
+	createTable := "CREATE TABLE public.accounts (\n" +
+		"    id integer NOT NULL DEFAULT nextval('accounts_id_seq'::regclass),\n" +
+		"    status character varying(20) DEFAULT 'active'::character varying,\n" +
+		"    opened date DEFAULT '2024-01-01'::date,\n" +
+		"    CONSTRAINT accounts_pkey PRIMARY KEY (id)\n" +
+		");"
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0): {row: []driver.Value{createTable}},
+		buildColumnDefaultsQuery(0): {rows: [][]driver.Value{
+			{"id", "integer", "nextval('accounts_id_seq'::regclass)"},
+			{"status", "character varying(20)", "'active'::character varying"},
+			{"opened", "date", "'2024-01-01'::date"},
+		}},
+	})
+	connector.SetNormalizeDefaults(true)
+
+	obj := &types.DBObject{Type: types.TypeTable, Schema: "public", Name: "accounts"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	expected := "CREATE TABLE public.accounts (\n" +
+		"    id integer NOT NULL DEFAULT nextval('accounts_id_seq'),\n" +
+		"    status character varying(20) DEFAULT 'active',\n" +
+		"    opened date DEFAULT '2024-01-01',\n" +
+		"    CONSTRAINT accounts_pkey PRIMARY KEY (id)\n" +
+		");"
+	if obj.Definition != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, obj.Definition)
+	}
+}
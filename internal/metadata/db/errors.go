@@ -0,0 +1,68 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// The error types below are the root cause of the stacktrace errors this package returns
+// for the failures callers most often handle, so an embedder can branch on them with
+// errors.As(stacktrace.RootCause(err), &target). stacktrace errors do not unwrap, which is
+// why the root cause must be taken first. Each type unwraps to the driver or system error
+// behind it.
+
+// ConnectionError reports that the database could not be reached
+type ConnectionError struct {
+	Msg string // What went wrong, when Err alone does not say
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	if e.Msg == "" {
+		return e.Err.Error()
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaNotFoundError reports selected schemas that do not exist in the database
+type SchemaNotFoundError struct {
+	Schemas []string
+}
+
+func (e *SchemaNotFoundError) Error() string {
+	return fmt.Sprintf("Schema does not exist: %s", strings.Join(e.Schemas, ", "))
+}
+
+// DefinitionError reports that the definition of an object could not be fetched, and why
+type DefinitionError struct {
+	Object types.ObjectKey
+	Kind   FailureKind
+	Err    error
+}
+
+func (e *DefinitionError) Error() string {
+	return stacktrace.RootCause(e.Err).Error()
+}
+
+func (e *DefinitionError) Unwrap() error {
+	return stacktrace.RootCause(e.Err)
+}
+
+// connectionError wraps err, from connecting to the database, in a ConnectionError
+func connectionError(err error, msg string, format string, args ...interface{}) error {
+	return stacktrace.PropagateWithCode(&ConnectionError{Msg: msg, Err: err}, ErrCodeConnection, format, args...)
+}
+
+// definitionError wraps err, from fetching the definition of obj, in a DefinitionError,
+// keeping its error code
+func definitionError(obj *types.DBObject, err error) error {
+	defErr := &DefinitionError{Object: obj.Key(), Kind: ClassifyFetchError(err), Err: err}
+	return stacktrace.PropagateWithCode(defErr, stacktrace.GetCode(err), "Failed to fetch definition for %s %s.%s", obj.Type, obj.Schema, obj.Name)
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestConnectionErrorAs(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "client.key")
+	tests := []struct {
+		name string
+		err  func() error
+	}{
+		{"invalid URL", func() error {
+			_, err := New("postgres://%zz", Options{})
+			return err
+		}},
+		{"unreadable key", func() error {
+			_, err := withTLSFiles("dbname=app", TLSFiles{Key: missing})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		err := tt.err()
+		var connErr *ConnectionError
+		if !errors.As(stacktrace.RootCause(err), &connErr) {
+			t.Errorf("%s: expected a ConnectionError, got %v", tt.name, err)
+			continue
+		}
+		if stacktrace.GetCode(err) != ErrCodeConnection {
+			t.Errorf("%s: expected code %v, got %v", tt.name, ErrCodeConnection, stacktrace.GetCode(err))
+		}
+	}
+
+	_, err := withTLSFiles("dbname=app", TLSFiles{Key: missing})
+	if !errors.Is(stacktrace.RootCause(err), os.ErrNotExist) {
+		t.Errorf("Expected the ConnectionError to unwrap to os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestSchemaNotFoundErrorAs(t *testing.T) {
+	// Unscripted queries return no rows, so no selected schema exists
+	connector := newScriptedConnector(t, map[string]scriptedResult{})
+	_, err := connector.QueryObjects(context.Background(), types.QueryOptions{Schemas: []string{"public", "app"}})
+
+	var schemaErr *SchemaNotFoundError
+	if !errors.As(stacktrace.RootCause(err), &schemaErr) {
+		t.Fatalf("Expected a SchemaNotFoundError, got %v", err)
+	}
+	if !slices.Equal(schemaErr.Schemas, []string{"public", "app"}) {
+		t.Errorf("Expected the missing schemas [public app], got %v", schemaErr.Schemas)
+	}
+	if got := schemaErr.Error(); got != "Schema does not exist: public, app" {
+		t.Errorf("Unexpected message: %s", got)
+	}
+}
+
+func TestDefinitionErrorAs(t *testing.T) {
+	view := types.DBObject{Type: types.TypeView, Schema: "public", Name: "totals"}
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildViewDefinitionQuery(DefinitionSourcePgCatalog): {err: &pq.Error{Code: "42501", Message: "permission denied for view totals"}},
+	})
+	err := connector.FetchObjectDefinition(context.Background(), &view)
+
+	var defErr *DefinitionError
+	if !errors.As(stacktrace.RootCause(err), &defErr) {
+		t.Fatalf("Expected a DefinitionError, got %v", err)
+	}
+	if defErr.Object != view.Key() {
+		t.Errorf("Expected the error for %v, got %v", view.Key(), defErr.Object)
+	}
+	if defErr.Kind != FailurePermissionDenied {
+		t.Errorf("Expected kind %q, got %q", FailurePermissionDenied, defErr.Kind)
+	}
+	if ClassifyFetchError(err) != FailurePermissionDenied {
+		t.Errorf("Expected the wrapped error to classify as %q, got %q", FailurePermissionDenied, ClassifyFetchError(err))
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(stacktrace.RootCause(err), &pqErr) || pqErr.Code != "42501" {
+		t.Errorf("Expected the DefinitionError to unwrap to the driver error, got %v", err)
+	}
+}
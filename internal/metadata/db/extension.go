@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// buildExtensionMembersQuery creates the SQL query for the relations and routines in the given
+// schemas, and the languages, that were created by an extension. CREATE EXTENSION restores
+// them, so exporting them as well would make the export fail to replay. Rows are keyed like
+// the comment tag query.
+func buildExtensionMembersQuery() string {
+	return strings.TrimSpace(`
+		SELECT 'relation', n.nspname, c.relname
+		FROM pg_depend d
+		JOIN pg_class c ON d.classid = 'pg_class'::regclass AND d.objid = c.oid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE d.deptype = 'e' AND n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'routine', n.nspname, p.proname
+		FROM pg_depend d
+		JOIN pg_proc p ON d.classid = 'pg_proc'::regclass AND d.objid = p.oid
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE d.deptype = 'e' AND n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'language', '', l.lanname
+		FROM pg_depend d
+		JOIN pg_language l ON d.classid = 'pg_language'::regclass AND d.objid = l.oid
+		WHERE d.deptype = 'e'
+	`)
+}
+
+// excludeExtensionMembers drops the objects created by an extension, and the indexes,
+// constraints and other objects of tables created by one. The schema-qualified names in
+// except are kept anyway, along with the objects of an excepted table.
+func (c *Connector) excludeExtensionMembers(ctx context.Context, objects []types.DBObject, schemas []string, except []string) ([]types.DBObject, error) {
+	rows, err := c.db.QueryContext(ctx, buildExtensionMembersQuery(), pq.Array(schemas))
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query extension members")
+	}
+	defer rows.Close()
+
+	members := make(map[commentKey]bool)
+	for rows.Next() {
+		var key commentKey
+		if err := rows.Scan(&key.kind, &key.schema, &key.name); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan extension member row")
+		}
+		members[key] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read extension members")
+	}
+
+	excepted := make(map[string]bool, len(except))
+	for _, name := range except {
+		excepted[name] = true
+	}
+
+	kept := make([]types.DBObject, 0, len(objects))
+	for _, obj := range objects {
+		member := members[commentLookupKey(obj)]
+		exception := excepted[obj.Schema+"."+obj.Name]
+		if obj.TableName != "" {
+			member = member || members[commentKey{kind: "relation", schema: obj.Schema, name: obj.TableName}]
+			exception = exception || excepted[obj.Schema+"."+obj.TableName]
+		}
+		if member && !exception {
+			log.Debug("Skipping %s %s.%s, which belongs to an extension", obj.Type, obj.Schema, obj.Name)
+			continue
+		}
+		kept = append(kept, obj)
+	}
+	if skipped := len(objects) - len(kept); skipped > 0 {
+		log.Info("Skipped %d objects that belong to an extension", skipped)
+	}
+	return kept, nil
+}
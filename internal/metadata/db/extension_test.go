@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestExcludeExtensionMembers(t *testing.T) {
+	// PostGIS creates spatial_ref_sys, its primary key and many functions in public
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildExtensionMembersQuery(): {rows: [][]driver.Value{
+			{"relation", "public", "spatial_ref_sys"},
+			{"relation", "public", "geography_columns"},
+			{"routine", "public", "st_area"},
+			{"routine", "public", "st_buffer"},
+			{"language", "", "plpgsql"},
+		}},
+	})
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "parcels"},
+		{Type: types.TypeTable, Schema: "public", Name: "spatial_ref_sys"},
+		{Type: types.TypeConstraint, Schema: "public", Name: "spatial_ref_sys_pkey", TableName: "spatial_ref_sys"},
+		{Type: types.TypeView, Schema: "public", Name: "geography_columns"},
+		{Type: types.TypeFunction, Schema: "public", Name: "st_area"},
+		{Type: types.TypeFunction, Schema: "public", Name: "st_buffer"},
+		{Type: types.TypeFunction, Schema: "public", Name: "parcel_area"},
+		{Type: types.TypeLanguage, Name: "plpgsql"},
+	}
+
+	// spatial_ref_sys was modified on purpose, so it and its constraint are exported anyway
+	kept, err := connector.excludeExtensionMembers(context.Background(), objects, []string{"public"}, []string{"public.spatial_ref_sys"})
+	if err != nil {
+		t.Fatalf("excludeExtensionMembers failed: %v", err)
+	}
+
+	want := []types.DBObject{objects[0], objects[1], objects[2], objects[6]}
+	if len(kept) != len(want) {
+		t.Fatalf("Expected %d objects, got %v", len(want), kept)
+	}
+	for i := range want {
+		if kept[i] != want[i] {
+			t.Errorf("Expected %+v at %d, got %+v", want[i], i, kept[i])
+		}
+	}
+}
+
+func TestBuildExtensionMembersQuery(t *testing.T) {
+	query := buildExtensionMembersQuery()
+	for _, part := range []string{"d.deptype = 'e'", "n.nspname = ANY($1)", "'pg_language'::regclass"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', got: %s", part, query)
+		}
+	}
+}
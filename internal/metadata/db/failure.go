@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// Codes of errors callers tell apart with stacktrace.GetCode
+const (
+	// ErrCodeNotFound marks errors for objects whose definition the catalogs no longer have
+	ErrCodeNotFound stacktrace.ErrorCode = iota + 1
+	// ErrCodeConnection marks errors connecting to the database
+	ErrCodeConnection
+	// ErrCodeNullDefinition marks errors for objects whose definition the catalogs returned as NULL
+	ErrCodeNullDefinition
+)
+
+// definitionRetryDelay is how long to wait before fetching a missing definition again
+var definitionRetryDelay = 250 * time.Millisecond
+
+// FailureKind classifies why the definition of an object could not be fetched
+type FailureKind string
+
+// Kinds of definition fetch failures
+const (
+	FailureNotFound         FailureKind = "not found"         // The object was dropped since it was listed
+	FailurePermissionDenied FailureKind = "permission denied" // The role may not inspect the object
+	FailureTimeout          FailureKind = "timeout"           // The fetch ran out of time
+	FailureOther            FailureKind = "error"             // Anything else
+)
+
+// noDefinitionError reports that the catalogs returned no definition for obj
+func noDefinitionError(obj *types.DBObject) error {
+	return stacktrace.NewErrorWithCode(ErrCodeNotFound, "No definition found for %s.%s of type %s", obj.Schema, obj.Name, obj.Type)
+}
+
+// nullDefinitionError reports that the catalogs returned a NULL definition for obj
+func nullDefinitionError(obj *types.DBObject) error {
+	return stacktrace.NewErrorWithCode(ErrCodeNullDefinition, "Definition is NULL for %s.%s of type %s", obj.Schema, obj.Name, obj.Type)
+}
+
+// definitionMissing reports whether err is the catalogs having no definition for an object
+func definitionMissing(err error) bool {
+	code := stacktrace.GetCode(err)
+	return code == ErrCodeNotFound || code == ErrCodeNullDefinition
+}
+
+// fetchDefinitionRetryingMissing fetches the definition of obj, fetching it once more
+// after definitionRetryDelay if the catalogs had none. On a busy server a materialized
+// view being refreshed or a function being replaced between listing and fetching can
+// briefly have no definition; an object that was really dropped still has none the
+// second time.
+func (c *Connector) fetchDefinitionRetryingMissing(ctx context.Context, obj *types.DBObject) error {
+	err := c.FetchObjectDefinition(ctx, obj)
+	if err == nil || !definitionMissing(err) {
+		return err
+	}
+	log.Debug("No definition for %s %s.%s yet, retrying once: %v", obj.Type, obj.Schema, obj.Name, err)
+	select {
+	case <-time.After(definitionRetryDelay):
+	case <-ctx.Done():
+		return err
+	}
+	return c.FetchObjectDefinition(ctx, obj)
+}
+
+// ClassifyFetchError tells apart the reasons fetching a definition fails: a missing object,
+// a role lacking the privilege to inspect it, as with pg_get_functiondef on a SECURITY
+// DEFINER function owned by another role on a read replica, a timeout, or anything else
+func ClassifyFetchError(err error) FailureKind {
+	var defErr *DefinitionError
+	if errors.As(stacktrace.RootCause(err), &defErr) {
+		return defErr.Kind
+	}
+	if definitionMissing(err) {
+		return FailureNotFound
+	}
+	cause := stacktrace.RootCause(err)
+	if cause == context.DeadlineExceeded {
+		return FailureTimeout
+	}
+	if pqErr, ok := cause.(*pq.Error); ok {
+		switch pqErr.Code.Name() {
+		case "insufficient_privilege":
+			return FailurePermissionDenied
+		case "query_canceled":
+			return FailureTimeout
+		case "undefined_table", "undefined_object", "undefined_function":
+			return FailureNotFound
+		}
+	}
+	return FailureOther
+}
+
+// recordFailure remembers why the definition of the object with key could not be fetched
+func (c *Connector) recordFailure(key types.ObjectKey, kind FailureKind) {
+	c.failuresMu.Lock()
+	defer c.failuresMu.Unlock()
+	if c.failures == nil {
+		c.failures = make(map[types.ObjectKey]FailureKind)
+	}
+	c.failures[key] = kind
+}
+
+// FetchFailureKind returns why FetchObjectsDefinitionsConcurrently failed to fetch the
+// definition of the object with key, or "" if it did not fail
+func (c *Connector) FetchFailureKind(key types.ObjectKey) FailureKind {
+	c.failuresMu.Lock()
+	defer c.failuresMu.Unlock()
+	return c.failures[key]
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestClassifyFetchError(t *testing.T) {
+	obj := &types.DBObject{Type: types.TypeView, Schema: "public", Name: "totals"}
+	tests := []struct {
+		name string
+		err  error
+		want FailureKind
+	}{
+		{"no definition", noDefinitionError(obj), FailureNotFound},
+		{"propagated no definition", stacktrace.Propagate(noDefinitionError(obj), "Failed to export"), FailureNotFound},
+		{"null definition", nullDefinitionError(obj), FailureNotFound},
+		{"permission denied", stacktrace.Propagate(&pq.Error{Code: "42501"}, "Database error"), FailurePermissionDenied},
+		{"statement timeout", &pq.Error{Code: "57014"}, FailureTimeout},
+		{"deadline", stacktrace.Propagate(context.DeadlineExceeded, "Database error"), FailureTimeout},
+		{"dropped relation", &pq.Error{Code: "42P01"}, FailureNotFound},
+		{"syntax error", &pq.Error{Code: "42601"}, FailureOther},
+		{"other", stacktrace.NewError("connection reset"), FailureOther},
+	}
+	for _, tt := range tests {
+		if got := ClassifyFetchError(tt.err); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestFetchFailureKind(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0): {row: []driver.Value{"CREATE TABLE public.users ();"}},
+		buildViewDefinitionQuery(DefinitionSourcePgCatalog):     {err: &pq.Error{Code: "42501", Message: "permission denied for view totals"}},
+	})
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeView, Schema: "public", Name: "totals"},
+	}
+
+	_, failed, err := connector.FetchObjectsDefinitionsConcurrently(context.Background(), objects, 2)
+	if err != nil {
+		t.Fatalf("FetchObjectsDefinitionsConcurrently failed: %v", err)
+	}
+	if len(failed) != 1 || failed[0] != objects[1].Key() {
+		t.Fatalf("Expected only the view to fail, got %v", failed)
+	}
+	if kind := connector.FetchFailureKind(objects[1].Key()); kind != FailurePermissionDenied {
+		t.Errorf("Expected the view to fail with %q, got %q", FailurePermissionDenied, kind)
+	}
+	if kind := connector.FetchFailureKind(objects[0].Key()); kind != "" {
+		t.Errorf("Expected no failure for the table, got %q", kind)
+	}
+}
+
+func TestFetchRetriesMissingDefinitionOnce(t *testing.T) {
+	definitionRetryDelay = 0
+	t.Cleanup(func() { definitionRetryDelay = 250 * time.Millisecond })
+	matView := types.DBObject{Type: types.TypeMaterializedView, Schema: "public", Name: "daily_totals"}
+	populated := []driver.Value{" SELECT 1 AS total;", "", true}
+
+	t.Run("missing once", func(t *testing.T) {
+		// The first fetch finds nothing, as while the materialized view is being replaced
+		connector := newScriptedConnector(t, map[string]scriptedResult{
+			buildMaterializedViewDefinitionQuery(): {next: []scriptedResult{{row: populated}}},
+		})
+		results, failed, err := connector.FetchObjectsDefinitionsConcurrently(context.Background(), []types.DBObject{matView}, 1)
+		if err != nil {
+			t.Fatalf("FetchObjectsDefinitionsConcurrently failed: %v", err)
+		}
+		if len(failed) != 0 {
+			t.Fatalf("Expected the retry to fetch the definition, got failures %v", failed)
+		}
+		if !strings.Contains(results[0].Definition, "CREATE MATERIALIZED VIEW") {
+			t.Errorf("Expected the materialized view's definition, got:\n%s", results[0].Definition)
+		}
+	})
+
+	t.Run("NULL once", func(t *testing.T) {
+		connector := newScriptedConnector(t, map[string]scriptedResult{
+			buildMaterializedViewDefinitionQuery(): {row: []driver.Value{nil, "", true}, next: []scriptedResult{{row: populated}}},
+		})
+		_, failed, err := connector.FetchObjectsDefinitionsConcurrently(context.Background(), []types.DBObject{matView}, 1)
+		if err != nil {
+			t.Fatalf("FetchObjectsDefinitionsConcurrently failed: %v", err)
+		}
+		if len(failed) != 0 {
+			t.Errorf("Expected the retry to fetch the definition, got failures %v", failed)
+		}
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		connector := newScriptedConnector(t, map[string]scriptedResult{})
+		_, failed, err := connector.FetchObjectsDefinitionsConcurrently(context.Background(), []types.DBObject{matView}, 1)
+		if err != nil {
+			t.Fatalf("FetchObjectsDefinitionsConcurrently failed: %v", err)
+		}
+		if len(failed) != 1 {
+			t.Fatalf("Expected the dropped materialized view to fail after its retry, got %v", failed)
+		}
+		if kind := connector.FetchFailureKind(matView.Key()); kind != FailureNotFound {
+			t.Errorf("Expected %q, got %q", FailureNotFound, kind)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"regexp"
+)
+
+// nameFilter decides which queried objects are kept, either by regex on the
+// object name or by an exact set of schema-qualified names
+type nameFilter struct {
+	pattern *regexp.Regexp
+	names   map[string]bool
+}
+
+// newNameFilter creates a filter; when names is non-empty it replaces the regex
+func newNameFilter(pattern *regexp.Regexp, names []string) *nameFilter {
+	f := &nameFilter{pattern: pattern}
+	if len(names) > 0 {
+		f.names = make(map[string]bool, len(names))
+		for _, name := range names {
+			f.names[name] = true
+		}
+	}
+	return f
+}
+
+// matches reports whether the object schema.name passes the filter
+func (f *nameFilter) matches(schema, name string) bool {
+	if f.names != nil {
+		return f.names[schema+"."+name]
+	}
+	return f.pattern.MatchString(name)
+}
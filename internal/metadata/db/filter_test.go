@@ -0,0 +1,37 @@
+package db
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNameFilterRegex(t *testing.T) {
+	filter := newNameFilter(regexp.MustCompile("^user"), nil)
+
+	if !filter.matches("public", "users") {
+		t.Error("Expected regex filter to match 'users'")
+	}
+	if filter.matches("public", "orders") {
+		t.Error("Expected regex filter not to match 'orders'")
+	}
+}
+
+func TestNameFilterNames(t *testing.T) {
+	// Exact names bypass the regex entirely
+	filter := newNameFilter(regexp.MustCompile("^$"), []string{"public.users", "app.get_product"})
+
+	if !filter.matches("public", "users") {
+		t.Error("Expected name filter to match public.users")
+	}
+	if !filter.matches("app", "get_product") {
+		t.Error("Expected name filter to match app.get_product")
+	}
+
+	// Names are schema-qualified, so the same name in another schema is not matched
+	if filter.matches("app", "users") {
+		t.Error("Expected name filter not to match app.users")
+	}
+	if filter.matches("public", "users_idx") {
+		t.Error("Expected name filter not to match a partial name")
+	}
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// functionInfo holds what is needed to recreate a function without pg_get_functiondef
+type functionInfo struct {
+	schema          string
+	name            string
+	arguments       string // pg_get_function_arguments, which keeps DEFAULT values and VARIADIC
+	result          string
+	language        string
+	source          string // prosrc: the body, or the symbol name for C functions
+	binary          string // probin: the library of C functions, empty otherwise
+	volatility      string // provolatile: 'i', 's' or 'v'
+	strict          bool
+	securityDefiner bool
+	config          []string // proconfig: settings such as search_path=public, applied while it runs
+}
+
+// buildFunctionDefinitionQuery creates the SQL query for a function's complete definition
+// and the configuration settings attached to it, such as search_path
+func buildFunctionDefinitionQuery() string {
+	return strings.TrimSpace(`
+		SELECT pg_get_functiondef(p.oid), p.proconfig
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = $1 AND p.proname = $2
+	`)
+}
+
+// buildFunctionFallbackQuery creates the SQL query for the catalog fields functionDefinition
+// renders. pg_get_function_arguments is used rather than the raw argument types because it
+// renders argument names, modes, DEFAULT expressions and VARIADIC exactly as declared.
+func buildFunctionFallbackQuery() string {
+	return strings.TrimSpace(`
+		SELECT
+			pg_get_function_arguments(p.oid),
+			pg_get_function_result(p.oid),
+			l.lanname,
+			p.prosrc,
+			COALESCE(p.probin, ''),
+			p.provolatile,
+			p.proisstrict,
+			p.prosecdef,
+			p.proconfig
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		JOIN pg_language l ON l.oid = p.prolang
+		WHERE n.nspname = $1 AND p.proname = $2
+		AND p.prokind = 'f'
+	`)
+}
+
+// dollarQuote wraps body in a dollar-quoted string whose tag does not occur in the body
+func dollarQuote(body string) string {
+	tag := "$function$"
+	for i := 1; strings.Contains(body, tag); i++ {
+		tag = fmt.Sprintf("$function%d$", i)
+	}
+	return tag + body + tag
+}
+
+// quoteLiteral quotes s as a standard SQL string literal
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// functionDefinition renders a CREATE OR REPLACE FUNCTION statement laid out like
+// pg_get_functiondef's output
+func functionDefinition(fn functionInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE OR REPLACE FUNCTION %s.%s(%s)\n", quoteIdent(fn.schema), quoteIdent(fn.name), fn.arguments)
+	fmt.Fprintf(&b, " RETURNS %s\n", fn.result)
+	fmt.Fprintf(&b, " LANGUAGE %s\n", quoteIdent(fn.language))
+
+	var attributes []string
+	switch fn.volatility {
+	case "i":
+		attributes = append(attributes, "IMMUTABLE")
+	case "s":
+		attributes = append(attributes, "STABLE")
+	}
+	if fn.strict {
+		attributes = append(attributes, "STRICT")
+	}
+	if fn.securityDefiner {
+		attributes = append(attributes, "SECURITY DEFINER")
+	}
+	if len(attributes) > 0 {
+		fmt.Fprintf(&b, " %s\n", strings.Join(attributes, " "))
+	}
+	for _, setting := range fn.config {
+		name, value, _ := strings.Cut(setting, "=")
+		fmt.Fprintf(&b, " SET %s TO %s\n", name, quoteLiteral(value))
+	}
+
+	switch fn.language {
+	case "c":
+		fmt.Fprintf(&b, "AS %s, %s\n", quoteLiteral(fn.binary), quoteLiteral(fn.source))
+	case "internal":
+		fmt.Fprintf(&b, "AS %s\n", quoteLiteral(fn.source))
+	default:
+		fmt.Fprintf(&b, "AS %s\n", dollarQuote(fn.source))
+	}
+	return b.String()
+}
+
+// functionDefUnavailable reports whether a pg_get_functiondef failure means the function
+// cannot be used on this server, as on some replicas and restricted roles, rather than
+// the query failing for another reason
+func functionDefUnavailable(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return false
+	}
+	switch pqErr.Code.Name() {
+	case "undefined_function", "insufficient_privilege":
+		return true
+	}
+	return false
+}
+
+// fetchFunctionDefinition fetches a function's definition with pg_get_functiondef, falling
+// back to rendering it from the catalogs when pg_get_functiondef is unavailable or returns NULL.
+// The search_path the function sets goes to obj.SearchPath.
+func (c *Connector) fetchFunctionDefinition(ctx context.Context, obj *types.DBObject) error {
+	var definition sql.NullString
+	var config pq.StringArray
+	err := c.db.QueryRowContext(ctx, buildFunctionDefinitionQuery(), obj.Schema, obj.Name).Scan(&definition, &config)
+	switch {
+	case err == sql.ErrNoRows:
+		return noDefinitionError(obj)
+	case err != nil && !functionDefUnavailable(err):
+		return stacktrace.Propagate(err, "Database error when fetching definition for %s.%s", obj.Schema, obj.Name)
+	case err == nil && definition.Valid:
+		obj.Definition = definition.String
+		obj.SearchPath = searchPathSetting(config)
+		return c.enforceDefinitionSize(obj)
+	}
+
+	log.Debug("pg_get_functiondef is unavailable for %s.%s, rendering it from the catalogs", obj.Schema, obj.Name)
+	fn := functionInfo{schema: obj.Schema, name: obj.Name}
+	err = c.db.QueryRowContext(ctx, buildFunctionFallbackQuery(), obj.Schema, obj.Name).Scan(
+		&fn.arguments, &fn.result, &fn.language, &fn.source, &fn.binary, &fn.volatility, &fn.strict, &fn.securityDefiner,
+		(*pq.StringArray)(&fn.config))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return noDefinitionError(obj)
+		}
+		return stacktrace.Propagate(err, "Database error when fetching definition for %s.%s", obj.Schema, obj.Name)
+	}
+	obj.Definition = functionDefinition(fn)
+	obj.SearchPath = searchPathSetting(fn.config)
+	return c.enforceDefinitionSize(obj)
+}
+
+// searchPathSetting returns the search_path among a routine's pg_proc.proconfig settings,
+// which are stored as name=value, or "" when it sets none
+func searchPathSetting(config []string) string {
+	for _, setting := range config {
+		if name, value, _ := strings.Cut(setting, "="); name == "search_path" {
+			return value
+		}
+	}
+	return ""
+}
+
+// buildRoutineDefinitionQuery creates the SQL query for the definition and configuration
+// settings of a routine of the pg_proc.prokind given as $3, such as a procedure ('p')
+func buildRoutineDefinitionQuery() string {
+	return strings.TrimSpace(`
+		SELECT pg_get_functiondef(p.oid), p.proconfig
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.prokind = $3
+		AND n.nspname = $1 AND p.proname = $2
+	`)
+}
+
+// fetchRoutineDefinition fetches the definition of a procedure or window function, with
+// the search_path it sets in obj.SearchPath
+func (c *Connector) fetchRoutineDefinition(ctx context.Context, obj *types.DBObject, prokind string) error {
+	var definition sql.NullString
+	var config pq.StringArray
+	err := c.db.QueryRowContext(ctx, buildRoutineDefinitionQuery(), obj.Schema, obj.Name, prokind).Scan(&definition, &config)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return noDefinitionError(obj)
+		}
+		return stacktrace.Propagate(err, "Database error when fetching definition for %s.%s", obj.Schema, obj.Name)
+	}
+	if !definition.Valid {
+		return nullDefinitionError(obj)
+	}
+	obj.Definition = definition.String
+	obj.SearchPath = searchPathSetting(config)
+	return c.enforceDefinitionSize(obj)
+}
@@ -0,0 +1,308 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// scriptedResult is what scriptedDriver answers a query with: a single row, several rows, or an error
+type scriptedResult struct {
+	row   []driver.Value
+	rows  [][]driver.Value
+	err   error
+	delay time.Duration    // How long the query runs before answering, unless its context ends first
+	next  []scriptedResult // Answers to the query's later runs in turn, the last one repeating
+	// Answers keyed by the query's arguments joined with commas, for queries that must
+	// tell objects apart; other arguments get the result itself
+	byArgs map[string]scriptedResult
+}
+
+// scriptedDriver is a database/sql driver that answers each query text with a fixed result
+type scriptedDriver struct {
+	results   map[string]scriptedResult
+	connLimit int // Connections it opens before refusing more, like a server at max_connections; 0 for no limit
+
+	mu      sync.Mutex
+	runs    map[string]int // How often each query ran, to pick its answer from next
+	queries int            // How many queries ran in all
+	opened  int            // How many connections were opened
+}
+
+func (d *scriptedDriver) Open(string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.connLimit > 0 && d.opened >= d.connLimit {
+		return nil, errors.New("sorry, too many clients already")
+	}
+	d.opened++
+	return &scriptedConn{d}, nil
+}
+
+// queryCount returns how many queries the driver has answered
+func (d *scriptedDriver) queryCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.queries
+}
+
+type scriptedConn struct{ driver *scriptedDriver }
+
+func (c *scriptedConn) Prepare(query string) (driver.Stmt, error) {
+	return &scriptedStmt{c.driver, query}, nil
+}
+func (c *scriptedConn) Close() error              { return nil }
+func (c *scriptedConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type scriptedStmt struct {
+	driver *scriptedDriver
+	query  string
+}
+
+func (s *scriptedStmt) Close() error  { return nil }
+func (s *scriptedStmt) NumInput() int { return -1 }
+func (s *scriptedStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+func (s *scriptedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.driver.mu.Lock()
+	s.driver.queries++
+	s.driver.mu.Unlock()
+
+	result, ok := s.driver.results[s.query]
+	if !ok {
+		return &scriptedRows{}, nil
+	}
+	if len(result.byArgs) > 0 {
+		key := make([]string, len(args))
+		for i, arg := range args {
+			key[i] = fmt.Sprint(arg)
+		}
+		if argsResult, ok := result.byArgs[strings.Join(key, ",")]; ok {
+			result = argsResult
+		}
+	}
+	if len(result.next) > 0 {
+		s.driver.mu.Lock()
+		run := s.driver.runs[s.query]
+		s.driver.runs[s.query]++
+		s.driver.mu.Unlock()
+		if run > 0 {
+			result = result.next[min(run, len(result.next))-1]
+		}
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	rows := result.rows
+	if result.row != nil {
+		rows = [][]driver.Value{result.row}
+	}
+	return &scriptedRows{rows: rows}, nil
+}
+
+func (s *scriptedStmt) QueryContext(ctx context.Context, named []driver.NamedValue) (driver.Rows, error) {
+	if delay := s.driver.results[s.query].delay; delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	return s.Query(args)
+}
+
+type scriptedRows struct{ rows [][]driver.Value }
+
+func (r *scriptedRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return make([]string, 1)
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *scriptedRows) Close() error { return nil }
+func (r *scriptedRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// scriptedDrivers numbers the registered drivers, since database/sql never forgets a name
+var scriptedDrivers atomic.Int64
+
+// newScriptedDriver returns a driver whose queries are answered from results
+func newScriptedDriver(results map[string]scriptedResult) *scriptedDriver {
+	return &scriptedDriver{results: results, runs: make(map[string]int)}
+}
+
+// connector registers the driver and returns a connector using it
+func (d *scriptedDriver) connector(t *testing.T) *Connector {
+	t.Helper()
+	name := fmt.Sprintf("pgmeta-scripted-%d", scriptedDrivers.Add(1))
+	sql.Register(name, d)
+	conn, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("Failed to open scripted driver: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &Connector{db: conn}
+}
+
+// newScriptedConnector returns a connector whose queries are answered from results
+func newScriptedConnector(t *testing.T, results map[string]scriptedResult) *Connector {
+	t.Helper()
+	return newScriptedDriver(results).connector(t)
+}
+
+// The arguments of a function with a default and a variadic parameter, as
+// pg_get_functiondef and pg_get_function_arguments render them
+const defaultAndVariadicArgs = "base integer, step integer DEFAULT 1, VARIADIC labels text[]"
+
+func TestFetchFunctionDefinitionKeepsDefaultsAndVariadic(t *testing.T) {
+	functionDef := "CREATE OR REPLACE FUNCTION public.tag(" + defaultAndVariadicArgs + ")\n" +
+		" RETURNS text\n LANGUAGE sql\n IMMUTABLE\nAS $function$ SELECT base + step || array_to_string(labels, ',') $function$\n"
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildFunctionDefinitionQuery(): {row: []driver.Value{functionDef, nil}},
+	})
+
+	obj := &types.DBObject{Type: types.TypeFunction, Schema: "public", Name: "tag"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	if obj.Definition != functionDef {
+		t.Errorf("Expected pg_get_functiondef's output unchanged, got:\n%s", obj.Definition)
+	}
+}
+
+func TestFetchFunctionDefinitionFallback(t *testing.T) {
+	for name, failure := range map[string]scriptedResult{
+		"unavailable": {err: &pq.Error{Code: "42883", Message: "function pg_get_functiondef(oid) does not exist"}},
+		"null":        {row: []driver.Value{nil, nil}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			connector := newScriptedConnector(t, map[string]scriptedResult{
+				buildFunctionDefinitionQuery(): failure,
+				buildFunctionFallbackQuery(): {row: []driver.Value{
+					defaultAndVariadicArgs, "text", "sql", " SELECT base + step || array_to_string(labels, ',') ", "", "i", false, false, nil,
+				}},
+			})
+
+			obj := &types.DBObject{Type: types.TypeFunction, Schema: "public", Name: "tag"}
+			if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+				t.Fatalf("FetchObjectDefinition failed: %v", err)
+			}
+			if !strings.HasPrefix(obj.Definition, "CREATE OR REPLACE FUNCTION public.tag("+defaultAndVariadicArgs+")\n") {
+				t.Errorf("Expected the DEFAULT and VARIADIC arguments to be kept, got:\n%s", obj.Definition)
+			}
+		})
+	}
+}
+
+func TestFetchFunctionDefinitionOtherErrors(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildFunctionDefinitionQuery(): {err: &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"}},
+	})
+	obj := &types.DBObject{Type: types.TypeFunction, Schema: "public", Name: "tag"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err == nil {
+		t.Error("Expected a timeout to fail the fetch instead of falling back")
+	}
+}
+
+func TestFunctionDefinition(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       functionInfo
+		expected string
+	}{
+		{
+			name: "defaults and variadic",
+			fn: functionInfo{
+				schema: "public", name: "tag", arguments: defaultAndVariadicArgs, result: "text",
+				language: "plpgsql", source: "\nBEGIN\n  RETURN base + step;\nEND;\n", volatility: "v",
+			},
+			expected: "CREATE OR REPLACE FUNCTION public.tag(" + defaultAndVariadicArgs + ")\n" +
+				" RETURNS text\n LANGUAGE plpgsql\nAS $function$\nBEGIN\n  RETURN base + step;\nEND;\n$function$\n",
+		},
+		{
+			name: "attributes and a body containing the tag",
+			fn: functionInfo{
+				schema: "App", name: "f", arguments: "", result: "SETOF integer", language: "sql",
+				source: "SELECT '$function$'::text", volatility: "s", strict: true, securityDefiner: true,
+			},
+			expected: "CREATE OR REPLACE FUNCTION \"App\".f()\n RETURNS SETOF integer\n LANGUAGE sql\n" +
+				" STABLE STRICT SECURITY DEFINER\nAS $function1$SELECT '$function$'::text$function1$\n",
+		},
+		{
+			name: "c function",
+			fn: functionInfo{
+				schema: "public", name: "ext_fn", arguments: "integer", result: "integer", language: "c",
+				source: "ext_fn", binary: "$libdir/ext", volatility: "i",
+			},
+			expected: "CREATE OR REPLACE FUNCTION public.ext_fn(integer)\n RETURNS integer\n LANGUAGE c\n" +
+				" IMMUTABLE\nAS '$libdir/ext', 'ext_fn'\n",
+		},
+		{
+			name: "settings",
+			fn: functionInfo{
+				schema: "public", name: "audit", arguments: "", result: "void", language: "sql",
+				source: " SELECT 1 ", volatility: "v", config: []string{"search_path=app, pg_temp", "work_mem=64MB"},
+			},
+			expected: "CREATE OR REPLACE FUNCTION public.audit()\n RETURNS void\n LANGUAGE sql\n" +
+				" SET search_path TO 'app, pg_temp'\n SET work_mem TO '64MB'\nAS $function$ SELECT 1 $function$\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := functionDefinition(tt.fn); got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFetchRoutineSearchPath(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildFunctionDefinitionQuery(): {row: []driver.Value{
+			"CREATE OR REPLACE FUNCTION public.tag()\n RETURNS void\n LANGUAGE sql\n SET search_path TO 'app'\nAS $function$ SELECT 1 $function$\n",
+			"{work_mem=64MB,search_path=app}",
+		}},
+		buildRoutineDefinitionQuery(): {byArgs: map[string]scriptedResult{
+			"public,archive,p": {row: []driver.Value{"CREATE OR REPLACE PROCEDURE public.archive()\n LANGUAGE plpgsql\nAS $procedure$ BEGIN SET search_path TO app; END $procedure$\n", nil}},
+		}},
+	})
+
+	// The setting is read from pg_proc.proconfig, not from the definition's text
+	for _, tt := range []struct {
+		obj        types.DBObject
+		searchPath string
+	}{
+		{types.DBObject{Type: types.TypeFunction, Schema: "public", Name: "tag"}, "app"},
+		{types.DBObject{Type: types.TypeProcedure, Schema: "public", Name: "archive"}, ""},
+	} {
+		obj := tt.obj
+		if err := connector.FetchObjectDefinition(context.Background(), &obj); err != nil {
+			t.Fatalf("FetchObjectDefinition failed for %s: %v", obj.Name, err)
+		}
+		if obj.SearchPath != tt.searchPath {
+			t.Errorf("Expected the search_path of %s to be %q, got %q", obj.Name, tt.searchPath, obj.SearchPath)
+		}
+	}
+}
@@ -0,0 +1,684 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// integrationURL returns the database to run integration tests against, skipping the
+// test when PGMETA_TEST_DATABASE_URL is not set
+func integrationURL(t *testing.T) string {
+	t.Helper()
+	url := os.Getenv("PGMETA_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("PGMETA_TEST_DATABASE_URL is not set")
+	}
+	return url
+}
+
+func TestStatementTimeoutIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_statement_timeout_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".slow_t (id integer)",
+		"CREATE VIEW " + schema + ".slow_v AS SELECT id FROM " + schema + ".slow_t",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	// pg_get_viewdef takes a share lock on the tables a view reads, so holding an
+	// exclusive lock makes the definition query wait until the server gives up
+	tx, err := setup.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin locking transaction: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	if _, err := tx.Exec("LOCK TABLE " + schema + ".slow_t IN ACCESS EXCLUSIVE MODE"); err != nil {
+		t.Fatalf("Failed to lock table: %v", err)
+	}
+
+	connector, err := New(url, Options{StatementTimeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	start := time.Now()
+	objects := []types.DBObject{{Type: types.TypeView, Schema: schema, Name: "slow_v"}}
+	_, failed, err := connector.FetchObjectsDefinitionsConcurrently(context.Background(), objects, 1)
+	if err != nil {
+		t.Fatalf("Expected the timed out object to be recorded, not to fail the fetch: %v", err)
+	}
+	if len(failed) != 1 || failed[0] != objects[0].Key() {
+		t.Errorf("Expected %s to be recorded as failed, got %v", objects[0].Key(), failed)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the server to cancel the query after 200ms, took %v", elapsed)
+	}
+}
+
+func TestFunctionArgumentsIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_function_args_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE FUNCTION " + schema + ".tag(base integer, step integer DEFAULT 1, VARIADIC labels text[] DEFAULT '{}') " +
+			"RETURNS text LANGUAGE sql AS $$ SELECT (base + step)::text || array_to_string(labels, ',') $$",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	const args = "base integer, step integer DEFAULT 1, VARIADIC labels text[] DEFAULT '{}'::text[]"
+	obj := &types.DBObject{Type: types.TypeFunction, Schema: schema, Name: "tag"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	if !strings.Contains(obj.Definition, "("+args+")") {
+		t.Errorf("Expected the exported function to keep its defaults and VARIADIC, got:\n%s", obj.Definition)
+	}
+
+	// The fallback must render the same argument list
+	fn := functionInfo{schema: schema, name: "tag"}
+	err = connector.db.QueryRow(buildFunctionFallbackQuery(), schema, "tag").Scan(
+		&fn.arguments, &fn.result, &fn.language, &fn.source, &fn.binary, &fn.volatility, &fn.strict, &fn.securityDefiner,
+		(*pq.StringArray)(&fn.config))
+	if err != nil {
+		t.Fatalf("Fallback query failed: %v", err)
+	}
+	if fn.arguments != args {
+		t.Errorf("Expected fallback arguments %q, got %q", args, fn.arguments)
+	}
+}
+
+func TestDisabledTriggerIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_trigger_state_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".t (id integer)",
+		"CREATE FUNCTION " + schema + ".noop() RETURNS trigger LANGUAGE plpgsql AS $$ BEGIN RETURN NEW; END $$",
+		"CREATE TRIGGER quiet BEFORE INSERT ON " + schema + ".t FOR EACH ROW EXECUTE FUNCTION " + schema + ".noop()",
+		"ALTER TABLE " + schema + ".t DISABLE TRIGGER quiet",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	obj := &types.DBObject{Type: types.TypeTrigger, Schema: schema, Name: "quiet", TableName: "t"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	if !strings.HasSuffix(obj.Definition, "ALTER TABLE "+schema+".t DISABLE TRIGGER quiet;\n") {
+		t.Errorf("Expected the trigger to be disabled after it is created, got:\n%s", obj.Definition)
+	}
+}
+
+func TestTableStatsIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_table_stats_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".t (id integer, body text) WITH (autovacuum_vacuum_scale_factor = 0.05, toast.autovacuum_enabled = false)",
+		"INSERT INTO " + schema + ".t SELECT g, 'x' FROM generate_series(1, 100) g",
+		"ANALYZE " + schema + ".t",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	stats, err := connector.FetchTableStats(context.Background(), schema)
+	if err != nil {
+		t.Fatalf("FetchTableStats failed: %v", err)
+	}
+	got, ok := stats["t"]
+	if !ok {
+		t.Fatalf("Expected stats for table t, got %v", stats)
+	}
+	if got.RowEstimate != 100 || got.TotalBytes <= 0 {
+		t.Errorf("Expected 100 rows and a non-zero size, got %+v", got)
+	}
+	if len(got.AutovacuumOptions) != 1 || got.AutovacuumOptions[0] != "autovacuum_vacuum_scale_factor=0.05" {
+		t.Errorf("Expected the autovacuum storage parameter, got %v", got.AutovacuumOptions)
+	}
+	if len(got.ToastOptions) != 1 || got.ToastOptions[0] != "autovacuum_enabled=false" {
+		t.Errorf("Expected the toast storage parameter, got %v", got.ToastOptions)
+	}
+}
+
+func TestCatalogTableDefinitionIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_definition_source_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".t (" +
+			"id integer GENERATED BY DEFAULT AS IDENTITY, " +
+			"tags text[] NOT NULL DEFAULT '{}', " +
+			"name varchar(40) COLLATE \"C\", " +
+			"total numeric(10,2) GENERATED ALWAYS AS (id * 2) STORED)",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	obj := &types.DBObject{Type: types.TypeTable, Schema: schema, Name: "t"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	for _, column := range []string{
+		"id integer NOT NULL GENERATED BY DEFAULT AS IDENTITY (START WITH 1 INCREMENT BY 1",
+		"tags text[] NOT NULL DEFAULT '{}'::text[]",
+		"name character varying(40) COLLATE pg_catalog.\"C\"",
+		"total numeric(10,2) GENERATED ALWAYS AS (",
+	} {
+		if !strings.Contains(obj.Definition, column) {
+			t.Errorf("Expected the definition to contain %q, got:\n%s", column, obj.Definition)
+		}
+	}
+}
+
+func TestColumnSettingsIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_column_settings_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".docs (id integer, body text, title text)",
+		"ALTER TABLE " + schema + ".docs ALTER COLUMN id SET STATISTICS 1000",
+		"ALTER TABLE " + schema + ".docs ALTER COLUMN body SET STORAGE EXTERNAL",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	obj := &types.DBObject{Type: types.TypeTable, Schema: schema, Name: "docs"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	expected := "ALTER TABLE " + schema + ".docs ALTER COLUMN id SET STATISTICS 1000;\n" +
+		"ALTER TABLE " + schema + ".docs ALTER COLUMN body SET STORAGE EXTERNAL;\n"
+	if !strings.HasSuffix(obj.Definition, expected) {
+		t.Errorf("Expected the definition to end with:\n%s\ngot:\n%s", expected, obj.Definition)
+	}
+}
+
+func TestStatisticsIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_statistics_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".orders (region text, city text, zip text)",
+		"CREATE STATISTICS " + schema + ".orders_geo (ndistinct, dependencies) ON region, city, zip FROM " + schema + ".orders",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	objects, err := connector.QueryObjects(context.Background(), types.QueryOptions{
+		Types: []types.ObjectType{types.TypeStatistics}, Schemas: []string{schema}, NameRegex: ".*",
+	})
+	if err != nil {
+		t.Fatalf("QueryObjects failed: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Name != "orders_geo" || objects[0].TableName != "orders" {
+		t.Fatalf("Expected orders_geo on orders, got %+v", objects)
+	}
+	if err := connector.FetchObjectDefinition(context.Background(), &objects[0]); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	expected := "CREATE STATISTICS " + schema + ".orders_geo (ndistinct, dependencies) ON region, city, zip FROM " + schema + ".orders;"
+	if objects[0].Definition != expected {
+		t.Errorf("Expected %q, got %q", expected, objects[0].Definition)
+	}
+}
+
+func TestInheritedConstraintsIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_inherited_constraints_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".measurements (reading integer CONSTRAINT reading_positive CHECK (reading > 0))",
+		"ALTER TABLE " + schema + ".measurements ADD CONSTRAINT parent_only CHECK (reading < 100) NO INHERIT",
+		"CREATE TABLE " + schema + ".measurements_2024 (CONSTRAINT reading_small CHECK (reading < 50)) INHERITS (" + schema + ".measurements)",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	objects, err := connector.QueryObjects(context.Background(), types.QueryOptions{
+		Types: []types.ObjectType{types.TypeConstraint}, Schemas: []string{schema}, NameRegex: ".*",
+	})
+	if err != nil {
+		t.Fatalf("QueryObjects failed: %v", err)
+	}
+
+	// The child's copy of reading_positive is exported once, with the parent
+	got := make(map[string]string)
+	for _, obj := range objects {
+		got[obj.TableName+"."+obj.Name] = obj.Definition
+	}
+	expected := map[string]string{
+		"measurements.reading_positive":   "CHECK (reading > 0)",
+		"measurements.parent_only":        "CHECK (reading < 100) NO INHERIT",
+		"measurements_2024.reading_small": "CHECK (reading < 50)",
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected %d constraints, got %v", len(expected), got)
+	}
+	for name, definition := range expected {
+		if got[name] != definition {
+			t.Errorf("Expected %s to be %q, got %q", name, definition, got[name])
+		}
+	}
+}
+
+func TestTablePersistenceIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_table_persistence_test"
+	ctx := context.Background()
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".users (id integer)",
+		"CREATE UNLOGGED TABLE " + schema + ".sessions (id integer)",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	// A temporary table and its schema only live as long as the session creating them
+	session, err := setup.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open a session: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	if _, err := session.ExecContext(ctx, "CREATE TEMPORARY TABLE scratch (id integer)"); err != nil {
+		t.Fatalf("Failed to create a temporary table: %v", err)
+	}
+	var tempSchema string
+	if err := session.QueryRowContext(ctx, "SELECT nspname FROM pg_namespace WHERE oid = pg_my_temp_schema()").Scan(&tempSchema); err != nil {
+		t.Fatalf("Failed to find the temporary schema: %v", err)
+	}
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	objects, err := connector.QueryObjects(ctx, types.QueryOptions{
+		Types: []types.ObjectType{types.TypeTable}, Schemas: []string{schema, tempSchema}, NameRegex: ".*",
+	})
+	if err != nil {
+		t.Fatalf("QueryObjects failed: %v", err)
+	}
+	definitions := make(map[string]string)
+	for _, obj := range objects {
+		definitions[obj.Schema+"."+obj.Name] = obj.Definition
+	}
+
+	if _, ok := definitions[tempSchema+".scratch"]; ok {
+		t.Errorf("Expected the temporary table to be excluded, got %v", definitions)
+	}
+	if len(definitions) != 2 {
+		t.Fatalf("Expected the users and sessions tables, got %v", definitions)
+	}
+	for _, obj := range objects {
+		if err := connector.FetchObjectDefinition(ctx, &obj); err != nil {
+			t.Fatalf("FetchObjectDefinition failed for %s: %v", obj.Name, err)
+		}
+		definitions[obj.Schema+"."+obj.Name] = obj.Definition
+	}
+	if !strings.HasPrefix(definitions[schema+".sessions"], "CREATE UNLOGGED TABLE "+schema+".sessions") {
+		t.Errorf("Expected sessions to be created UNLOGGED, got:\n%s", definitions[schema+".sessions"])
+	}
+	if !strings.HasPrefix(definitions[schema+".users"], "CREATE TABLE "+schema+".users") {
+		t.Errorf("Expected users to be created as a logged table, got:\n%s", definitions[schema+".users"])
+	}
+}
+
+func TestSerialColumnIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_serial_test"
+	ctx := context.Background()
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".orders (id serial PRIMARY KEY, ref bigint GENERATED ALWAYS AS IDENTITY)",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	// The identity column's sequence is part of its column, so only the serial's is listed
+	objects, err := connector.QueryObjects(ctx, types.QueryOptions{
+		Types: []types.ObjectType{types.TypeSequence}, Schemas: []string{schema}, NameRegex: ".*",
+	})
+	if err != nil {
+		t.Fatalf("QueryObjects failed: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Name != "orders_id_seq" || objects[0].TableName != "orders" {
+		t.Fatalf("Expected only orders_id_seq, stored with orders, got %+v", objects)
+	}
+	seq := objects[0]
+	if err := connector.FetchObjectDefinition(ctx, &seq); err != nil {
+		t.Fatalf("FetchObjectDefinition failed for the sequence: %v", err)
+	}
+	if !strings.HasPrefix(seq.Definition, "-- Owned by column "+schema+".orders.id") {
+		t.Errorf("Expected the sequence to be marked as owned by orders.id, got:\n%s", seq.Definition)
+	}
+
+	table := &types.DBObject{Type: types.TypeTable, Schema: schema, Name: "orders"}
+	if err := connector.FetchObjectDefinition(ctx, table); err != nil {
+		t.Fatalf("FetchObjectDefinition failed for the table: %v", err)
+	}
+	ownership := "ALTER SEQUENCE " + schema + ".orders_id_seq OWNED BY " + schema + ".orders.id;"
+	if !strings.Contains(table.Definition, ownership) {
+		t.Errorf("Expected the table definition to restore the serial's ownership with %q, got:\n%s", ownership, table.Definition)
+	}
+	if strings.Count(table.Definition, "ALTER SEQUENCE") != 1 {
+		t.Errorf("Expected no ownership statement for the identity column, got:\n%s", table.Definition)
+	}
+
+	// Asked for, the identity column's sequence is listed as well
+	connector.SetIdentitySequences(true)
+	objects, err = connector.QueryObjects(ctx, types.QueryOptions{
+		Types: []types.ObjectType{types.TypeSequence}, Schemas: []string{schema}, NameRegex: ".*",
+	})
+	if err != nil {
+		t.Fatalf("QueryObjects failed: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Errorf("Expected both sequences with identity sequences included, got %+v", objects)
+	}
+}
+
+func TestDatabaseCommentsIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_database_comments_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	var database string
+	if err := setup.QueryRow("SELECT current_database()").Scan(&database); err != nil {
+		t.Fatalf("Failed to read the database name: %v", err)
+	}
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"COMMENT ON SCHEMA " + schema + " IS 'Schema under test'",
+		"COMMENT ON DATABASE " + quoteIdent(database) + " IS 'Database under test'",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+		if _, err := setup.Exec("COMMENT ON DATABASE " + quoteIdent(database) + " IS NULL"); err != nil {
+			t.Errorf("Failed to remove the database comment: %v", err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	databaseComment, schemaComments, err := connector.FetchDatabaseComments(context.Background(), []string{schema})
+	if err != nil {
+		t.Fatalf("FetchDatabaseComments failed: %v", err)
+	}
+	if expected := "COMMENT ON DATABASE " + quoteIdent(database) + " IS 'Database under test';\n"; databaseComment != expected {
+		t.Errorf("Expected the database comment %q, got %q", expected, databaseComment)
+	}
+	if expected := "COMMENT ON SCHEMA " + schema + " IS 'Schema under test';\n"; schemaComments[schema] != expected {
+		t.Errorf("Expected the schema comment %q, got %q", expected, schemaComments[schema])
+	}
+}
+
+func TestAutovacuumSettingsIntegration(t *testing.T) {
+	url := integrationURL(t)
+	const schema = "pgmeta_autovacuum_test"
+
+	setup, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("Failed to open setup connection: %v", err)
+	}
+	t.Cleanup(func() { setup.Close() })
+
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + schema + " CASCADE",
+		"CREATE SCHEMA " + schema,
+		"CREATE TABLE " + schema + ".events (id bigint, body text) WITH (fillfactor = 90, autovacuum_vacuum_scale_factor = 0.01)",
+		"ALTER TABLE " + schema + ".events SET (toast.autovacuum_enabled = false)",
+	} {
+		if _, err := setup.Exec(stmt); err != nil {
+			t.Fatalf("Setup failed on %q: %v", stmt, err)
+		}
+	}
+	t.Cleanup(func() {
+		if _, err := setup.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE"); err != nil {
+			t.Errorf("Failed to drop %s: %v", schema, err)
+		}
+	})
+
+	connector, err := New(url, Options{})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { connector.Close() })
+
+	obj := &types.DBObject{Type: types.TypeTable, Schema: schema, Name: "events"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	expected := "ALTER TABLE " + schema + ".events SET (autovacuum_vacuum_scale_factor=0.01, toast.autovacuum_enabled=false);"
+	if !strings.Contains(obj.Definition, expected) {
+		t.Errorf("Expected the definition to restore the autovacuum settings with %q, got:\n%s", expected, obj.Definition)
+	}
+	if strings.Contains(obj.Definition, "fillfactor") {
+		t.Errorf("Expected only autovacuum settings to be restored, got:\n%s", obj.Definition)
+	}
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// buildObjectsByOIDQuery creates the SQL query resolving OIDs to objects in a single round trip.
+// Each branch types and names objects like the listing query of its object type and skips
+// what is never exported, such as internal triggers and identity sequences. OIDs are only
+// unique within one catalog, so in the rare case that an OID is reused across catalogs every
+// matching object is returned.
+func buildObjectsByOIDQuery() string {
+	return strings.TrimSpace(`
+		WITH wanted AS (SELECT unnest(($1)::oid[]) AS oid)
+		SELECT
+			CASE c.relkind
+				WHEN 'v' THEN 'view'
+				WHEN 'm' THEN 'materialized_view'
+				ELSE 'table'
+			END as type,
+			n.nspname as schema,
+			c.relname as name,
+			NULL as table_name,
+			NULL as definition
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid IN (SELECT oid FROM wanted)
+		AND c.relkind IN ('r', 'p', 'v', 'm')
+		UNION ALL
+		SELECT 'sequence', n.nspname, c.relname, owner.relname, NULL
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_depend d ON d.objid = c.oid AND d.deptype = 'a' AND d.refclassid = 'pg_class'::regclass
+		LEFT JOIN pg_class owner ON owner.oid = d.refobjid
+		WHERE c.oid IN (SELECT oid FROM wanted)
+		AND c.relkind = 'S'
+		-- Identity sequences are implicit in their column's GENERATED ... AS IDENTITY clause
+		AND NOT EXISTS (SELECT 1 FROM pg_depend dep WHERE dep.objid = c.oid AND dep.deptype = 'i')
+		UNION ALL
+		SELECT 'index', n.nspname, c.relname, t.relname, NULL
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE i.indexrelid IN (SELECT oid FROM wanted)
+		AND t.relkind IN ('r', 'p')
+		UNION ALL
+		SELECT
+			CASE p.prokind
+				WHEN 'a' THEN 'aggregate'
+				WHEN 'w' THEN 'window_function'
+				WHEN 'p' THEN 'procedure'
+				ELSE 'function'
+			END,
+			n.nspname, p.proname, NULL, NULL
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.oid IN (SELECT oid FROM wanted)
+		UNION ALL
+		SELECT 'trigger', n.nspname, t.tgname, c.relname, NULL
+		FROM pg_trigger t
+		JOIN pg_class c ON t.tgrelid = c.oid
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+		WHERE t.oid IN (SELECT oid FROM wanted)
+		AND NOT t.tgisinternal
+		UNION ALL
+		SELECT 'constraint', n.nspname, c.conname, rel.relname, pg_get_constraintdef(c.oid, true)
+		FROM pg_constraint c
+		JOIN pg_class rel ON rel.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = rel.relnamespace
+		WHERE c.oid IN (SELECT oid FROM wanted)
+		AND c.contype IN ('p', 'f', 'u', 'c', 'x')
+		UNION ALL
+		SELECT 'policy', n.nspname, pol.polname, c.relname, NULL
+		FROM pg_policy pol
+		JOIN pg_class c ON pol.polrelid = c.oid
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+		WHERE pol.oid IN (SELECT oid FROM wanted)
+		UNION ALL
+		SELECT 'rule', n.nspname, r.rulename, c.relname, NULL
+		FROM pg_rewrite r
+		JOIN pg_class c ON r.ev_class = c.oid
+		JOIN pg_namespace n ON c.relnamespace = n.oid
+		WHERE r.oid IN (SELECT oid FROM wanted)
+		AND r.rulename != '_RETURN'
+		UNION ALL
+		SELECT 'statistics', n.nspname, s.stxname, CASE WHEN c.relnamespace = s.stxnamespace THEN c.relname END, NULL
+		FROM pg_statistic_ext s
+		JOIN pg_namespace n ON n.oid = s.stxnamespace
+		JOIN pg_class c ON c.oid = s.stxrelid
+		WHERE s.oid IN (SELECT oid FROM wanted)
+		UNION ALL
+		SELECT 'extension', n.nspname, e.extname, NULL, NULL
+		FROM pg_extension e
+		JOIN pg_namespace n ON n.oid = e.extnamespace
+		WHERE e.oid IN (SELECT oid FROM wanted)
+		UNION ALL
+		SELECT 'publication', 'postgres', pubname, NULL, NULL
+		FROM pg_publication
+		WHERE oid IN (SELECT oid FROM wanted)
+		UNION ALL
+		-- Only columns readable without superuser; subconninfo is not
+		SELECT 'subscription', 'postgres', subname, NULL, NULL
+		FROM pg_subscription
+		WHERE oid IN (SELECT oid FROM wanted)
+		UNION ALL
+		SELECT 'language', 'postgres', lanname, NULL, NULL
+		FROM pg_language
+		WHERE oid IN (SELECT oid FROM wanted)
+		AND lanname NOT IN ('internal', 'c', 'sql')
+	`)
+}
+
+// queryObjectsByOID returns the objects with the given OIDs, whatever their type or schema.
+// OIDs that match nothing pgmeta exports are ignored.
+func (c *Connector) queryObjectsByOID(ctx context.Context, oids []uint32) ([]types.DBObject, error) {
+	array := make(pq.Int64Array, len(oids))
+	for i, oid := range oids {
+		array[i] = int64(oid)
+	}
+
+	rows, err := c.db.QueryContext(ctx, buildObjectsByOIDQuery(), array)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query objects by OID")
+	}
+	defer rows.Close()
+
+	var objects []types.DBObject
+	for rows.Next() {
+		var obj types.DBObject
+		var typeStr string
+		var tableName, definition sql.NullString
+		if err := rows.Scan(&typeStr, &obj.Schema, &obj.Name, &tableName, &definition); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan object row")
+		}
+		obj.Type = types.ObjectType(typeStr)
+		obj.TableName = tableName.String
+		obj.Definition = definition.String
+		objects = append(objects, obj)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read objects by OID")
+	}
+
+	log.Info("Found %d database objects for %d OIDs", len(objects), len(oids))
+	return objects, nil
+}
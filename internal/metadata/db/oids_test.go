@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestQueryObjectsByOID(t *testing.T) {
+	// The catalogs only have rows for the OIDs that exist
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildObjectsByOIDQuery(): {byArgs: map[string]scriptedResult{
+			"{16390,16400,16410,99999}": {rows: [][]driver.Value{
+				{"index", "public", "users_email_idx", "users", nil},
+				{"function", "billing", "compute_invoice", nil, nil},
+				{"constraint", "public", "users_pkey", "users", "PRIMARY KEY (id)"},
+			}},
+		}},
+	})
+
+	// Name, type and schema options are ignored when OIDs are given
+	objects, err := connector.QueryObjects(context.Background(), types.QueryOptions{
+		OIDs:      []uint32{16390, 16400, 16410, 99999},
+		Types:     []types.ObjectType{types.TypeView},
+		Schemas:   []string{"reporting"},
+		NameRegex: "nothing-matches",
+	})
+	if err != nil {
+		t.Fatalf("QueryObjects failed: %v", err)
+	}
+
+	expected := []types.DBObject{
+		{Type: types.TypeIndex, Schema: "public", Name: "users_email_idx", TableName: "users"},
+		{Type: types.TypeFunction, Schema: "billing", Name: "compute_invoice"},
+		{Type: types.TypeConstraint, Schema: "public", Name: "users_pkey", TableName: "users", Definition: "PRIMARY KEY (id)"},
+	}
+	if len(objects) != len(expected) {
+		t.Fatalf("Expected only the %d requested objects, got %+v", len(expected), objects)
+	}
+	for i, obj := range objects {
+		if obj != expected[i] {
+			t.Errorf("Object %d: expected %+v, got %+v", i, expected[i], obj)
+		}
+	}
+}
+
+func TestBuildObjectsByOIDQuery(t *testing.T) {
+	query := buildObjectsByOIDQuery()
+	if !strings.HasPrefix(query, "WITH wanted AS (SELECT unnest(($1)::oid[]) AS oid)") {
+		t.Errorf("Expected the OIDs to be passed as a single array parameter, got: %s", query)
+	}
+	for _, catalog := range []string{"pg_class", "pg_index", "pg_proc", "pg_trigger", "pg_constraint", "pg_policy", "pg_rewrite", "pg_extension", "pg_publication", "pg_subscription", "pg_language"} {
+		if !strings.Contains(query, "FROM "+catalog) {
+			t.Errorf("Expected the query to resolve OIDs in %s", catalog)
+		}
+	}
+	// Objects pgmeta never exports stay excluded
+	for _, clause := range []string{"NOT t.tgisinternal", "r.rulename != '_RETURN'", "dep.deptype = 'i'"} {
+		if !strings.Contains(query, clause) {
+			t.Errorf("Expected the query to contain %q", clause)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// ownerKey identifies a catalog entry in the owners query. Database-level entries such as
+// languages and publications have no schema.
+type ownerKey struct {
+	kind   string
+	schema string
+	name   string
+}
+
+// buildOwnersQuery creates the SQL query for the owning role of every relation and routine
+// in the given schemas, and of every language, publication and subscription
+func buildOwnersQuery() string {
+	return strings.TrimSpace(`
+		SELECT 'relation', n.nspname, c.relname, pg_get_userbyid(c.relowner)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = ANY($1)
+		AND c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f')
+		UNION ALL
+		SELECT 'routine', n.nspname, p.proname, pg_get_userbyid(p.proowner)
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = ANY($1)
+		UNION ALL
+		SELECT 'language', '', l.lanname, pg_get_userbyid(l.lanowner)
+		FROM pg_language l
+		UNION ALL
+		SELECT 'publication', '', p.pubname, pg_get_userbyid(p.pubowner)
+		FROM pg_publication p
+		UNION ALL
+		SELECT 'subscription', '', s.subname, pg_get_userbyid(s.subowner)
+		FROM pg_subscription s
+		WHERE s.subdbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+	`)
+}
+
+// ownerLookupKey returns the owners query entry that owns obj. Objects that live on a table,
+// such as indexes and triggers, belong to the table's owner. ok is false for objects without
+// a meaningful owner, such as extensions.
+func ownerLookupKey(obj types.DBObject) (key ownerKey, ok bool) {
+	switch obj.Type {
+	case types.TypeTable, types.TypeView, types.TypeMaterializedView:
+		return ownerKey{kind: "relation", schema: obj.Schema, name: obj.Name}, true
+	case types.TypeSequence:
+		if obj.TableName != "" {
+			return ownerKey{kind: "relation", schema: obj.Schema, name: obj.TableName}, true
+		}
+		return ownerKey{kind: "relation", schema: obj.Schema, name: obj.Name}, true
+	case types.TypeIndex, types.TypeConstraint, types.TypeTrigger, types.TypePolicy, types.TypeRule, types.TypeStatistics:
+		if obj.TableName == "" {
+			return ownerKey{}, false
+		}
+		return ownerKey{kind: "relation", schema: obj.Schema, name: obj.TableName}, true
+	case types.TypeFunction, types.TypeProcedure, types.TypeAggregate, types.TypeWindowFunction:
+		return ownerKey{kind: "routine", schema: obj.Schema, name: obj.Name}, true
+	case types.TypeLanguage, types.TypePublication, types.TypeSubscription:
+		return ownerKey{kind: string(obj.Type), name: obj.Name}, true
+	}
+	return ownerKey{}, false
+}
+
+// FetchOwners returns the role owning each of objects, by object key. Objects without a
+// meaningful owner, such as extensions, are left out.
+func (c *Connector) FetchOwners(ctx context.Context, objects []types.DBObject) (map[types.ObjectKey]string, error) {
+	var schemas []string
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		if !seen[obj.Schema] {
+			seen[obj.Schema] = true
+			schemas = append(schemas, obj.Schema)
+		}
+	}
+
+	rows, err := c.db.QueryContext(ctx, buildOwnersQuery(), pq.Array(schemas))
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query object owners")
+	}
+	defer rows.Close()
+
+	roles := make(map[ownerKey]string)
+	for rows.Next() {
+		var key ownerKey
+		var role string
+		if err := rows.Scan(&key.kind, &key.schema, &key.name, &role); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan object owner row")
+		}
+		roles[key] = role
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read object owners")
+	}
+
+	owners := make(map[types.ObjectKey]string)
+	for _, obj := range objects {
+		key, ok := ownerLookupKey(obj)
+		if !ok {
+			continue
+		}
+		if role, found := roles[key]; found {
+			owners[obj.Key()] = role
+		}
+	}
+	return owners, nil
+}
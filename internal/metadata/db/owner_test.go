@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestFetchOwners(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildOwnersQuery(): {rows: [][]driver.Value{
+			{"relation", "public", "users", "app_owner"},
+			{"relation", "public", "orders", "billing"},
+			{"routine", "public", "tag", "app_owner"},
+			{"language", "", "plpgsql", "postgres"},
+			{"publication", "", "changes", "replicator"},
+		}},
+	})
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "orders_idx", TableName: "orders"},
+		{Type: types.TypeFunction, Schema: "public", Name: "tag"},
+		{Type: types.TypeLanguage, Schema: "", Name: "plpgsql"},
+		{Type: types.TypePublication, Schema: "postgres", Name: "changes"},
+		{Type: types.TypeExtension, Schema: "public", Name: "pgcrypto"},
+		{Type: types.TypeView, Schema: "public", Name: "dropped_since"},
+	}
+
+	owners, err := connector.FetchOwners(context.Background(), objects)
+	if err != nil {
+		t.Fatalf("FetchOwners failed: %v", err)
+	}
+
+	want := map[types.ObjectKey]string{
+		objects[0].Key(): "app_owner",
+		objects[1].Key(): "billing", // the owner of the index's table
+		objects[2].Key(): "app_owner",
+		objects[3].Key(): "postgres",
+		objects[4].Key(): "replicator",
+	}
+	if len(owners) != len(want) {
+		t.Errorf("Expected %d owners, got %v", len(want), owners)
+	}
+	for key, role := range want {
+		if owners[key] != role {
+			t.Errorf("Expected %s to be owned by %q, got %q", key, role, owners[key])
+		}
+	}
+	// Extensions have no meaningful owner, and objects missing from the catalog have none
+	for _, obj := range objects[5:] {
+		if role, ok := owners[obj.Key()]; ok {
+			t.Errorf("Expected no owner for %s, got %q", obj.Key(), role)
+		}
+	}
+}
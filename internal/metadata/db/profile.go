@@ -0,0 +1,52 @@
+package db
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// ObjectTiming is how long fetching one object's definition took
+type ObjectTiming struct {
+	Object   types.ObjectKey
+	Duration time.Duration
+}
+
+// SetProfiling enables or disables timing each definition fetched by
+// FetchObjectsDefinitionsConcurrently, read back with SlowestFetches. Disabling it discards
+// the timings collected so far.
+func (c *Connector) SetProfiling(enabled bool) {
+	c.timingsMu.Lock()
+	defer c.timingsMu.Unlock()
+	c.profiling = enabled
+	if !enabled {
+		c.timings = nil
+	}
+}
+
+// recordTiming stores how long fetching key took when profiling is enabled
+func (c *Connector) recordTiming(key types.ObjectKey, d time.Duration) {
+	c.timingsMu.Lock()
+	defer c.timingsMu.Unlock()
+	if c.profiling {
+		c.timings = append(c.timings, ObjectTiming{Object: key, Duration: d})
+	}
+}
+
+// SlowestFetches returns the n slowest definition fetches timed since profiling was
+// enabled, slowest first. Failed fetches are included, since a timeout is often the slowest.
+func (c *Connector) SlowestFetches(n int) []ObjectTiming {
+	c.timingsMu.Lock()
+	timings := slices.Clone(c.timings)
+	c.timingsMu.Unlock()
+
+	slices.SortStableFunc(timings, func(a, b ObjectTiming) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+	if n < len(timings) {
+		timings = timings[:n]
+	}
+	return timings
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestSlowestFetches(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0): {row: []driver.Value{"CREATE TABLE public.users ();"}},
+		buildViewDefinitionQuery(DefinitionSourcePgCatalog):     {row: []driver.Value{"SELECT 1;"}, delay: 150 * time.Millisecond},
+		buildMaterializedViewDefinitionQuery():                  {row: []driver.Value{" SELECT 1 AS total;", "", true}, delay: 75 * time.Millisecond},
+	})
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeView, Schema: "public", Name: "totals"},
+		{Type: types.TypeMaterializedView, Schema: "public", Name: "daily_totals"},
+	}
+
+	// Without profiling nothing is timed
+	if _, _, err := connector.FetchObjectsDefinitionsConcurrently(context.Background(), objects, 3); err != nil {
+		t.Fatalf("FetchObjectsDefinitionsConcurrently failed: %v", err)
+	}
+	if timings := connector.SlowestFetches(3); len(timings) != 0 {
+		t.Fatalf("Expected no timings without profiling, got %v", timings)
+	}
+
+	connector.SetProfiling(true)
+	if _, _, err := connector.FetchObjectsDefinitionsConcurrently(context.Background(), objects, 3); err != nil {
+		t.Fatalf("FetchObjectsDefinitionsConcurrently failed: %v", err)
+	}
+
+	timings := connector.SlowestFetches(2)
+	if len(timings) != 2 {
+		t.Fatalf("Expected the 2 slowest fetches, got %v", timings)
+	}
+	if timings[0].Object != objects[1].Key() || timings[1].Object != objects[2].Key() {
+		t.Errorf("Expected the view then the materialized view, got %v", timings)
+	}
+	if timings[0].Duration < 150*time.Millisecond {
+		t.Errorf("Expected the view to take at least 150ms, got %v", timings[0].Duration)
+	}
+
+	if all := connector.SlowestFetches(10); len(all) != 3 {
+		t.Errorf("Expected all 3 fetches when asking for more, got %v", all)
+	}
+
+	connector.SetProfiling(false)
+	if timings := connector.SlowestFetches(3); len(timings) != 0 {
+		t.Errorf("Expected disabling profiling to discard the timings, got %v", timings)
+	}
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// Definition sources for tables and views. pg_catalog renders them with the pg_get_*
+// functions and format_type; information_schema uses the SQL-standard views, whose type
+// names and view text some teams prefer to diff against.
+const (
+	DefinitionSourcePgCatalog         = "pg_catalog"
+	DefinitionSourceInformationSchema = "information_schema"
+)
+
+// DefinitionSources lists the supported definition sources, the default first
+func DefinitionSources() []string {
+	return []string{DefinitionSourcePgCatalog, DefinitionSourceInformationSchema}
+}
+
+// IsValidDefinitionSource reports whether source is a supported definition source
+func IsValidDefinitionSource(source string) bool {
+	return source == DefinitionSourcePgCatalog || source == DefinitionSourceInformationSchema
+}
+
+// SetDefinitionSource chooses where table and view definitions are read from
+func (c *Connector) SetDefinitionSource(source string) {
+	c.definitionSource = source
+}
+
+// buildViewDefinitionQuery creates the SQL query for a view definition from the given source.
+// information_schema.views reports a NULL view_definition for views the current role does
+// not own; pg_get_viewdef has no such restriction, so fetchViewDefinition falls back to it.
+func buildViewDefinitionQuery(source string) string {
+	if source == DefinitionSourceInformationSchema {
+		return strings.TrimSpace(`
+			SELECT 'CREATE OR REPLACE VIEW ' || quote_ident($1) || '.' || quote_ident($2) || ' AS' || E'\n' ||
+				view_definition
+			FROM information_schema.views
+			WHERE table_schema = $1 AND table_name = $2;
+		`)
+	}
+	return strings.TrimSpace(`
+		SELECT 'CREATE OR REPLACE VIEW ' || quote_ident($1) || '.' || quote_ident($2) || ' AS' || E'\n' ||
+			pg_get_viewdef(c.oid, true)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind = 'v';
+	`)
+}
+
+// fetchViewDefinition fetches a view's CREATE OR REPLACE VIEW statement from the chosen
+// definition source. A NULL view_definition from information_schema is fetched again with
+// pg_get_viewdef rather than failing the view.
+func (c *Connector) fetchViewDefinition(ctx context.Context, obj *types.DBObject) error {
+	definition, err := c.queryViewDefinition(ctx, c.definitionSource, obj)
+	if err == nil && !definition.Valid && c.definitionSource == DefinitionSourceInformationSchema {
+		log.Debug("information_schema.views hides the definition of view %s.%s; using pg_get_viewdef", obj.Schema, obj.Name)
+		definition, err = c.queryViewDefinition(ctx, DefinitionSourcePgCatalog, obj)
+	}
+	if err != nil {
+		return err
+	}
+	if !definition.Valid {
+		return nullDefinitionError(obj)
+	}
+
+	obj.Definition = definition.String
+	return c.enforceDefinitionSize(obj)
+}
+
+// queryViewDefinition runs the view definition query of source for obj
+func (c *Connector) queryViewDefinition(ctx context.Context, source string, obj *types.DBObject) (sql.NullString, error) {
+	var definition sql.NullString
+	err := c.db.QueryRowContext(ctx, buildViewDefinitionQuery(source), obj.Schema, obj.Name).Scan(&definition)
+	if err == sql.ErrNoRows {
+		return definition, noDefinitionError(obj)
+	}
+	if err != nil {
+		return definition, stacktrace.Propagate(err, "Database error when fetching definition for %s.%s", obj.Schema, obj.Name)
+	}
+	return definition, nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// buildTableStatsQuery creates the SQL query for the size and maintenance metadata of every
+// table in a schema. The row estimate comes from pg_class.reltuples, which is -1 for tables
+// never analyzed on PostgreSQL 14+; the toast options are the toast table's own reloptions.
+func buildTableStatsQuery() string {
+	return strings.TrimSpace(`
+		SELECT
+			c.relname,
+			c.reltuples::bigint,
+			pg_total_relation_size(c.oid),
+			COALESCE(pg_total_relation_size(NULLIF(c.reltoastrelid, 0)), 0),
+			COALESCE(t.reloptions, '{}'),
+			ARRAY(SELECT opt FROM unnest(c.reloptions) AS opt WHERE opt LIKE 'autovacuum\_%'),
+			COALESCE(s.n_live_tup, 0),
+			COALESCE(s.n_dead_tup, 0),
+			s.last_vacuum,
+			s.last_autovacuum,
+			s.last_analyze,
+			s.last_autoanalyze
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_class t ON t.oid = c.reltoastrelid
+		LEFT JOIN pg_stat_user_tables s ON s.relid = c.oid
+		WHERE n.nspname = $1
+		AND c.relkind IN ('r', 'p')
+	`)
+}
+
+// FetchTableStats returns the size and maintenance metadata of every table in schema, by table name
+func (c *Connector) FetchTableStats(ctx context.Context, schema string) (map[string]types.TableStats, error) {
+	rows, err := c.db.QueryContext(ctx, buildTableStatsQuery(), schema)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query table stats in schema: %s", schema)
+	}
+	defer rows.Close()
+
+	stats := make(map[string]types.TableStats)
+	for rows.Next() {
+		var name string
+		var s types.TableStats
+		var toastOptions, autovacuumOptions pq.StringArray
+		var lastVacuum, lastAutovacuum, lastAnalyze, lastAutoanalyze sql.NullTime
+		if err := rows.Scan(&name, &s.RowEstimate, &s.TotalBytes, &s.ToastBytes, &toastOptions, &autovacuumOptions,
+			&s.LiveTuples, &s.DeadTuples, &lastVacuum, &lastAutovacuum, &lastAnalyze, &lastAutoanalyze); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan table stats row")
+		}
+		// Empty lists stay [] rather than null in stats.json
+		s.ToastOptions = append([]string{}, toastOptions...)
+		s.AutovacuumOptions = append([]string{}, autovacuumOptions...)
+		s.LastVacuum = nullTime(lastVacuum)
+		s.LastAutovacuum = nullTime(lastAutovacuum)
+		s.LastAnalyze = nullTime(lastAnalyze)
+		s.LastAutoanalyze = nullTime(lastAutoanalyze)
+		stats[name] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read table stats in schema: %s", schema)
+	}
+	return stats, nil
+}
+
+// nullTime returns the time held by t, or nil when it is NULL
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
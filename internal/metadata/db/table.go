@@ -0,0 +1,322 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// columnSetting holds a column's tuning that CREATE TABLE cannot express
+type columnSetting struct {
+	name        string
+	statsTarget int    // attstattarget; -1 when the default statistics target applies
+	storage     string // attstorage: 'p', 'e', 'm' or 'x'
+	typeStorage string // the storage mode of the column's type, which is the default
+}
+
+// storageModes maps pg_attribute.attstorage to the SET STORAGE keyword
+var storageModes = map[string]string{
+	"p": "PLAIN",
+	"e": "EXTERNAL",
+	"m": "MAIN",
+	"x": "EXTENDED",
+}
+
+// buildColumnSettingsQuery creates the SQL query for the columns of a table whose statistics
+// target or storage mode differs from the default. attstattarget is NULL by default since
+// PostgreSQL 17 and -1 before.
+func buildColumnSettingsQuery() string {
+	return strings.TrimSpace(`
+		SELECT a.attname, COALESCE(a.attstattarget, -1), a.attstorage, t.typstorage
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_type t ON t.oid = a.atttypid
+		WHERE n.nspname = $1 AND c.relname = $2
+		AND a.attnum > 0
+		AND NOT a.attisdropped
+		AND (COALESCE(a.attstattarget, -1) >= 0 OR a.attstorage <> t.typstorage)
+		ORDER BY a.attnum
+	`)
+}
+
+// columnSettingsStatements renders the ALTER TABLE statements restoring each column's
+// non-default statistics target and storage mode
+func columnSettingsStatements(schema, table string, settings []columnSetting) string {
+	var b strings.Builder
+	for _, s := range settings {
+		column := fmt.Sprintf("ALTER TABLE %s.%s ALTER COLUMN %s", quoteIdent(schema), quoteIdent(table), quoteIdent(s.name))
+		if s.statsTarget >= 0 {
+			fmt.Fprintf(&b, "%s SET STATISTICS %d;\n", column, s.statsTarget)
+		}
+		if mode, ok := storageModes[s.storage]; ok && s.storage != s.typeStorage {
+			fmt.Fprintf(&b, "%s SET STORAGE %s;\n", column, mode)
+		}
+	}
+	return b.String()
+}
+
+// ownedSequence is a sequence owned by one of a table's columns, as a serial column's sequence is
+type ownedSequence struct {
+	schema string
+	name   string
+	column string
+}
+
+// buildOwnedSequencesQuery creates the SQL query for the sequences owned by a table's columns.
+// Identity sequences depend on their column internally rather than automatically, so they are
+// left to the GENERATED ... AS IDENTITY clause.
+func buildOwnedSequencesQuery() string {
+	return strings.TrimSpace(`
+		SELECT sn.nspname, s.relname, a.attname
+		FROM pg_depend d
+		JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_class c ON c.oid = d.refobjid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = d.refobjsubid
+		WHERE d.classid = 'pg_class'::regclass
+		AND d.refclassid = 'pg_class'::regclass
+		AND d.deptype = 'a'
+		AND n.nspname = $1 AND c.relname = $2
+		ORDER BY a.attnum
+	`)
+}
+
+// ownedSequenceStatements renders the ALTER SEQUENCE statements tying each sequence back to
+// its column. Sequences replay before tables so column defaults can call nextval, which
+// leaves the ownership to be restored once the table exists.
+func ownedSequenceStatements(schema, table string, sequences []ownedSequence) string {
+	var b strings.Builder
+	for _, s := range sequences {
+		fmt.Fprintf(&b, "ALTER SEQUENCE %s.%s OWNED BY %s.%s.%s;\n",
+			quoteIdent(s.schema), quoteIdent(s.name), quoteIdent(schema), quoteIdent(table), quoteIdent(s.column))
+	}
+	return b.String()
+}
+
+// fetchOwnedSequences returns the sequences owned by the columns of a table
+func (c *Connector) fetchOwnedSequences(ctx context.Context, obj *types.DBObject) ([]ownedSequence, error) {
+	rows, err := c.db.QueryContext(ctx, buildOwnedSequencesQuery(), obj.Schema, obj.Name)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query owned sequences of %s.%s", obj.Schema, obj.Name)
+	}
+	defer rows.Close()
+
+	var sequences []ownedSequence
+	for rows.Next() {
+		var s ownedSequence
+		if err := rows.Scan(&s.schema, &s.name, &s.column); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan owned sequences of %s.%s", obj.Schema, obj.Name)
+		}
+		sequences = append(sequences, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error iterating owned sequences of %s.%s", obj.Schema, obj.Name)
+	}
+	return sequences, nil
+}
+
+// foreignKey is one of a table's foreign key constraints
+type foreignKey struct {
+	name       string
+	definition string
+}
+
+// buildForeignKeysQuery creates the SQL query for the foreign keys of a table. They are
+// rendered with pg_get_constraintdef, one row per constraint, so composite keys and both
+// ON UPDATE and ON DELETE actions round-trip unchanged.
+func buildForeignKeysQuery() string {
+	return strings.TrimSpace(`
+		SELECT c.conname, pg_get_constraintdef(c.oid, true)
+		FROM pg_constraint c
+		JOIN pg_class rel ON rel.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = rel.relnamespace
+		WHERE n.nspname = $1 AND rel.relname = $2
+		AND c.contype = 'f'
+		ORDER BY c.conname
+	`)
+}
+
+// foreignKeyStatements renders the ALTER TABLE statements adding a table's foreign keys
+func foreignKeyStatements(schema, table string, keys []foreignKey) string {
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "ALTER TABLE ONLY %s.%s ADD CONSTRAINT %s %s;\n",
+			quoteIdent(schema), quoteIdent(table), quoteIdent(k.name), k.definition)
+	}
+	return b.String()
+}
+
+// fetchForeignKeys returns the foreign keys of a table
+func (c *Connector) fetchForeignKeys(ctx context.Context, obj *types.DBObject) ([]foreignKey, error) {
+	rows, err := c.db.QueryContext(ctx, buildForeignKeysQuery(), obj.Schema, obj.Name)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to query foreign keys of %s.%s", obj.Schema, obj.Name)
+	}
+	defer rows.Close()
+
+	var keys []foreignKey
+	for rows.Next() {
+		var k foreignKey
+		if err := rows.Scan(&k.name, &k.definition); err != nil {
+			return nil, stacktrace.Propagate(err, "Failed to scan foreign keys of %s.%s", obj.Schema, obj.Name)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Error iterating foreign keys of %s.%s", obj.Schema, obj.Name)
+	}
+	return keys, nil
+}
+
+// buildAutovacuumSettingsQuery creates the SQL query for a table's autovacuum storage
+// parameters, followed by those of its toast table with the toast. prefix ALTER TABLE takes
+func buildAutovacuumSettingsQuery() string {
+	return strings.TrimSpace(`
+		SELECT
+			ARRAY(SELECT opt FROM unnest(c.reloptions) AS opt WHERE opt LIKE 'autovacuum\_%') ||
+			ARRAY(SELECT 'toast.' || opt FROM unnest(t.reloptions) AS opt WHERE opt LIKE 'autovacuum\_%')
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_class t ON t.oid = c.reltoastrelid
+		WHERE n.nspname = $1 AND c.relname = $2
+	`)
+}
+
+// autovacuumStatement renders the ALTER TABLE statement restoring a table's autovacuum
+// storage parameters, such as autovacuum_vacuum_scale_factor=0.05
+func autovacuumStatement(schema, table string, options []string) string {
+	if len(options) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ALTER TABLE %s.%s SET (%s);\n", quoteIdent(schema), quoteIdent(table), strings.Join(options, ", "))
+}
+
+// fetchAutovacuumSettings returns the autovacuum storage parameters of a table and its toast table
+func (c *Connector) fetchAutovacuumSettings(ctx context.Context, obj *types.DBObject) ([]string, error) {
+	var options pq.StringArray
+	err := c.db.QueryRowContext(ctx, buildAutovacuumSettingsQuery(), obj.Schema, obj.Name).Scan(&options)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, stacktrace.Propagate(err, "Failed to query autovacuum settings of %s.%s", obj.Schema, obj.Name)
+	}
+	return options, nil
+}
+
+// buildTableOidsQuery creates the SQL query for whether a table was created WITH OIDS.
+// pg_class.relhasoids only exists before PostgreSQL 12, so the query must not run on later servers.
+func buildTableOidsQuery() string {
+	return strings.TrimSpace(`
+		SELECT c.relhasoids
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2
+	`)
+}
+
+// withOids adds the WITH OIDS clause to a CREATE TABLE statement whose column list closes
+// on its own last line, as the table definition query renders it
+func withOids(definition string) string {
+	trimmed := strings.TrimRight(definition, "\n")
+	if !strings.HasSuffix(trimmed, "\n);") {
+		return definition
+	}
+	return strings.TrimSuffix(trimmed, ";") + " WITH OIDS;"
+}
+
+// fetchTableHasOids reports whether a table has an oid system column. Servers from
+// PostgreSQL 12 on have no such tables, and servers whose version is unknown are not asked,
+// since the query fails wherever relhasoids is missing.
+func (c *Connector) fetchTableHasOids(ctx context.Context, obj *types.DBObject) (bool, error) {
+	if c.serverVersionNum == 0 || c.serverVersionNum >= oidsRemovedVersionNum {
+		return false, nil
+	}
+	var hasOids bool
+	err := c.db.QueryRowContext(ctx, buildTableOidsQuery(), obj.Schema, obj.Name).Scan(&hasOids)
+	if err != nil && err != sql.ErrNoRows {
+		return false, stacktrace.Propagate(err, "Failed to query WITH OIDS for %s.%s", obj.Schema, obj.Name)
+	}
+	return hasOids, nil
+}
+
+// fetchTableDefinition fetches a table's CREATE TABLE statement, WITH OIDS on servers that
+// still have them, followed by the statements restoring column statistics targets and
+// storage modes that were tuned after creation, its autovacuum settings, and the ownership
+// of sequences owned by its columns. Its foreign keys go to obj.ForeignKeys, to be added
+// once the tables they reference exist.
+func (c *Connector) fetchTableDefinition(ctx context.Context, obj *types.DBObject) error {
+	var definition sql.NullString
+	err := c.db.QueryRowContext(ctx, buildTableDefinitionQuery(c.definitionSource, c.serverVersionNum), obj.Schema, obj.Name).Scan(&definition)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return noDefinitionError(obj)
+		}
+		return stacktrace.Propagate(err, "Database error when fetching definition for %s.%s", obj.Schema, obj.Name)
+	}
+	if !definition.Valid {
+		return nullDefinitionError(obj)
+	}
+
+	rows, err := c.db.QueryContext(ctx, buildColumnSettingsQuery(), obj.Schema, obj.Name)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to query column settings for %s.%s", obj.Schema, obj.Name)
+	}
+	defer rows.Close()
+
+	var settings []columnSetting
+	for rows.Next() {
+		var s columnSetting
+		if err := rows.Scan(&s.name, &s.statsTarget, &s.storage, &s.typeStorage); err != nil {
+			return stacktrace.Propagate(err, "Failed to scan column settings for %s.%s", obj.Schema, obj.Name)
+		}
+		settings = append(settings, s)
+	}
+	if err := rows.Err(); err != nil {
+		return stacktrace.Propagate(err, "Error iterating column settings for %s.%s", obj.Schema, obj.Name)
+	}
+
+	sequences, err := c.fetchOwnedSequences(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	autovacuum, err := c.fetchAutovacuumSettings(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	hasOids, err := c.fetchTableHasOids(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	foreignKeys, err := c.fetchForeignKeys(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	obj.Definition = definition.String
+	if hasOids {
+		obj.Definition = withOids(obj.Definition)
+	}
+	if c.normalizeDefaults {
+		defaults, err := c.fetchColumnDefaults(ctx, obj)
+		if err != nil {
+			return err
+		}
+		obj.Definition = normalizeTableDefaults(obj.Definition, defaults)
+	}
+	statements := columnSettingsStatements(obj.Schema, obj.Name, settings) +
+		autovacuumStatement(obj.Schema, obj.Name, autovacuum) +
+		ownedSequenceStatements(obj.Schema, obj.Name, sequences)
+	if statements != "" {
+		obj.Definition = strings.TrimRight(obj.Definition, "\n") + "\n" + statements
+	}
+	obj.ForeignKeys = foreignKeyStatements(obj.Schema, obj.Name, foreignKeys)
+	return c.enforceDefinitionSize(obj)
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestBuildColumnSettingsQuery(t *testing.T) {
+	query := buildColumnSettingsQuery()
+	for _, part := range []string{"COALESCE(a.attstattarget, -1) >= 0", "a.attstorage <> t.typstorage", "NOT a.attisdropped"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', got: %s", part, query)
+		}
+	}
+}
+
+func TestFetchTableDefinitionColumnSettings(t *testing.T) {
+	createTable := "CREATE TABLE public.docs (\n    id integer NOT NULL,\n    body text,\n    title text\n);"
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0): {row: []driver.Value{createTable}},
+		buildColumnSettingsQuery(): {rows: [][]driver.Value{
+			{"id", int64(1000), "p", "p"},
+			{"body", int64(-1), "e", "x"},
+			{"title", int64(0), "m", "x"},
+		}},
+	})
+
+	obj := &types.DBObject{Type: types.TypeTable, Schema: "public", Name: "docs"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	expected := createTable + "\n" +
+		"ALTER TABLE public.docs ALTER COLUMN id SET STATISTICS 1000;\n" +
+		"ALTER TABLE public.docs ALTER COLUMN body SET STORAGE EXTERNAL;\n" +
+		"ALTER TABLE public.docs ALTER COLUMN title SET STATISTICS 0;\n" +
+		"ALTER TABLE public.docs ALTER COLUMN title SET STORAGE MAIN;\n"
+	if obj.Definition != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, obj.Definition)
+	}
+}
+
+func TestFetchTableDefinitionDefaultColumnSettings(t *testing.T) {
+	createTable := "CREATE TABLE public.plain (\n    id integer\n);"
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0): {row: []driver.Value{createTable}},
+	})
+
+	obj := &types.DBObject{Type: types.TypeTable, Schema: "public", Name: "plain"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	if obj.Definition != createTable {
+		t.Errorf("Expected the definition unchanged without tuned columns, got:\n%s", obj.Definition)
+	}
+}
+
+func TestFetchTableDefinitionOwnedSequences(t *testing.T) {
+	createTable := "CREATE TABLE public.orders (\n    id integer DEFAULT nextval('orders_id_seq'::regclass) NOT NULL\n);"
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0): {row: []driver.Value{createTable}},
+		buildOwnedSequencesQuery(): {rows: [][]driver.Value{
+			{"public", "orders_id_seq", "id"},
+			{"Billing", "order_numbers", "Number"},
+		}},
+	})
+
+	obj := &types.DBObject{Type: types.TypeTable, Schema: "public", Name: "orders"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	expected := createTable + "\n" +
+		"ALTER SEQUENCE public.orders_id_seq OWNED BY public.orders.id;\n" +
+		`ALTER SEQUENCE "Billing".order_numbers OWNED BY public.orders."Number";` + "\n"
+	if obj.Definition != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, obj.Definition)
+	}
+}
+
+func TestBuildOwnedSequencesQuery(t *testing.T) {
+	query := buildOwnedSequencesQuery()
+	// Identity sequences depend on their column with deptype 'i' and must not be listed
+	for _, part := range []string{"d.deptype = 'a'", "s.relkind = 'S'", "a.attnum = d.refobjsubid"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', got: %s", part, query)
+		}
+	}
+}
+
+func TestFetchTableDefinitionForeignKeys(t *testing.T) {
+	createTable := "CREATE TABLE public.orders (\n    id integer NOT NULL,\n    user_id integer\n);"
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0): {row: []driver.Value{createTable}},
+		buildForeignKeysQuery(): {rows: [][]driver.Value{
+			{"orders_user_fk", "FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL"},
+			{"Orders_Pair", "FOREIGN KEY (id, user_id) REFERENCES pairs(a, b)"},
+		}},
+	})
+
+	obj := &types.DBObject{Type: types.TypeTable, Schema: "public", Name: "orders"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	// The referenced tables may not exist yet when the table is created
+	if obj.Definition != createTable {
+		t.Errorf("Expected the definition without foreign keys, got:\n%s", obj.Definition)
+	}
+	expected := "ALTER TABLE ONLY public.orders ADD CONSTRAINT orders_user_fk FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL;\n" +
+		`ALTER TABLE ONLY public.orders ADD CONSTRAINT "Orders_Pair" FOREIGN KEY (id, user_id) REFERENCES pairs(a, b);` + "\n"
+	if obj.ForeignKeys != expected {
+		t.Errorf("Expected foreign keys:\n%s\ngot:\n%s", expected, obj.ForeignKeys)
+	}
+}
+
+func TestBuildForeignKeysQuery(t *testing.T) {
+	query := buildForeignKeysQuery()
+	// One row per constraint keeps composite keys and both referential actions intact
+	for _, part := range []string{"pg_get_constraintdef(c.oid, true)", "c.contype = 'f'"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', got: %s", part, query)
+		}
+	}
+	for _, part := range []string{"key_column_usage", "rc.delete_rule", "referential_constraints"} {
+		if strings.Contains(query, part) {
+			t.Errorf("Query should not reconstruct foreign keys via '%s'", part)
+		}
+	}
+}
+
+func TestFetchTableDefinitionAutovacuumSettings(t *testing.T) {
+	createTable := "CREATE TABLE public.events (\n    id bigint NOT NULL\n);"
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildTableDefinitionQuery(DefinitionSourcePgCatalog, 0): {row: []driver.Value{createTable}},
+		buildAutovacuumSettingsQuery(): {row: []driver.Value{
+			"{autovacuum_vacuum_scale_factor=0.01,autovacuum_analyze_threshold=500,toast.autovacuum_enabled=false}",
+		}},
+	})
+
+	obj := &types.DBObject{Type: types.TypeTable, Schema: "public", Name: "events"}
+	if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+		t.Fatalf("FetchObjectDefinition failed: %v", err)
+	}
+	expected := createTable + "\n" +
+		"ALTER TABLE public.events SET (autovacuum_vacuum_scale_factor=0.01, autovacuum_analyze_threshold=500, toast.autovacuum_enabled=false);\n"
+	if obj.Definition != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, obj.Definition)
+	}
+}
+
+func TestBuildAutovacuumSettingsQuery(t *testing.T) {
+	query := buildAutovacuumSettingsQuery()
+	// Other storage parameters such as fillfactor are left out
+	for _, part := range []string{`opt LIKE 'autovacuum\_%'`, "'toast.' || opt", "t.oid = c.reltoastrelid"} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain '%s', got: %s", part, query)
+		}
+	}
+}
+
+func TestFetchTableDefinitionWithOids(t *testing.T) {
+	createTable := "CREATE TABLE public.legacy (\n    id integer\n);"
+	for _, tt := range []struct {
+		name       string
+		versionNum int
+		expected   string
+	}{
+		{"PostgreSQL 11", 110005, "CREATE TABLE public.legacy (\n    id integer\n) WITH OIDS;"},
+		// relhasoids is gone, so asking would fail the fetch
+		{"PostgreSQL 12", 120000, createTable},
+		{"unknown version", 0, createTable},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Only the query for this server version is answered, so the fetch fails if the
+			// connector builds another one
+			tableQuery := buildTableDefinitionQuery(DefinitionSourcePgCatalog, tt.versionNum)
+			if tt.versionNum != 0 && tt.versionNum < 120000 && strings.Contains(tableQuery, "attgenerated") {
+				t.Fatalf("Expected the table query for %s not to read attgenerated, got: %s", tt.name, tableQuery)
+			}
+			connector := newScriptedConnector(t, map[string]scriptedResult{
+				tableQuery:            {row: []driver.Value{createTable}},
+				buildTableOidsQuery(): {row: []driver.Value{true}},
+			})
+			connector.serverVersionNum = tt.versionNum
+
+			obj := &types.DBObject{Type: types.TypeTable, Schema: "public", Name: "legacy"}
+			if err := connector.FetchObjectDefinition(context.Background(), obj); err != nil {
+				t.Fatalf("FetchObjectDefinition failed: %v", err)
+			}
+			if obj.Definition != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, obj.Definition)
+			}
+		})
+	}
+}
+
+func TestWithOids(t *testing.T) {
+	if got := withOids("CREATE TABLE t (\n    id integer\n);\n"); got != "CREATE TABLE t (\n    id integer\n) WITH OIDS;" {
+		t.Errorf("Unexpected definition: %q", got)
+	}
+	// Anything but a column list closing on its own line is left alone
+	if got := withOids("CREATE TABLE t () PARTITION BY RANGE (id);"); got != "CREATE TABLE t () PARTITION BY RANGE (id);" {
+		t.Errorf("Unexpected definition: %q", got)
+	}
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"os"
+	"strings"
+
+	"github.com/skamensky/pgmeta/internal/log"
+)
+
+// TLSFiles are the certificate and key files of a TLS connection, as managed providers
+// requiring client certificates expect. Empty fields are left to the connection string.
+type TLSFiles struct {
+	RootCert string // CA certificate the server's certificate is verified against (sslrootcert)
+	Cert     string // Client certificate (sslcert)
+	Key      string // Private key of the client certificate (sslkey)
+}
+
+// params returns the connection string keys of the files that are set, in a stable order
+func (f TLSFiles) params() [][2]string {
+	var params [][2]string
+	for _, p := range [][2]string{{"sslrootcert", f.RootCert}, {"sslcert", f.Cert}, {"sslkey", f.Key}} {
+		if p[1] != "" {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// quoteConnValue quotes a key/value connection string value when it holds spaces, quotes
+// or backslashes, as lib/pq parses them
+func quoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// withTLSFiles adds the files to a key/value connection string, overriding any it already
+// names, after checking that each one can be read. lib/pq only uses them when sslmode
+// enables TLS.
+func withTLSFiles(connStr string, files TLSFiles) (string, error) {
+	params := files.params()
+	if len(params) == 0 {
+		return connStr, nil
+	}
+	for _, p := range params {
+		f, err := os.Open(p[1])
+		if err != nil {
+			return "", connectionError(err, "", "Cannot read the %s file: %s", p[0], p[1])
+		}
+		f.Close()
+		// lib/pq uses the last value of a repeated key
+		connStr += " " + p[0] + "=" + quoteConnValue(p[1])
+	}
+	if strings.Contains(connStr, "sslmode=disable") {
+		log.Warn("TLS certificate files are ignored with sslmode=disable; set sslmode to require, verify-ca or verify-full")
+	}
+	return strings.TrimSpace(connStr), nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/palantir/stacktrace"
+)
+
+func TestWithTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	rootCert := filepath.Join(dir, "root.crt")
+	cert := filepath.Join(dir, "client cert.crt")
+	key := filepath.Join(dir, "client.key")
+	for _, path := range []string{rootCert, cert, key} {
+		if err := os.WriteFile(path, []byte("-----BEGIN-----\n"), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	base := "host=db.example.com dbname=app sslmode=verify-full sslrootcert=/old/root.crt"
+
+	connStr, err := withTLSFiles(base, TLSFiles{RootCert: rootCert, Cert: cert, Key: key})
+	if err != nil {
+		t.Fatalf("withTLSFiles failed: %v", err)
+	}
+	// The given root certificate comes last, so lib/pq uses it over the one already set
+	want := base + " sslrootcert=" + rootCert + " sslcert='" + cert + "' sslkey=" + key
+	if connStr != want {
+		t.Errorf("Expected %q, got %q", want, connStr)
+	}
+
+	if unchanged, err := withTLSFiles(base, TLSFiles{}); err != nil || unchanged != base {
+		t.Errorf("Expected no files to leave the connection string unchanged, got %q, %v", unchanged, err)
+	}
+
+	_, err = withTLSFiles(base, TLSFiles{Key: filepath.Join(dir, "missing.key")})
+	if err == nil {
+		t.Fatal("Expected an unreadable key file to fail")
+	}
+	if stacktrace.GetCode(err) != ErrCodeConnection {
+		t.Errorf("Expected a connection error, got code %v", stacktrace.GetCode(err))
+	}
+}
+
+func TestQuoteConnValue(t *testing.T) {
+	for value, want := range map[string]string{
+		"/certs/root.crt":   "/certs/root.crt",
+		"/my certs/a.crt":   "'/my certs/a.crt'",
+		`C:\certs\it's.pem`: `'C:\\certs\\it\'s.pem'`,
+	} {
+		if got := quoteConnValue(value); got != want {
+			t.Errorf("quoteConnValue(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+)
+
+// MinServerVersionNum is the oldest server_version_num the catalog queries support.
+// They rely on pg_proc.prokind and pg_publication, which arrived in PostgreSQL 11.
+const MinServerVersionNum = 110000
+
+// generatedColumnsVersionNum is the server_version_num of PostgreSQL 12, which added
+// generated columns along with pg_attribute.attgenerated
+const generatedColumnsVersionNum = 120000
+
+// hasGeneratedColumns reports whether a server of versionNum has pg_attribute.attgenerated.
+// A server whose version is unknown is assumed to be recent.
+func hasGeneratedColumns(versionNum int) bool {
+	return versionNum == 0 || versionNum >= generatedColumnsVersionNum
+}
+
+// oidsRemovedVersionNum is the server_version_num of PostgreSQL 12, which dropped WITH OIDS
+// tables along with pg_class.relhasoids
+const oidsRemovedVersionNum = 120000
+
+// buildServerVersionQuery creates the SQL query for the numeric server version and the
+// full version() banner
+func buildServerVersionQuery() string {
+	return "SELECT current_setting('server_version_num'), version()"
+}
+
+// serverVersionProblem explains why a server reporting versionNum and version is not
+// supported, or returns "" when it is. Servers that speak the PostgreSQL protocol but are
+// not PostgreSQL, such as Redshift and CockroachDB, report a PostgreSQL version while
+// lacking much of pg_catalog, so the version() banner is checked as well.
+func serverVersionProblem(versionNum, version string) string {
+	for _, fork := range []string{"Redshift", "CockroachDB"} {
+		if strings.Contains(version, fork) {
+			return fork + " is not PostgreSQL (" + version + ")"
+		}
+	}
+	if !strings.HasPrefix(version, "PostgreSQL ") {
+		return "the server does not identify as PostgreSQL (" + version + ")"
+	}
+
+	num, err := strconv.Atoi(strings.TrimSpace(versionNum))
+	if err != nil {
+		return "the server reports an unrecognized server_version_num " + strconv.Quote(versionNum)
+	}
+	if num < MinServerVersionNum {
+		return "server_version_num " + versionNum + " is below the minimum supported " + strconv.Itoa(MinServerVersionNum)
+	}
+	return ""
+}
+
+// checkServerVersion warns when the server is older than MinServerVersionNum or not
+// genuine PostgreSQL, where exports fail part way through with confusing catalog errors.
+// With strict set it returns an error instead.
+func (c *Connector) checkServerVersion(ctx context.Context, strict bool) error {
+	var versionNum, version string
+	var problem string
+	if err := c.db.QueryRowContext(ctx, buildServerVersionQuery()).Scan(&versionNum, &version); err != nil {
+		problem = "the server version could not be read: " + err.Error()
+	} else {
+		problem = serverVersionProblem(versionNum, version)
+		// Catalog queries that differ between versions are chosen by the number
+		if num, err := strconv.Atoi(strings.TrimSpace(versionNum)); err == nil {
+			c.serverVersionNum = num
+		}
+	}
+	if problem == "" {
+		log.Debug("Server version %s is supported", versionNum)
+		return nil
+	}
+
+	if strict {
+		return stacktrace.NewError("Unsupported server: %s", problem)
+	}
+	log.Warn("Unsupported server: %s. pgmeta requires PostgreSQL 11 or later; expect queries to fail (use --strict-version to stop here instead)", problem)
+	return nil
+}
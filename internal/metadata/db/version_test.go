@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+// redshiftVersion is what version() returns on Amazon Redshift
+const redshiftVersion = "PostgreSQL 8.0.2 on i686-pc-linux-gnu, compiled by GCC gcc (GCC) 3.4.2 20041017 (Red Hat 3.4.2-6.fc3), Redshift 1.0.54321"
+
+func TestServerVersionProblem(t *testing.T) {
+	tests := []struct {
+		name       string
+		versionNum string
+		version    string
+		problem    string
+	}{
+		{"supported", "160002", "PostgreSQL 16.2 on x86_64-pc-linux-gnu", ""},
+		{"minimum", "110000", "PostgreSQL 11.0", ""},
+		{"too old", "90624", "PostgreSQL 9.6.24 on x86_64-pc-linux-gnu", "below the minimum"},
+		{"redshift", "80002", redshiftVersion, "Redshift is not PostgreSQL"},
+		{"cockroachdb", "130000", "CockroachDB CCL v23.1.11 (x86_64-pc-linux-gnu)", "CockroachDB is not PostgreSQL"},
+		{"unknown", "150000", "SomeDB 1.0", "does not identify as PostgreSQL"},
+		{"bad number", "", "PostgreSQL 16.2", "unrecognized server_version_num"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := serverVersionProblem(tt.versionNum, tt.version)
+			if tt.problem == "" && problem != "" {
+				t.Errorf("Expected no problem, got %q", problem)
+			}
+			if !strings.Contains(problem, tt.problem) {
+				t.Errorf("Expected a problem containing %q, got %q", tt.problem, problem)
+			}
+		})
+	}
+}
+
+func TestCheckServerVersionRedshift(t *testing.T) {
+	connector := newScriptedConnector(t, map[string]scriptedResult{
+		buildServerVersionQuery(): {row: []driver.Value{"80002", redshiftVersion}},
+	})
+
+	if err := connector.checkServerVersion(context.Background(), false); err != nil {
+		t.Errorf("Expected only a warning without --strict-version, got %v", err)
+	}
+	err := connector.checkServerVersion(context.Background(), true)
+	if err == nil || !strings.Contains(err.Error(), "Redshift") {
+		t.Errorf("Expected --strict-version to reject Redshift, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package metadata
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// TypeEstimate holds the object count and extrapolated output size for one object type
+type TypeEstimate struct {
+	Type           types.ObjectType
+	Count          int
+	Sampled        int
+	EstimatedBytes int64
+}
+
+// Estimate summarizes how many objects an export would write and roughly how large it would be
+type Estimate struct {
+	Types          []TypeEstimate
+	TotalCount     int
+	TotalSampled   int
+	TotalFailed    int // Sampled definitions that could not be fetched, left out of the averages
+	EstimatedBytes int64
+}
+
+// EstimateObjects fetches definitions for a random sample of about sampleSize objects
+// and extrapolates the total output size per object type
+func (f *Fetcher) EstimateObjects(objects []types.DBObject, sampleSize, concurrency int) (Estimate, error) {
+	sample := sampleObjects(objects, sampleSize, rand.New(rand.NewSource(time.Now().UnixNano())))
+
+	ctx := f.ctx
+	fetched, failed, err := f.connector.FetchObjectsDefinitionsConcurrently(ctx, sample, concurrency)
+	if err != nil {
+		return Estimate{}, stacktrace.Propagate(err, "Failed to fetch sampled definitions")
+	}
+	return extrapolate(objects, fetched, failed), nil
+}
+
+// sampleObjects picks about n objects at random, stratified by type so every type
+// present is sampled at least once and larger types get proportionally more samples
+func sampleObjects(objects []types.DBObject, n int, rng *rand.Rand) []types.DBObject {
+	if n <= 0 {
+		return nil
+	}
+	if len(objects) <= n {
+		return objects
+	}
+
+	byType := make(map[types.ObjectType][]types.DBObject)
+	for _, obj := range objects {
+		byType[obj.Type] = append(byType[obj.Type], obj)
+	}
+
+	var sample []types.DBObject
+	for _, objType := range sortedTypes(byType) {
+		group := byType[objType]
+		quota := n * len(group) / len(objects)
+		if quota < 1 {
+			quota = 1
+		}
+		if quota > len(group) {
+			quota = len(group)
+		}
+		for _, i := range rng.Perm(len(group))[:quota] {
+			sample = append(sample, group[i])
+		}
+	}
+	return sample
+}
+
+// extrapolate scales the average definition size of each sampled type up to the full object count.
+// Samples whose key is in failed have no definition and are left out of the averages, so
+// types without a successfully fetched sample fall back to the overall average.
+func extrapolate(objects, sampled []types.DBObject, failed []types.ObjectKey) Estimate {
+	counts := make(map[types.ObjectType][]types.DBObject)
+	for _, obj := range objects {
+		counts[obj.Type] = append(counts[obj.Type], obj)
+	}
+
+	isFailed := make(map[types.ObjectKey]bool, len(failed))
+	for _, key := range failed {
+		isFailed[key] = true
+	}
+
+	sampledBytes := make(map[types.ObjectType]int64)
+	sampledCount := make(map[types.ObjectType]int)
+	var totalBytes int64
+	var totalSampled int
+	for _, obj := range sampled {
+		if isFailed[obj.Key()] {
+			continue
+		}
+		totalSampled++
+		sampledBytes[obj.Type] += int64(len(obj.Definition))
+		sampledCount[obj.Type]++
+		totalBytes += int64(len(obj.Definition))
+	}
+
+	var overallAvg int64
+	if totalSampled > 0 {
+		overallAvg = totalBytes / int64(totalSampled)
+	}
+
+	estimate := Estimate{TotalCount: len(objects), TotalSampled: totalSampled, TotalFailed: len(sampled) - totalSampled}
+	for _, objType := range sortedTypes(counts) {
+		count := len(counts[objType])
+		avg := overallAvg
+		if n := sampledCount[objType]; n > 0 {
+			avg = sampledBytes[objType] / int64(n)
+		}
+		typeEstimate := TypeEstimate{
+			Type:           objType,
+			Count:          count,
+			Sampled:        sampledCount[objType],
+			EstimatedBytes: avg * int64(count),
+		}
+		estimate.Types = append(estimate.Types, typeEstimate)
+		estimate.EstimatedBytes += typeEstimate.EstimatedBytes
+	}
+	return estimate
+}
+
+// sortedTypes returns the keys of a per-type grouping in a stable order
+func sortedTypes(groups map[types.ObjectType][]types.DBObject) []types.ObjectType {
+	keys := make([]types.ObjectType, 0, len(groups))
+	for objType := range groups {
+		keys = append(keys, objType)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
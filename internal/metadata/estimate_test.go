@@ -0,0 +1,108 @@
+package metadata
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// estimateTestObjects returns tables, indexes and a single view
+func estimateTestObjects() []types.DBObject {
+	var objects []types.DBObject
+	for i := 0; i < 80; i++ {
+		objects = append(objects, types.DBObject{Type: types.TypeTable, Schema: "public", Name: strings.Repeat("t", i+1)})
+	}
+	for i := 0; i < 19; i++ {
+		objects = append(objects, types.DBObject{Type: types.TypeIndex, Schema: "public", Name: strings.Repeat("i", i+1)})
+	}
+	objects = append(objects, types.DBObject{Type: types.TypeView, Schema: "public", Name: "v"})
+	return objects
+}
+
+func TestSampleObjects(t *testing.T) {
+	objects := estimateTestObjects()
+	sample := sampleObjects(objects, 10, rand.New(rand.NewSource(1)))
+
+	byType := make(map[types.ObjectType]int)
+	for _, obj := range sample {
+		byType[obj.Type]++
+	}
+
+	// Quotas are proportional to the type's share, but every type is sampled
+	if byType[types.TypeTable] != 8 {
+		t.Errorf("Expected 8 sampled tables, got %d", byType[types.TypeTable])
+	}
+	if byType[types.TypeIndex] != 1 {
+		t.Errorf("Expected 1 sampled index, got %d", byType[types.TypeIndex])
+	}
+	if byType[types.TypeView] != 1 {
+		t.Errorf("Expected 1 sampled view, got %d", byType[types.TypeView])
+	}
+
+	// Small inputs are returned whole
+	if got := sampleObjects(objects[:5], 10, rand.New(rand.NewSource(1))); len(got) != 5 {
+		t.Errorf("Expected all 5 objects to be sampled, got %d", len(got))
+	}
+	if got := sampleObjects(objects, 0, rand.New(rand.NewSource(1))); len(got) != 0 {
+		t.Errorf("Expected no sample for size 0, got %d", len(got))
+	}
+}
+
+func TestExtrapolate(t *testing.T) {
+	objects := estimateTestObjects()
+	sampled := []types.DBObject{
+		{Type: types.TypeTable, Definition: strings.Repeat("x", 100)},
+		{Type: types.TypeTable, Definition: strings.Repeat("x", 300)},
+		{Type: types.TypeIndex, Definition: strings.Repeat("x", 50)},
+	}
+
+	estimate := extrapolate(objects, sampled, nil)
+
+	if estimate.TotalCount != 100 || estimate.TotalSampled != 3 {
+		t.Errorf("Unexpected totals: %+v", estimate)
+	}
+
+	expected := map[types.ObjectType]int64{
+		types.TypeTable: 200 * 80, // Average of the sampled tables
+		types.TypeIndex: 50 * 19,
+		types.TypeView:  150, // No sample, falls back to the overall average
+	}
+	var total int64
+	for _, typeEstimate := range estimate.Types {
+		if typeEstimate.EstimatedBytes != expected[typeEstimate.Type] {
+			t.Errorf("Expected %d bytes for %s, got %d", expected[typeEstimate.Type], typeEstimate.Type, typeEstimate.EstimatedBytes)
+		}
+		total += expected[typeEstimate.Type]
+	}
+	if estimate.EstimatedBytes != total {
+		t.Errorf("Expected total of %d bytes, got %d", total, estimate.EstimatedBytes)
+	}
+}
+
+func TestExtrapolateSkipsFailedSamples(t *testing.T) {
+	objects := estimateTestObjects()
+	sampled := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "t1", Definition: strings.Repeat("x", 100)},
+		{Type: types.TypeTable, Schema: "public", Name: "t2"}, // Failed, so it has no definition
+		{Type: types.TypeIndex, Schema: "public", Name: "i1"}, // Failed
+	}
+	failed := []types.ObjectKey{sampled[1].Key(), sampled[2].Key()}
+
+	estimate := extrapolate(objects, sampled, failed)
+
+	if estimate.TotalSampled != 1 || estimate.TotalFailed != 2 {
+		t.Errorf("Expected 1 sample and 2 failed, got %+v", estimate)
+	}
+	expected := map[types.ObjectType]int64{
+		types.TypeTable: 100 * 80, // The failed table does not halve the average
+		types.TypeIndex: 100 * 19, // No successful sample, falls back to the overall average
+		types.TypeView:  100,
+	}
+	for _, typeEstimate := range estimate.Types {
+		if typeEstimate.EstimatedBytes != expected[typeEstimate.Type] {
+			t.Errorf("Expected %d bytes for %s, got %d", expected[typeEstimate.Type], typeEstimate.Type, typeEstimate.EstimatedBytes)
+		}
+	}
+}
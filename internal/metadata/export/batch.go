@@ -0,0 +1,95 @@
+package export
+
+import (
+	"context"
+
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// WithBatchSize makes the export fetch and write definitions n objects at a time, so only
+// one batch of definitions is held in memory instead of all of them. 0, the default,
+// fetches every definition before writing any file.
+func (e *Exporter) WithBatchSize(n int) *Exporter {
+	if n >= 0 {
+		e.batchSize = n
+	}
+	return e
+}
+
+// batchUnit returns the key of the group obj must be written with: a table and every
+// object stored under it share their table's key, so a table directory is always written
+// by a single batch. Other objects are a group of their own.
+func batchUnit(obj types.DBObject) (types.ObjectKey, bool) {
+	switch {
+	case obj.Type == types.TypeTable:
+		return tableKey(obj.Schema, obj.Name), true
+	case obj.TableName != "":
+		return tableKey(obj.Schema, obj.TableName), true
+	}
+	return types.ObjectKey{}, false
+}
+
+// batchObjects splits objects into batches of about size objects, keeping each table
+// together with its child objects. A batch only exceeds size when a single table has more
+// objects than that. Groups keep the order in which they first appear.
+func batchObjects(objects []types.DBObject, size int) [][]types.DBObject {
+	var groups [][]types.DBObject
+	tableGroups := make(map[types.ObjectKey]int)
+	for _, obj := range objects {
+		key, isTable := batchUnit(obj)
+		if !isTable {
+			groups = append(groups, []types.DBObject{obj})
+			continue
+		}
+		i, ok := tableGroups[key]
+		if !ok {
+			i = len(groups)
+			tableGroups[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], obj)
+	}
+
+	var batches [][]types.DBObject
+	var batch []types.DBObject
+	for _, group := range groups {
+		if len(batch) > 0 && len(batch)+len(group) > size {
+			batches = append(batches, batch)
+			batch = nil
+		}
+		batch = append(batch, group...)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// exportInBatches fetches and writes objects one batch at a time. Collisions and owners
+// only depend on names, so they are settled for all objects before the first fetch;
+// everything that needs the complete export, such as the manifest, is left to the caller.
+func (e *Exporter) exportInBatches(ctx context.Context, objects []types.DBObject, continueOnError bool) error {
+	// Two objects must never overwrite each other's file, even in different batches
+	objects, err := resolveCollisions(objects, continueOnError)
+	if err != nil {
+		return err
+	}
+
+	if err := e.fetchOwners(ctx, objects); err != nil {
+		return err
+	}
+
+	batches := batchObjects(objects, e.batchSize)
+	for i, batch := range batches {
+		log.Info("Exporting batch %d of %d (%d objects)", i+1, len(batches), len(batch))
+		withDefs, err := e.prepareDefinitions(ctx, batch, continueOnError)
+		if err != nil {
+			return err
+		}
+		if err := e.writeObjects(ctx, withDefs, continueOnError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
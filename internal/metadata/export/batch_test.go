@@ -0,0 +1,174 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// batchRecordingConnector is a mockConnector that remembers the size of every fetch
+type batchRecordingConnector struct {
+	mockConnector
+	batchMu sync.Mutex
+	batches []int
+}
+
+func (b *batchRecordingConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
+	b.batchMu.Lock()
+	b.batches = append(b.batches, len(objects))
+	b.batchMu.Unlock()
+	return b.mockConnector.FetchObjectsDefinitionsConcurrently(ctx, objects, concurrency)
+}
+
+func TestBatchObjects(t *testing.T) {
+	users := types.DBObject{Type: types.TypeTable, Schema: "public", Name: "users"}
+	usersIdx := types.DBObject{Type: types.TypeIndex, Schema: "public", Name: "users_idx", TableName: "users"}
+	usersPkey := types.DBObject{Type: types.TypeConstraint, Schema: "public", Name: "users_pkey", TableName: "users"}
+	tag := types.DBObject{Type: types.TypeFunction, Schema: "public", Name: "tag"}
+	report := types.DBObject{Type: types.TypeView, Schema: "public", Name: "report"}
+
+	batches := batchObjects([]types.DBObject{usersIdx, tag, users, report, usersPkey}, 2)
+
+	// The users group is three objects, more than a batch, but is never split
+	want := [][]types.DBObject{
+		{usersIdx, users, usersPkey},
+		{tag, report},
+	}
+	if fmt.Sprint(batches) != fmt.Sprint(want) {
+		t.Errorf("Expected batches %v, got %v", want, batches)
+	}
+}
+
+func TestExportInBatches(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	var objects []types.DBObject
+	for i := range 5 {
+		table := fmt.Sprintf("t%d", i)
+		objects = append(objects,
+			types.DBObject{Type: types.TypeTable, Schema: "public", Name: table},
+			types.DBObject{Type: types.TypeIndex, Schema: "public", Name: table + "_idx", TableName: table},
+			types.DBObject{Type: types.TypeFunction, Schema: "public", Name: "f" + table},
+		)
+	}
+
+	connector := &batchRecordingConnector{}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	exporter.WithBatchSize(4).WithManifest(true, false)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	if len(connector.batches) != 5 {
+		t.Errorf("Expected 15 objects to be fetched in 5 batches of at most 4, got %v", connector.batches)
+	}
+	for _, size := range connector.batches {
+		if size > 4 {
+			t.Errorf("Expected no batch larger than 4, got %v", connector.batches)
+		}
+	}
+
+	for i := range 5 {
+		table := fmt.Sprintf("t%d", i)
+		for _, path := range []string{
+			filepath.Join(outputDir, "public", "tables", table, "table.sql"),
+			filepath.Join(outputDir, "public", "tables", table, "indexes", table+"_idx.sql"),
+			filepath.Join(outputDir, "public", "functions", "f"+table+".sql"),
+		} {
+			if _, err := fs.ReadFile(path); err != nil {
+				t.Errorf("Expected %s to be written: %v", path, err)
+			}
+		}
+	}
+
+	// The manifest still covers every batch
+	manifest, err := fs.ReadFile(filepath.Join(outputDir, "apply.sql"))
+	if err != nil {
+		t.Fatalf("Expected apply.sql to be written: %v", err)
+	}
+	if lines := strings.Count(string(manifest), "\\ir "); lines != len(objects) {
+		t.Errorf("Expected %d files in the manifest, got %d:\n%s", len(objects), lines, manifest)
+	}
+}
+
+// largeDefinitionConnector returns a definition of definitionSize bytes for every object
+type largeDefinitionConnector struct {
+	mockConnector
+	definitionSize int
+}
+
+func (l *largeDefinitionConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
+	results := make([]types.DBObject, len(objects))
+	for i, obj := range objects {
+		obj.Definition = "-- " + obj.Name + "\n" + strings.Repeat("x", l.definitionSize)
+		results[i] = obj
+	}
+	return results, nil, nil
+}
+
+// discardFileSystem accepts every write and keeps nothing, so only the exporter's own
+// memory is measured
+type discardFileSystem struct{}
+
+func (discardFileSystem) MkdirAll(path string, perm os.FileMode) error               { return nil }
+func (discardFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error { return nil }
+
+// BenchmarkExportMemory compares the peak heap of exporting 2000 functions of 64 KiB each
+// with all definitions fetched up front and in batches of 100:
+//
+//	go test ./internal/metadata/export -run '^$' -bench ExportMemory
+func BenchmarkExportMemory(b *testing.B) {
+	var objects []types.DBObject
+	for i := range 2000 {
+		objects = append(objects, types.DBObject{Type: types.TypeFunction, Schema: "public", Name: fmt.Sprintf("f%d", i)})
+	}
+
+	for _, batchSize := range []int{0, 100} {
+		b.Run(fmt.Sprintf("batch-size=%d", batchSize), func(b *testing.B) {
+			var peak uint64
+			for range b.N {
+				exporter := NewWithMock(&largeDefinitionConnector{definitionSize: 64 << 10}, "/pgmeta-output").
+					WithFileSystem(discardFileSystem{}).
+					WithBatchSize(batchSize)
+				runtime.GC()
+				peak = max(peak, peakHeap(func() {
+					if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+						b.Fatalf("ExportObjects failed: %v", err)
+					}
+				}))
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MiB")
+		})
+	}
+}
+
+// peakHeap runs fn and returns the largest heap size sampled while it ran
+func peakHeap(fn func()) uint64 {
+	var peak uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapAlloc)
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+	fn()
+	close(done)
+	<-sampled
+	return peak
+}
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// catalogHeader is the first row of the catalog
+var catalogHeader = []string{"schema", "type", "name", "table_name", "owner", "definition_sha256", "file_path"}
+
+// WithCatalog writes a catalog with one row per exported file at path, relative to the
+// output directory. A path ending in .tsv is tab-separated, anything else comma-separated.
+func (e *Exporter) WithCatalog(path string) *Exporter {
+	e.catalogPath = path
+	return e
+}
+
+// writeCatalog writes the catalog of every file this export wrote, sorted by file path.
+// Paths are relative to the output directory and always use forward slashes.
+func (e *Exporter) writeCatalog() error {
+	e.writtenMu.Lock()
+	entries := append([]exportedFile(nil), e.writtenFiles...)
+	e.writtenMu.Unlock()
+
+	rows := make([][]string, 0, len(entries))
+	for _, entry := range entries {
+		rel, err := filepath.Rel(e.outputDir, entry.path)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to compute catalog path for %s", entry.path)
+		}
+		name := entry.objName
+		if entry.objType == types.TypeTable {
+			name = entry.tableName
+		}
+		owner := e.owners[entry.key]
+		rows = append(rows, []string{entry.objSchema, string(entry.objType), name, entry.tableName, owner, entry.sha256, filepath.ToSlash(rel)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][6] < rows[j][6]
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if strings.HasSuffix(strings.ToLower(e.catalogPath), ".tsv") {
+		w.Comma = '\t'
+	}
+	if err := w.Write(catalogHeader); err != nil {
+		return stacktrace.Propagate(err, "Failed to encode catalog")
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return stacktrace.Propagate(err, "Failed to encode catalog")
+	}
+
+	path := filepath.Join(e.outputDir, e.catalogPath)
+	if err := e.writeFile(path, buf.Bytes()); err != nil {
+		return stacktrace.Propagate(err, "Failed to write catalog: %s", path)
+	}
+	log.Info("Wrote catalog with %d entries to %s", len(rows), path)
+	return nil
+}
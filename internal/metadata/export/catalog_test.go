@@ -0,0 +1,80 @@
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestExportCatalog(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	users := types.DBObject{Type: types.TypeTable, Schema: "public", Name: "users", Definition: "CREATE TABLE public.users ();"}
+	usersIdx := types.DBObject{Type: types.TypeIndex, Schema: "public", Name: "users_idx", TableName: "users", Definition: "CREATE INDEX users_idx ON public.users (id);"}
+	quoted := types.DBObject{Type: types.TypeView, Schema: "public", Name: `totals, "net"`, Definition: `CREATE VIEW public."totals, ""net""" AS SELECT 1;`}
+	connector := &ownerConnector{owners: map[types.ObjectKey]string{
+		users.Key():    "app_owner",
+		usersIdx.Key(): "app_owner",
+	}}
+
+	exporter := NewWithMock(connector, outputDir).WithCatalog("catalog.csv")
+	fs := NewMemFileSystem()
+	exporter.WithFileSystem(fs)
+	objects := []types.DBObject{users, usersIdx, quoted}
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	content, err := fs.ReadFile(filepath.Join(outputDir, "catalog.csv"))
+	if err != nil {
+		t.Fatalf("Expected catalog.csv to be written: %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(content))).ReadAll()
+	if err != nil {
+		t.Fatalf("catalog.csv is not valid CSV: %v\n%s", err, content)
+	}
+
+	digest := func(definition string) string {
+		sum := sha256.Sum256([]byte(definition))
+		return hex.EncodeToString(sum[:])
+	}
+	want := [][]string{
+		catalogHeader,
+		{"public", "index", "users_idx", "users", "app_owner", digest(usersIdx.Definition), "public/tables/users/indexes/users_idx.sql"},
+		{"public", "table", "users", "users", "app_owner", digest(users.Definition), "public/tables/users/table.sql"},
+		{"public", "view", `totals, "net"`, "", "", digest(quoted.Definition), `public/views/totals, "net".sql`},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("Expected %d rows, got %d:\n%s", len(want), len(rows), content)
+	}
+	for i := range want {
+		if strings.Join(rows[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("Row %d:\nexpected %q\ngot      %q", i, want[i], rows[i])
+		}
+	}
+}
+
+func TestExportCatalogTSV(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	exporter := NewWithMock(&ownerConnector{}, outputDir).WithCatalog("catalog.tsv")
+	fs := NewMemFileSystem()
+	exporter.WithFileSystem(fs)
+	objects := []types.DBObject{{Type: types.TypeFunction, Schema: "public", Name: "tag"}}
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	content, err := fs.ReadFile(filepath.Join(outputDir, "catalog.tsv"))
+	if err != nil {
+		t.Fatalf("Expected catalog.tsv to be written: %v", err)
+	}
+	header, _, _ := strings.Cut(string(content), "\n")
+	if header != strings.Join(catalogHeader, "\t") {
+		t.Errorf("Expected a tab-separated header, got %q", header)
+	}
+}
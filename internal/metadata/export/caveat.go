@@ -0,0 +1,51 @@
+package export
+
+import (
+	"strings"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// caveats are the restore prerequisites of the object types that have any, written as
+// a comment header on their definition files with WithCaveatHeaders
+var caveats = map[types.ObjectType]string{
+	types.TypeSubscription:     "The publication must exist on the publisher first; creating the subscription connects to it and copies its data unless connect = false.",
+	types.TypePublication:      "The tables it publishes must exist first.",
+	types.TypeMaterializedView: "Created WITH NO DATA if it was unpopulated; run REFRESH MATERIALIZED VIEW once its source tables are loaded.",
+	types.TypeExtension:        "The extension must be installed on the target server.",
+}
+
+// concurrentIndexCaveat is the caveat of index files rewritten to CREATE INDEX CONCURRENTLY
+const concurrentIndexCaveat = "CREATE INDEX CONCURRENTLY cannot run inside a transaction block."
+
+// WithCaveatHeaders starts the definition files of object types with restore
+// prerequisites, such as subscriptions and materialized views, with a comment noting them
+func (e *Exporter) WithCaveatHeaders(enabled bool) *Exporter {
+	e.caveatHeaders = enabled
+	return e
+}
+
+// caveatOf returns the caveat of files of objType, or "" if it has none
+func (e *Exporter) caveatOf(objType types.ObjectType) string {
+	if objType == types.TypeIndex && e.concurrentIndexes {
+		return concurrentIndexCaveat
+	}
+	return caveats[objType]
+}
+
+// withCaveatHeader prepends the caveat of objType to the content of its definition file
+func (e *Exporter) withCaveatHeader(objType types.ObjectType, content []byte) []byte {
+	if !e.caveatHeaders {
+		return content
+	}
+	caveat := e.caveatOf(objType)
+	if caveat == "" {
+		return content
+	}
+	var b strings.Builder
+	b.WriteString("-- Caveat: ")
+	b.WriteString(caveat)
+	b.WriteString("\n")
+	b.Write(content)
+	return []byte(b.String())
+}
@@ -0,0 +1,62 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestCaveatHeaders(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	objects := []types.DBObject{
+		{Type: types.TypeSubscription, Schema: "postgres", Name: "sub_remote"},
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+	}
+	subscriptionFile := filepath.Join(outputDir, "postgres", "subscriptions", "sub_remote.sql")
+	tableFile := filepath.Join(outputDir, "public", "tables", "users", "table.sql")
+
+	exporter, fs := NewWithMemFS(&mockConnector{}, outputDir)
+	exporter.WithCaveatHeaders(true)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	content, err := fs.ReadFile(subscriptionFile)
+	if err != nil {
+		t.Fatalf("Expected the subscription to be written: %v", err)
+	}
+	if want := "-- Caveat: " + caveats[types.TypeSubscription] + "\n"; !strings.HasPrefix(string(content), want) {
+		t.Errorf("Expected the subscription file to start with its caveat, got:\n%s", content)
+	}
+	// Tables have no prerequisites to note
+	content, err = fs.ReadFile(tableFile)
+	if err != nil {
+		t.Fatalf("Expected the table to be written: %v", err)
+	}
+	if strings.Contains(string(content), "-- Caveat:") {
+		t.Errorf("Expected no caveat on the table file, got:\n%s", content)
+	}
+
+	// Without the option files are unchanged
+	exporter, fs = NewWithMemFS(&mockConnector{}, outputDir)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	if content, _ := fs.ReadFile(subscriptionFile); strings.Contains(string(content), "-- Caveat:") {
+		t.Errorf("Expected no caveat without the option, got:\n%s", content)
+	}
+}
+
+func TestConcurrentIndexCaveat(t *testing.T) {
+	exporter, _ := NewWithMemFS(&mockConnector{}, "/pgmeta-output")
+	exporter.WithCaveatHeaders(true)
+	if caveat := exporter.caveatOf(types.TypeIndex); caveat != "" {
+		t.Errorf("Expected plain indexes to have no caveat, got %q", caveat)
+	}
+	exporter.WithConcurrentIndexes(true)
+	if caveat := exporter.caveatOf(types.TypeIndex); caveat != concurrentIndexCaveat {
+		t.Errorf("Expected concurrent indexes to note the transaction caveat, got %q", caveat)
+	}
+}
@@ -0,0 +1,104 @@
+package export
+
+import (
+	"crypto/sha256"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// Snapshot records the content of every definition file of an export directory, within
+// the schemas and types it was taken for. Files are keyed by their path without the .gz
+// suffix, so toggling --compress between two exports changes nothing.
+type Snapshot struct {
+	files map[string]DefinitionFile
+	sums  map[string][sha256.Size]byte
+}
+
+// ChangeReport lists the objects whose definition files differ between two snapshots
+type ChangeReport struct {
+	Added   []DefinitionFile `json:"added"`
+	Removed []DefinitionFile `json:"removed"`
+	Changed []DefinitionFile `json:"changed"`
+}
+
+// HasChanges reports whether any object was added, removed or changed
+func (r ChangeReport) HasChanges() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0 || len(r.Changed) > 0
+}
+
+// SnapshotDefinitions reads the definition files below dir that belong to schemas and
+// objTypes (all types when empty), the same files --prune would consider, laid out with
+// the directory names of names. A missing dir is an empty snapshot.
+func SnapshotDefinitions(dir string, schemas []string, objTypes []types.ObjectType, names DirNames) (*Snapshot, error) {
+	schemaSet, typeSet := scopeSets(schemas, objTypes)
+	typeDirs := pruneTypeDirs(names)
+	tablesDir := names.name(typeDir(types.TypeTable))
+	snapshot := &Snapshot{
+		files: make(map[string]DefinitionFile),
+		sums:  make(map[string][sha256.Size]byte),
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		file, ok := parseDefinitionPath(rel, tablesDir, typeDirs)
+		if !ok || !inScope(file, schemaSet, typeSet) {
+			return nil
+		}
+		// Symlinks written by --dedupe are followed, so they compare by content, and
+		// --compress files by their decompressed content
+		content, err := ReadDefinition(strings.TrimSuffix(path, ".gz"))
+		if err != nil {
+			return err
+		}
+		key := strings.TrimSuffix(file.Path, ".gz")
+		snapshot.files[key] = file
+		snapshot.sums[key] = sha256.Sum256(content)
+		return nil
+	})
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read definitions in %s", dir)
+	}
+	return snapshot, nil
+}
+
+// CompareSnapshots reports the objects added, removed and changed going from before to
+// after, each list sorted by path
+func CompareSnapshots(before, after *Snapshot) ChangeReport {
+	report := ChangeReport{Added: []DefinitionFile{}, Removed: []DefinitionFile{}, Changed: []DefinitionFile{}}
+	for path, file := range after.files {
+		sum, existed := before.sums[path]
+		switch {
+		case !existed:
+			report.Added = append(report.Added, file)
+		case sum != after.sums[path]:
+			report.Changed = append(report.Changed, file)
+		}
+	}
+	for path, file := range before.files {
+		if _, exists := after.files[path]; !exists {
+			report.Removed = append(report.Removed, file)
+		}
+	}
+	for _, list := range [][]DefinitionFile{report.Added, report.Removed, report.Changed} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	}
+	return report
+}
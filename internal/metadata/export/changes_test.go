@@ -0,0 +1,129 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// writeDefinitions writes files, keyed by path relative to dir, below dir
+func writeDefinitions(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompareSnapshots(t *testing.T) {
+	before, after := t.TempDir(), t.TempDir()
+	writeDefinitions(t, before, map[string]string{
+		"public/tables/users/table.sql":           "CREATE TABLE public.users (id int);",
+		"public/tables/users/indexes/users_a.sql": "CREATE INDEX users_a ON public.users (id);",
+		"public/functions/tag.sql":                "CREATE FUNCTION public.tag() ...",
+		"audit/functions/log.sql":                 "CREATE FUNCTION audit.log() ...",
+		"apply.sql":                               "\\ir public/functions/tag.sql",
+	})
+	writeDefinitions(t, after, map[string]string{
+		"public/tables/users/table.sql":           "CREATE TABLE public.users (id bigint);",
+		"public/tables/users/indexes/users_b.sql": "CREATE INDEX users_b ON public.users (id);",
+		"public/functions/tag.sql":                "CREATE FUNCTION public.tag() ...",
+		"apply.sql":                               "\\ir public/tables/users/table.sql",
+	})
+
+	// audit is outside the schemas, and apply.sql is not a definition
+	snapshot := func(dir string) *Snapshot {
+		s, err := SnapshotDefinitions(dir, []string{"public"}, nil, nil)
+		if err != nil {
+			t.Fatalf("SnapshotDefinitions failed: %v", err)
+		}
+		return s
+	}
+	report := CompareSnapshots(snapshot(before), snapshot(after))
+
+	check := func(name string, got []DefinitionFile, want ...DefinitionFile) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("Expected %s %v, got %v", name, want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Expected %s %v, got %v", name, want[i], got[i])
+			}
+		}
+	}
+	check("added", report.Added, DefinitionFile{Type: types.TypeIndex, Schema: "public", Name: "users_b", Table: "users", Path: "public/tables/users/indexes/users_b.sql"})
+	check("removed", report.Removed, DefinitionFile{Type: types.TypeIndex, Schema: "public", Name: "users_a", Table: "users", Path: "public/tables/users/indexes/users_a.sql"})
+	check("changed", report.Changed, DefinitionFile{Type: types.TypeTable, Schema: "public", Name: "users", Table: "users", Path: "public/tables/users/table.sql"})
+	if !report.HasChanges() {
+		t.Error("Expected the report to have changes")
+	}
+}
+
+func TestSnapshotMissingDirectory(t *testing.T) {
+	before, err := SnapshotDefinitions(filepath.Join(t.TempDir(), "missing"), []string{"public"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Expected a missing directory to be an empty snapshot, got %v", err)
+	}
+	after := t.TempDir()
+	writeDefinitions(t, after, map[string]string{"public/views/totals.sql": "CREATE VIEW public.totals AS SELECT 1;"})
+	afterSnapshot, err := SnapshotDefinitions(after, []string{"public"}, []types.ObjectType{types.TypeFunction}, nil)
+	if err != nil {
+		t.Fatalf("SnapshotDefinitions failed: %v", err)
+	}
+
+	// Views are outside the requested types
+	if report := CompareSnapshots(before, afterSnapshot); report.HasChanges() {
+		t.Errorf("Expected no changes, got %+v", report)
+	}
+}
+
+func TestCompareSnapshotsCompressed(t *testing.T) {
+	before, after := t.TempDir(), t.TempDir()
+	writeDefinitions(t, before, map[string]string{
+		"public/functions/tag.sql": "CREATE FUNCTION public.tag() ...",
+		"public/views/totals.sql":  "CREATE VIEW public.totals AS SELECT 1;",
+	})
+	// The same objects exported again with --compress
+	gzipped := func(content string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	writeDefinitions(t, after, map[string]string{
+		"public/functions/tag.sql.gz": gzipped("CREATE FUNCTION public.tag() ..."),
+		"public/views/totals.sql.gz":  gzipped("CREATE VIEW public.totals AS SELECT 2;"),
+	})
+
+	snapshot := func(dir string) *Snapshot {
+		s, err := SnapshotDefinitions(dir, []string{"public"}, nil, nil)
+		if err != nil {
+			t.Fatalf("SnapshotDefinitions failed: %v", err)
+		}
+		return s
+	}
+	report := CompareSnapshots(snapshot(before), snapshot(after))
+
+	// Files compare by their decompressed content, whichever way they were written
+	if len(report.Added) != 0 || len(report.Removed) != 0 {
+		t.Errorf("Expected compression not to add or remove objects, got %+v", report)
+	}
+	if len(report.Changed) != 1 || report.Changed[0].Path != "public/views/totals.sql.gz" {
+		t.Errorf("Expected only the view to change, got %+v", report.Changed)
+	}
+}
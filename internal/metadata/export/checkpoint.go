@@ -0,0 +1,185 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// checkpointFile records, in the output directory, the definitions fetched so far by a
+// --resume export. It is removed once an export completes.
+const checkpointFile = ".pgmeta-checkpoint.jsonl"
+
+// DefaultCheckpointBatch is how many definitions a --resume export fetches between checkpoints
+const DefaultCheckpointBatch = 200
+
+// CheckpointFileSystem is a FileSystem that can keep a checkpoint: read it back, append
+// to it, and delete it
+type CheckpointFileSystem interface {
+	FileSystem
+	ReadFile(name string) ([]byte, error)
+	AppendFile(name string, data []byte) error
+	Remove(name string) error
+}
+
+// checkpointEntry is one fetched definition, a line of the checkpoint file
+type checkpointEntry struct {
+	Type        types.ObjectType `json:"type"`
+	Schema      string           `json:"schema"`
+	Name        string           `json:"name"`
+	TableName   string           `json:"table_name,omitempty"`
+	Definition  string           `json:"definition"`
+	ForeignKeys string           `json:"foreign_keys,omitempty"`
+	SearchPath  string           `json:"search_path,omitempty"`
+}
+
+// key returns the identity of the entry's object. The table name is part of it, so a
+// trigger, policy or rule never reuses the definition of a same-named one on another table.
+func (entry checkpointEntry) key() types.ObjectKey {
+	return types.ObjectKey{Type: entry.Type, Schema: entry.Schema, TableName: entry.TableName, Name: entry.Name}
+}
+
+// WithResume makes the export fetch definitions in batches, recording each batch in a
+// checkpoint file, and reuse the definitions an interrupted earlier run recorded instead
+// of fetching them again
+func (e *Exporter) WithResume(enabled bool) *Exporter {
+	e.resume = enabled
+	e.checkpointBatch = DefaultCheckpointBatch
+	return e
+}
+
+// checkpointPath returns where the checkpoint file is kept
+func (e *Exporter) checkpointPath() string {
+	return filepath.Join(e.outputDir, checkpointFile)
+}
+
+// checkpointFS returns the filesystem as a CheckpointFileSystem, or an error if it cannot keep one
+func (e *Exporter) checkpointFS() (CheckpointFileSystem, error) {
+	cfs, ok := e.fs.(CheckpointFileSystem)
+	if !ok {
+		return nil, stacktrace.NewError("--resume is only supported for local output directories")
+	}
+	return cfs, nil
+}
+
+// loadCheckpoint returns the definitions recorded by an earlier run. A last line cut short
+// by the interruption is ignored.
+func (e *Exporter) loadCheckpoint(cfs CheckpointFileSystem) (map[types.ObjectKey]checkpointEntry, error) {
+	content, err := cfs.ReadFile(e.checkpointPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read checkpoint %s", e.checkpointPath())
+	}
+
+	entries := make(map[types.ObjectKey]checkpointEntry)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		var entry checkpointEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Debug("Ignoring an incomplete checkpoint entry: %v", err)
+			continue
+		}
+		entries[entry.key()] = entry
+	}
+	return entries, nil
+}
+
+// appendCheckpoint records fetched definitions at the end of the checkpoint file
+func (e *Exporter) appendCheckpoint(cfs CheckpointFileSystem, objects []types.DBObject) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, obj := range objects {
+		entry := checkpointEntry{Type: obj.Type, Schema: obj.Schema, Name: obj.Name, TableName: obj.TableName, Definition: obj.Definition, ForeignKeys: obj.ForeignKeys, SearchPath: obj.SearchPath}
+		if err := enc.Encode(entry); err != nil {
+			return stacktrace.Propagate(err, "Failed to encode checkpoint entry for %s", obj.Key())
+		}
+	}
+	if err := cfs.AppendFile(e.checkpointPath(), buf.Bytes()); err != nil {
+		return stacktrace.Propagate(err, "Failed to write checkpoint %s", e.checkpointPath())
+	}
+	return nil
+}
+
+// fetchDefinitions fetches the definitions of objects. With --resume, definitions recorded
+// by an earlier run are reused and the rest are fetched in batches, each recorded in the
+// checkpoint before the next starts, so an interrupted export loses at most one batch.
+func (e *Exporter) fetchDefinitions(ctx context.Context, objects []types.DBObject) ([]types.DBObject, []types.ObjectKey, error) {
+	if !e.resume {
+		return e.connector.FetchObjectsDefinitionsConcurrently(ctx, objects, e.fetchConcurrency)
+	}
+
+	cfs, err := e.checkpointFS()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := e.safelyMkdir(e.outputDir); err != nil {
+		return nil, nil, err
+	}
+	// Batched exports fetch definitions many times; the checkpoint is only read the first time
+	if e.checkpointed == nil {
+		recorded, err := e.loadCheckpoint(cfs)
+		if err != nil {
+			return nil, nil, err
+		}
+		if recorded == nil {
+			recorded = make(map[types.ObjectKey]checkpointEntry)
+		}
+		e.checkpointed = recorded
+	}
+
+	var fetched []types.DBObject
+	var pending []types.DBObject
+	for _, obj := range objects {
+		if entry, ok := e.checkpointed[obj.Key()]; ok {
+			obj.Definition = entry.Definition
+			obj.ForeignKeys = entry.ForeignKeys
+			obj.SearchPath = entry.SearchPath
+			fetched = append(fetched, obj)
+			continue
+		}
+		pending = append(pending, obj)
+	}
+	if len(fetched) > 0 {
+		log.Info("Resuming: reusing %d definitions from %s, fetching the remaining %d", len(fetched), e.checkpointPath(), len(pending))
+	}
+
+	var failed []types.ObjectKey
+	for start := 0; start < len(pending); start += e.checkpointBatch {
+		batch := pending[start:min(start+e.checkpointBatch, len(pending))]
+		withDefs, batchFailed, err := e.connector.FetchObjectsDefinitionsConcurrently(ctx, batch, e.fetchConcurrency)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := e.appendCheckpoint(cfs, withDefs); err != nil {
+			return nil, nil, err
+		}
+		fetched = append(fetched, withDefs...)
+		failed = append(failed, batchFailed...)
+	}
+	return fetched, failed, nil
+}
+
+// removeCheckpoint deletes the checkpoint once the export it belongs to has completed
+func (e *Exporter) removeCheckpoint() error {
+	cfs, err := e.checkpointFS()
+	if err != nil {
+		return err
+	}
+	if err := cfs.Remove(e.checkpointPath()); err != nil && !os.IsNotExist(err) {
+		return stacktrace.Propagate(err, "Failed to remove checkpoint %s", e.checkpointPath())
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// interruptingConnector records every object it fetches and fails any batch containing
+// interruptAt, as when an export is cut short by --timeout
+type interruptingConnector struct {
+	mockConnector
+	interruptAt string
+	mu          sync.Mutex
+	fetched     []string
+}
+
+func (c *interruptingConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
+	for _, obj := range objects {
+		if obj.Name == c.interruptAt {
+			return nil, nil, errors.New("context deadline exceeded")
+		}
+	}
+	c.mu.Lock()
+	for _, obj := range objects {
+		c.fetched = append(c.fetched, obj.Name)
+	}
+	c.mu.Unlock()
+	return c.mockConnector.FetchObjectsDefinitionsConcurrently(ctx, objects, concurrency)
+}
+
+func TestResumeInterruptedExport(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	var objects []types.DBObject
+	for i := 1; i <= 5; i++ {
+		objects = append(objects, types.DBObject{Type: types.TypeView, Schema: "public", Name: fmt.Sprintf("v%d", i)})
+	}
+	fs := NewMemFileSystem()
+
+	// The first run is interrupted in the third batch, after v1 to v4 were fetched
+	interrupted := &interruptingConnector{interruptAt: "v5"}
+	exporter := NewWithMock(interrupted, outputDir).WithFileSystem(fs).WithResume(true)
+	exporter.checkpointBatch = 2
+	if err := exporter.ExportObjects(context.Background(), objects, false); err == nil {
+		t.Fatal("Expected the interrupted export to fail")
+	}
+	checkpoint := filepath.Join(outputDir, checkpointFile)
+	content, err := fs.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatalf("Expected a checkpoint after the interruption: %v", err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 4 {
+		t.Errorf("Expected 4 checkpointed definitions, got %d:\n%s", lines, content)
+	}
+
+	// The resumed run only fetches what the interruption left out
+	resumed := &interruptingConnector{}
+	exporter = NewWithMock(resumed, outputDir).WithFileSystem(fs).WithResume(true)
+	exporter.checkpointBatch = 2
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("Resumed export failed: %v", err)
+	}
+	sort.Strings(resumed.fetched)
+	if strings.Join(resumed.fetched, ",") != "v5" {
+		t.Errorf("Expected the resumed export to fetch only v5, fetched %v", resumed.fetched)
+	}
+	for _, obj := range objects {
+		path := filepath.Join(outputDir, "public", "views", obj.Name+".sql")
+		if _, err := fs.ReadFile(path); err != nil {
+			t.Errorf("Expected %s to be exported: %v", path, err)
+		}
+	}
+	if _, err := fs.ReadFile(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed after a complete export, got %v", err)
+	}
+}
+
+func TestLoadCheckpointIgnoresTruncatedEntry(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	exporter, fs := NewWithMemFS(&mockConnector{}, outputDir)
+	if err := fs.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `{"type":"view","schema":"public","name":"v1","definition":"CREATE VIEW public.v1 AS SELECT 1;"}` + "\n" +
+		`{"type":"view","schema":"public","name":"v2","defin`
+	if err := fs.WriteFile(filepath.Join(outputDir, checkpointFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := exporter.loadCheckpoint(fs)
+	if err != nil {
+		t.Fatalf("loadCheckpoint failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected only the complete entry, got %v", entries)
+	}
+	if entry := entries[types.ObjectKey{Type: types.TypeView, Schema: "public", Name: "v1"}]; entry.Definition != "CREATE VIEW public.v1 AS SELECT 1;" {
+		t.Errorf("Expected v1's definition, got %q", entry.Definition)
+	}
+}
+
+func TestResumeKeysCheckpointByTable(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	fs := NewMemFileSystem()
+	if err := fs.MkdirAll(outputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Only the trigger on users was fetched before the interruption
+	content := `{"type":"trigger","schema":"public","name":"audit","table_name":"users","definition":"CREATE TRIGGER audit ON public.users;"}` + "\n"
+	if err := fs.WriteFile(filepath.Join(outputDir, checkpointFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := &interruptingConnector{}
+	exporter := NewWithMock(resumed, outputDir).WithFileSystem(fs).WithResume(true)
+	objects := []types.DBObject{
+		{Type: types.TypeTrigger, Schema: "public", Name: "audit", TableName: "users"},
+		{Type: types.TypeTrigger, Schema: "public", Name: "audit", TableName: "orders"},
+	}
+	fetched, _, err := exporter.fetchDefinitions(context.Background(), objects)
+	if err != nil {
+		t.Fatalf("fetchDefinitions failed: %v", err)
+	}
+	if len(resumed.fetched) != 1 {
+		t.Fatalf("Expected only the trigger on orders to be fetched, fetched %v", resumed.fetched)
+	}
+	for _, obj := range fetched {
+		if obj.TableName == "users" && obj.Definition != "CREATE TRIGGER audit ON public.users;" {
+			t.Errorf("Expected the trigger on users to reuse its checkpointed definition, got %q", obj.Definition)
+		}
+		if obj.TableName == "orders" && strings.Contains(obj.Definition, "public.users") {
+			t.Errorf("Expected the trigger on orders not to reuse the definition of the one on users, got %q", obj.Definition)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// tableChildDirs names the per-table directory of each object type stored under its table
+var tableChildDirs = map[types.ObjectType]string{
+	types.TypeTrigger:    "triggers",
+	types.TypeIndex:      "indexes",
+	types.TypeConstraint: "constraints",
+	types.TypeSequence:   "sequences",
+	types.TypePolicy:     "policies",
+	types.TypeRule:       "rules",
+	types.TypeStatistics: "statistics",
+}
+
+// typeDir names the directory standalone objects of objType are written to
+func typeDir(objType types.ObjectType) string {
+	if objType == types.TypeStatistics {
+		return "statistics"
+	}
+	return string(objType) + "s"
+}
+
+// tableKey identifies the parent table of a table-level object
+func tableKey(schema, table string) types.ObjectKey {
+	return types.ObjectKey{Type: types.TypeTable, Schema: schema, Name: table}
+}
+
+// fileBase returns the base name, without extension, of the file an object is written to
+func fileBase(obj types.DBObject) string {
+	if obj.FileName != "" {
+		return obj.FileName
+	}
+	return obj.Name
+}
+
+// objectDir returns the directory, relative to the output root, that ExportObjects writes obj into.
+// tables holds the exported table directories, which decide where rules go.
+func objectDir(obj types.DBObject, tables map[types.ObjectKey]bool) string {
+	switch obj.Type {
+	case types.TypeTable:
+		return path.Join(obj.Schema, "tables", obj.Name)
+	case types.TypeTrigger, types.TypeIndex, types.TypeConstraint, types.TypeSequence, types.TypePolicy, types.TypeStatistics:
+		if obj.TableName != "" {
+			return path.Join(obj.Schema, "tables", obj.TableName, tableChildDirs[obj.Type])
+		}
+	case types.TypeRule:
+		if obj.TableName != "" && tables[tableKey(obj.Schema, obj.TableName)] {
+			return path.Join(obj.Schema, "tables", obj.TableName, tableChildDirs[obj.Type])
+		}
+	case types.TypePublication, types.TypeSubscription:
+		return path.Join("postgres", string(obj.Type)+"s")
+	case types.TypeLanguage:
+		return "languages"
+	}
+	return path.Join(obj.Schema, typeDir(obj.Type))
+}
+
+// resolveCollisions finds objects that would be written to the same output path, such as
+// overloaded functions or same-named rules on different views. With continueOnError the
+// later objects get a numeric suffix (name_2, name_3, ...) and a warning; otherwise the
+// first collision is an error. The returned slice is a copy with FileName set where needed.
+func resolveCollisions(objects []types.DBObject, continueOnError bool) ([]types.DBObject, error) {
+	// Rules go under a table directory when anything else is exported into it
+	tables := make(map[types.ObjectKey]bool)
+	for _, obj := range objects {
+		switch obj.Type {
+		case types.TypeTable:
+			tables[obj.Key()] = true
+		case types.TypeTrigger, types.TypeIndex, types.TypeConstraint, types.TypeSequence, types.TypePolicy, types.TypeStatistics:
+			if obj.TableName != "" {
+				tables[tableKey(obj.Schema, obj.TableName)] = true
+			}
+		}
+	}
+
+	resolved := make([]types.DBObject, len(objects))
+	taken := make(map[string]types.DBObject, len(objects))
+	for i, obj := range objects {
+		resolved[i] = obj
+		if obj.Type == types.TypeTable {
+			// A table's file is always table.sql inside its own directory
+			continue
+		}
+
+		dir := objectDir(obj, tables)
+		target := path.Join(dir, fileBase(obj))
+		existing, collides := taken[target]
+		if !collides {
+			taken[target] = obj
+			continue
+		}
+
+		if !continueOnError {
+			return nil, stacktrace.NewError("%s %s.%s and %s %s.%s would both be written to %s.sql. Use --on-error warn to export them with a numeric suffix.",
+				existing.Type, existing.Schema, existing.Name, obj.Type, obj.Schema, obj.Name, target)
+		}
+
+		for n := 2; ; n++ {
+			candidate := fmt.Sprintf("%s_%d", fileBase(obj), n)
+			if _, used := taken[path.Join(dir, candidate)]; !used {
+				resolved[i].FileName = candidate
+				taken[path.Join(dir, candidate)] = obj
+				break
+			}
+		}
+		log.Warn("%s %s.%s collides with %s %s.%s at %s.sql; writing it to %s.sql instead",
+			obj.Type, obj.Schema, obj.Name, existing.Type, existing.Schema, existing.Name, target, path.Join(dir, resolved[i].FileName))
+	}
+	return resolved, nil
+}
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestResolveCollisions(t *testing.T) {
+	objects := []types.DBObject{
+		{Type: types.TypeFunction, Schema: "public", Name: "add"},
+		{Type: types.TypeFunction, Schema: "public", Name: "add"},
+		// Same name but a different directory: no collision
+		{Type: types.TypeProcedure, Schema: "public", Name: "add"},
+		{Type: types.TypeFunction, Schema: "app", Name: "add"},
+		// Rules on views share the schema's rules directory
+		{Type: types.TypeRule, Schema: "public", Name: "_protect", TableName: "v1"},
+		{Type: types.TypeRule, Schema: "public", Name: "_protect", TableName: "v2"},
+		// Triggers on different tables have their own directories
+		{Type: types.TypeTrigger, Schema: "public", Name: "audit", TableName: "users"},
+		{Type: types.TypeTrigger, Schema: "public", Name: "audit", TableName: "orders"},
+	}
+
+	resolved, err := resolveCollisions(objects, true)
+	if err != nil {
+		t.Fatalf("resolveCollisions failed: %v", err)
+	}
+
+	expected := []string{"add", "add_2", "add", "add", "_protect", "_protect_2", "audit", "audit"}
+	for i, obj := range resolved {
+		if got := fileBase(obj); got != expected[i] {
+			t.Errorf("Object %d (%s %s.%s): expected file %s, got %s", i, obj.Type, obj.Schema, obj.Name, expected[i], got)
+		}
+	}
+	// The input is left untouched
+	if objects[1].FileName != "" {
+		t.Error("resolveCollisions should not modify its input")
+	}
+
+	if _, err := resolveCollisions(objects, false); err == nil {
+		t.Error("Expected a collision to fail when not continuing on error")
+	} else if !strings.Contains(err.Error(), "public/functions/add.sql") {
+		t.Errorf("Expected the error to name the colliding path, got: %v", err)
+	}
+}
+
+func TestExportCollidingObjects(t *testing.T) {
+	objects := []types.DBObject{
+		{Type: types.TypeFunction, Schema: "public", Name: "add", Definition: "CREATE FUNCTION public.add(integer) ..."},
+		{Type: types.TypeFunction, Schema: "public", Name: "add", Definition: "CREATE FUNCTION public.add(numeric) ..."},
+	}
+	outputDir := "/pgmeta-output"
+	connector := &mockConnector{shouldFail: false}
+
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err == nil {
+		t.Error("Expected colliding objects to fail the export with on-error fail")
+	}
+	if files := fs.Files(); len(files) != 0 {
+		t.Errorf("Expected nothing to be written after a collision, got %v", files)
+	}
+
+	exporter, fs = NewWithMemFS(connector, outputDir)
+	if err := exporter.ExportObjects(context.Background(), objects, true); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	for path, expected := range map[string]string{
+		filepath.Join(outputDir, "public", "functions", "add.sql"):   "integer",
+		filepath.Join(outputDir, "public", "functions", "add_2.sql"): "numeric",
+	} {
+		content, err := fs.ReadFile(path)
+		if err != nil {
+			t.Errorf("Expected %s to be written: %v", path, err)
+			continue
+		}
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %s to hold the %s overload, got %q", path, expected, content)
+		}
+	}
+}
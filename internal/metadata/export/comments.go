@@ -0,0 +1,190 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+const (
+	// databaseCommentFile holds COMMENT ON DATABASE, at the top of the output directory
+	databaseCommentFile = "database.sql"
+	// schemaCommentFile holds COMMENT ON SCHEMA, in each schema's directory
+	schemaCommentFile = "schema.sql"
+	// objectCommentsFile holds the comments on a schema's objects with CommentsSeparate
+	objectCommentsFile = "comments.sql"
+)
+
+// Supported layouts of the comments on exported objects
+const (
+	CommentsNone     = "none"     // Comments on objects are not exported
+	CommentsInline   = "inline"   // Each object's comments are appended to its definition file
+	CommentsSeparate = "separate" // Comments are collected into one comments.sql per schema
+)
+
+// IsValidCommentsLayout reports whether layout is a supported comments layout
+func IsValidCommentsLayout(layout string) bool {
+	return layout == CommentsNone || layout == CommentsInline || layout == CommentsSeparate
+}
+
+// ObjectCommentConnector is a DBConnector that can also render the comments on objects
+type ObjectCommentConnector interface {
+	DBConnector
+	FetchObjectComments(ctx context.Context, objects []types.DBObject) ([]string, error)
+}
+
+// objectComment is the COMMENT ON statements of one object, kept for comments.sql
+type objectComment struct {
+	obj        types.DBObject
+	statements string
+}
+
+// DatabaseCommentConnector is a DBConnector that can also render the comments on the
+// database itself and on its schemas
+type DatabaseCommentConnector interface {
+	DBConnector
+	FetchDatabaseComments(ctx context.Context, schemas []string) (string, map[string]string, error)
+}
+
+// WithDatabaseComments makes the export write the database's comment to database.sql and
+// each exported schema's comment to <schema>/schema.sql. Nothing is written for an object
+// without a comment.
+func (e *Exporter) WithDatabaseComments(enabled bool) *Exporter {
+	e.databaseComments = enabled
+	return e
+}
+
+// WithCommentsLayout exports the comments on objects, and on the columns of relations, as
+// COMMENT ON statements: appended to each definition with CommentsInline, or collected into
+// a comments.sql per schema with CommentsSeparate, leaving the definition files purely
+// structural. CommentsNone, the default, exports no object comments.
+func (e *Exporter) WithCommentsLayout(layout string) *Exporter {
+	e.commentsLayout = layout
+	return e
+}
+
+// exportedSchemas returns the schemas that objects belong to, leaving out database-level
+// objects, which have no schema of their own
+func exportedSchemas(objects []types.DBObject) []string {
+	seen := make(map[string]bool)
+	var schemas []string
+	for _, obj := range objects {
+		switch obj.Type {
+		case types.TypeLanguage, types.TypePublication, types.TypeSubscription:
+			continue
+		}
+		if obj.Schema != "" && !seen[obj.Schema] {
+			seen[obj.Schema] = true
+			schemas = append(schemas, obj.Schema)
+		}
+	}
+	sort.Strings(schemas)
+	return schemas
+}
+
+// writeDatabaseComments writes database.sql and the schema.sql of every commented schema
+// among objects
+func (e *Exporter) writeDatabaseComments(ctx context.Context, objects []types.DBObject) error {
+	dc, ok := e.connector.(DatabaseCommentConnector)
+	if !ok {
+		return stacktrace.NewError("Database comments are not supported by this connector")
+	}
+	schemas := exportedSchemas(objects)
+	database, schemaComments, err := dc.FetchDatabaseComments(ctx, schemas)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to fetch database comments")
+	}
+
+	if database != "" {
+		path := filepath.Join(e.outputDir, databaseCommentFile)
+		if err := e.writeFile(path, []byte(database)); err != nil {
+			return stacktrace.Propagate(err, "Failed to write database comment: %s", path)
+		}
+		log.Info("Wrote the database comment to %s", path)
+	}
+	for _, schema := range schemas {
+		comment, ok := schemaComments[schema]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(e.outputDir, schema, schemaCommentFile)
+		if err := e.writeFile(path, []byte(comment)); err != nil {
+			return stacktrace.Propagate(err, "Failed to write comment of schema %s: %s", schema, path)
+		}
+	}
+	log.Info("Wrote the comments of %d of %d exported schemas", len(schemaComments), len(schemas))
+	return nil
+}
+
+// attachComments fetches the comments on objects, which already have their definitions,
+// and appends them to the definitions or keeps them for writeObjectComments
+func (e *Exporter) attachComments(ctx context.Context, objects []types.DBObject) error {
+	oc, ok := e.connector.(ObjectCommentConnector)
+	if !ok {
+		return stacktrace.NewError("Object comments are not supported by this connector")
+	}
+	comments, err := oc.FetchObjectComments(ctx, objects)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to fetch object comments")
+	}
+
+	for i, statements := range comments {
+		if statements == "" {
+			continue
+		}
+		obj := &objects[i]
+		if e.commentsLayout == CommentsInline {
+			obj.Definition = strings.TrimRight(obj.Definition, "\n") + "\n\n" + statements
+		} else {
+			e.objectComments = append(e.objectComments, objectComment{obj: *obj, statements: statements})
+		}
+	}
+	return nil
+}
+
+// writeObjectComments writes the comments kept by attachComments to the comments.sql of
+// each object's schema, ordered by type, table and name so the files are stable across
+// runs. Languages, publications and subscriptions have no schema and are written to the
+// comments.sql of the directory holding publications and subscriptions.
+func (e *Exporter) writeObjectComments() error {
+	sort.Slice(e.objectComments, func(i, j int) bool {
+		a, b := e.objectComments[i].obj, e.objectComments[j].obj
+		if a.Schema != b.Schema {
+			return a.Schema < b.Schema
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.TableName != b.TableName {
+			return a.TableName < b.TableName
+		}
+		return a.Name < b.Name
+	})
+
+	var schemas []string
+	files := make(map[string]*strings.Builder)
+	for _, c := range e.objectComments {
+		schema := c.obj.Schema
+		b, ok := files[schema]
+		if !ok {
+			b = &strings.Builder{}
+			files[schema] = b
+			schemas = append(schemas, schema)
+		}
+		b.WriteString(c.statements)
+	}
+
+	for _, schema := range schemas {
+		path := filepath.Join(e.outputDir, schema, objectCommentsFile)
+		if err := e.writeFile(path, []byte(files[schema].String())); err != nil {
+			return stacktrace.Propagate(err, "Failed to write comments of schema %s: %s", schema, path)
+		}
+	}
+	log.Info("Wrote the comments of %d objects to %d %s files", len(e.objectComments), len(schemas), objectCommentsFile)
+	return nil
+}
@@ -0,0 +1,167 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// commentConnector is a mockConnector that also reports database and schema comments
+type commentConnector struct {
+	mockConnector
+	database string
+	schemas  map[string]string
+	queried  []string
+}
+
+func (c *commentConnector) FetchDatabaseComments(ctx context.Context, schemas []string) (string, map[string]string, error) {
+	c.queried = schemas
+	return c.database, c.schemas, nil
+}
+
+func TestExportDatabaseComments(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	connector := &commentConnector{
+		database: "COMMENT ON DATABASE shop IS 'Orders and billing';\n",
+		schemas:  map[string]string{"public": "COMMENT ON SCHEMA public IS 'Customer-facing tables';\n"},
+	}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	exporter.WithDatabaseComments(true)
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeFunction, Schema: "audit", Name: "log"},
+		{Type: types.TypePublication, Schema: "postgres", Name: "changes"},
+	}
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	// Publications have no schema of their own, so only public and audit are looked up
+	if len(connector.queried) != 2 || connector.queried[0] != "audit" || connector.queried[1] != "public" {
+		t.Errorf("Expected the comments of audit and public to be queried, got %v", connector.queried)
+	}
+
+	content, err := fs.ReadFile(filepath.Join(outputDir, "database.sql"))
+	if err != nil {
+		t.Fatalf("Expected database.sql to be written: %v", err)
+	}
+	if string(content) != connector.database {
+		t.Errorf("Expected database.sql to hold %q, got %q", connector.database, content)
+	}
+
+	content, err = fs.ReadFile(filepath.Join(outputDir, "public", "schema.sql"))
+	if err != nil {
+		t.Fatalf("Expected public/schema.sql to be written: %v", err)
+	}
+	if string(content) != connector.schemas["public"] {
+		t.Errorf("Expected public/schema.sql to hold %q, got %q", connector.schemas["public"], content)
+	}
+
+	// audit has no comment
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "audit", "schema.sql")); err == nil {
+		t.Error("Expected no schema.sql for a schema without a comment")
+	}
+}
+
+// objectCommentConnector is a mockConnector that also reports comments on objects, keyed
+// by "schema.name"
+type objectCommentConnector struct {
+	mockConnector
+	comments map[string]string
+}
+
+func (c *objectCommentConnector) FetchObjectComments(ctx context.Context, objects []types.DBObject) ([]string, error) {
+	comments := make([]string, len(objects))
+	for i, obj := range objects {
+		comments[i] = c.comments[obj.Schema+"."+obj.Name]
+	}
+	return comments, nil
+}
+
+func commentedObjects() ([]types.DBObject, *objectCommentConnector) {
+	objects := []types.DBObject{
+		{Type: types.TypeView, Schema: "public", Name: "totals"},
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeFunction, Schema: "public", Name: "tag"},
+		{Type: types.TypeTable, Schema: "public", Name: "audit_log"},
+		{Type: types.TypeTable, Schema: "billing", Name: "invoices"},
+	}
+	connector := &objectCommentConnector{comments: map[string]string{
+		"public.users":     "COMMENT ON TABLE public.users IS 'Registered users';\nCOMMENT ON COLUMN public.users.email IS 'Login address';\n",
+		"public.tag":       "COMMENT ON FUNCTION public.tag() IS 'Tags a row';\n",
+		"public.totals":    "COMMENT ON VIEW public.totals IS 'Daily totals';\n",
+		"billing.invoices": "COMMENT ON TABLE billing.invoices IS 'Issued invoices';\n",
+	}}
+	return objects, connector
+}
+
+func TestExportObjectCommentsSeparate(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	objects, connector := commentedObjects()
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	exporter.WithCommentsLayout(CommentsSeparate)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	content, err := fs.ReadFile(filepath.Join(outputDir, "public", "comments.sql"))
+	if err != nil {
+		t.Fatalf("Expected public/comments.sql to be written: %v", err)
+	}
+	// Ordered by type, then name, regardless of the order objects were exported in
+	want := connector.comments["public.tag"] + connector.comments["public.users"] + connector.comments["public.totals"]
+	if string(content) != want {
+		t.Errorf("Unexpected public/comments.sql:\n%s\nwant:\n%s", content, want)
+	}
+
+	content, err = fs.ReadFile(filepath.Join(outputDir, "billing", "comments.sql"))
+	if err != nil {
+		t.Fatalf("Expected billing/comments.sql to be written: %v", err)
+	}
+	if string(content) != connector.comments["billing.invoices"] {
+		t.Errorf("Unexpected billing/comments.sql: %q", content)
+	}
+
+	// The definition files stay purely structural
+	table, err := fs.ReadFile(filepath.Join(outputDir, "public", "tables", "users", "table.sql"))
+	if err != nil {
+		t.Fatalf("Expected the users table to be written: %v", err)
+	}
+	if strings.Contains(string(table), "COMMENT ON") {
+		t.Errorf("Expected no comments in the table definition, got:\n%s", table)
+	}
+}
+
+func TestExportObjectCommentsInline(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	objects, connector := commentedObjects()
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	exporter.WithCommentsLayout(CommentsInline)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	table, err := fs.ReadFile(filepath.Join(outputDir, "public", "tables", "users", "table.sql"))
+	if err != nil {
+		t.Fatalf("Expected the users table to be written: %v", err)
+	}
+	want := "CREATE TABLE public.users (id integer);\n\n" + connector.comments["public.users"]
+	if string(table) != want {
+		t.Errorf("Expected the comments after the definition, got:\n%s", table)
+	}
+
+	// An object without a comment is written as is
+	table, err = fs.ReadFile(filepath.Join(outputDir, "public", "tables", "audit_log", "table.sql"))
+	if err != nil {
+		t.Fatalf("Expected the audit_log table to be written: %v", err)
+	}
+	if strings.Contains(string(table), "COMMENT ON") {
+		t.Errorf("Expected no comments for audit_log, got:\n%s", table)
+	}
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "public", "comments.sql")); err == nil {
+		t.Error("Expected no comments.sql with inline comments")
+	}
+}
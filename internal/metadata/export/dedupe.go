@@ -0,0 +1,90 @@
+package export
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+)
+
+// dedupeFile maps each deduplicated definition file to the file holding its content
+const dedupeFile = "dedupe.json"
+
+// SymlinkFileSystem is a FileSystem that can also create symbolic links.
+// Symlink replaces any existing file at newname, and RemoveSymlink deletes name
+// only if it is a symbolic link, so a re-export never writes through a stale link.
+type SymlinkFileSystem interface {
+	FileSystem
+	Symlink(oldname, newname string) error
+	RemoveSymlink(name string) error
+}
+
+// linkDuplicate checks whether content was already written to another definition file.
+// The first file with a given content stays a regular file; later ones become a relative
+// symlink to it. It reports whether path was linked; when it returns false the caller must
+// write the file itself, either because the content is new or because symlinks are not
+// supported and a copy is needed. Hashing and linking are serialized so concurrent workers
+// agree on which file is the original.
+func (e *Exporter) linkDuplicate(path string, content []byte) (bool, error) {
+	sum := sha256.Sum256(content)
+
+	e.dedupeMu.Lock()
+	defer e.dedupeMu.Unlock()
+
+	sfs, canLink := e.fs.(SymlinkFileSystem)
+	original, seen := e.dedupeOriginals[sum]
+	if !seen {
+		e.dedupeOriginals[sum] = path
+		if canLink {
+			if err := sfs.RemoveSymlink(path); err != nil {
+				return false, stacktrace.Propagate(err, "Failed to remove stale link %s", path)
+			}
+		}
+		return false, nil
+	}
+	e.dedupeLinks[path] = original
+
+	if !canLink {
+		return false, nil
+	}
+	target, err := filepath.Rel(filepath.Dir(path), original)
+	if err != nil {
+		return false, stacktrace.Propagate(err, "Failed to compute link from %s to %s", path, original)
+	}
+	if err := sfs.Symlink(target, path); err != nil {
+		log.Debug("Could not link %s to %s, writing a copy instead: %v", path, original, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// writeDedupeMap writes dedupe.json at the root of the output directory, mapping each
+// deduplicated file to its original, both relative to the output directory
+func (e *Exporter) writeDedupeMap() error {
+	mapping := make(map[string]string, len(e.dedupeLinks))
+	for link, original := range e.dedupeLinks {
+		relLink, err := filepath.Rel(e.outputDir, link)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to compute relative path for %s", link)
+		}
+		relOriginal, err := filepath.Rel(e.outputDir, original)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to compute relative path for %s", original)
+		}
+		mapping[filepath.ToSlash(relLink)] = filepath.ToSlash(relOriginal)
+	}
+
+	// Map keys are sorted on marshal, keeping the file stable between runs
+	data, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to encode %s", dedupeFile)
+	}
+	path := filepath.Join(e.outputDir, dedupeFile)
+	if err := e.writeFile(path, append(data, '\n')); err != nil {
+		return stacktrace.Propagate(err, "Failed to write %s", path)
+	}
+	log.Info("Deduplicated %d definition files, see %s", len(mapping), path)
+	return nil
+}
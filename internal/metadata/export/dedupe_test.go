@@ -0,0 +1,145 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// copyOnlyFileSystem hides MemFileSystem's symlink support
+type copyOnlyFileSystem struct {
+	FileSystem
+}
+
+// tenantFunctions returns the same function in three tenant schemas plus one that differs
+func tenantFunctions() []types.DBObject {
+	shared := "CREATE FUNCTION touch() RETURNS trigger AS $$ BEGIN NEW.updated_at = now(); RETURN NEW; END; $$ LANGUAGE plpgsql;"
+	return []types.DBObject{
+		{Type: types.TypeFunction, Schema: "tenant_a", Name: "touch", Definition: shared},
+		{Type: types.TypeFunction, Schema: "tenant_b", Name: "touch", Definition: shared},
+		{Type: types.TypeFunction, Schema: "tenant_c", Name: "touch", Definition: shared},
+		{Type: types.TypeFunction, Schema: "tenant_c", Name: "other", Definition: "CREATE FUNCTION other() ..."},
+	}
+}
+
+// readDedupeMap decodes dedupe.json from the in-memory filesystem
+func readDedupeMap(t *testing.T, fs *MemFileSystem, outputDir string) map[string]string {
+	t.Helper()
+	data, err := fs.ReadFile(filepath.Join(outputDir, dedupeFile))
+	if err != nil {
+		t.Fatalf("Expected %s to be written: %v", dedupeFile, err)
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		t.Fatalf("Failed to parse %s: %v", dedupeFile, err)
+	}
+	return mapping
+}
+
+func TestExportDedupe(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	connector := &mockConnector{shouldFail: false}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	exporter.WithDedupe(true)
+
+	if err := exporter.ExportObjects(context.Background(), tenantFunctions(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	// Exactly one of the identical files is real; workers race for which one
+	var originals, links []string
+	for _, schema := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+		path := filepath.Join(outputDir, schema, "functions", "touch.sql")
+		if target, err := fs.Readlink(path); err == nil {
+			// Links are relative to the link's directory
+			if filepath.IsAbs(target) {
+				t.Errorf("Expected a relative link for %s, got %s", path, target)
+			} else if _, err := fs.ReadFile(filepath.Join(filepath.Dir(path), target)); err != nil {
+				t.Errorf("Link %s -> %s does not resolve to a written file", path, target)
+			}
+			links = append(links, path)
+		} else if _, err := fs.ReadFile(path); err == nil {
+			originals = append(originals, path)
+		} else {
+			t.Errorf("Expected %s to be written or linked", path)
+		}
+	}
+	if len(originals) != 1 || len(links) != 2 {
+		t.Fatalf("Expected 1 original and 2 links, got originals %v and links %v", originals, links)
+	}
+
+	// Different content is never linked
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "tenant_c", "functions", "other.sql")); err != nil {
+		t.Errorf("Expected other.sql to be a regular file: %v", err)
+	}
+
+	mapping := readDedupeMap(t, fs, outputDir)
+	if len(mapping) != 2 {
+		t.Fatalf("Expected 2 entries in %s, got %v", dedupeFile, mapping)
+	}
+	original, _ := filepath.Rel(outputDir, originals[0])
+	for _, link := range links {
+		rel, _ := filepath.Rel(outputDir, link)
+		if mapping[rel] != original {
+			t.Errorf("Expected %s to map to %s, got %q", rel, original, mapping[rel])
+		}
+	}
+}
+
+func TestExportDedupeWithoutSymlinks(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	connector := &mockConnector{shouldFail: false}
+	mem := NewMemFileSystem()
+	exporter := NewWithMock(connector, outputDir).WithFileSystem(copyOnlyFileSystem{mem}).WithDedupe(true)
+
+	if err := exporter.ExportObjects(context.Background(), tenantFunctions(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	// Every file is a full copy, but the duplicates are still recorded
+	for _, schema := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+		path := filepath.Join(outputDir, schema, "functions", "touch.sql")
+		if _, err := mem.ReadFile(path); err != nil {
+			t.Errorf("Expected a copy at %s: %v", path, err)
+		}
+	}
+	if mapping := readDedupeMap(t, mem, outputDir); len(mapping) != 2 {
+		t.Errorf("Expected 2 entries in %s, got %v", dedupeFile, mapping)
+	}
+}
+
+func TestExportDedupeOnDisk(t *testing.T) {
+	tmpDir := t.TempDir()
+	connector := &mockConnector{shouldFail: false}
+
+	// Export twice: the second run must replace the links instead of writing through them
+	for run := 0; run < 2; run++ {
+		exporter := NewWithMock(connector, tmpDir).WithDedupe(true)
+		if err := exporter.ExportObjects(context.Background(), tenantFunctions(), false); err != nil {
+			t.Fatalf("ExportObjects run %d failed: %v", run+1, err)
+		}
+	}
+
+	links := 0
+	for _, schema := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+		path := filepath.Join(tmpDir, schema, "functions", "touch.sql")
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", path, err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			links++
+		}
+		content, err := os.ReadFile(path)
+		if err != nil || len(content) == 0 {
+			t.Errorf("Expected %s to resolve to the shared definition: %v", path, err)
+		}
+	}
+	if links != 2 {
+		t.Errorf("Expected 2 symlinks, got %d", links)
+	}
+}
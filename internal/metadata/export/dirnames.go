@@ -0,0 +1,98 @@
+package export
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// DirNames renames the directories definitions are written into, keyed by their default name:
+// a schema's "tables", "functions", "views" and so on, or a table's "indexes", "constraints",
+// "triggers" and so on. Directories without an entry keep their default name.
+type DirNames map[string]string
+
+// name returns the directory written in place of the default dir
+func (d DirNames) name(dir string) string {
+	if renamed, ok := d[dir]; ok {
+		return renamed
+	}
+	return dir
+}
+
+// renamableDirs maps the default name of every directory that can be renamed to the type
+// of object it holds. Languages are left out: their directory sits beside the schemas.
+func renamableDirs() map[string]types.ObjectType {
+	dirs := make(map[string]types.ObjectType)
+	for _, t := range types.ValidTypes() {
+		if t != types.TypeLanguage {
+			dirs[typeDir(t)] = t
+		}
+	}
+	for t, dir := range tableChildDirs {
+		dirs[dir] = t
+	}
+	return dirs
+}
+
+// ParseDirNames parses comma-separated default=name overrides such as
+// "tables=relations,indexes=idx". Unknown directories, names that are not a single path
+// element and names that would put two types of object in the same directory are rejected.
+func ParseDirNames(list string) (DirNames, error) {
+	names := make(DirNames)
+	if strings.TrimSpace(list) == "" {
+		return names, nil
+	}
+
+	dirs := renamableDirs()
+	for _, entry := range strings.Split(list, ",") {
+		dir, name, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		dir, name = strings.TrimSpace(dir), strings.TrimSpace(name)
+		if !ok || dir == "" || name == "" {
+			return nil, stacktrace.NewError("Invalid directory name override: %q. Expected default=name, e.g. tables=relations", entry)
+		}
+		if _, known := dirs[dir]; !known {
+			valid := make([]string, 0, len(dirs))
+			for d := range dirs {
+				valid = append(valid, d)
+			}
+			sort.Strings(valid)
+			return nil, stacktrace.NewError("Unknown directory %q. Directories that can be renamed: %s", dir, strings.Join(valid, ", "))
+		}
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return nil, stacktrace.NewError("Invalid name for the %s directory: %q. It must be a single directory name", dir, name)
+		}
+		if _, seen := names[dir]; seen {
+			return nil, stacktrace.NewError("The %s directory is renamed more than once", dir)
+		}
+		names[dir] = name
+	}
+
+	// Reading an export back, for --prune and --report-changes, tells types apart by directory
+	holds := make(map[string]types.ObjectType)
+	for dir, t := range dirs {
+		name := names.name(dir)
+		if other, taken := holds[name]; taken && other != t {
+			return nil, stacktrace.NewError("Directory name %q would hold both %s and %s definitions", name, other, t)
+		}
+		holds[name] = t
+	}
+	return names, nil
+}
+
+// WithDirNames renames the directories definitions are written into
+func (e *Exporter) WithDirNames(names DirNames) *Exporter {
+	e.dirNames = names
+	return e
+}
+
+// tableChildDir returns the directory, below its table's, that objects of objType are written to
+func (e *Exporter) tableChildDir(objType types.ObjectType) string {
+	return e.dirNames.name(tableChildDirs[objType])
+}
+
+// standaloneDir returns the directory, below its schema's, that objects of objType are written to
+func (e *Exporter) standaloneDir(objType types.ObjectType) string {
+	return e.dirNames.name(typeDir(objType))
+}
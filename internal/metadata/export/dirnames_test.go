@@ -0,0 +1,73 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestExportDirNames(t *testing.T) {
+	names, err := ParseDirNames("tables=relations, indexes=idx,functions=routines")
+	if err != nil {
+		t.Fatalf("ParseDirNames failed: %v", err)
+	}
+
+	outputDir := "/pgmeta-output"
+	exporter, fs := NewWithMemFS(&mockConnector{}, outputDir)
+	exporter.WithDirNames(names)
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_email_idx", TableName: "users"},
+		{Type: types.TypeConstraint, Schema: "public", Name: "users_pkey", TableName: "users"},
+		{Type: types.TypeFunction, Schema: "public", Name: "tag"},
+		{Type: types.TypeView, Schema: "public", Name: "totals"},
+	}
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	for _, rel := range []string{
+		"public/relations/users/table.sql",
+		"public/relations/users/idx/users_email_idx.sql",
+		"public/relations/users/constraints/users_pkey.sql",
+		"public/routines/tag.sql",
+		"public/views/totals.sql",
+	} {
+		if _, err := fs.ReadFile(filepath.Join(outputDir, rel)); err != nil {
+			t.Errorf("Expected %s to be written: %v", rel, err)
+		}
+	}
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "public/tables/users/table.sql")); err == nil {
+		t.Error("Expected nothing to be written to the default tables directory")
+	}
+
+	// Reading the export back, as --prune does, follows the renamed directories
+	file, ok := parseDefinitionPath("public/relations/users/idx/users_email_idx.sql", names.name("tables"), pruneTypeDirs(names))
+	if !ok || file.Type != types.TypeIndex || file.Table != "users" || file.Name != "users_email_idx" {
+		t.Errorf("Expected the renamed index file to be recognized, got %+v (ok %v)", file, ok)
+	}
+}
+
+func TestParseDirNamesRejects(t *testing.T) {
+	for _, list := range []string{
+		"tables",                       // no name
+		"tabels=relations",             // unknown directory
+		"languages=langs",              // beside the schemas, not below one
+		"tables=a/b",                   // not a single directory
+		"tables=..",                    // not a single directory
+		"tables=relations,tables=rels", // renamed twice
+		"indexes=constraints",          // indexes and constraints would share a directory
+		"views=tables",                 // views and tables would share a directory
+	} {
+		if _, err := ParseDirNames(list); err == nil {
+			t.Errorf("Expected %q to be rejected", list)
+		}
+	}
+
+	// Table and standalone indexes are both indexes, so they may share a name
+	if _, err := ParseDirNames("indexes=idx,indexs=idx"); err != nil {
+		t.Errorf("Expected both index directories to share a name, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/palantir/stacktrace"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// EncodingUTF8 is the default output encoding; definitions are written as PostgreSQL returns them
+const EncodingUTF8 = "utf-8"
+
+// outputEncodings maps the supported --output-encoding names to their encodings.
+// UTF-8 has no entry because it needs no transcoding.
+var outputEncodings = map[string]encoding.Encoding{
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"latin9":       charmap.ISO8859_15,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"windows-1252": charmap.Windows1252,
+	"cp1252":       charmap.Windows1252,
+}
+
+// normalizeEncodingName lowercases an encoding name and accepts "utf8" for "utf-8"
+func normalizeEncodingName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "utf8" {
+		return EncodingUTF8
+	}
+	return name
+}
+
+// IsValidOutputEncoding reports whether name is a supported output encoding
+func IsValidOutputEncoding(name string) bool {
+	name = normalizeEncodingName(name)
+	_, ok := outputEncodings[name]
+	return ok || name == EncodingUTF8
+}
+
+// OutputEncodings lists the supported output encoding names
+func OutputEncodings() []string {
+	names := []string{EncodingUTF8}
+	for name := range outputEncodings {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// encodeOutput transcodes UTF-8 content to the output encoding. A character the
+// encoding cannot represent is an error naming the character and its line in name,
+// rather than being silently replaced.
+func (e *Exporter) encodeOutput(name string, content []byte) ([]byte, error) {
+	if e.encoding == nil {
+		return content, nil
+	}
+	encoded, err := e.encoding.NewEncoder().Bytes(content)
+	if err == nil {
+		return encoded, nil
+	}
+
+	// Find the offending character to report something actionable
+	line := 1
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRune(content[i:])
+		if r == '\n' {
+			line++
+		}
+		if _, runeErr := e.encoding.NewEncoder().Bytes(content[i : i+size]); runeErr != nil {
+			return nil, stacktrace.NewError("%s cannot be written as %s: %s on line %d has no equivalent",
+				name, e.encodingName, describeRune(r, content[i:i+size]), line)
+		}
+		i += size
+	}
+	return nil, stacktrace.Propagate(err, "Failed to encode %s as %s", name, e.encodingName)
+}
+
+// describeRune renders a character for an error message, showing invalid UTF-8 as bytes
+func describeRune(r rune, raw []byte) string {
+	if r == utf8.RuneError && len(raw) == 1 {
+		return fmt.Sprintf("invalid UTF-8 byte 0x%02x", raw[0])
+	}
+	return fmt.Sprintf("%q (%U)", r, r)
+}
@@ -0,0 +1,96 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestExportLatin1Encoding(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	objects := []types.DBObject{
+		{Type: types.TypeFunction, Schema: "public", Name: "greet", Definition: "CREATE FUNCTION greet() RETURNS text AS $$ SELECT 'Café, naïve' $$ LANGUAGE sql;"},
+	}
+
+	connector := &mockConnector{shouldFail: false}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	exporter.WithOutputEncoding("latin1")
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	content, err := fs.ReadFile(filepath.Join(outputDir, "public", "functions", "greet.sql"))
+	if err != nil {
+		t.Fatalf("Failed to read function: %v", err)
+	}
+	// é and ï are single bytes in latin1
+	expected := []byte("CREATE FUNCTION greet() RETURNS text AS $$ SELECT 'Caf\xe9, na\xefve' $$ LANGUAGE sql;")
+	if !bytes.Equal(content, expected) {
+		t.Errorf("Expected latin1 bytes %q, got %q", expected, content)
+	}
+}
+
+func TestExportEncodingUnrepresentable(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	objects := []types.DBObject{
+		{Type: types.TypeView, Schema: "public", Name: "prices", Definition: "CREATE VIEW public.prices AS\nSELECT '€' AS currency;"},
+		{Type: types.TypeView, Schema: "public", Name: "plain", Definition: "CREATE VIEW public.plain AS SELECT 1;"},
+	}
+	connector := &mockConnector{shouldFail: false}
+
+	// latin1 has no euro sign: the file fails and the error says why
+	exporter, _ := NewWithMemFS(connector, outputDir)
+	exporter.WithOutputEncoding("latin1")
+	err := exporter.ExportObjects(context.Background(), objects, false)
+	if err == nil {
+		t.Fatal("Expected an unrepresentable character to fail the export with on-error fail")
+	}
+	if !strings.Contains(err.Error(), "U+20AC") || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected the error to name the character and its line, got: %v", err)
+	}
+
+	// With on-error warn the rest of the export is still written
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	exporter.WithOutputEncoding("latin1")
+	if err := exporter.ExportObjects(context.Background(), objects, true); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "public", "views", "prices.sql")); err == nil {
+		t.Error("Expected the unrepresentable view not to be written")
+	}
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "public", "views", "plain.sql")); err != nil {
+		t.Errorf("Expected the representable view to be written: %v", err)
+	}
+
+	// windows-1252 does have the euro sign
+	exporter, fs = NewWithMemFS(connector, outputDir)
+	exporter.WithOutputEncoding("windows-1252")
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	content, err := fs.ReadFile(filepath.Join(outputDir, "public", "views", "prices.sql"))
+	if err != nil || !bytes.Contains(content, []byte("'\x80'")) {
+		t.Errorf("Expected the euro sign as 0x80 in windows-1252, got %q (%v)", content, err)
+	}
+}
+
+func TestOutputEncodingNames(t *testing.T) {
+	for _, name := range []string{"", "utf-8", "UTF8", "latin1", "ISO-8859-1", "cp1252"} {
+		if !IsValidOutputEncoding(name) {
+			t.Errorf("Expected %q to be a valid output encoding", name)
+		}
+	}
+	if IsValidOutputEncoding("ebcdic") {
+		t.Error("Expected ebcdic to be rejected")
+	}
+
+	// UTF-8 leaves content untouched
+	exporter := NewWithMock(&mockConnector{}, "/pgmeta-output").WithOutputEncoding("utf-8")
+	if out, err := exporter.encodeOutput("x.sql", []byte("€")); err != nil || string(out) != "€" {
+		t.Errorf("Expected UTF-8 to pass content through, got %q (%v)", out, err)
+	}
+}
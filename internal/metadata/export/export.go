@@ -1,10 +1,17 @@
 package export
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,32 +19,105 @@ import (
 	"github.com/skamensky/pgmeta/internal/log"
 	"github.com/skamensky/pgmeta/internal/metadata/db"
 	"github.com/skamensky/pgmeta/internal/metadata/types"
+	"golang.org/x/text/encoding"
 )
 
 // Define the interface we need from the connector
 type DBConnector interface {
 	FetchObjectDefinition(ctx context.Context, obj *types.DBObject) error
-	FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []string, error)
+	FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error)
 }
 
 // Exporter handles exporting database objects to files
 type Exporter struct {
-	connector   DBConnector
-	outputDir   string
-	concurrency int
-	dirMutexes  sync.Map // Used to synchronize directory creation
+	connector        DBConnector
+	outputDir        string
+	concurrency      int        // Number of files written at once
+	fetchConcurrency int        // Number of definitions fetched at once; 0 uses the connector's default
+	createdDirs      sync.Map   // Directories already created, so each is only made once
+	fs               FileSystem // Where files are written, the local disk by default
+
+	manifest          bool              // Write apply.sql listing every exported file
+	wrapTransaction   bool              // Bracket apply.sql with BEGIN/COMMIT
+	concurrentIndexes bool              // Rewrite index definitions to CREATE INDEX CONCURRENTLY
+	serverInfo        *types.ServerInfo // Recorded in the manifest header
+	writeIndex        bool              // Write an index.json per schema
+	compression       string            // Compression applied to definition files ("" or "gzip")
+	lint              bool              // Report migration hazards in fetched definitions
+	lintFail          bool              // Abort the export when lint reports findings
+	lintSchemas       []string          // Schemas in the database, to recognize qualified references
+	stream            io.Writer         // When set, all definitions are written here instead of to files
+	combined          []io.Writer       // Each also receives all definitions as one script, next to the files
+	formatSQL         bool              // Canonicalize keyword casing and indentation of definitions
+	encoding          encoding.Encoding // Definitions are transcoded to this encoding; nil keeps UTF-8
+	encodingName      string            // Name of the output encoding, for messages
+	dedupe            bool              // Link byte-identical definition files to a single original
+	dedupeMu          sync.Mutex
+	dedupeOriginals   map[[sha256.Size]byte]string
+	dedupeLinks       map[string]string
+	manifestOrder     []types.ObjectType                     // Types replayed first in apply.sql, ahead of the default order
+	withStats         bool                                   // Write a stats.json with size and maintenance metadata per table
+	prune             bool                                   // Delete definition files of objects that no longer exist
+	pruneSchemas      map[string]bool                        // Schemas that were queried, the only ones pruned
+	pruneTypes        map[types.ObjectType]bool              // Types that were queried, the only ones pruned
+	incomplete        bool                                   // Some definitions were not written, so nothing is pruned
+	redactPatterns    []*regexp.Regexp                       // Matches in definitions are replaced with [REDACTED]
+	groupBy           string                                 // Layout of the output directory, GroupBySchema by default
+	catalogPath       string                                 // Where the CSV catalog is written, relative to outputDir; "" for none
+	owners            map[types.ObjectKey]string             // Owner of each object, fetched for the owner layout
+	resume            bool                                   // Reuse definitions checkpointed by an interrupted run
+	checkpointBatch   int                                    // Definitions fetched between checkpoints when resuming
+	checkpointed      map[types.ObjectKey]checkpointEntry    // Definitions recorded by an earlier run, loaded once
+	batchSize         int                                    // Objects fetched and written per batch; 0 fetches everything first
+	tableStats        map[string]map[string]types.TableStats // Stats already fetched, by schema, so batches query each schema once
+	databaseComments  bool                                   // Write the database and schema comments to database.sql and schema.sql
+	failed            []types.ObjectKey                      // Objects whose definitions could not be fetched, across batches
+	dirNames          DirNames                               // Directories renamed from their default names
+	psqlMetaCommands  bool                                   // Make the manifest stop at the first error and echo each file it applies
+	commentsLayout    string                                 // Where comments on objects are exported; "" or CommentsNone for nowhere
+	objectComments    []objectComment                        // Comments collected for comments.sql, across batches
+	skipPermission    bool                                   // Permission-denied fetches are warnings even without continueOnError
+	hashOnly          bool                                   // Write hashes.json instead of the definition files
+	caveatHeaders     bool                                   // Start definition files of types with restore prerequisites with a note
+	writtenMu         sync.Mutex
+	writtenFiles      []exportedFile
 }
 
+// Supported compression modes for definition files
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+)
+
+// IsValidCompression reports whether mode is a supported compression mode
+func IsValidCompression(mode string) bool {
+	return mode == CompressionNone || mode == CompressionGzip
+}
+
+// DefaultWriteConcurrency is the default number of files written at once
+const DefaultWriteConcurrency = 50
+
 // New creates a new exporter with default concurrency
 func New(connector *db.Connector, outputDir string) *Exporter {
 	return &Exporter{
-		connector:   connector,
-		outputDir:   outputDir,
-		concurrency: 50, // Default number of concurrent file operations
+		connector:        connector,
+		outputDir:        outputDir,
+		fs:               OSFileSystem(),
+		concurrency:      DefaultWriteConcurrency,
+		fetchConcurrency: db.DefaultFetchConcurrency,
 	}
 }
 
-// WithConcurrency sets the concurrency level for file operations
+// WithFileSystem makes the exporter write through fs instead of the local disk
+func (e *Exporter) WithFileSystem(fs FileSystem) *Exporter {
+	if fs != nil {
+		e.fs = fs
+	}
+	return e
+}
+
+// WithConcurrency sets the number of files written at once. It does not affect how many
+// definitions are fetched at once; see WithFetchConcurrency.
 func (e *Exporter) WithConcurrency(n int) *Exporter {
 	if n > 0 {
 		e.concurrency = n
@@ -45,25 +125,142 @@ func (e *Exporter) WithConcurrency(n int) *Exporter {
 	return e
 }
 
-// safelyMkdir creates a directory if it doesn't exist, using a mutex to prevent race conditions
-func (e *Exporter) safelyMkdir(dir string) error {
-	// Use a mutex for this specific directory to prevent race conditions
-	// when multiple goroutines try to create the same directory
-	key := dir
-	mutex, _ := e.dirMutexes.LoadOrStore(key, &sync.Mutex{})
-	mtx := mutex.(*sync.Mutex)
-
-	mtx.Lock()
-	defer mtx.Unlock()
-
-	// Check if directory exists again under lock
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return stacktrace.Propagate(err, "Failed to create directory: %s", dir)
+// WithFetchConcurrency sets the number of definitions fetched from the database at once.
+// Each fetch holds a connection, so this is bounded by the server's max_connections
+// independently of how many files are written at once.
+func (e *Exporter) WithFetchConcurrency(n int) *Exporter {
+	if n > 0 {
+		e.fetchConcurrency = n
+	}
+	return e
+}
+
+// WithManifest enables writing an apply.sql manifest; if wrapTransaction is true the
+// manifest runs inside a single transaction and non-transactional statements go to apply_post.sql
+func (e *Exporter) WithManifest(enabled, wrapTransaction bool) *Exporter {
+	e.manifest = enabled
+	e.wrapTransaction = wrapTransaction
+	return e
+}
+
+// WithPsqlMetaCommands makes the manifest set ON_ERROR_STOP, so psql stops at the first
+// failing file, and \echo the name of each file before including it
+func (e *Exporter) WithPsqlMetaCommands(enabled bool) *Exporter {
+	e.psqlMetaCommands = enabled
+	return e
+}
+
+// WithManifestOrder replays the given types first, in the given order, in apply.sql and
+// the --output - stream. Types not listed follow in the default dependency order.
+func (e *Exporter) WithManifestOrder(order []types.ObjectType) *Exporter {
+	e.manifestOrder = order
+	return e
+}
+
+// WithStats writes a stats.json beside each table.sql with the table's row estimate, sizes,
+// toast and autovacuum storage parameters and vacuum history. The connector must implement
+// StatsConnector; it costs one extra query per schema.
+func (e *Exporter) WithStats(enabled bool) *Exporter {
+	e.withStats = enabled
+	return e
+}
+
+// WithConcurrentIndexes rewrites exported index definitions to their CONCURRENTLY form
+func (e *Exporter) WithConcurrentIndexes(enabled bool) *Exporter {
+	e.concurrentIndexes = enabled
+	return e
+}
+
+// WithIndex enables writing an index.json per schema describing every exported file
+func (e *Exporter) WithIndex(enabled bool) *Exporter {
+	e.writeIndex = enabled
+	return e
+}
+
+// WithCompression compresses each definition file; "gzip" writes <name>.sql.gz
+func (e *Exporter) WithCompression(mode string) *Exporter {
+	e.compression = mode
+	return e
+}
+
+// WithLint reports functions without an explicit search_path and views or policies that
+// reference other schemas; schemas lists the database's schemas and fail aborts the export on findings
+func (e *Exporter) WithLint(enabled, fail bool, schemas []string) *Exporter {
+	e.lint = enabled
+	e.lintFail = fail
+	e.lintSchemas = schemas
+	return e
+}
+
+// WithStream writes the whole export to w as a single SQL script instead of individual files
+func (e *Exporter) WithStream(w io.Writer) *Exporter {
+	e.stream = w
+	return e
+}
+
+// WithDedupe writes byte-identical definitions once, linking the other files to it
+// with relative symlinks (or copies where symlinks are unsupported) and recording
+// the mapping in dedupe.json
+func (e *Exporter) WithDedupe(enabled bool) *Exporter {
+	e.dedupe = enabled
+	e.dedupeOriginals = make(map[[sha256.Size]byte]string)
+	e.dedupeLinks = make(map[string]string)
+	return e
+}
+
+// WithFormatSQL reformats definitions with consistent keyword casing and indentation
+// before writing, leaving literals, comments and dollar-quoted bodies untouched
+func (e *Exporter) WithFormatSQL(enabled bool) *Exporter {
+	e.formatSQL = enabled
+	return e
+}
+
+// WithOutputEncoding transcodes definitions from UTF-8 to the named encoding before they
+// are written. Characters the encoding cannot represent fail the file. Names are checked
+// with IsValidOutputEncoding; unknown names and "utf-8" keep the definitions as UTF-8.
+func (e *Exporter) WithOutputEncoding(name string) *Exporter {
+	e.encodingName = normalizeEncodingName(name)
+	e.encoding = outputEncodings[e.encodingName]
+	return e
+}
+
+// WithPrune deletes, after a successful export, the definition files in schemas and of
+// objTypes that the export did not write, along with directories left empty. An empty
+// objTypes means every type. Only an export of everything in those schemas and types may
+// prune, or files of objects that were merely not selected would be deleted.
+func (e *Exporter) WithPrune(enabled bool, schemas []string, objTypes []types.ObjectType) *Exporter {
+	e.prune = enabled
+	e.pruneSchemas, e.pruneTypes = scopeSets(schemas, objTypes)
+	return e
+}
+
+// WithServerInfo records the source server in the manifest header
+func (e *Exporter) WithServerInfo(info *types.ServerInfo) *Exporter {
+	e.serverInfo = info
+	return e
+}
+
+// makeIndexConcurrent rewrites a pg_get_indexdef statement into its CONCURRENTLY form
+func makeIndexConcurrent(definition string) string {
+	for _, prefix := range []string{"CREATE UNIQUE INDEX ", "CREATE INDEX "} {
+		if strings.HasPrefix(definition, prefix) && !strings.HasPrefix(definition, prefix+"CONCURRENTLY ") {
+			return prefix + "CONCURRENTLY " + strings.TrimPrefix(definition, prefix)
 		}
-	} else if err != nil {
-		return stacktrace.Propagate(err, "Error checking directory: %s", dir)
 	}
+	return definition
+}
+
+// safelyMkdir creates a directory if it doesn't exist. Once a directory was created every
+// later call is a map lookup without locking. Goroutines that race on the first call may
+// each run MkdirAll, which is safe because it succeeds for directories that already exist.
+func (e *Exporter) safelyMkdir(dir string) error {
+	if _, created := e.createdDirs.Load(dir); created {
+		return nil
+	}
+	if err := e.fs.MkdirAll(dir, 0755); err != nil {
+		return stacktrace.Propagate(err, "Failed to create directory: %s", dir)
+	}
+	e.createdDirs.Store(dir, struct{}{})
 	return nil
 }
 
@@ -76,7 +273,63 @@ func (e *Exporter) writeFile(path string, content []byte) error {
 	}
 
 	// Write the file
-	return os.WriteFile(path, content, 0644)
+	return e.fs.WriteFile(path, content, 0644)
+}
+
+// definitionPath returns the on-disk path for a definition file given the compression mode
+func (e *Exporter) definitionPath(path string) string {
+	if e.compression == CompressionGzip {
+		return path + ".gz"
+	}
+	return path
+}
+
+// writeDefinition writes a definition file, compressing it if requested.
+// With dedupe, a definition identical to one already written becomes a link to it.
+// Each call uses its own gzip writer so concurrent workers never share state.
+func (e *Exporter) writeDefinition(path string, content []byte) error {
+	content, err := e.encodeOutput(path, content)
+	if err != nil {
+		return err
+	}
+	if e.dedupe {
+		linked, err := e.linkDuplicate(path, content)
+		if linked || err != nil {
+			return err
+		}
+	}
+	if e.compression != CompressionGzip {
+		return e.writeFile(path, content)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return e.writeFile(path, buf.Bytes())
+}
+
+// ReadDefinition reads an exported definition file, transparently decompressing
+// it when only the .gz variant of path exists
+func ReadDefinition(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err == nil || !os.IsNotExist(err) {
+		return content, err
+	}
+	f, gzErr := os.Open(path + ".gz")
+	if gzErr != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, gzErr := gzip.NewReader(f)
+	if gzErr != nil {
+		return nil, stacktrace.Propagate(gzErr, "Failed to open compressed definition: %s.gz", path)
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
 }
 
 // ExportObjects exports database objects to files
@@ -84,10 +337,132 @@ func (e *Exporter) writeFile(path string, content []byte) error {
 func (e *Exporter) ExportObjects(ctx context.Context, objects []types.DBObject, continueOnError bool) error {
 	startTime := time.Now()
 
+	if e.hashOnly {
+		if err := e.writeHashes(ctx, objects, continueOnError); err != nil {
+			return err
+		}
+		log.Info("Successfully hashed %d objects in %v", len(objects), time.Since(startTime))
+		return nil
+	}
+
+	if e.batchSize > 0 && e.stream == nil {
+		// A combined script is ordered across every object, which batches never hold at once
+		if len(e.combined) > 0 {
+			return stacktrace.NewError("Combined outputs cannot be written in batches")
+		}
+		if err := e.exportInBatches(ctx, objects, continueOnError); err != nil {
+			return err
+		}
+	} else {
+		objectsWithDefs, err := e.prepareDefinitions(ctx, objects, continueOnError)
+		if err != nil {
+			return err
+		}
+
+		if e.stream != nil {
+			if err := e.writeStream(objectsWithDefs); err != nil {
+				return err
+			}
+			log.Info("Successfully streamed %d objects in %v", len(objectsWithDefs), time.Since(startTime))
+			return nil
+		}
+		if err := e.writeCombinedOutputs(objectsWithDefs); err != nil {
+			return err
+		}
+
+		// Two objects must never overwrite each other's file
+		objectsWithDefs, err = resolveCollisions(objectsWithDefs, continueOnError)
+		if err != nil {
+			return err
+		}
+
+		if err := e.fetchOwners(ctx, objectsWithDefs); err != nil {
+			return err
+		}
+
+		if err := e.writeObjects(ctx, objectsWithDefs, continueOnError); err != nil {
+			return err
+		}
+	}
+
+	if e.databaseComments {
+		if err := e.writeDatabaseComments(ctx, objects); err != nil {
+			return err
+		}
+	}
+
+	if e.commentsLayout == CommentsSeparate {
+		if err := e.writeObjectComments(); err != nil {
+			return err
+		}
+	}
+
+	if err := e.writeFailedObjects(); err != nil {
+		return err
+	}
+
+	if e.manifest {
+		if err := e.writeManifest(); err != nil {
+			return err
+		}
+	}
+
+	if e.writeIndex {
+		if err := e.writeSchemaIndexes(); err != nil {
+			return err
+		}
+	}
+
+	if e.dedupe {
+		if err := e.writeDedupeMap(); err != nil {
+			return err
+		}
+	}
+
+	if e.catalogPath != "" {
+		if err := e.writeCatalog(); err != nil {
+			return err
+		}
+	}
+
+	if e.prune {
+		// Files of objects that failed are indistinguishable from stale ones
+		if e.incomplete {
+			log.Warn("Skipping --prune because some objects were not exported")
+		} else if err := e.pruneStale(); err != nil {
+			return err
+		}
+	}
+
+	// Keep the checkpoint when objects failed, so resuming only fetches those again
+	if e.resume && !e.incomplete {
+		if err := e.removeCheckpoint(); err != nil {
+			return err
+		}
+	}
+
+	duration := time.Since(startTime)
+	successMsg := "Successfully exported objects"
+	if continueOnError {
+		successMsg += " (with warnings)"
+	}
+	log.Info("%s in %v", successMsg, duration)
+	return nil
+}
+
+// Incomplete reports whether ExportObjects skipped objects it failed to fetch or write,
+// as it only does when continuing on error
+func (e *Exporter) Incomplete() bool {
+	return e.incomplete
+}
+
+// prepareDefinitions fetches the definitions of objects and applies the requested
+// redaction, linting and formatting to them
+func (e *Exporter) prepareDefinitions(ctx context.Context, objects []types.DBObject, continueOnError bool) ([]types.DBObject, error) {
 	// Fetch all object definitions concurrently
-	objectsWithDefs, failedObjects, err := e.connector.FetchObjectsDefinitionsConcurrently(ctx, objects, e.concurrency)
+	objectsWithDefs, failedObjects, err := e.fetchDefinitions(ctx, objects)
 	if err != nil {
-		return stacktrace.Propagate(err, "Failed to fetch object definitions")
+		return nil, stacktrace.Propagate(err, "Failed to fetch object definitions")
 	}
 
 	// If any objects failed, either warn and continue or stop based on continueOnError
@@ -97,14 +472,8 @@ func (e *Exporter) ExportObjects(ctx context.Context, objects []types.DBObject,
 
 		// Group objects by type for better reporting
 		failedByType := make(map[types.ObjectType]int)
-		for _, objName := range failedObjects {
-			// Find the matching object to get its type
-			for _, obj := range objects {
-				if fmt.Sprintf("%s.%s", obj.Schema, obj.Name) == objName {
-					failedByType[obj.Type]++
-					break
-				}
-			}
+		for _, key := range failedObjects {
+			failedByType[key.Type]++
 		}
 
 		// Log summary by type
@@ -112,62 +481,47 @@ func (e *Exporter) ExportObjects(ctx context.Context, objects []types.DBObject,
 			log.Warn("  • %d objects of type '%s' failed", count, objType)
 		}
 
+		fatal := e.fatalFailures(failedObjects)
+
 		// Only return error if not continuing on error
-		if !continueOnError {
-			return stacktrace.NewError("Failed to fetch definitions for %d objects. Use --on-error warn to continue despite errors.", len(failedObjects))
+		if !continueOnError && len(fatal) > 0 {
+			return nil, stacktrace.NewError("Failed to fetch definitions for %d objects. Use --on-error warn to continue despite errors.", len(fatal))
 		}
+		e.incomplete = true
+		e.failed = append(e.failed, failedObjects...)
 	}
 
-	// Group objects by schema and their tables
-	schemaObjects := make(map[string]map[string][]types.DBObject)
-	schemaStandalone := make(map[string][]types.DBObject)
+	if e.commentsLayout == CommentsInline || e.commentsLayout == CommentsSeparate {
+		if err := e.attachComments(ctx, objectsWithDefs); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(e.redactPatterns) > 0 {
+		e.redact(objectsWithDefs)
+	}
 
-	// Initialize maps for each schema
-	for _, obj := range objectsWithDefs {
-		if _, exists := schemaObjects[obj.Schema]; !exists {
-			schemaObjects[obj.Schema] = make(map[string][]types.DBObject)
-			schemaStandalone[obj.Schema] = make([]types.DBObject, 0)
+	if e.lint {
+		if err := e.reportLint(objectsWithDefs); err != nil {
+			return nil, err
 		}
 	}
 
-	// Populate the maps
-	for _, obj := range objectsWithDefs {
-		switch obj.Type {
-		case types.TypeTable:
-			schemaObjects[obj.Schema][obj.Name] = append(schemaObjects[obj.Schema][obj.Name], obj)
-		case types.TypeTrigger, types.TypeIndex, types.TypeConstraint, types.TypeSequence, types.TypePolicy:
-			// Use the TableName field we populated during query
-			if obj.TableName != "" {
-				schemaObjects[obj.Schema][obj.TableName] = append(schemaObjects[obj.Schema][obj.TableName], obj)
-			} else {
-				log.Warn("%s %s has no associated table name", obj.Type, obj.Name)
-				schemaStandalone[obj.Schema] = append(schemaStandalone[obj.Schema], obj)
-			}
-		case types.TypePublication, types.TypeSubscription:
-			// Database-level objects - use a special "postgres" schema
-			dbSchema := "postgres"
-			if _, exists := schemaStandalone[dbSchema]; !exists {
-				schemaStandalone[dbSchema] = make([]types.DBObject, 0)
-			}
-			schemaStandalone[dbSchema] = append(schemaStandalone[dbSchema], obj)
-		case types.TypeRule:
-			// Rules may be associated with tables or views
-			if obj.TableName != "" {
-				// First check if this table exists in the tables map
-				if _, exists := schemaObjects[obj.Schema][obj.TableName]; exists {
-					schemaObjects[obj.Schema][obj.TableName] = append(schemaObjects[obj.Schema][obj.TableName], obj)
-				} else {
-					// If not associated with a table in our set, treat as standalone
-					schemaStandalone[obj.Schema] = append(schemaStandalone[obj.Schema], obj)
-				}
-			} else {
-				schemaStandalone[obj.Schema] = append(schemaStandalone[obj.Schema], obj)
-			}
-		default:
-			schemaStandalone[obj.Schema] = append(schemaStandalone[obj.Schema], obj)
+	if e.formatSQL {
+		for i := range objectsWithDefs {
+			transformDefinition(&objectsWithDefs[i], "--format-sql", formatSQL)
 		}
 	}
 
+	return objectsWithDefs, nil
+}
+
+// writeObjects writes the definition files of objects, which already have their
+// definitions, collisions resolved and owners looked up
+func (e *Exporter) writeObjects(ctx context.Context, objects []types.DBObject, continueOnError bool) error {
+	groups := groupObjects(objects, e.layoutDir)
+	schemaObjects, schemaStandalone, dirSchemas := groups.tables, groups.standalone, groups.schemas
+
 	// Ensure output directory exists
 	if err := e.safelyMkdir(e.outputDir); err != nil {
 		return err
@@ -182,7 +536,14 @@ func (e *Exporter) ExportObjects(ctx context.Context, objects []types.DBObject,
 
 		// Start with table objects, which are usually more numerous
 		if len(tableObjects) > 0 {
-			tableErr := e.exportTableObjects(schema, tableObjects, continueOnError)
+			stats, err := e.fetchTableStats(ctx, dirSchemas[schema])
+			if err != nil {
+				if !continueOnError {
+					return err
+				}
+				log.Error("%v", err)
+			}
+			tableErr := e.exportTableObjects(schema, tableObjects, stats, continueOnError)
 			if tableErr != nil {
 				return tableErr
 			}
@@ -196,13 +557,6 @@ func (e *Exporter) ExportObjects(ctx context.Context, objects []types.DBObject,
 			}
 		}
 	}
-
-	duration := time.Since(startTime)
-	successMsg := "Successfully exported objects"
-	if continueOnError {
-		successMsg += " (with warnings)"
-	}
-	log.Info("%s in %v", successMsg, duration)
 	return nil
 }
 
@@ -211,13 +565,51 @@ type fileExportTask struct {
 	path      string
 	content   []byte
 	objType   types.ObjectType
+	objSchema string
+	tableName string
+	objName   string
+	key       types.ObjectKey // Identity of the exported object
+}
+
+// exportedFile records a successfully written file for the manifest and schema indexes
+type exportedFile struct {
+	path      string
+	schema    string
+	objType   types.ObjectType
+	objSchema string
 	tableName string
 	objName   string
+	key       types.ObjectKey // Identity of the exported object, to look up its owner
+	sha256    string          // Hex digest of the definition, recorded for the catalog
+}
+
+// recordExportedFile remembers a written file if a manifest, index, catalog or pruning was requested
+func (e *Exporter) recordExportedFile(schema string, task fileExportTask) {
+	if !e.manifest && !e.writeIndex && !e.prune && e.catalogPath == "" {
+		return
+	}
+	entry := exportedFile{
+		path:      task.path,
+		schema:    schema,
+		objType:   task.objType,
+		objSchema: task.objSchema,
+		tableName: task.tableName,
+		objName:   task.objName,
+		key:       task.key,
+	}
+	if e.catalogPath != "" {
+		sum := sha256.Sum256(task.content)
+		entry.sha256 = hex.EncodeToString(sum[:])
+	}
+	e.writtenMu.Lock()
+	defer e.writtenMu.Unlock()
+	e.writtenFiles = append(e.writtenFiles, entry)
 }
 
-// exportTableObjects exports table-related objects using concurrency
+// exportTableObjects exports table-related objects using concurrency, with a stats.json
+// beside each exported table found in stats.
 // If continueOnError is true, it will log errors and continue; otherwise it will fail on first error
-func (e *Exporter) exportTableObjects(schema string, tableObjects map[string][]types.DBObject, continueOnError bool) error {
+func (e *Exporter) exportTableObjects(schema string, tableObjects map[string][]types.DBObject, stats map[string]types.TableStats, continueOnError bool) error {
 	// Create a channel for file export tasks
 	tasks := make(chan fileExportTask, len(tableObjects)*4) // Reasonable buffer size
 
@@ -234,8 +626,10 @@ func (e *Exporter) exportTableObjects(schema string, tableObjects map[string][]t
 			defer wg.Done()
 			for task := range tasks {
 				// Create dir if not exists and write file
+				task.path = e.definitionPath(task.path)
 				log.Debug("Writing %s definition to %s", task.objType, task.path)
-				if err := e.writeFile(task.path, task.content); err != nil {
+				task.content = e.withCaveatHeader(task.objType, task.content)
+				if err := e.writeDefinition(task.path, task.content); err != nil {
 					errMsg := ""
 					switch {
 					case task.objType == types.TypeTable:
@@ -263,6 +657,8 @@ func (e *Exporter) exportTableObjects(schema string, tableObjects map[string][]t
 							log.Error("%s: %v", errMsg, err)
 						}
 					}
+				} else {
+					e.recordExportedFile(schema, task)
 				}
 			}
 		}()
@@ -272,7 +668,7 @@ func (e *Exporter) exportTableObjects(schema string, tableObjects map[string][]t
 	for tableName, objs := range tableObjects {
 		// Ensure schema and tables directory exists synchronously to avoid race conditions
 		schemaDir := filepath.Join(e.outputDir, schema)
-		tablesDir := filepath.Join(schemaDir, "tables")
+		tablesDir := filepath.Join(schemaDir, e.standaloneDir(types.TypeTable))
 		tableDir := filepath.Join(tablesDir, tableName)
 
 		// Create the schema directory first
@@ -312,72 +708,123 @@ func (e *Exporter) exportTableObjects(schema string, tableObjects map[string][]t
 				tasks <- fileExportTask{
 					path:      tablePath,
 					content:   []byte(obj.Definition),
+					key:       obj.Key(),
 					objType:   types.TypeTable,
+					objSchema: obj.Schema,
 					tableName: tableName,
 				}
+				if obj.ForeignKeys != "" {
+					tasks <- fileExportTask{
+						path:      filepath.Join(tableDir, foreignKeysFile),
+						content:   []byte(obj.ForeignKeys),
+						key:       obj.Key(),
+						objType:   typeForeignKeys,
+						objSchema: obj.Schema,
+						tableName: tableName,
+					}
+				}
+				if tableStats, ok := stats[tableName]; ok {
+					if err := e.writeTableStats(tableDir, tableStats); err != nil {
+						if !continueOnError {
+							close(tasks)
+							wg.Wait()
+							return err
+						}
+						log.Error("%v", err)
+					}
+				}
 
 			case types.TypeTrigger:
-				triggerDir := filepath.Join(tableDir, "triggers")
-				filename := filepath.Join(triggerDir, fmt.Sprintf("%s.sql", obj.Name))
+				triggerDir := filepath.Join(tableDir, e.tableChildDir(types.TypeTrigger))
+				filename := filepath.Join(triggerDir, fileBase(obj)+".sql")
 				tasks <- fileExportTask{
 					path:      filename,
 					content:   []byte(obj.Definition),
+					key:       obj.Key(),
 					objType:   types.TypeTrigger,
+					objSchema: obj.Schema,
 					tableName: tableName,
 					objName:   obj.Name,
 				}
 
 			case types.TypeIndex:
-				indexDir := filepath.Join(tableDir, "indexes")
-				filename := filepath.Join(indexDir, fmt.Sprintf("%s.sql", obj.Name))
+				indexDir := filepath.Join(tableDir, e.tableChildDir(types.TypeIndex))
+				filename := filepath.Join(indexDir, fileBase(obj)+".sql")
+				definition := obj.Definition
+				if e.concurrentIndexes {
+					definition = makeIndexConcurrent(definition)
+				}
 				tasks <- fileExportTask{
 					path:      filename,
-					content:   []byte(obj.Definition),
+					content:   []byte(definition),
+					key:       obj.Key(),
 					objType:   types.TypeIndex,
+					objSchema: obj.Schema,
 					tableName: tableName,
 					objName:   obj.Name,
 				}
 
 			case types.TypeConstraint:
-				constraintDir := filepath.Join(tableDir, "constraints")
-				filename := filepath.Join(constraintDir, fmt.Sprintf("%s.sql", obj.Name))
+				constraintDir := filepath.Join(tableDir, e.tableChildDir(types.TypeConstraint))
+				filename := filepath.Join(constraintDir, fileBase(obj)+".sql")
 				tasks <- fileExportTask{
 					path:      filename,
 					content:   []byte(obj.Definition),
+					key:       obj.Key(),
 					objType:   types.TypeConstraint,
+					objSchema: obj.Schema,
 					tableName: tableName,
 					objName:   obj.Name,
 				}
 
 			case types.TypeSequence:
-				sequenceDir := filepath.Join(tableDir, "sequences")
-				filename := filepath.Join(sequenceDir, fmt.Sprintf("%s.sql", obj.Name))
+				sequenceDir := filepath.Join(tableDir, e.tableChildDir(types.TypeSequence))
+				filename := filepath.Join(sequenceDir, fileBase(obj)+".sql")
 				tasks <- fileExportTask{
 					path:      filename,
 					content:   []byte(obj.Definition),
+					key:       obj.Key(),
 					objType:   types.TypeSequence,
+					objSchema: obj.Schema,
 					tableName: tableName,
 					objName:   obj.Name,
 				}
 
 			case types.TypePolicy:
-				policyDir := filepath.Join(tableDir, "policies")
-				filename := filepath.Join(policyDir, fmt.Sprintf("%s.sql", obj.Name))
+				policyDir := filepath.Join(tableDir, e.tableChildDir(types.TypePolicy))
+				filename := filepath.Join(policyDir, fileBase(obj)+".sql")
 				tasks <- fileExportTask{
 					path:      filename,
 					content:   []byte(obj.Definition),
+					key:       obj.Key(),
 					objType:   types.TypePolicy,
+					objSchema: obj.Schema,
 					tableName: tableName,
 					objName:   obj.Name,
 				}
 
 			case types.TypeRule:
-				ruleDir := filepath.Join(tableDir, "rules")
-				filename := filepath.Join(ruleDir, fmt.Sprintf("%s.sql", obj.Name))
+				ruleDir := filepath.Join(tableDir, e.tableChildDir(types.TypeRule))
+				filename := filepath.Join(ruleDir, fileBase(obj)+".sql")
 				tasks <- fileExportTask{
 					path:      filename,
 					content:   []byte(obj.Definition),
+					key:       obj.Key(),
 					objType:   types.TypeRule,
+					objSchema: obj.Schema,
+					tableName: tableName,
+					objName:   obj.Name,
+				}
+
+			case types.TypeStatistics:
+				statisticsDir := filepath.Join(tableDir, e.tableChildDir(types.TypeStatistics))
+				filename := filepath.Join(statisticsDir, fileBase(obj)+".sql")
+				tasks <- fileExportTask{
+					path:      filename,
+					content:   []byte(obj.Definition),
+					key:       obj.Key(),
+					objType:   types.TypeStatistics,
+					objSchema: obj.Schema,
 					tableName: tableName,
 					objName:   obj.Name,
 				}
@@ -394,6 +841,7 @@ func (e *Exporter) exportTableObjects(schema string, tableObjects map[string][]t
 	// If we're continuing on error and have errors, just log a summary
 	if continueOnError && errCount > 0 {
 		log.Warn("Encountered %d errors while exporting table objects, but continuing as requested", errCount)
+		e.incomplete = true
 		return nil
 	}
 
@@ -429,8 +877,10 @@ func (e *Exporter) exportStandaloneObjects(schema string, objects []types.DBObje
 			defer wg.Done()
 			for task := range tasks {
 				// Write file
+				task.path = e.definitionPath(task.path)
 				log.Debug("Writing %s definition to %s", task.objType, task.path)
-				if err := e.writeFile(task.path, task.content); err != nil {
+				task.content = e.withCaveatHeader(task.objType, task.content)
+				if err := e.writeDefinition(task.path, task.content); err != nil {
 					errMsg := fmt.Sprintf("Failed to write %s definition for %s",
 						task.objType, task.objName)
 
@@ -449,6 +899,8 @@ func (e *Exporter) exportStandaloneObjects(schema string, objects []types.DBObje
 							log.Error("%s: %v", errMsg, err)
 						}
 					}
+				} else {
+					e.recordExportedFile(schema, task)
 				}
 			}
 		}()
@@ -474,7 +926,7 @@ func (e *Exporter) exportStandaloneObjects(schema string, objects []types.DBObje
 	// Process each type group
 	for objType, groupObjects := range typeGroups {
 		// Create the directory for this object type under the schema
-		dir := filepath.Join(schemaDir, string(objType)+"s")
+		dir := filepath.Join(schemaDir, e.standaloneDir(objType))
 		if err := e.safelyMkdir(dir); err != nil {
 			close(tasks) // Close channel to prevent goroutine leaks
 			if continueOnError {
@@ -486,12 +938,14 @@ func (e *Exporter) exportStandaloneObjects(schema string, objects []types.DBObje
 
 		// Queue up all file write tasks for this type
 		for _, obj := range groupObjects {
-			filename := filepath.Join(dir, fmt.Sprintf("%s.sql", obj.Name))
+			filename := filepath.Join(dir, fileBase(obj)+".sql")
 			tasks <- fileExportTask{
-				path:    filename,
-				content: []byte(obj.Definition),
-				objType: obj.Type,
-				objName: obj.Name,
+				path:      filename,
+				content:   []byte(obj.Definition),
+				key:       obj.Key(),
+				objType:   obj.Type,
+				objSchema: obj.Schema,
+				objName:   obj.Name,
 			}
 		}
 	}
@@ -505,6 +959,7 @@ func (e *Exporter) exportStandaloneObjects(schema string, objects []types.DBObje
 	// If we're continuing on error and have errors, just log a summary
 	if continueOnError && errCount > 0 {
 		log.Warn("Encountered %d errors while exporting standalone objects, but continuing as requested", errCount)
+		e.incomplete = true
 		return nil
 	}
 
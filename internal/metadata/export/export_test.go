@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,7 +17,7 @@ import (
 // Define our own interface for the connector
 type dbConnector interface {
 	FetchObjectDefinition(ctx context.Context, obj *types.DBObject) error
-	FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []string, error)
+	FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error)
 }
 
 // Mock connector for testing
@@ -58,18 +60,18 @@ func (m *mockConnector) FetchObjectDefinition(ctx context.Context, obj *types.DB
 	return nil
 }
 
-func (m *mockConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []string, error) {
+func (m *mockConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
 	if m.shouldFail {
 		// Instead of returning an error, return an empty result list and a list of failed objects
-		failedObjects := make([]string, 0, len(objects))
+		failedObjects := make([]types.ObjectKey, 0, len(objects))
 		for _, obj := range objects {
-			failedObjects = append(failedObjects, fmt.Sprintf("%s.%s", obj.Schema, obj.Name))
+			failedObjects = append(failedObjects, obj.Key())
 		}
 		return []types.DBObject{}, failedObjects, nil
 	}
 
 	results := make([]types.DBObject, len(objects))
-	failedObjects := make([]string, 0)
+	failedObjects := make([]types.ObjectKey, 0)
 
 	for i, obj := range objects {
 		results[i] = obj // Copy the object
@@ -77,7 +79,7 @@ func (m *mockConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context,
 		// Fetch definition for each object
 		err := m.FetchObjectDefinition(ctx, &results[i])
 		if err != nil {
-			failedObjects = append(failedObjects, fmt.Sprintf("%s.%s", obj.Schema, obj.Name))
+			failedObjects = append(failedObjects, obj.Key())
 		}
 	}
 
@@ -95,26 +97,30 @@ func NewWithMock(connector dbConnector, outputDir string) *Exporter {
 	return &Exporter{
 		connector:   connector,
 		outputDir:   outputDir,
+		fs:          OSFileSystem(),
 		concurrency: 10, // Smaller concurrency for tests
 	}
 }
 
+// NewWithMemFS creates a test exporter that writes to an in-memory filesystem
+func NewWithMemFS(connector dbConnector, outputDir string) (*Exporter, *MemFileSystem) {
+	fs := NewMemFileSystem()
+	return NewWithMock(connector, outputDir).WithFileSystem(fs), fs
+}
+
 // NewWithMockAndConcurrency creates a test exporter with specified concurrency
 func NewWithMockAndConcurrency(connector dbConnector, outputDir string, concurrency int) *Exporter {
 	return &Exporter{
 		connector:   connector,
 		outputDir:   outputDir,
+		fs:          OSFileSystem(),
 		concurrency: concurrency,
 	}
 }
 
 func TestExportObjects(t *testing.T) {
-	// Create a temporary directory for output
-	tmpDir, err := os.MkdirTemp("", "pgmeta-test")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tmpDir)
+	// Export to memory; nothing touches the local disk
+	outputDir := "/pgmeta-output"
 
 	// Create test objects
 	objects := []types.DBObject{
@@ -156,43 +162,43 @@ func TestExportObjects(t *testing.T) {
 
 	// Create exporter with mock connector
 	connector := &mockConnector{shouldFail: false}
-	exporter := NewWithMock(connector, tmpDir)
+	exporter, fs := NewWithMemFS(connector, outputDir)
 
 	// Export objects
-	err = exporter.ExportObjects(context.Background(), objects, false)
+	err := exporter.ExportObjects(context.Background(), objects, false)
 	if err != nil {
 		t.Fatalf("ExportObjects failed: %v", err)
 	}
 
 	// Verify directories were created
 	expectedDirs := []string{
-		filepath.Join(tmpDir, "public"),
-		filepath.Join(tmpDir, "public", "tables", "users"),
-		filepath.Join(tmpDir, "public", "tables", "users", "indexes"),
-		filepath.Join(tmpDir, "public", "tables", "users", "constraints"),
-		filepath.Join(tmpDir, "public", "tables", "users", "triggers"),
-		filepath.Join(tmpDir, "public", "functions"),
-		filepath.Join(tmpDir, "public", "views"),
+		filepath.Join(outputDir, "public"),
+		filepath.Join(outputDir, "public", "tables", "users"),
+		filepath.Join(outputDir, "public", "tables", "users", "indexes"),
+		filepath.Join(outputDir, "public", "tables", "users", "constraints"),
+		filepath.Join(outputDir, "public", "tables", "users", "triggers"),
+		filepath.Join(outputDir, "public", "functions"),
+		filepath.Join(outputDir, "public", "views"),
 	}
 
 	for _, dir := range expectedDirs {
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if !fs.IsDir(dir) {
 			t.Errorf("Expected directory was not created: %s", dir)
 		}
 	}
 
 	// Verify files were created
 	expectedFiles := []string{
-		filepath.Join(tmpDir, "public", "tables", "users", "table.sql"),
-		filepath.Join(tmpDir, "public", "tables", "users", "indexes", "users_idx.sql"),
-		filepath.Join(tmpDir, "public", "tables", "users", "constraints", "users_pk.sql"),
-		filepath.Join(tmpDir, "public", "tables", "users", "triggers", "users_audit.sql"),
-		filepath.Join(tmpDir, "public", "functions", "get_user.sql"),
-		filepath.Join(tmpDir, "public", "views", "active_users.sql"),
+		filepath.Join(outputDir, "public", "tables", "users", "table.sql"),
+		filepath.Join(outputDir, "public", "tables", "users", "indexes", "users_idx.sql"),
+		filepath.Join(outputDir, "public", "tables", "users", "constraints", "users_pk.sql"),
+		filepath.Join(outputDir, "public", "tables", "users", "triggers", "users_audit.sql"),
+		filepath.Join(outputDir, "public", "functions", "get_user.sql"),
+		filepath.Join(outputDir, "public", "views", "active_users.sql"),
 	}
 
 	for _, file := range expectedFiles {
-		if _, err := os.Stat(file); os.IsNotExist(err) {
+		if _, err := fs.ReadFile(file); err != nil {
 			t.Errorf("Expected file was not created: %s", file)
 		}
 	}
@@ -250,12 +256,8 @@ func TestExportObjectsWithFetchError(t *testing.T) {
 }
 
 func TestExportObjectWithNoTableName(t *testing.T) {
-	// Create a temporary directory for output
-	tmpDir, err := os.MkdirTemp("", "pgmeta-test")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tmpDir)
+	// Export to memory; nothing touches the local disk
+	outputDir := "/pgmeta-output"
 
 	// Create test objects
 	objects := []types.DBObject{
@@ -273,29 +275,191 @@ func TestExportObjectWithNoTableName(t *testing.T) {
 
 	// Create exporter with mock connector
 	connector := &mockConnector{shouldFail: false}
-	exporter := NewWithMock(connector, tmpDir)
+	exporter, fs := NewWithMemFS(connector, outputDir)
 
 	// Export objects
-	err = exporter.ExportObjects(context.Background(), objects, false)
+	err := exporter.ExportObjects(context.Background(), objects, false)
 	if err != nil {
 		t.Fatalf("ExportObjects failed: %v", err)
 	}
 
 	// The orphan trigger should be exported as a standalone object
-	triggerFile := filepath.Join(tmpDir, "public", "triggers", "orphan_trigger.sql")
-	if _, err := os.Stat(triggerFile); os.IsNotExist(err) {
+	triggerFile := filepath.Join(outputDir, "public", "triggers", "orphan_trigger.sql")
+	if _, err := fs.ReadFile(triggerFile); err != nil {
 		t.Errorf("Expected orphan trigger file was not created: %s", triggerFile)
 	}
 }
 
-func TestMultiSchemaExport(t *testing.T) {
+func TestExportWindowFunction(t *testing.T) {
+	// Export to memory; nothing touches the local disk
+	outputDir := "/pgmeta-output"
+
+	// A window function (prokind = 'w') alongside a normal function
+	objects := []types.DBObject{
+		{
+			Type:   types.TypeFunction,
+			Schema: "public",
+			Name:   "get_user",
+		},
+		{
+			Type:   types.TypeWindowFunction,
+			Schema: "public",
+			Name:   "running_rank",
+		},
+	}
+
+	// Create exporter with mock connector
+	connector := &mockConnector{shouldFail: false}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+
+	// Export objects
+	err := exporter.ExportObjects(context.Background(), objects, false)
+	if err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	// Window functions get their own directory rather than being dropped
+	expectedFiles := []string{
+		filepath.Join(outputDir, "public", "functions", "get_user.sql"),
+		filepath.Join(outputDir, "public", "window_functions", "running_rank.sql"),
+	}
+
+	for _, file := range expectedFiles {
+		if _, err := fs.ReadFile(file); err != nil {
+			t.Errorf("Expected file was not created: %s", file)
+		}
+	}
+}
+
+func TestExportWithGzipCompression(t *testing.T) {
+	// Create a temporary directory for output
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-gzip")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_idx", TableName: "users"},
+		{Type: types.TypeView, Schema: "public", Name: "active_users"},
+	}
+
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir).WithCompression(CompressionGzip).WithIndex(true)
+
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	tablePath := filepath.Join(tmpDir, "public", "tables", "users", "table.sql")
+	if _, err := os.Stat(tablePath); !os.IsNotExist(err) {
+		t.Errorf("Uncompressed file should not be written: %s", tablePath)
+	}
+	if _, err := os.Stat(tablePath + ".gz"); err != nil {
+		t.Errorf("Expected compressed file: %v", err)
+	}
+
+	// Compressed files are read back transparently
+	content, err := ReadDefinition(tablePath)
+	if err != nil {
+		t.Fatalf("ReadDefinition failed: %v", err)
+	}
+	if string(content) != "CREATE TABLE public.users (id integer);" {
+		t.Errorf("Unexpected decompressed content: %q", content)
+	}
+
+	// The index lists the compressed paths
+	index, err := os.ReadFile(filepath.Join(tmpDir, "public", indexFile))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if !strings.Contains(string(index), "views/active_users.sql.gz") {
+		t.Errorf("Expected index to reference compressed files, got:\n%s", index)
+	}
+}
+
+func TestReadDefinitionUncompressed(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-read")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "view.sql")
+	if err := os.WriteFile(path, []byte("SELECT 1;"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	content, err := ReadDefinition(path)
+	if err != nil {
+		t.Fatalf("ReadDefinition failed: %v", err)
+	}
+	if string(content) != "SELECT 1;" {
+		t.Errorf("Unexpected content: %q", content)
+	}
+
+	if _, err := ReadDefinition(filepath.Join(tmpDir, "missing.sql")); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist error for missing file, got %v", err)
+	}
+}
+
+func TestExportDeferrableNotValidConstraint(t *testing.T) {
 	// Create a temporary directory for output
-	tmpDir, err := os.MkdirTemp("", "pgmeta-test-multi-schema")
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test")
 	if err != nil {
 		t.Fatalf("Failed to create temp dir: %v", err)
 	}
 	defer os.RemoveAll(tmpDir)
 
+	definition := "FOREIGN KEY (user_id) REFERENCES users(id) DEFERRABLE INITIALLY DEFERRED NOT VALID"
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "orders"},
+		{
+			Type:       types.TypeConstraint,
+			Schema:     "public",
+			Name:       "orders_user_id_fkey",
+			TableName:  "orders",
+			Definition: definition,
+		},
+	}
+
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir)
+
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	// Constraint attributes are written exactly as the server rendered them
+	content, err := os.ReadFile(filepath.Join(tmpDir, "public", "tables", "orders", "constraints", "orders_user_id_fkey.sql"))
+	if err != nil {
+		t.Fatalf("Failed to read constraint file: %v", err)
+	}
+	if string(content) != definition {
+		t.Errorf("Expected constraint definition %q, got %q", definition, content)
+	}
+}
+
+func TestMakeIndexConcurrent(t *testing.T) {
+	tests := map[string]string{
+		"CREATE INDEX users_idx ON public.users USING btree (id)":              "CREATE INDEX CONCURRENTLY users_idx ON public.users USING btree (id)",
+		"CREATE UNIQUE INDEX users_email ON public.users USING btree (email)":  "CREATE UNIQUE INDEX CONCURRENTLY users_email ON public.users USING btree (email)",
+		"CREATE INDEX CONCURRENTLY users_idx ON public.users USING btree (id)": "CREATE INDEX CONCURRENTLY users_idx ON public.users USING btree (id)",
+		"ALTER TABLE public.users ADD PRIMARY KEY (id)":                        "ALTER TABLE public.users ADD PRIMARY KEY (id)",
+	}
+
+	for input, expected := range tests {
+		if got := makeIndexConcurrent(input); got != expected {
+			t.Errorf("makeIndexConcurrent(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestMultiSchemaExport(t *testing.T) {
+	// Export to memory; nothing touches the local disk
+	outputDir := "/pgmeta-output"
+
 	// Create test objects with multiple schemas
 	objects := []types.DBObject{
 		{
@@ -333,10 +497,10 @@ func TestMultiSchemaExport(t *testing.T) {
 
 	// Create exporter with mock connector
 	connector := &mockConnector{shouldFail: false}
-	exporter := NewWithMock(connector, tmpDir)
+	exporter, fs := NewWithMemFS(connector, outputDir)
 
 	// Export objects
-	err = exporter.ExportObjects(context.Background(), objects, false)
+	err := exporter.ExportObjects(context.Background(), objects, false)
 	if err != nil {
 		t.Fatalf("ExportObjects failed: %v", err)
 	}
@@ -344,8 +508,8 @@ func TestMultiSchemaExport(t *testing.T) {
 	// Verify schema directories were created
 	expectedSchemas := []string{"public", "app", "reporting"}
 	for _, schema := range expectedSchemas {
-		schemaDir := filepath.Join(tmpDir, schema)
-		if _, err := os.Stat(schemaDir); os.IsNotExist(err) {
+		schemaDir := filepath.Join(outputDir, schema)
+		if !fs.IsDir(schemaDir) {
 			t.Errorf("Expected schema directory was not created: %s", schemaDir)
 		}
 	}
@@ -353,32 +517,161 @@ func TestMultiSchemaExport(t *testing.T) {
 	// Verify expected files by schema
 	expectedFiles := []string{
 		// public schema
-		filepath.Join(tmpDir, "public", "tables", "users", "table.sql"),
-		filepath.Join(tmpDir, "public", "functions", "get_user.sql"),
+		filepath.Join(outputDir, "public", "tables", "users", "table.sql"),
+		filepath.Join(outputDir, "public", "functions", "get_user.sql"),
 
 		// app schema
-		filepath.Join(tmpDir, "app", "tables", "products", "table.sql"),
-		filepath.Join(tmpDir, "app", "tables", "products", "indexes", "products_idx.sql"),
-		filepath.Join(tmpDir, "app", "functions", "get_product.sql"),
+		filepath.Join(outputDir, "app", "tables", "products", "table.sql"),
+		filepath.Join(outputDir, "app", "tables", "products", "indexes", "products_idx.sql"),
+		filepath.Join(outputDir, "app", "functions", "get_product.sql"),
 
 		// reporting schema
-		filepath.Join(tmpDir, "reporting", "views", "sales_summary.sql"),
+		filepath.Join(outputDir, "reporting", "views", "sales_summary.sql"),
 	}
 
 	for _, file := range expectedFiles {
-		if _, err := os.Stat(file); os.IsNotExist(err) {
+		if _, err := fs.ReadFile(file); err != nil {
 			t.Errorf("Expected file was not created: %s", file)
 		}
 	}
 }
 
-func TestConcurrentExport(t *testing.T) {
-	// Create a temporary directory for output
-	tmpDir, err := os.MkdirTemp("", "pgmeta-test")
+func TestSameNamedTablesInTwoSchemas(t *testing.T) {
+	outputDir := "/pgmeta-output"
+
+	// Both schemas have a users table with identically named child objects
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_email_idx", TableName: "users"},
+		{Type: types.TypeTrigger, Schema: "public", Name: "audit", TableName: "users"},
+		{Type: types.TypeTable, Schema: "tenant_a", Name: "users"},
+		{Type: types.TypeIndex, Schema: "tenant_a", Name: "users_email_idx", TableName: "users"},
+		{Type: types.TypeTrigger, Schema: "tenant_a", Name: "audit", TableName: "users"},
+	}
+
+	connector := &mockConnector{shouldFail: false}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	if files := fs.Files(); len(files) != len(objects) {
+		t.Fatalf("Expected %d files, got %v", len(objects), files)
+	}
+	for _, schema := range []string{"public", "tenant_a"} {
+		tableDir := filepath.Join(outputDir, schema, "tables", "users")
+		for path, expected := range map[string]string{
+			filepath.Join(tableDir, "table.sql"):                      "CREATE TABLE " + schema + ".users",
+			filepath.Join(tableDir, "indexes", "users_email_idx.sql"): "ON " + schema + ".users",
+			filepath.Join(tableDir, "triggers", "audit.sql"):          "ON " + schema + ".users",
+		} {
+			content, err := fs.ReadFile(path)
+			if err != nil {
+				t.Errorf("Expected %s to be written: %v", path, err)
+				continue
+			}
+			if !strings.Contains(string(content), expected) {
+				t.Errorf("Expected %s to hold the %s object, got %q", path, schema, content)
+			}
+		}
+	}
+}
+
+func TestPartitionChildObjects(t *testing.T) {
+	outputDir := "/pgmeta-output"
+
+	// A partitioned table with one index on the parent and one created on a single partition
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "events"},
+		{Type: types.TypeTable, Schema: "public", Name: "events_2024"},
+		{Type: types.TypeIndex, Schema: "public", Name: "events_created_at_idx", TableName: "events"},
+		{Type: types.TypeIndex, Schema: "public", Name: "events_2024_payload_idx", TableName: "events_2024"},
+		{Type: types.TypeConstraint, Schema: "public", Name: "events_2024_year_check", TableName: "events_2024",
+			Definition: "CHECK (created_at >= '2024-01-01'::date)"},
+	}
+
+	connector := &mockConnector{shouldFail: false}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	tablesDir := filepath.Join(outputDir, "public", "tables")
+	expected := []string{
+		filepath.Join(tablesDir, "events", "table.sql"),
+		filepath.Join(tablesDir, "events", "indexes", "events_created_at_idx.sql"),
+		filepath.Join(tablesDir, "events_2024", "table.sql"),
+		filepath.Join(tablesDir, "events_2024", "indexes", "events_2024_payload_idx.sql"),
+		filepath.Join(tablesDir, "events_2024", "constraints", "events_2024_year_check.sql"),
+	}
+	for _, path := range expected {
+		if _, err := fs.ReadFile(path); err != nil {
+			t.Errorf("Expected %s to be written: %v", path, err)
+		}
+	}
+	if files := fs.Files(); len(files) != len(expected) {
+		t.Errorf("Expected %d files, got %v", len(expected), files)
+	}
+	// The partition's index must not end up under the parent
+	if _, err := fs.ReadFile(filepath.Join(tablesDir, "events", "indexes", "events_2024_payload_idx.sql")); err == nil {
+		t.Error("Expected the partition-local index to be written under the partition, not its parent")
+	}
+}
+
+func TestExportLanguages(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	objects := []types.DBObject{
+		{Type: types.TypeLanguage, Schema: "postgres", Name: "plv8",
+			Definition: "CREATE TRUSTED PROCEDURAL LANGUAGE plv8 HANDLER plv8_call_handler;"},
+		{Type: types.TypeFunction, Schema: "public", Name: "greet"},
+	}
+
+	exporter, fs := NewWithMemFS(&mockConnector{shouldFail: false}, outputDir)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	// Languages are database-level and live in a top-level directory, not under a schema
+	expected := []string{
+		filepath.Join(outputDir, "languages", "plv8.sql"),
+		filepath.Join(outputDir, "public", "functions", "greet.sql"),
+	}
+	if files := fs.Files(); strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected files %v, got %v", expected, files)
+	}
+}
+
+func TestExportStatistics(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	const definition = "CREATE STATISTICS public.orders_region_city (ndistinct, dependencies) ON region, city FROM public.orders;"
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "orders", Definition: "CREATE TABLE public.orders (region text, city text);"},
+		{Type: types.TypeStatistics, Schema: "public", Name: "orders_region_city", TableName: "orders", Definition: definition},
+		// Statistics on a table in another schema have no table directory to go in
+		{Type: types.TypeStatistics, Schema: "stats", Name: "orders_by_day", Definition: "CREATE STATISTICS stats.orders_by_day ON day, region FROM public.orders;"},
+	}
+
+	exporter, fs := NewWithMemFS(&mockConnector{shouldFail: false}, outputDir)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	path := filepath.Join(outputDir, "public", "tables", "orders", "statistics", "orders_region_city.sql")
+	content, err := fs.ReadFile(path)
 	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
+		t.Fatalf("Expected statistics under their table: %v", err)
 	}
-	defer os.RemoveAll(tmpDir)
+	if string(content) != definition {
+		t.Errorf("Expected %q, got %q", definition, content)
+	}
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "stats", "statistics", "orders_by_day.sql")); err != nil {
+		t.Errorf("Expected statistics without a table in the schema's statistics directory: %v", err)
+	}
+}
+
+func TestConcurrentExport(t *testing.T) {
+	// Export to memory; nothing touches the local disk
+	outputDir := "/pgmeta-output"
 
 	// Create a larger set of test objects to test concurrency
 	objects := make([]types.DBObject, 0)
@@ -443,11 +736,12 @@ func TestConcurrentExport(t *testing.T) {
 
 	// Create exporter with mock connector and higher concurrency
 	connector := &mockConnector{shouldFail: false}
-	exporter := NewWithMockAndConcurrency(connector, tmpDir, 20)
+	fs := NewMemFileSystem()
+	exporter := NewWithMockAndConcurrency(connector, outputDir, 20).WithFileSystem(fs)
 
 	// Export objects
 	start := time.Now()
-	err = exporter.ExportObjects(context.Background(), objects, false)
+	err := exporter.ExportObjects(context.Background(), objects, false)
 	duration := time.Since(start)
 
 	if err != nil {
@@ -457,21 +751,14 @@ func TestConcurrentExport(t *testing.T) {
 	t.Logf("Exported %d objects in %v", len(objects), duration)
 
 	// Verify the number of files created matches the objects
-	fileCount := countFiles(t, tmpDir)
+	fileCount := len(fs.Files())
 	if fileCount != len(objects) {
 		t.Errorf("Expected %d files, but found %d", len(objects), fileCount)
 	}
 
 	// Try with single thread for comparison
-	// Create a new temp dir
-	singleThreadDir, err := os.MkdirTemp("", "pgmeta-single")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(singleThreadDir)
-
-	// Create single-threaded exporter
-	singleThreadExporter := NewWithMockAndConcurrency(connector, singleThreadDir, 1)
+	singleThreadFS := NewMemFileSystem()
+	singleThreadExporter := NewWithMockAndConcurrency(connector, outputDir, 1).WithFileSystem(singleThreadFS)
 
 	// Export objects with single thread
 	startSingle := time.Now()
@@ -485,12 +772,137 @@ func TestConcurrentExport(t *testing.T) {
 	t.Logf("Single-threaded: Exported %d objects in %v", len(objects), durationSingle)
 
 	// Verify files created matches objects
-	singleFileCount := countFiles(t, singleThreadDir)
+	singleFileCount := len(singleThreadFS.Files())
 	if singleFileCount != len(objects) {
 		t.Errorf("Single-threaded: Expected %d files, but found %d", len(objects), singleFileCount)
 	}
 }
 
+// concurrencyRecordingConnector records the fetch concurrency it is asked for
+type concurrencyRecordingConnector struct {
+	mockConnector
+	fetchConcurrency int
+}
+
+func (c *concurrencyRecordingConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
+	c.fetchConcurrency = concurrency
+	return c.mockConnector.FetchObjectsDefinitionsConcurrently(ctx, objects, concurrency)
+}
+
+// inFlightFileSystem tracks the most file writes that were ever in progress at once
+type inFlightFileSystem struct {
+	FileSystem
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (fs *inFlightFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	fs.mu.Lock()
+	fs.inFlight++
+	if fs.inFlight > fs.maxInFlight {
+		fs.maxInFlight = fs.inFlight
+	}
+	fs.mu.Unlock()
+
+	time.Sleep(time.Millisecond) // Give other writers a chance to overlap
+	err := fs.FileSystem.WriteFile(name, data, perm)
+
+	fs.mu.Lock()
+	fs.inFlight--
+	fs.mu.Unlock()
+	return err
+}
+
+// mkdirCountingFileSystem counts the MkdirAll calls that reach the filesystem
+type mkdirCountingFileSystem struct {
+	FileSystem
+	calls atomic.Int64
+}
+
+func (fs *mkdirCountingFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	fs.calls.Add(1)
+	return fs.FileSystem.MkdirAll(path, perm)
+}
+
+func TestSafelyMkdirConcurrent(t *testing.T) {
+	mem := NewMemFileSystem()
+	fs := &mkdirCountingFileSystem{FileSystem: mem}
+	exporter := NewWithMock(&mockConnector{}, "/pgmeta-output").WithFileSystem(fs)
+	dir := filepath.Join("/pgmeta-output", "public", "tables", "users")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- exporter.safelyMkdir(dir)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("safelyMkdir failed: %v", err)
+		}
+	}
+	if !mem.IsDir(dir) {
+		t.Fatalf("Expected %s to be created", dir)
+	}
+
+	// Once created, the directory is never requested from the filesystem again
+	before := fs.calls.Load()
+	for i := 0; i < 100; i++ {
+		if err := exporter.safelyMkdir(dir); err != nil {
+			t.Fatalf("safelyMkdir failed: %v", err)
+		}
+	}
+	if after := fs.calls.Load(); after != before {
+		t.Errorf("Expected later calls to skip MkdirAll, it ran %d more times", after-before)
+	}
+}
+
+func TestFetchAndWriteConcurrencyAreIndependent(t *testing.T) {
+	objects := make([]types.DBObject, 0, 30)
+	for i := 1; i <= 30; i++ {
+		objects = append(objects, types.DBObject{Type: types.TypeFunction, Schema: "public", Name: fmt.Sprintf("function_%d", i)})
+	}
+
+	tests := []struct {
+		fetch, write int
+	}{
+		{fetch: 20, write: 1},
+		{fetch: 1, write: 4},
+	}
+	for _, tt := range tests {
+		connector := &concurrencyRecordingConnector{}
+		fs := &inFlightFileSystem{FileSystem: NewMemFileSystem()}
+		exporter := NewWithMock(connector, "/pgmeta-output").
+			WithFileSystem(fs).
+			WithFetchConcurrency(tt.fetch).
+			WithConcurrency(tt.write)
+
+		if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+			t.Fatalf("ExportObjects failed: %v", err)
+		}
+		if connector.fetchConcurrency != tt.fetch {
+			t.Errorf("fetch %d, write %d: expected definitions to be fetched with concurrency %d, got %d",
+				tt.fetch, tt.write, tt.fetch, connector.fetchConcurrency)
+		}
+		if fs.maxInFlight > tt.write {
+			t.Errorf("fetch %d, write %d: expected at most %d concurrent writes, saw %d",
+				tt.fetch, tt.write, tt.write, fs.maxInFlight)
+		}
+	}
+
+	// Non-positive values keep the defaults
+	exporter := NewWithMock(&mockConnector{}, "/pgmeta-output").WithFetchConcurrency(5).WithFetchConcurrency(0).WithConcurrency(-1)
+	if exporter.fetchConcurrency != 5 || exporter.concurrency != 10 {
+		t.Errorf("Expected invalid values to be ignored, got fetch %d and write %d", exporter.fetchConcurrency, exporter.concurrency)
+	}
+}
+
 // selectiveFailConnector is a mock connector that fails on specific objects
 type selectiveFailConnector struct {
 	mockConnector
@@ -506,13 +918,13 @@ func (s *selectiveFailConnector) FetchObjectDefinition(ctx context.Context, obj
 }
 
 // FetchObjectsDefinitionsConcurrently overrides the mockConnector method to fail selectively
-func (s *selectiveFailConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []string, error) {
+func (s *selectiveFailConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
 	results := make([]types.DBObject, 0, len(objects))
-	failedObjects := make([]string, 0)
+	failedObjects := make([]types.ObjectKey, 0)
 
 	for _, obj := range objects {
 		if s.failedObjects[obj.Name] {
-			failedObjects = append(failedObjects, fmt.Sprintf("%s.%s", obj.Schema, obj.Name))
+			failedObjects = append(failedObjects, obj.Key())
 			continue
 		}
 
@@ -520,7 +932,7 @@ func (s *selectiveFailConnector) FetchObjectsDefinitionsConcurrently(ctx context
 		if err := s.mockConnector.FetchObjectDefinition(ctx, &objCopy); err == nil {
 			results = append(results, objCopy)
 		} else {
-			failedObjects = append(failedObjects, fmt.Sprintf("%s.%s", obj.Schema, obj.Name))
+			failedObjects = append(failedObjects, obj.Key())
 		}
 	}
 
@@ -0,0 +1,50 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+)
+
+// FailedObjectsFile lists, in the output directory, the objects whose definitions the most
+// recent export could not fetch, one "type schema.name" line each, the format of
+// --objects-from-file. It is removed by an export without failures.
+const FailedObjectsFile = "failed_objects.txt"
+
+// failedObjectsHeader explains the file to whoever opens it; ParseObjectList skips it
+const failedObjectsHeader = "# Objects whose definitions could not be fetched. Export them again with --retry-failed.\n"
+
+// writeFailedObjects records the objects that failed to fetch, or removes the list left by an
+// earlier export when nothing failed
+func (e *Exporter) writeFailedObjects() error {
+	path := filepath.Join(e.outputDir, FailedObjectsFile)
+	if len(e.failed) == 0 {
+		// A filesystem that cannot delete files, such as S3, keeps the old list
+		if pfs, ok := e.fs.(PruneFileSystem); ok {
+			if err := pfs.Remove(path); err != nil && !os.IsNotExist(err) {
+				return stacktrace.Propagate(err, "Failed to remove stale failed object list %s", path)
+			}
+		}
+		return nil
+	}
+
+	lines := make([]string, 0, len(e.failed))
+	for _, key := range e.failed {
+		lines = append(lines, key.String())
+	}
+	sort.Strings(lines)
+	// Same-named objects on different tables share a line, as the list leaves tables out
+	lines = slices.Compact(lines)
+
+	content := failedObjectsHeader + strings.Join(lines, "\n") + "\n"
+	if err := e.writeFile(path, []byte(content)); err != nil {
+		return stacktrace.Propagate(err, "Failed to write failed object list %s", path)
+	}
+	log.Warn("Listed the %d objects that failed in %s; export them again with --retry-failed %s", len(lines), path, path)
+	return nil
+}
@@ -0,0 +1,95 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// flakyConnector is a mockConnector that fails to fetch the objects named in failing
+type flakyConnector struct {
+	mockConnector
+	failing map[string]bool
+}
+
+func (c *flakyConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
+	var fetched []types.DBObject
+	var failed []types.ObjectKey
+	for _, obj := range objects {
+		if c.failing[obj.Schema+"."+obj.Name] {
+			failed = append(failed, obj.Key())
+			continue
+		}
+		if err := c.FetchObjectDefinition(ctx, &obj); err != nil {
+			return nil, nil, err
+		}
+		fetched = append(fetched, obj)
+	}
+	return fetched, failed, nil
+}
+
+func TestRetryFailedObjects(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	connector := &flakyConnector{failing: map[string]bool{"public.orders": true, "postgres.plpython3u": true}}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeTable, Schema: "public", Name: "orders"},
+		{Type: types.TypeView, Schema: "public", Name: "orders"},
+		{Type: types.TypeLanguage, Schema: "postgres", Name: "plpython3u"},
+	}
+	if err := exporter.ExportObjects(context.Background(), objects, true); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	if !exporter.Incomplete() {
+		t.Error("Expected the export to be reported as incomplete")
+	}
+
+	listPath := filepath.Join(outputDir, FailedObjectsFile)
+	content, err := fs.ReadFile(listPath)
+	if err != nil {
+		t.Fatalf("Expected %s to be written: %v", FailedObjectsFile, err)
+	}
+	refs, err := types.ParseObjectList(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Expected the failed object list to parse: %v", err)
+	}
+	want := []types.ObjectRef{
+		{Type: types.TypeLanguage, Name: "postgres.plpython3u"},
+		{Type: types.TypeTable, Name: "public.orders"},
+		{Type: types.TypeView, Name: "public.orders"},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("Expected failed objects %v, got %v", want, refs)
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Errorf("Expected failed object %v, got %v", want[i], refs[i])
+		}
+	}
+
+	// The retry selects only the listed objects, as --retry-failed does against the database
+	opts := types.QueryOptionsFor(refs)
+	if len(opts.Schemas) != 1 || opts.Schemas[0] != "public" {
+		t.Errorf("Expected only public to be queried, got %v", opts.Schemas)
+	}
+	retry := types.FilterRefs(refs, objects)
+	if len(retry) != 3 {
+		t.Fatalf("Expected the 3 failed objects to be selected, got %v", retry)
+	}
+
+	connector.failing = nil
+	exporter = NewWithMock(connector, outputDir).WithFileSystem(fs)
+	if err := exporter.ExportObjects(context.Background(), retry, true); err != nil {
+		t.Fatalf("Retrying failed objects failed: %v", err)
+	}
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "public", "tables", "orders", "table.sql")); err != nil {
+		t.Errorf("Expected the retry to write public.orders: %v", err)
+	}
+	if _, err := fs.ReadFile(listPath); err == nil {
+		t.Errorf("Expected %s to be removed once nothing failed", FailedObjectsFile)
+	}
+}
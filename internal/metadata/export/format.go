@@ -0,0 +1,241 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+)
+
+// formatIndent is the indentation added per nesting level by formatSQL
+const formatIndent = "    "
+
+// sqlKeywords are uppercased by formatSQL. The list is limited to words PostgreSQL
+// reserves (plus the join keywords), so they can never be unquoted identifiers.
+var sqlKeywords = map[string]bool{
+	"all": true, "and": true, "any": true, "array": true, "as": true, "asc": true,
+	"between": true, "both": true, "by": true, "case": true, "cast": true, "check": true,
+	"collate": true, "column": true, "constraint": true, "create": true, "cross": true,
+	"default": true, "deferrable": true, "desc": true, "distinct": true, "do": true,
+	"else": true, "end": true, "except": true, "false": true, "fetch": true, "for": true,
+	"foreign": true, "from": true, "full": true, "grant": true, "group": true,
+	"having": true, "ilike": true, "in": true, "initially": true, "inner": true,
+	"intersect": true, "into": true, "is": true, "isnull": true, "join": true,
+	"lateral": true, "leading": true, "left": true, "like": true, "limit": true,
+	"natural": true, "not": true, "notnull": true, "null": true, "offset": true,
+	"on": true, "only": true, "or": true, "order": true, "outer": true, "primary": true,
+	"references": true, "returning": true, "right": true, "select": true, "some": true,
+	"symmetric": true, "table": true, "then": true, "to": true, "trailing": true,
+	"true": true, "union": true, "unique": true, "using": true, "variadic": true,
+	"when": true, "where": true, "window": true, "with": true,
+}
+
+// clauseKeywords start a clause; lines beginning with one are not indented as continuations
+var clauseKeywords = map[string]bool{
+	"ALTER": true, "AS": true, "CREATE": true, "EXCEPT": true, "FETCH": true,
+	"FROM": true, "GROUP": true, "HAVING": true, "INTERSECT": true, "LIMIT": true,
+	"OFFSET": true, "ORDER": true, "RETURNING": true, "SELECT": true, "UNION": true,
+	"VALUES": true, "WHERE": true, "WINDOW": true, "WITH": true,
+}
+
+// sqlSegment is a run of SQL text; only code segments may be reformatted
+type sqlSegment struct {
+	text string
+	code bool
+}
+
+// formatSQL canonicalizes a definition: reserved keywords are uppercased and each line
+// is re-indented by its parenthesis and CASE nesting. Outside parentheses, lines that do
+// not start a clause are indented one extra level as continuations. String literals,
+// quoted identifiers, comments and dollar-quoted bodies (function bodies in particular)
+// are copied unchanged.
+func formatSQL(definition string) string {
+	var out bytes.Buffer
+	var nesting []bool // one entry per open parenthesis (false) or CASE (true)
+	atLineStart := true
+
+	// indent writes the indentation for a line starting with a clause keyword or not
+	indent := func(clause bool) {
+		level := len(nesting)
+		if !clause && (len(nesting) == 0 || nesting[len(nesting)-1]) {
+			level++
+		}
+		out.WriteString(strings.Repeat(formatIndent, level))
+		atLineStart = false
+	}
+	// pop closes the innermost parenthesis or CASE
+	pop := func() {
+		if len(nesting) > 0 {
+			nesting = nesting[:len(nesting)-1]
+		}
+	}
+
+	for _, seg := range splitSQL(definition) {
+		if !seg.code {
+			if atLineStart {
+				indent(false)
+			}
+			out.WriteString(seg.text)
+			continue
+		}
+
+		text := seg.text
+		for i := 0; i < len(text); {
+			c := text[i]
+			switch {
+			case c == '\n':
+				out.Truncate(len(bytes.TrimRight(out.Bytes(), " \t\r")))
+				out.WriteByte('\n')
+				atLineStart = true
+				i++
+			case atLineStart && (c == ' ' || c == '\t' || c == '\r'):
+				i++
+			case isIdentStart(c) && (i == 0 || !isIdentChar(text[i-1])):
+				j := i
+				for j < len(text) && isIdentChar(text[j]) {
+					j++
+				}
+				word := text[i:j]
+				if sqlKeywords[strings.ToLower(word)] {
+					word = strings.ToUpper(word)
+				}
+				if word == "END" {
+					pop()
+				}
+				if atLineStart {
+					indent(clauseKeywords[word])
+				}
+				if word == "CASE" {
+					nesting = append(nesting, true)
+				}
+				out.WriteString(word)
+				i = j
+			default:
+				if c == ')' {
+					pop()
+				}
+				if atLineStart {
+					indent(c == ')')
+				}
+				if c == '(' {
+					nesting = append(nesting, false)
+				}
+				out.WriteByte(c)
+				i++
+			}
+		}
+	}
+	return out.String()
+}
+
+// splitSQL separates code from the parts that must not be reformatted:
+// single-quoted strings, quoted identifiers, comments and dollar-quoted strings
+func splitSQL(s string) []sqlSegment {
+	var segments []sqlSegment
+	start := 0
+	emit := func(end int, code bool) {
+		if end > start {
+			segments = append(segments, sqlSegment{text: s[start:end], code: code})
+		}
+		start = end
+	}
+
+	for i := 0; i < len(s); {
+		var end int
+		switch {
+		case strings.HasPrefix(s[i:], "--"):
+			end = strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = len(s)
+			} else {
+				end += i
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end = blockCommentEnd(s, i)
+		case s[i] == '\'':
+			escapes := i > 0 && (s[i-1] == 'E' || s[i-1] == 'e') && (i < 2 || !isIdentChar(s[i-2]))
+			end = quotedEnd(s, i, '\'', escapes)
+		case s[i] == '"':
+			end = quotedEnd(s, i, '"', false)
+		case s[i] == '$' && (i == 0 || !isIdentChar(s[i-1])):
+			tag, ok := dollarTag(s[i:])
+			if !ok {
+				i++
+				continue
+			}
+			closing := strings.Index(s[i+len(tag):], tag)
+			if closing < 0 {
+				end = len(s)
+			} else {
+				end = i + len(tag) + closing + len(tag)
+			}
+		default:
+			i++
+			continue
+		}
+		emit(i, true)
+		emit(end, false)
+		i = end
+	}
+	emit(len(s), true)
+	return segments
+}
+
+// dollarTag returns the $tag$ opening s, if any
+func dollarTag(s string) (string, bool) {
+	for j := 1; j < len(s); j++ {
+		switch {
+		case s[j] == '$':
+			return s[:j+1], true
+		case j == 1 && !isIdentStart(s[j]), j > 1 && !isIdentChar(s[j]):
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// quotedEnd returns the index just past the quote that closes the one at start.
+// A doubled quote is an escaped quote; with backslashEscapes a backslash escapes the next byte.
+func quotedEnd(s string, start int, quote byte, backslashEscapes bool) int {
+	for j := start + 1; j < len(s); j++ {
+		switch {
+		case backslashEscapes && s[j] == '\\':
+			j++
+		case s[j] == quote:
+			if j+1 < len(s) && s[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// blockCommentEnd returns the index just past the comment opening at start; PostgreSQL block comments nest
+func blockCommentEnd(s string, start int) int {
+	nesting := 0
+	for j := start; j+1 < len(s); j++ {
+		switch {
+		case s[j] == '/' && s[j+1] == '*':
+			nesting++
+			j++
+		case s[j] == '*' && s[j+1] == '/':
+			nesting--
+			j++
+			if nesting == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// isIdentStart reports whether c can start an unquoted identifier; bytes of multi-byte
+// UTF-8 characters count as letters
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// isIdentChar reports whether c can continue an unquoted identifier
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '$' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,101 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestFormatSQLView(t *testing.T) {
+	input := "CREATE VIEW public.active_users as\n" +
+		" select u.id,\n" +
+		"    case\n" +
+		"            when u.deleted_at is null then 'active'\n" +
+		"      else 'deleted'\n" +
+		"        end as status   \n" +
+		"   from users u\n" +
+		"     join orders o on o.user_id = u.id\n" +
+		"  where (u.id in ( select admins.user_id\n" +
+		"           from admins));"
+
+	expected := "CREATE VIEW public.active_users AS\n" +
+		"SELECT u.id,\n" +
+		"    CASE\n" +
+		"        WHEN u.deleted_at IS NULL THEN 'active'\n" +
+		"        ELSE 'deleted'\n" +
+		"    END AS status\n" +
+		"FROM users u\n" +
+		"    JOIN orders o ON o.user_id = u.id\n" +
+		"WHERE (u.id IN ( SELECT admins.user_id\n" +
+		"        FROM admins));"
+
+	if got := formatSQL(input); got != expected {
+		t.Errorf("formatSQL produced:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestFormatSQLTable(t *testing.T) {
+	input := "CREATE TABLE public.users (\n\tid integer not null,\n\t  email text default 'a' ,\n\tprimary KEY (id)\n);"
+	expected := "CREATE TABLE public.users (\n    id integer NOT NULL,\n    email text DEFAULT 'a' ,\n    PRIMARY KEY (id)\n);"
+
+	if got := formatSQL(input); got != expected {
+		t.Errorf("formatSQL produced:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestFormatSQLLeavesProtectedTextAlone(t *testing.T) {
+	tests := map[string]string{
+		// Dollar-quoted function bodies keep their casing and indentation
+		"create FUNCTION f() RETURNS int as $function$\n  select 1 from t where x is null;\n\tend\n$function$ LANGUAGE sql": "CREATE FUNCTION f() RETURNS int AS $function$\n  select 1 from t where x is null;\n\tend\n$function$ LANGUAGE sql",
+		// Tagless dollar quotes and nested tags
+		"select $$ from (where $$, $a$ $$ select $a$": "SELECT $$ from (where $$, $a$ $$ select $a$",
+		// String literals, including doubled and backslash-escaped quotes
+		"select 'it''s from where', E'a\\' select' from t": "SELECT 'it''s from where', E'a\\' select' FROM t",
+		// Quoted identifiers keep their case
+		`select "select", "Order" from "From"`: `SELECT "select", "Order" FROM "From"`,
+		// Comments, including nested block comments
+		"select 1 -- from here\n/* select /* nested */ where */ from t": "SELECT 1 -- from here\n    /* select /* nested */ where */ FROM t",
+		// Positional parameters are not dollar quotes
+		"select $1 from t where id = $2": "SELECT $1 FROM t WHERE id = $2",
+		// Identifiers containing keywords are not split
+		"select end_date, from_id, order_total from t": "SELECT end_date, from_id, order_total FROM t",
+	}
+
+	for input, expected := range tests {
+		if got := formatSQL(input); got != expected {
+			t.Errorf("formatSQL(%q)\n got: %q\nwant: %q", input, got, expected)
+		}
+	}
+}
+
+func TestFormatSQLIsIdempotent(t *testing.T) {
+	input := "CREATE VIEW v as\n select a,\n   case when b then 1 else 2 end as c\n   from t\n  where (x in ( select y\n   from z));"
+	once := formatSQL(input)
+	if twice := formatSQL(once); twice != once {
+		t.Errorf("formatSQL is not idempotent:\n%s\nthen:\n%s", once, twice)
+	}
+}
+
+func TestExportFormatSQL(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	objects := []types.DBObject{
+		{Type: types.TypeView, Schema: "public", Name: "v", Definition: "CREATE VIEW public.v as\n select 1\n   from t;"},
+	}
+
+	connector := &mockConnector{shouldFail: false}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	exporter.WithFormatSQL(true)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	content, err := fs.ReadFile(filepath.Join(outputDir, "public", "views", "v.sql"))
+	if err != nil {
+		t.Fatalf("Failed to read view: %v", err)
+	}
+	if expected := "CREATE VIEW public.v AS\nSELECT 1\nFROM t;"; string(content) != expected {
+		t.Errorf("Expected formatted view %q, got %q", expected, content)
+	}
+}
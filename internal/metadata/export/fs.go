@@ -0,0 +1,314 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/palantir/stacktrace"
+)
+
+// FileSystem is the set of file operations the exporter writes through,
+// so exports can target something other than the local disk
+type FileSystem interface {
+	MkdirAll(path string, perm os.FileMode) error
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+// osFileSystem writes to the local disk
+type osFileSystem struct{}
+
+// OSFileSystem returns a FileSystem backed by the local disk
+func OSFileSystem() FileSystem {
+	return osFileSystem{}
+}
+
+func (osFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (osFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFileSystem) AppendFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (osFileSystem) Symlink(oldname, newname string) error {
+	if err := os.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(oldname, newname)
+}
+
+func (osFileSystem) RemoveSymlink(name string) error {
+	info, err := os.Lstat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	return os.Remove(name)
+}
+
+func (osFileSystem) ListTree(root string) ([]string, []string, error) {
+	var files, dirs []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir():
+			dirs = append(dirs, path)
+		default:
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, dirs, err
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// PrepareOutputDir checks that dir can hold an export before anything is fetched:
+// it must be absent or a directory, and writable. A missing directory is created.
+func PrepareOutputDir(dir string) error {
+	info, err := os.Stat(dir)
+	switch {
+	case err == nil && !info.IsDir():
+		return stacktrace.NewError("Output path %s exists and is not a directory", dir)
+	case err != nil && !os.IsNotExist(err):
+		return stacktrace.Propagate(err, "Failed to check output path: %s", dir)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return stacktrace.Propagate(err, "Failed to create output directory: %s", dir)
+	}
+
+	// Permission bits don't tell the whole story (read-only mounts, ACLs), so try a write
+	probe, err := os.CreateTemp(dir, ".pgmeta-write-check-*")
+	if err != nil {
+		return stacktrace.Propagate(err, "Output directory %s is not writable", dir)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// MemFileSystem is an in-memory FileSystem that is safe for concurrent use.
+// Like the local disk, it refuses to write a file whose directory was not created.
+type MemFileSystem struct {
+	mu    sync.Mutex
+	dirs  map[string]bool
+	files map[string][]byte
+	links map[string]string
+}
+
+// NewMemFileSystem creates an empty in-memory filesystem
+func NewMemFileSystem() *MemFileSystem {
+	return &MemFileSystem{
+		dirs:  make(map[string]bool),
+		files: make(map[string][]byte),
+		links: make(map[string]string),
+	}
+}
+
+// MkdirAll records path and all of its parents as directories
+func (m *MemFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var missing []string
+	for dir := filepath.Clean(path); !m.dirs[dir]; dir = filepath.Dir(dir) {
+		if _, isFile := m.files[dir]; isFile {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: os.ErrExist}
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for _, dir := range missing {
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+// WriteFile stores a copy of data at name
+func (m *MemFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if dir := filepath.Dir(name); dir != "." && !m.dirs[dir] {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+// AppendFile adds data to the end of the file at name, creating it if needed
+func (m *MemFileSystem) AppendFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if dir := filepath.Dir(name); dir != "." && !m.dirs[dir] {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	m.files[name] = append(m.files[name], data...)
+	return nil
+}
+
+// Symlink records newname as a link to oldname, replacing any file at newname
+func (m *MemFileSystem) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	newname = filepath.Clean(newname)
+	if dir := filepath.Dir(newname); dir != "." && !m.dirs[dir] {
+		return &os.PathError{Op: "symlink", Path: newname, Err: os.ErrNotExist}
+	}
+	delete(m.files, newname)
+	m.links[newname] = oldname
+	return nil
+}
+
+// RemoveSymlink deletes name if it is a link
+func (m *MemFileSystem) RemoveSymlink(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.links, filepath.Clean(name))
+	return nil
+}
+
+// ListTree returns every file, link and directory below root, including root itself
+func (m *MemFileSystem) ListTree(root string) ([]string, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	root = filepath.Clean(root)
+	below := func(path string) bool {
+		return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+	}
+	var files, dirs []string
+	for path := range m.files {
+		if below(path) {
+			files = append(files, path)
+		}
+	}
+	for path := range m.links {
+		if below(path) {
+			files = append(files, path)
+		}
+	}
+	for path := range m.dirs {
+		if below(path) {
+			dirs = append(dirs, path)
+		}
+	}
+	sort.Strings(files)
+	sort.Strings(dirs)
+	return files, dirs, nil
+}
+
+// Remove deletes the file or link at name, or the directory name if nothing is below it
+func (m *MemFileSystem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if _, ok := m.links[name]; ok {
+		delete(m.links, name)
+		return nil
+	}
+	if !m.dirs[name] {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	prefix := name + string(filepath.Separator)
+	notEmpty := &os.PathError{Op: "remove", Path: name, Err: os.ErrExist}
+	for path := range m.dirs {
+		if strings.HasPrefix(path, prefix) {
+			return notEmpty
+		}
+	}
+	for path := range m.files {
+		if strings.HasPrefix(path, prefix) {
+			return notEmpty
+		}
+	}
+	for path := range m.links {
+		if strings.HasPrefix(path, prefix) {
+			return notEmpty
+		}
+	}
+	delete(m.dirs, name)
+	return nil
+}
+
+// Readlink returns the target of the link at name
+func (m *MemFileSystem) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	target, ok := m.links[filepath.Clean(name)]
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrInvalid}
+	}
+	return target, nil
+}
+
+// ReadFile returns the content written to name
+func (m *MemFileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// IsDir reports whether path was created as a directory
+func (m *MemFileSystem) IsDir(path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dirs[filepath.Clean(path)]
+}
+
+// Files returns the paths of all written files in sorted order
+func (m *MemFileSystem) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
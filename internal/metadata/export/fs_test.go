@@ -0,0 +1,86 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemFileSystem(t *testing.T) {
+	fs := NewMemFileSystem()
+
+	// Writing requires the parent directory, as on disk
+	if err := fs.WriteFile("/out/public/view.sql", []byte("SELECT 1;"), 0644); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist error without a parent directory, got %v", err)
+	}
+
+	if err := fs.MkdirAll("/out/public", 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if !fs.IsDir("/out") || !fs.IsDir("/out/public") {
+		t.Error("Expected MkdirAll to create every parent directory")
+	}
+
+	if err := fs.WriteFile("/out/public/view.sql", []byte("SELECT 1;"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	content, err := fs.ReadFile("/out/public/view.sql")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(content) != "SELECT 1;" {
+		t.Errorf("Unexpected content: %q", content)
+	}
+
+	// A directory cannot be created over a file
+	if err := fs.MkdirAll("/out/public/view.sql/nested", 0755); err == nil {
+		t.Error("Expected MkdirAll to fail when a path component is a file")
+	}
+	if fs.IsDir("/out/public/view.sql/nested") {
+		t.Error("Expected a failed MkdirAll not to create any directory")
+	}
+
+	if files := fs.Files(); len(files) != 1 || files[0] != "/out/public/view.sql" {
+		t.Errorf("Unexpected files: %v", files)
+	}
+	if _, err := fs.ReadFile("/out/missing.sql"); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist error for missing file, got %v", err)
+	}
+}
+
+func TestPrepareOutputDir(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A regular file is rejected with a clear message
+	file := filepath.Join(tmpDir, "schema.sql")
+	if err := os.WriteFile(file, []byte("SELECT 1;"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := PrepareOutputDir(file); err == nil || !strings.Contains(err.Error(), "exists and is not a directory") {
+		t.Errorf("Expected a not-a-directory error for %s, got: %v", file, err)
+	}
+
+	// Missing directories are created, existing ones accepted, and no probe file is left behind
+	out := filepath.Join(tmpDir, "nested", "pgmeta-output")
+	for i := 0; i < 2; i++ {
+		if err := PrepareOutputDir(out); err != nil {
+			t.Fatalf("PrepareOutputDir(%s) failed: %v", out, err)
+		}
+	}
+	if entries, err := os.ReadDir(out); err != nil || len(entries) != 0 {
+		t.Errorf("Expected an empty output directory, got %v (%v)", entries, err)
+	}
+
+	// Permissions don't apply to root
+	if os.Geteuid() == 0 {
+		return
+	}
+	readOnly := filepath.Join(tmpDir, "read-only")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("Failed to create read-only directory: %v", err)
+	}
+	if err := PrepareOutputDir(readOnly); err == nil || !strings.Contains(err.Error(), "is not writable") {
+		t.Errorf("Expected a not-writable error for %s, got: %v", readOnly, err)
+	}
+}
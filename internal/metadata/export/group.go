@@ -0,0 +1,90 @@
+package export
+
+import (
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// objectGroups is the layout ExportObjects writes objects in, before any file is named
+type objectGroups struct {
+	tables     map[string]map[string][]types.DBObject // Objects of each table, by schema directory and table name
+	standalone map[string][]types.DBObject            // Objects outside any table, by schema directory
+	schemas    map[string]string                      // The schema each schema directory holds, for table stats
+}
+
+// GroupObjects groups objects as ExportObjects lays them out by schema: schemaObjects holds
+// the objects of each table, keyed by schema directory and table name, and schemaStandalone
+// the objects outside any table, keyed by schema directory. Publications and subscriptions
+// go to the "postgres" directory, languages to "". A trigger, index or other table object
+// without a table name is standalone, as is a rule whose table is not among objects.
+func GroupObjects(objects []types.DBObject) (schemaObjects map[string]map[string][]types.DBObject, schemaStandalone map[string][]types.DBObject) {
+	groups := groupObjects(objects, schemaLayout)
+	return groups.tables, groups.standalone
+}
+
+// schemaLayout places every schema directory at the root of the output directory
+func schemaLayout(obj types.DBObject, schemaDir string) string {
+	return schemaDir
+}
+
+// groupObjects groups objects by schema directory and their tables. Table names are only
+// unique within a schema, so every lookup goes through the schema directory first and
+// same-named tables in different schemas keep their own child objects. layoutDir places
+// each object's schema directory, so in the owner layout a schema's objects are split
+// across one directory per owner.
+func groupObjects(objects []types.DBObject, layoutDir func(obj types.DBObject, schemaDir string) string) objectGroups {
+	groups := objectGroups{
+		tables:     make(map[string]map[string][]types.DBObject),
+		standalone: make(map[string][]types.DBObject),
+		schemas:    make(map[string]string),
+	}
+
+	addTable := func(dir, table string, obj types.DBObject) {
+		if _, exists := groups.tables[dir]; !exists {
+			groups.tables[dir] = make(map[string][]types.DBObject)
+		}
+		groups.tables[dir][table] = append(groups.tables[dir][table], obj)
+	}
+	addStandalone := func(dir string, obj types.DBObject) {
+		if _, exists := groups.tables[dir]; !exists {
+			groups.tables[dir] = make(map[string][]types.DBObject)
+		}
+		groups.standalone[dir] = append(groups.standalone[dir], obj)
+	}
+
+	for _, obj := range objects {
+		dir := layoutDir(obj, obj.Schema)
+		switch obj.Type {
+		case types.TypeTable:
+			groups.schemas[dir] = obj.Schema
+			addTable(dir, obj.Name, obj)
+		case types.TypeTrigger, types.TypeIndex, types.TypeConstraint, types.TypeSequence, types.TypePolicy, types.TypeStatistics:
+			// Use the TableName field we populated during query
+			if obj.TableName != "" {
+				groups.schemas[dir] = obj.Schema
+				addTable(dir, obj.TableName, obj)
+			} else {
+				log.Warn("%s %s has no associated table name", obj.Type, obj.Name)
+				addStandalone(dir, obj)
+			}
+		case types.TypePublication, types.TypeSubscription:
+			// Database-level objects - use a special "postgres" schema
+			addStandalone(layoutDir(obj, databaseSchema), obj)
+		case types.TypeLanguage:
+			// Languages belong to the database and go in a top-level languages directory,
+			// exported as a schema with no directory of its own
+			addStandalone(layoutDir(obj, ""), obj)
+		case types.TypeRule:
+			// Rules may be associated with tables or views; rules on a table in our set go
+			// with it, the rest are treated as standalone
+			if _, exists := groups.tables[dir][obj.TableName]; obj.TableName != "" && exists {
+				addTable(dir, obj.TableName, obj)
+			} else {
+				addStandalone(dir, obj)
+			}
+		default:
+			addStandalone(dir, obj)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,86 @@
+package export
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// objectNames returns the names of objects, in order
+func objectNames(objects []types.DBObject) []string {
+	var out []string
+	for _, obj := range objects {
+		out = append(out, obj.Name)
+	}
+	return out
+}
+
+// checkNames fails the test unless got holds exactly the objects named want, in order
+func checkNames(t *testing.T, what string, got []types.DBObject, want ...string) {
+	t.Helper()
+	gotNames := objectNames(got)
+	if len(gotNames) != len(want) {
+		t.Errorf("Expected %s %v, got %v", what, want, gotNames)
+		return
+	}
+	for i := range want {
+		if gotNames[i] != want[i] {
+			t.Errorf("Expected %s %v, got %v", what, want, gotNames)
+			return
+		}
+	}
+}
+
+func TestGroupObjects(t *testing.T) {
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_email_idx", TableName: "users"},
+		{Type: types.TypeRule, Schema: "public", Name: "users_insert", TableName: "users"},
+		// Same table name in another schema keeps its own objects
+		{Type: types.TypeTable, Schema: "app", Name: "users"},
+		{Type: types.TypeConstraint, Schema: "app", Name: "users_pkey", TableName: "users"},
+		// A trigger whose table is unknown cannot go under a table
+		{Type: types.TypeTrigger, Schema: "public", Name: "orphan_trigger"},
+		// A rule on a view has no table directory to go in
+		{Type: types.TypeRule, Schema: "public", Name: "totals_insert", TableName: "totals"},
+		{Type: types.TypeFunction, Schema: "public", Name: "tag"},
+		{Type: types.TypePublication, Schema: "postgres", Name: "changes"},
+		{Type: types.TypeLanguage, Schema: "postgres", Name: "plpython3u"},
+	}
+	schemaObjects, schemaStandalone := GroupObjects(objects)
+
+	checkNames(t, "public.users objects", schemaObjects["public"]["users"], "users", "users_email_idx", "users_insert")
+	checkNames(t, "app.users objects", schemaObjects["app"]["users"], "users", "users_pkey")
+	checkNames(t, "public standalone objects", schemaStandalone["public"], "orphan_trigger", "totals_insert", "tag")
+	checkNames(t, "database-level objects", schemaStandalone[databaseSchema], "changes")
+	checkNames(t, "languages", schemaStandalone[""], "plpython3u")
+	if len(schemaObjects["public"]) != 1 {
+		t.Errorf("Expected only the users table in public, got %v", schemaObjects["public"])
+	}
+}
+
+func TestGroupObjectsRuleBeforeTable(t *testing.T) {
+	// A rule is only placed with a table grouped before it
+	_, schemaStandalone := GroupObjects([]types.DBObject{
+		{Type: types.TypeRule, Schema: "public", Name: "users_insert", TableName: "users"},
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+	})
+	checkNames(t, "public standalone objects", schemaStandalone["public"], "users_insert")
+}
+
+func TestGroupObjectsOwnerLayout(t *testing.T) {
+	e := &Exporter{groupBy: GroupByOwner, owners: map[types.ObjectKey]string{
+		{Type: types.TypeTable, Schema: "public", Name: "users"}: "app_owner",
+	}}
+	groups := groupObjects([]types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeExtension, Schema: "public", Name: "pgcrypto"},
+	}, e.layoutDir)
+
+	checkNames(t, "app_owner/public tables", groups.tables[filepath.Join("app_owner", "public")]["users"], "users")
+	checkNames(t, "unowned/public standalone objects", groups.standalone[filepath.Join(unownedDir, "public")], "pgcrypto")
+	if groups.schemas[filepath.Join("app_owner", "public")] != "public" {
+		t.Errorf("Expected app_owner/public to hold schema public, got %v", groups.schemas)
+	}
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// HashesFile is written to the output directory by a hash-only export in place of the
+// definition files
+const HashesFile = "hashes.json"
+
+// DefinitionHashes maps each object, keyed "schema.type.name", to the SHA-256 of its
+// definition. Objects of a table are keyed "schema.type.table.name", since their names
+// are only unique per table.
+type DefinitionHashes map[string]string
+
+// HashReport lists the keys of the objects whose hashes differ between two DefinitionHashes
+type HashReport struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// HasChanges reports whether any object was added, removed or changed
+func (r HashReport) HasChanges() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0 || len(r.Changed) > 0
+}
+
+// hashKey returns the key of obj in DefinitionHashes
+func hashKey(obj types.DBObject) string {
+	name := obj.Name
+	if _, ok := tableChildDirs[obj.Type]; ok && obj.TableName != "" {
+		name = obj.TableName + "." + obj.Name
+	}
+	return obj.Schema + "." + string(obj.Type) + "." + name
+}
+
+// HashDefinitions returns the hash of the definition of every object
+func HashDefinitions(objects []types.DBObject) DefinitionHashes {
+	hashes := make(DefinitionHashes, len(objects))
+	for _, obj := range objects {
+		sum := sha256.Sum256([]byte(obj.Definition))
+		hashes[hashKey(obj)] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
+
+// ReadHashes reads the hashes a hash-only export wrote to path. A missing file holds no
+// hashes, so the first run reports every object as added.
+func ReadHashes(path string) (DefinitionHashes, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefinitionHashes{}, nil
+	}
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read definition hashes: %s", path)
+	}
+	var hashes DefinitionHashes
+	if err := json.Unmarshal(content, &hashes); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to parse definition hashes: %s", path)
+	}
+	return hashes, nil
+}
+
+// CompareHashes reports the objects added, removed and changed going from before to
+// after, each list sorted by key
+func CompareHashes(before, after DefinitionHashes) HashReport {
+	report := HashReport{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for key, sum := range after {
+		old, existed := before[key]
+		switch {
+		case !existed:
+			report.Added = append(report.Added, key)
+		case old != sum:
+			report.Changed = append(report.Changed, key)
+		}
+	}
+	for key := range before {
+		if _, exists := after[key]; !exists {
+			report.Removed = append(report.Removed, key)
+		}
+	}
+	for _, list := range [][]string{report.Added, report.Removed, report.Changed} {
+		sort.Strings(list)
+	}
+	return report
+}
+
+// WithHashOnly makes the export fetch definitions and write only their hashes, to
+// hashes.json, instead of a file per definition
+func (e *Exporter) WithHashOnly(enabled bool) *Exporter {
+	e.hashOnly = enabled
+	return e
+}
+
+// writeHashes fetches the definitions of objects and writes their hashes to hashes.json
+func (e *Exporter) writeHashes(ctx context.Context, objects []types.DBObject, continueOnError bool) error {
+	objectsWithDefs, err := e.prepareDefinitions(ctx, objects, continueOnError)
+	if err != nil {
+		return err
+	}
+	// Sorted keys keep the file stable, so it diffs cleanly under version control
+	content, err := json.MarshalIndent(HashDefinitions(objectsWithDefs), "", "  ")
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to encode definition hashes")
+	}
+	path := filepath.Join(e.outputDir, HashesFile)
+	if err := e.writeFile(path, append(content, '\n')); err != nil {
+		return stacktrace.Propagate(err, "Failed to write definition hashes: %s", path)
+	}
+	log.Info("Wrote the hashes of %d definitions to %s", len(objectsWithDefs), path)
+	return nil
+}
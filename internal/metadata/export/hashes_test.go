@@ -0,0 +1,72 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestCompareHashes(t *testing.T) {
+	before := HashDefinitions([]types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users", Definition: "CREATE TABLE users (id int);"},
+		{Type: types.TypeView, Schema: "public", Name: "active_users", Definition: "CREATE VIEW active_users AS SELECT 1;"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_pkey", TableName: "users", Definition: "CREATE INDEX users_pkey ON users (id);"},
+	})
+	after := HashDefinitions([]types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users", Definition: "CREATE TABLE users (id bigint);"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_pkey", TableName: "users", Definition: "CREATE INDEX users_pkey ON users (id);"},
+		{Type: types.TypeFunction, Schema: "public", Name: "rotate_keys", Definition: "CREATE FUNCTION rotate_keys() ..."},
+	})
+
+	if _, ok := before["public.index.users.users_pkey"]; !ok {
+		t.Errorf("Expected table-level objects to be keyed by their table, got keys %v", reflect.ValueOf(before).MapKeys())
+	}
+
+	report := CompareHashes(before, after)
+	want := HashReport{
+		Added:   []string{"public.function.rotate_keys"},
+		Removed: []string{"public.view.active_users"},
+		Changed: []string{"public.table.users"},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("Expected %+v, got %+v", want, report)
+	}
+	if !report.HasChanges() {
+		t.Error("Expected the report to have changes")
+	}
+	if CompareHashes(after, after).HasChanges() {
+		t.Error("Expected identical hashes to have no changes")
+	}
+}
+
+func TestExportHashOnly(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	exporter, fs := NewWithMemFS(&mockConnector{}, outputDir)
+	exporter.WithHashOnly(true)
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeFunction, Schema: "public", Name: "rotate_keys"},
+	}
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("Failed to export hashes: %v", err)
+	}
+
+	for _, file := range fs.Files() {
+		if strings.HasSuffix(file, ".sql") {
+			t.Errorf("Expected no definition files, found %s", file)
+		}
+	}
+	content, err := fs.ReadFile(filepath.Join(outputDir, HashesFile))
+	if err != nil {
+		t.Fatalf("Expected %s to be written: %v", HashesFile, err)
+	}
+	for _, key := range []string{`"public.table.users"`, `"public.function.rotate_keys"`} {
+		if !strings.Contains(string(content), key) {
+			t.Errorf("Expected %s in %s, got:\n%s", key, HashesFile, content)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package export
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// indexFile is the machine-readable listing written at the root of each schema directory
+const indexFile = "index.json"
+
+// IndexEntry describes a single exported file in a schema's index.json
+type IndexEntry struct {
+	Path      string           `json:"path"`
+	Type      types.ObjectType `json:"type"`
+	Name      string           `json:"name"`
+	TableName string           `json:"table,omitempty"`
+}
+
+// SchemaIndex is the content of a schema's index.json
+type SchemaIndex struct {
+	Schema string       `json:"schema"`
+	Files  []IndexEntry `json:"files"`
+}
+
+// writeSchemaIndexes writes an index.json into every schema directory that received files.
+// Paths are relative to the schema directory and always use forward slashes.
+func (e *Exporter) writeSchemaIndexes() error {
+	e.writtenMu.Lock()
+	bySchema := make(map[string][]exportedFile)
+	for _, entry := range e.writtenFiles {
+		bySchema[entry.schema] = append(bySchema[entry.schema], entry)
+	}
+	e.writtenMu.Unlock()
+
+	for schema, entries := range bySchema {
+		schemaDir := filepath.Join(e.outputDir, schema)
+		index := SchemaIndex{Schema: schema, Files: make([]IndexEntry, 0, len(entries))}
+		for _, entry := range entries {
+			rel, err := filepath.Rel(schemaDir, entry.path)
+			if err != nil {
+				return stacktrace.Propagate(err, "Failed to compute index path for %s", entry.path)
+			}
+			name := entry.objName
+			if entry.objType == types.TypeTable {
+				name = entry.tableName
+			}
+			index.Files = append(index.Files, IndexEntry{
+				Path:      filepath.ToSlash(rel),
+				Type:      entry.objType,
+				Name:      name,
+				TableName: entry.tableName,
+			})
+		}
+		sort.Slice(index.Files, func(i, j int) bool {
+			return index.Files[i].Path < index.Files[j].Path
+		})
+
+		content, err := json.MarshalIndent(index, "", "  ")
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to encode index for schema %s", schema)
+		}
+		indexPath := filepath.Join(schemaDir, indexFile)
+		if err := e.writeFile(indexPath, append(content, '\n')); err != nil {
+			return stacktrace.Propagate(err, "Failed to write index: %s", indexPath)
+		}
+		log.Info("Wrote index with %d entries to %s", len(index.Files), indexPath)
+	}
+	return nil
+}
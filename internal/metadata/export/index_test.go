@@ -0,0 +1,91 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestWriteSchemaIndexes(t *testing.T) {
+	// Create a temporary directory for output
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-index")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir).WithIndex(true)
+
+	if err := exporter.ExportObjects(context.Background(), manifestTestObjects(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "public", indexFile))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	var index SchemaIndex
+	if err := json.Unmarshal(content, &index); err != nil {
+		t.Fatalf("Failed to decode index: %v", err)
+	}
+
+	if index.Schema != "public" {
+		t.Errorf("Expected schema 'public', got %q", index.Schema)
+	}
+
+	expected := map[string]IndexEntry{
+		"extensions/pgcrypto.sql":               {Type: types.TypeExtension, Name: "pgcrypto"},
+		"tables/users/table.sql":                {Type: types.TypeTable, Name: "users", TableName: "users"},
+		"tables/users/indexes/users_idx.sql":    {Type: types.TypeIndex, Name: "users_idx", TableName: "users"},
+		"tables/users/constraints/users_pk.sql": {Type: types.TypeConstraint, Name: "users_pk", TableName: "users"},
+		"views/active_users.sql":                {Type: types.TypeView, Name: "active_users"},
+	}
+	if len(index.Files) != len(expected) {
+		t.Errorf("Expected %d index entries, got %d: %+v", len(expected), len(index.Files), index.Files)
+	}
+	for _, entry := range index.Files {
+		want, ok := expected[entry.Path]
+		if !ok {
+			t.Errorf("Unexpected index entry %+v", entry)
+			continue
+		}
+		want.Path = entry.Path
+		if entry != want {
+			t.Errorf("Expected index entry %+v, got %+v", want, entry)
+		}
+	}
+
+	// Database-level objects get their own index
+	if _, err := os.Stat(filepath.Join(tmpDir, "postgres", indexFile)); err != nil {
+		t.Errorf("Expected index for the postgres directory: %v", err)
+	}
+
+	// No manifest is written unless requested
+	if _, err := os.Stat(filepath.Join(tmpDir, manifestFile)); !os.IsNotExist(err) {
+		t.Error("Manifest should not be written unless requested")
+	}
+}
+
+func TestExportWithoutIndex(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-no-index")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir)
+
+	if err := exporter.ExportObjects(context.Background(), manifestTestObjects(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "public", indexFile)); !os.IsNotExist(err) {
+		t.Error("Index should not be written unless requested")
+	}
+}
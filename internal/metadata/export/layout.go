@@ -0,0 +1,72 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// Supported layouts of the output directory
+const (
+	GroupBySchema = "schema" // <schema>/<type>/...
+	GroupByOwner  = "owner"  // <owner>/<schema>/<type>/...
+)
+
+// GroupByModes returns the supported layouts, for flag help
+func GroupByModes() []string {
+	return []string{GroupBySchema, GroupByOwner}
+}
+
+// IsValidGroupBy reports whether mode is a supported layout
+func IsValidGroupBy(mode string) bool {
+	return mode == GroupBySchema || mode == GroupByOwner
+}
+
+// unownedDir holds, in the owner layout, objects without a meaningful owner such as extensions
+const unownedDir = "unowned"
+
+// OwnerConnector is a DBConnector that can also report the role owning each object
+type OwnerConnector interface {
+	DBConnector
+	FetchOwners(ctx context.Context, objects []types.DBObject) (map[types.ObjectKey]string, error)
+}
+
+// WithGroupBy sets the layout of the output directory. GroupByOwner nests each schema
+// directory under the role owning its objects; the default is GroupBySchema.
+func (e *Exporter) WithGroupBy(mode string) *Exporter {
+	e.groupBy = mode
+	return e
+}
+
+// fetchOwners looks up the owners of objects when the owner layout or a catalog was requested
+func (e *Exporter) fetchOwners(ctx context.Context, objects []types.DBObject) error {
+	if e.groupBy != GroupByOwner && e.catalogPath == "" {
+		return nil
+	}
+	oc, ok := e.connector.(OwnerConnector)
+	if !ok {
+		return stacktrace.NewError("Object owners are not supported by this connector")
+	}
+	owners, err := oc.FetchOwners(ctx, objects)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to fetch object owners")
+	}
+	e.owners = owners
+	return nil
+}
+
+// layoutDir returns the directory, relative to the output directory, that obj is exported
+// under in place of schemaDir: schemaDir itself, or in the owner layout schemaDir nested
+// under the object's owner
+func (e *Exporter) layoutDir(obj types.DBObject, schemaDir string) string {
+	if e.groupBy != GroupByOwner {
+		return schemaDir
+	}
+	owner, ok := e.owners[obj.Key()]
+	if !ok || owner == "" {
+		owner = unownedDir
+	}
+	return filepath.Join(owner, schemaDir)
+}
@@ -0,0 +1,66 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// ownerConnector is a mockConnector that also reports object owners
+type ownerConnector struct {
+	mockConnector
+	owners map[types.ObjectKey]string
+}
+
+func (o *ownerConnector) FetchOwners(ctx context.Context, objects []types.DBObject) (map[types.ObjectKey]string, error) {
+	return o.owners, nil
+}
+
+func TestExportGroupByOwner(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	users := types.DBObject{Type: types.TypeTable, Schema: "public", Name: "users"}
+	usersIdx := types.DBObject{Type: types.TypeIndex, Schema: "public", Name: "users_idx", TableName: "users"}
+	invoices := types.DBObject{Type: types.TypeView, Schema: "public", Name: "invoices"}
+	tag := types.DBObject{Type: types.TypeFunction, Schema: "app", Name: "tag"}
+	pgcrypto := types.DBObject{Type: types.TypeExtension, Schema: "public", Name: "pgcrypto"}
+	connector := &ownerConnector{owners: map[types.ObjectKey]string{
+		users.Key():    "app_owner",
+		usersIdx.Key(): "app_owner",
+		invoices.Key(): "billing",
+		tag.Key():      "app_owner",
+	}}
+
+	exporter := NewWithMock(connector, outputDir).WithGroupBy(GroupByOwner)
+	fs := NewMemFileSystem()
+	exporter.WithFileSystem(fs)
+	objects := []types.DBObject{users, usersIdx, invoices, tag, pgcrypto}
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	for _, path := range []string{
+		filepath.Join(outputDir, "app_owner", "public", "tables", "users", "table.sql"),
+		filepath.Join(outputDir, "app_owner", "public", "tables", "users", "indexes", "users_idx.sql"),
+		filepath.Join(outputDir, "billing", "public", "views", "invoices.sql"),
+		filepath.Join(outputDir, "app_owner", "app", "functions", "tag.sql"),
+		filepath.Join(outputDir, unownedDir, "public", "extensions", "pgcrypto.sql"),
+	} {
+		if _, err := fs.ReadFile(path); err != nil {
+			t.Errorf("Expected %s to be written: %v", path, err)
+		}
+	}
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "public", "tables", "users", "table.sql")); err == nil {
+		t.Error("Expected no schema directory at the top level in the owner layout")
+	}
+}
+
+func TestExportGroupByOwnerUnsupported(t *testing.T) {
+	exporter := NewWithMock(&mockConnector{}, "/pgmeta-output").WithGroupBy(GroupByOwner)
+	exporter.WithFileSystem(NewMemFileSystem())
+	objects := []types.DBObject{{Type: types.TypeTable, Schema: "public", Name: "users"}}
+	if err := exporter.ExportObjects(context.Background(), objects, false); err == nil {
+		t.Error("Expected an error when the connector cannot report owners")
+	}
+}
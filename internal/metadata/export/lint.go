@@ -0,0 +1,117 @@
+package export
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+var (
+	// stringLiteralPattern matches single-quoted literals so their contents are not linted
+	stringLiteralPattern = regexp.MustCompile(`'(?:[^']|'')*'`)
+	// qualifiedNamePattern captures the qualifier of a dotted identifier such as schema.table
+	qualifiedNamePattern = regexp.MustCompile(`(?:"((?:[^"]|"")+)"|\b([A-Za-z_][A-Za-z0-9_$]*))\s*\.\s*(?:"|[A-Za-z_])`)
+)
+
+// LintFinding describes a migration hazard found in an exported definition
+type LintFinding struct {
+	Type    types.ObjectType
+	Schema  string
+	Name    string
+	Message string
+}
+
+// String renders the finding as a single report line
+func (f LintFinding) String() string {
+	return fmt.Sprintf("[%s] %s.%s: %s", f.Type, f.Schema, f.Name, f.Message)
+}
+
+// lintObjects checks fetched definitions for functions without an explicit search_path
+// and for views and policies that reference objects in other schemas.
+// knownSchemas is used to tell schema qualifiers apart from table aliases.
+func lintObjects(objects []types.DBObject, knownSchemas []string) []LintFinding {
+	schemas := make(map[string]bool, len(knownSchemas))
+	for _, schema := range knownSchemas {
+		schemas[schema] = true
+	}
+
+	var findings []LintFinding
+	for _, obj := range objects {
+		switch obj.Type {
+		case types.TypeFunction, types.TypeProcedure, types.TypeWindowFunction:
+			if obj.SearchPath == "" {
+				findings = append(findings, LintFinding{
+					Type:    obj.Type,
+					Schema:  obj.Schema,
+					Name:    obj.Name,
+					Message: "no explicit SET search_path; unqualified references depend on the caller's search_path",
+				})
+			}
+		case types.TypeView, types.TypeMaterializedView, types.TypePolicy:
+			if others := referencedSchemas(obj, schemas); len(others) > 0 {
+				findings = append(findings, LintFinding{
+					Type:    obj.Type,
+					Schema:  obj.Schema,
+					Name:    obj.Name,
+					Message: "references objects in other schemas: " + strings.Join(others, ", "),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].String() < findings[j].String()
+	})
+	return findings
+}
+
+// referencedSchemas returns the known schemas other than the object's own that its definition qualifies names with
+func referencedSchemas(obj types.DBObject, schemas map[string]bool) []string {
+	body := stringLiteralPattern.ReplaceAllString(obj.Definition, "''")
+
+	found := make(map[string]bool)
+	for _, match := range qualifiedNamePattern.FindAllStringSubmatch(body, -1) {
+		qualifier := strings.ReplaceAll(match[1], `""`, `"`)
+		if qualifier == "" {
+			// Unquoted identifiers are folded to lower case
+			qualifier = strings.ToLower(match[2])
+		}
+		if qualifier == obj.Schema || qualifier == "pg_catalog" || qualifier == "information_schema" {
+			continue
+		}
+		if schemas[qualifier] {
+			found[qualifier] = true
+		}
+	}
+
+	others := make([]string, 0, len(found))
+	for schema := range found {
+		others = append(others, schema)
+	}
+	sort.Strings(others)
+	return others
+}
+
+// reportLint logs the lint findings and, when failOnFindings is set, returns an error if there are any
+func (e *Exporter) reportLint(objects []types.DBObject) error {
+	findings := lintObjects(objects, e.lintSchemas)
+	if len(findings) == 0 {
+		log.Info("Lint found no issues")
+		return nil
+	}
+
+	log.Warn("Lint found %d issues:", len(findings))
+	for _, finding := range findings {
+		log.Warn("  • %s", finding)
+	}
+
+	if e.lintFail {
+		return stacktrace.NewError("Lint found %d issues. Remove --lint-fail to export despite lint findings.", len(findings))
+	}
+	return nil
+}
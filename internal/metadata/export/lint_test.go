@@ -0,0 +1,123 @@
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestLintFunctionsSearchPath(t *testing.T) {
+	objects := []types.DBObject{
+		{
+			Type:       types.TypeFunction,
+			Schema:     "public",
+			Name:       "safe",
+			Definition: "CREATE OR REPLACE FUNCTION public.safe()\n RETURNS void\n LANGUAGE sql\n SET search_path TO 'public'\nAS $function$ SELECT 1 $function$",
+			SearchPath: "public",
+		},
+		{
+			Type:       types.TypeFunction,
+			Schema:     "public",
+			Name:       "unsafe",
+			Definition: "CREATE OR REPLACE FUNCTION public.unsafe()\n RETURNS void\n LANGUAGE sql\nAS $function$ SELECT * FROM users $function$",
+		},
+		{
+			// Only the routine's own setting counts, not a SET statement in its body
+			Type:       types.TypeProcedure,
+			Schema:     "public",
+			Name:       "body_only",
+			Definition: "CREATE OR REPLACE PROCEDURE public.body_only()\n LANGUAGE plpgsql\nAS $procedure$ BEGIN SET search_path TO public; END $procedure$",
+		},
+	}
+
+	findings := lintObjects(objects, []string{"public"})
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %d: %v", len(findings), findings)
+	}
+	for i, name := range []string{"unsafe", "body_only"} {
+		if findings[i].Name != name || !strings.Contains(findings[i].Message, "search_path") {
+			t.Errorf("Unexpected finding: %s", findings[i])
+		}
+	}
+}
+
+func TestLintCrossSchemaReferences(t *testing.T) {
+	objects := []types.DBObject{
+		{
+			Type:       types.TypeView,
+			Schema:     "public",
+			Name:       "order_totals",
+			Definition: "CREATE OR REPLACE VIEW public.order_totals AS\n SELECT o.id, sum(o.amount) FROM billing.orders o GROUP BY o.id;",
+		},
+		{
+			// Aliases, literals and the object's own schema are not cross-schema references
+			Type:       types.TypeView,
+			Schema:     "public",
+			Name:       "local_users",
+			Definition: "CREATE OR REPLACE VIEW public.local_users AS\n SELECT u.id, 'billing.orders' AS note FROM public.users u WHERE pg_catalog.now() > u.created;",
+		},
+		{
+			Type:       types.TypePolicy,
+			Schema:     "public",
+			Name:       "tenant_isolation",
+			Definition: "CREATE POLICY tenant_isolation ON public.users FOR ALL TO PUBLIC\n  USING ((tenant_id IN ( SELECT t.id FROM \"Auth\".tenants t)));",
+		},
+	}
+
+	findings := lintObjects(objects, []string{"public", "billing", "Auth"})
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %d: %v", len(findings), findings)
+	}
+
+	expected := map[string]string{
+		"order_totals":     "billing",
+		"tenant_isolation": "Auth",
+	}
+	for _, finding := range findings {
+		schema, ok := expected[finding.Name]
+		if !ok {
+			t.Errorf("Unexpected finding: %s", finding)
+			continue
+		}
+		if !strings.HasSuffix(finding.Message, schema) {
+			t.Errorf("Expected finding for %s to mention schema %s, got: %s", finding.Name, schema, finding.Message)
+		}
+	}
+}
+
+func TestExportWithLintFail(t *testing.T) {
+	// Create a temporary directory for output
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-lint")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The mock function definition has no SET search_path
+	objects := []types.DBObject{
+		{Type: types.TypeFunction, Schema: "public", Name: "get_user"},
+	}
+
+	// Findings are only reported unless --lint-fail is set
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir).WithLint(true, false, []string{"public"})
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects should not fail on lint findings without lint-fail: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "public", "functions", "get_user.sql")); err != nil {
+		t.Errorf("Expected function to be exported: %v", err)
+	}
+
+	failDir := filepath.Join(tmpDir, "fail")
+	exporter = NewWithMock(connector, failDir).WithLint(true, true, []string{"public"})
+	if err := exporter.ExportObjects(context.Background(), objects, false); err == nil {
+		t.Error("Expected ExportObjects to fail on lint findings with lint-fail")
+	}
+	if _, err := os.Stat(failDir); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be written when lint fails")
+	}
+}
@@ -0,0 +1,180 @@
+package export
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+const (
+	// manifestFile is the psql script that replays every exported file
+	manifestFile = "apply.sql"
+	// manifestPostFile holds statements that cannot run inside a transaction block
+	manifestPostFile = "apply_post.sql"
+	// foreignKeysFile holds the statements adding a table's foreign keys, beside its table.sql
+	foreignKeysFile = "foreign_keys.sql"
+)
+
+// typeForeignKeys is the type foreign_keys.sql files are recorded with. It is not an object
+// type of its own, only a place in the replay order.
+const typeForeignKeys types.ObjectType = "foreign_keys"
+
+// manifestOrder lists object types in an order that satisfies their dependencies on replay.
+// Functions come before the tables whose defaults and CHECK constraints call them, with
+// check_function_bodies off so their bodies may name tables that do not exist yet. Foreign
+// keys follow every table and the unique indexes they may reference.
+// Constraints are omitted because table.sql already declares them and the constraint
+// files only hold the constraint clause, not a runnable statement.
+var manifestOrder = []types.ObjectType{
+	types.TypeExtension,
+	types.TypeLanguage,
+	types.TypeSequence,
+	types.TypeFunction,
+	types.TypeProcedure,
+	types.TypeAggregate,
+	types.TypeWindowFunction,
+	types.TypeTable,
+	types.TypeView,
+	types.TypeMaterializedView,
+	types.TypeIndex,
+	typeForeignKeys,
+	types.TypeStatistics,
+	types.TypeTrigger,
+	types.TypePolicy,
+	types.TypeRule,
+	types.TypePublication,
+	types.TypeSubscription,
+}
+
+// IsManifestType reports whether files of objType are included in the manifest
+func IsManifestType(objType types.ObjectType) bool {
+	for _, t := range manifestOrder {
+		if t == objType {
+			return true
+		}
+	}
+	return false
+}
+
+// typeRank maps each manifest type to its position in the replay order: the types given
+// to WithManifestOrder first, in that order, then the rest in the default order
+func (e *Exporter) typeRank() map[types.ObjectType]int {
+	rank := make(map[types.ObjectType]int, len(manifestOrder))
+	for _, objType := range e.manifestOrder {
+		if _, seen := rank[objType]; !seen && IsManifestType(objType) {
+			rank[objType] = len(rank)
+		}
+	}
+	for _, objType := range manifestOrder {
+		if _, seen := rank[objType]; !seen {
+			rank[objType] = len(rank)
+		}
+	}
+	return rank
+}
+
+// isRoutineType reports whether objType is replayed with CREATE FUNCTION or CREATE PROCEDURE,
+// whose bodies are checked against the tables they use unless check_function_bodies is off
+func isRoutineType(objType types.ObjectType) bool {
+	switch objType {
+	case types.TypeFunction, types.TypeProcedure, types.TypeWindowFunction:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransactional reports whether an object type can be replayed inside BEGIN/COMMIT.
+// CREATE SUBSCRIPTION creates a replication slot and CREATE INDEX CONCURRENTLY refuses
+// to run in a transaction block, so both must be applied afterwards.
+func (e *Exporter) isTransactional(objType types.ObjectType) bool {
+	switch objType {
+	case types.TypeSubscription:
+		return false
+	case types.TypeIndex, typeForeignKeys:
+		// Foreign keys may reference a unique index, so they follow the indexes
+		return !e.concurrentIndexes
+	default:
+		return true
+	}
+}
+
+// writeManifest writes apply.sql (and apply_post.sql when wrapping in a transaction)
+// that include every exported file in dependency order
+func (e *Exporter) writeManifest() error {
+	rank := e.typeRank()
+
+	e.writtenMu.Lock()
+	entries := make([]exportedFile, 0, len(e.writtenFiles))
+	for _, entry := range e.writtenFiles {
+		if _, ok := rank[entry.objType]; ok {
+			entries = append(entries, entry)
+		}
+	}
+	e.writtenMu.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if rank[entries[i].objType] != rank[entries[j].objType] {
+			return rank[entries[i].objType] < rank[entries[j].objType]
+		}
+		return entries[i].path < entries[j].path
+	})
+
+	var main, post strings.Builder
+	if e.serverInfo != nil {
+		header := fmt.Sprintf("-- Exported from %s\n", e.serverInfo)
+		main.WriteString(header)
+		post.WriteString(header)
+	}
+	if e.psqlMetaCommands {
+		// apply_post.sql is run on its own, so it needs the setting as well
+		main.WriteString("\\set ON_ERROR_STOP on\n")
+		post.WriteString("\\set ON_ERROR_STOP on\n")
+	}
+	if slices.ContainsFunc(entries, func(entry exportedFile) bool { return isRoutineType(entry.objType) }) {
+		main.WriteString("SET check_function_bodies = false;\n")
+	}
+	headerLen := post.Len()
+	if e.wrapTransaction {
+		main.WriteString("BEGIN;\n")
+	}
+	for _, entry := range entries {
+		rel, err := filepath.Rel(e.outputDir, entry.path)
+		if err != nil {
+			return stacktrace.Propagate(err, "Failed to compute manifest path for %s", entry.path)
+		}
+		line := fmt.Sprintf("\\ir %s\n", filepath.ToSlash(rel))
+		if e.psqlMetaCommands {
+			line = fmt.Sprintf("\\echo 'applying %s'\n", strings.ReplaceAll(filepath.ToSlash(rel), "'", "''")) + line
+		}
+		if e.wrapTransaction && !e.isTransactional(entry.objType) {
+			post.WriteString(line)
+		} else {
+			main.WriteString(line)
+		}
+	}
+	if e.wrapTransaction {
+		main.WriteString("COMMIT;\n")
+	}
+
+	manifestPath := filepath.Join(e.outputDir, manifestFile)
+	if err := e.writeFile(manifestPath, []byte(main.String())); err != nil {
+		return stacktrace.Propagate(err, "Failed to write manifest: %s", manifestPath)
+	}
+	log.Info("Wrote manifest with %d entries to %s", len(entries), manifestPath)
+
+	if post.Len() > headerLen {
+		postPath := filepath.Join(e.outputDir, manifestPostFile)
+		if err := e.writeFile(postPath, []byte(post.String())); err != nil {
+			return stacktrace.Propagate(err, "Failed to write manifest: %s", postPath)
+		}
+		log.Info("Wrote non-transactional statements to %s", postPath)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// manifestTestObjects returns a mix of objects whose replay order matters
+func manifestTestObjects() []types.DBObject {
+	return []types.DBObject{
+		{Type: types.TypeView, Schema: "public", Name: "active_users"},
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_idx", TableName: "users"},
+		{Type: types.TypeConstraint, Schema: "public", Name: "users_pk", TableName: "users"},
+		{Type: types.TypeExtension, Schema: "public", Name: "pgcrypto"},
+		{Type: types.TypeSubscription, Schema: "postgres", Name: "sub_remote"},
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	// Create a temporary directory for output
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-manifest")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir).WithManifest(true, false)
+
+	// Languages must exist before the functions written in them, and functions before the
+	// tables whose defaults call them
+	objects := append(manifestTestObjects(),
+		types.DBObject{Type: types.TypeFunction, Schema: "public", Name: "greet"},
+		types.DBObject{Type: types.TypeLanguage, Schema: "postgres", Name: "plv8"},
+		types.DBObject{
+			Type:        types.TypeTable,
+			Schema:      "public",
+			Name:        "accounts",
+			ForeignKeys: "ALTER TABLE ONLY public.accounts ADD CONSTRAINT accounts_user_fk FOREIGN KEY (user_id) REFERENCES users(id);\n",
+		},
+	)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, manifestFile))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	manifest := string(content)
+
+	// Objects are replayed in dependency order
+	expectedOrder := []string{
+		`\ir public/extensions/pgcrypto.sql`,
+		`\ir languages/plv8.sql`,
+		`\ir public/functions/greet.sql`,
+		`\ir public/tables/accounts/table.sql`,
+		`\ir public/tables/users/table.sql`,
+		`\ir public/views/active_users.sql`,
+		`\ir public/tables/users/indexes/users_idx.sql`,
+		`\ir public/tables/accounts/foreign_keys.sql`,
+		`\ir postgres/subscriptions/sub_remote.sql`,
+	}
+	last := -1
+	for _, line := range expectedOrder {
+		idx := strings.Index(manifest, line)
+		if idx < 0 {
+			t.Errorf("Expected manifest to contain %q, got:\n%s", line, manifest)
+			continue
+		}
+		if idx < last {
+			t.Errorf("Expected %q to appear later in the manifest", line)
+		}
+		last = idx
+	}
+
+	// Function bodies may use tables that are created after them
+	if !strings.HasPrefix(manifest, "SET check_function_bodies = false;\n") {
+		t.Errorf("Expected manifest to turn off check_function_bodies, got:\n%s", manifest)
+	}
+
+	foreignKeys, err := os.ReadFile(filepath.Join(tmpDir, "public", "tables", "accounts", foreignKeysFile))
+	if err != nil {
+		t.Fatalf("Failed to read foreign keys: %v", err)
+	}
+	if !strings.Contains(string(foreignKeys), "ADD CONSTRAINT accounts_user_fk") {
+		t.Errorf("Expected the foreign key statements, got:\n%s", foreignKeys)
+	}
+
+	// Constraint files are not standalone statements
+	if strings.Contains(manifest, "constraints/") {
+		t.Errorf("Manifest should not include constraint files, got:\n%s", manifest)
+	}
+
+	// Without wrapping there is no transaction and no post script
+	if strings.Contains(manifest, "BEGIN;") {
+		t.Error("Manifest should not start a transaction unless requested")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, manifestPostFile)); !os.IsNotExist(err) {
+		t.Error("Post script should not be written unless wrapping in a transaction")
+	}
+}
+
+func TestWriteManifestWrapTransaction(t *testing.T) {
+	// Create a temporary directory for output
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-manifest")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir).WithManifest(true, true)
+
+	if err := exporter.ExportObjects(context.Background(), manifestTestObjects(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, manifestFile))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	manifest := string(content)
+
+	if !strings.HasPrefix(manifest, "BEGIN;\n") || !strings.HasSuffix(manifest, "COMMIT;\n") {
+		t.Errorf("Expected manifest to be wrapped in BEGIN/COMMIT, got:\n%s", manifest)
+	}
+
+	// Subscriptions cannot run inside a transaction block
+	if strings.Contains(manifest, "sub_remote") {
+		t.Errorf("Subscription should be moved out of the transaction, got:\n%s", manifest)
+	}
+
+	post, err := os.ReadFile(filepath.Join(tmpDir, manifestPostFile))
+	if err != nil {
+		t.Fatalf("Failed to read post script: %v", err)
+	}
+	if !strings.Contains(string(post), `\ir postgres/subscriptions/sub_remote.sql`) {
+		t.Errorf("Expected post script to include the subscription, got:\n%s", post)
+	}
+}
+
+func TestWriteManifestConcurrentIndexes(t *testing.T) {
+	// Create a temporary directory for output
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-manifest")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir).WithManifest(true, true).WithConcurrentIndexes(true)
+
+	if err := exporter.ExportObjects(context.Background(), manifestTestObjects(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	// The index file itself is rewritten
+	indexDef, err := os.ReadFile(filepath.Join(tmpDir, "public", "tables", "users", "indexes", "users_idx.sql"))
+	if err != nil {
+		t.Fatalf("Failed to read index file: %v", err)
+	}
+	if !strings.HasPrefix(string(indexDef), "CREATE INDEX CONCURRENTLY ") {
+		t.Errorf("Expected concurrent index definition, got: %s", indexDef)
+	}
+
+	// And it is flagged as non-transactional
+	manifest, err := os.ReadFile(filepath.Join(tmpDir, manifestFile))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if strings.Contains(string(manifest), "users_idx") {
+		t.Errorf("Concurrent index should be moved out of the transaction, got:\n%s", manifest)
+	}
+	post, err := os.ReadFile(filepath.Join(tmpDir, manifestPostFile))
+	if err != nil {
+		t.Fatalf("Failed to read post script: %v", err)
+	}
+	if !strings.Contains(string(post), `\ir public/tables/users/indexes/users_idx.sql`) {
+		t.Errorf("Expected post script to include the index, got:\n%s", post)
+	}
+}
+
+func TestWriteManifestServerInfo(t *testing.T) {
+	// Create a temporary directory for output
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-manifest")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	info := &types.ServerInfo{Version: "16.2", Encoding: "UTF8", Collation: "C"}
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir).WithManifest(true, false).WithServerInfo(info)
+
+	if err := exporter.ExportObjects(context.Background(), manifestTestObjects(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(tmpDir, manifestFile))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	expected := "-- Exported from PostgreSQL 16.2 (encoding UTF8, collation C)\n"
+	if !strings.HasPrefix(string(manifest), expected) {
+		t.Errorf("Expected manifest to start with %q, got:\n%s", expected, manifest)
+	}
+}
+
+func TestWriteManifestCustomOrder(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	exporter, fs := NewWithMemFS(&mockConnector{shouldFail: false}, outputDir)
+	exporter.WithManifest(true, false).
+		WithManifestOrder([]types.ObjectType{types.TypeIndex, types.TypeView})
+
+	if err := exporter.ExportObjects(context.Background(), manifestTestObjects(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	content, err := fs.ReadFile(filepath.Join(outputDir, manifestFile))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+
+	// Listed types come first in the given order, the rest keep the default order
+	expected := "\\ir public/tables/users/indexes/users_idx.sql\n" +
+		"\\ir public/views/active_users.sql\n" +
+		"\\ir public/extensions/pgcrypto.sql\n" +
+		"\\ir public/tables/users/table.sql\n" +
+		"\\ir postgres/subscriptions/sub_remote.sql\n"
+	if string(content) != expected {
+		t.Errorf("Expected manifest:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+func TestWriteManifestPsqlMetaCommands(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	exporter, fs := NewWithMemFS(&mockConnector{shouldFail: false}, outputDir)
+	exporter.WithManifest(true, true).WithPsqlMetaCommands(true)
+
+	if err := exporter.ExportObjects(context.Background(), manifestTestObjects(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	content, err := fs.ReadFile(filepath.Join(outputDir, manifestFile))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+
+	// psql stops at the first error and echoes each file before applying it
+	expected := "\\set ON_ERROR_STOP on\n" +
+		"BEGIN;\n" +
+		"\\echo 'applying public/extensions/pgcrypto.sql'\n" +
+		"\\ir public/extensions/pgcrypto.sql\n" +
+		"\\echo 'applying public/tables/users/table.sql'\n" +
+		"\\ir public/tables/users/table.sql\n" +
+		"\\echo 'applying public/views/active_users.sql'\n" +
+		"\\ir public/views/active_users.sql\n" +
+		"\\echo 'applying public/tables/users/indexes/users_idx.sql'\n" +
+		"\\ir public/tables/users/indexes/users_idx.sql\n" +
+		"COMMIT;\n"
+	if string(content) != expected {
+		t.Errorf("Expected manifest:\n%s\ngot:\n%s", expected, content)
+	}
+
+	// apply_post.sql is run separately, so it stops on errors too
+	post, err := fs.ReadFile(filepath.Join(outputDir, manifestPostFile))
+	if err != nil {
+		t.Fatalf("Failed to read post manifest: %v", err)
+	}
+	expected = "\\set ON_ERROR_STOP on\n" +
+		"\\echo 'applying postgres/subscriptions/sub_remote.sql'\n" +
+		"\\ir postgres/subscriptions/sub_remote.sql\n"
+	if string(post) != expected {
+		t.Errorf("Expected post manifest:\n%s\ngot:\n%s", expected, post)
+	}
+}
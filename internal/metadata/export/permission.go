@@ -0,0 +1,50 @@
+package export
+
+import (
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// FailureClassifier is a DBConnector that can also tell why the definition of an object
+// could not be fetched
+type FailureClassifier interface {
+	DBConnector
+	FetchFailureKind(key types.ObjectKey) db.FailureKind
+}
+
+// WithSkipPermissionErrors makes definitions the role is not permitted to fetch, as on a
+// read replica exported with a read-only role, warnings rather than errors even when the
+// export otherwise stops at the first failure. The objects are still reported as failed.
+func (e *Exporter) WithSkipPermissionErrors(enabled bool) *Exporter {
+	e.skipPermission = enabled
+	return e
+}
+
+// fatalFailures logs why the failed objects could not be fetched, when the connector can
+// tell, and returns those that should stop an export that does not continue on error
+func (e *Exporter) fatalFailures(failed []types.ObjectKey) []types.ObjectKey {
+	fc, ok := e.connector.(FailureClassifier)
+	if !ok {
+		return failed
+	}
+
+	byKind := make(map[db.FailureKind]int)
+	var fatal []types.ObjectKey
+	for _, key := range failed {
+		kind := fc.FetchFailureKind(key)
+		byKind[kind]++
+		if !(e.skipPermission && kind == db.FailurePermissionDenied) {
+			fatal = append(fatal, key)
+		}
+	}
+	for _, kind := range []db.FailureKind{db.FailurePermissionDenied, db.FailureNotFound, db.FailureTimeout, db.FailureOther} {
+		if byKind[kind] > 0 {
+			log.Warn("  • %d objects failed with: %s", byKind[kind], kind)
+		}
+	}
+	if e.skipPermission && byKind[db.FailurePermissionDenied] > 0 {
+		log.Warn("Skipped %d objects the role is not permitted to inspect (--skip-permission-errors)", byKind[db.FailurePermissionDenied])
+	}
+	return fatal
+}
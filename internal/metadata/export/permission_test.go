@@ -0,0 +1,75 @@
+package export
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/db"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// restrictedConnector is a flakyConnector that reports why each failing object failed,
+// as a read-only role on a replica would see for objects it may not inspect
+type restrictedConnector struct {
+	flakyConnector
+	kinds map[string]db.FailureKind
+}
+
+func (c *restrictedConnector) FetchFailureKind(key types.ObjectKey) db.FailureKind {
+	return c.kinds[key.Schema+"."+key.Name]
+}
+
+func TestSkipPermissionErrors(t *testing.T) {
+	newRestricted := func(kinds map[string]db.FailureKind) *restrictedConnector {
+		failing := make(map[string]bool)
+		for name := range kinds {
+			failing[name] = true
+		}
+		return &restrictedConnector{flakyConnector: flakyConnector{failing: failing}, kinds: kinds}
+	}
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeFunction, Schema: "public", Name: "rotate_keys"},
+	}
+
+	t.Run("permission denied is a warning", func(t *testing.T) {
+		outputDir := "/pgmeta-output"
+		connector := newRestricted(map[string]db.FailureKind{"public.rotate_keys": db.FailurePermissionDenied})
+		exporter, fs := NewWithMemFS(connector, outputDir)
+		exporter.WithSkipPermissionErrors(true)
+		// Not continuing on error, as with --on-error fail
+		if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+			t.Fatalf("Expected the permission error to be skipped, got: %v", err)
+		}
+		if _, err := fs.ReadFile(filepath.Join(outputDir, "public", "tables", "users", "table.sql")); err != nil {
+			t.Errorf("Expected the users table to be written: %v", err)
+		}
+		// The skipped object is still reported as failed
+		content, err := fs.ReadFile(filepath.Join(outputDir, FailedObjectsFile))
+		if err != nil {
+			t.Fatalf("Expected %s to be written: %v", FailedObjectsFile, err)
+		}
+		if !strings.Contains(string(content), "function public.rotate_keys") {
+			t.Errorf("Expected the skipped function to be listed, got:\n%s", content)
+		}
+	})
+
+	t.Run("without the flag", func(t *testing.T) {
+		connector := newRestricted(map[string]db.FailureKind{"public.rotate_keys": db.FailurePermissionDenied})
+		exporter, _ := NewWithMemFS(connector, "/pgmeta-output")
+		if err := exporter.ExportObjects(context.Background(), objects, false); err == nil {
+			t.Error("Expected the permission error to fail the export")
+		}
+	})
+
+	t.Run("missing objects still fail", func(t *testing.T) {
+		connector := newRestricted(map[string]db.FailureKind{"public.rotate_keys": db.FailureNotFound})
+		exporter, _ := NewWithMemFS(connector, "/pgmeta-output")
+		exporter.WithSkipPermissionErrors(true)
+		if err := exporter.ExportObjects(context.Background(), objects, false); err == nil {
+			t.Error("Expected a missing object to fail the export")
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package export
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// PruneFileSystem is a FileSystem that can also list and delete what an earlier export wrote.
+// ListTree returns every file and directory below root, and Remove deletes a single file
+// or empty directory.
+type PruneFileSystem interface {
+	FileSystem
+	ListTree(root string) (files, dirs []string, err error)
+	Remove(name string) error
+}
+
+// databaseSchema is the directory database-level objects such as publications are written to
+const databaseSchema = "postgres"
+
+// pruneTypeDirs maps the directory names the exporter writes definitions into, after names
+// renames them, to their type. Standalone objects go to typeDir(type) while table children
+// use tableChildDirs, so policies and indexes appear under both spellings.
+func pruneTypeDirs(names DirNames) map[string]types.ObjectType {
+	dirs := make(map[string]types.ObjectType)
+	for _, t := range types.ValidTypes() {
+		dirs[names.name(typeDir(t))] = t
+	}
+	for t, dir := range tableChildDirs {
+		dirs[names.name(dir)] = t
+	}
+	return dirs
+}
+
+// isDefinitionFile reports whether name is a definition file the exporter may have written
+func isDefinitionFile(name string) bool {
+	return strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, ".sql.gz")
+}
+
+// DefinitionFile identifies the object a definition file in an export belongs to
+type DefinitionFile struct {
+	Type   types.ObjectType `json:"type"`
+	Schema string           `json:"schema,omitempty"`
+	Name   string           `json:"name"`
+	Table  string           `json:"table,omitempty"`
+	Path   string           `json:"path"`
+}
+
+// parseDefinitionPath recognizes rel, a path relative to the output directory, as the
+// definition file of an object, given the name of the tables directory. ok is false for
+// anything else, such as manifests and indexes.
+func parseDefinitionPath(rel string, tablesDir string, typeDirs map[string]types.ObjectType) (file DefinitionFile, ok bool) {
+	rel = filepath.ToSlash(rel)
+	parts := strings.Split(rel, "/")
+	base := parts[len(parts)-1]
+	if !isDefinitionFile(base) {
+		return DefinitionFile{}, false
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(base, ".gz"), ".sql")
+
+	switch {
+	case len(parts) == 4 && parts[1] == tablesDir && (name == "table" || base == foreignKeysFile || base == foreignKeysFile+".gz"):
+		// A table's foreign keys belong to the table
+		file = DefinitionFile{Type: types.TypeTable, Schema: parts[0], Name: parts[2], Table: parts[2]}
+	case len(parts) == 5 && parts[1] == tablesDir:
+		file = DefinitionFile{Type: typeDirs[parts[3]], Schema: parts[0], Name: name, Table: parts[2]}
+	case len(parts) == 3 && parts[1] != tablesDir:
+		file = DefinitionFile{Type: typeDirs[parts[1]], Schema: parts[0], Name: name}
+	case len(parts) == 2 && parts[0] == "languages":
+		file = DefinitionFile{Type: types.TypeLanguage, Name: name}
+	}
+	if file.Type == "" {
+		return DefinitionFile{}, false
+	}
+	file.Path = rel
+	return file, true
+}
+
+// scopeSets returns schemas and objTypes as sets; no objTypes means every type
+func scopeSets(schemas []string, objTypes []types.ObjectType) (map[string]bool, map[types.ObjectType]bool) {
+	schemaSet := make(map[string]bool, len(schemas))
+	for _, s := range schemas {
+		schemaSet[s] = true
+	}
+	if len(objTypes) == 0 {
+		objTypes = types.ValidTypes()
+	}
+	typeSet := make(map[types.ObjectType]bool, len(objTypes))
+	for _, t := range objTypes {
+		typeSet[t] = true
+	}
+	return schemaSet, typeSet
+}
+
+// inScope reports whether file belongs to one of schemas and objTypes
+func inScope(file DefinitionFile, schemas map[string]bool, objTypes map[types.ObjectType]bool) bool {
+	if !objTypes[file.Type] {
+		return false
+	}
+	switch file.Type {
+	case types.TypePublication, types.TypeSubscription:
+		// Publications and subscriptions belong to the database, not to a queried schema
+		return file.Schema == databaseSchema
+	case types.TypeLanguage:
+		return true
+	}
+	return schemas[file.Schema]
+}
+
+// pruneScope reports whether rel, a path relative to the output directory, is a definition
+// file for one of the queried schemas and types. Anything else, including manifests,
+// indexes and files in other schemas, is never pruned.
+func (e *Exporter) pruneScope(rel string, typeDirs map[string]types.ObjectType) bool {
+	file, ok := parseDefinitionPath(rel, e.standaloneDir(types.TypeTable), typeDirs)
+	return ok && inScope(file, e.pruneSchemas, e.pruneTypes)
+}
+
+// pruneStale deletes definition files left behind by objects that no longer exist: every file in
+// the queried schemas and types that this export did not write. Directories emptied by the
+// deletions are removed as well.
+func (e *Exporter) pruneStale() error {
+	pfs, ok := e.fs.(PruneFileSystem)
+	if !ok {
+		return stacktrace.NewError("--prune is only supported for local output directories")
+	}
+
+	files, dirs, err := pfs.ListTree(e.outputDir)
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to list %s for pruning", e.outputDir)
+	}
+
+	e.writtenMu.Lock()
+	written := make(map[string]bool, len(e.writtenFiles))
+	for _, f := range e.writtenFiles {
+		written[filepath.Clean(f.path)] = true
+	}
+	e.writtenMu.Unlock()
+
+	typeDirs := pruneTypeDirs(e.dirNames)
+	removed := make(map[string]bool)
+	for _, path := range files {
+		path = filepath.Clean(path)
+		rel, err := filepath.Rel(e.outputDir, path)
+		if err != nil || written[path] || !e.pruneScope(rel, typeDirs) {
+			continue
+		}
+		if err := pfs.Remove(path); err != nil {
+			return stacktrace.Propagate(err, "Failed to prune %s", path)
+		}
+		log.Debug("Pruned %s", path)
+		removed[path] = true
+	}
+
+	// A directory is empty once nothing that survived lives below it. Deepest first, so a
+	// directory that is kept marks its parents as occupied before they are checked.
+	root := filepath.Clean(e.outputDir)
+	occupied := make(map[string]bool)
+	occupy := func(path string) {
+		for dir := filepath.Dir(path); dir != root && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			occupied[dir] = true
+		}
+	}
+	for _, path := range files {
+		if path = filepath.Clean(path); !removed[path] {
+			occupy(path)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if dir == root {
+			continue
+		}
+		if occupied[dir] || !prunedBelow(dir, removed) {
+			occupy(dir)
+			continue
+		}
+		if err := pfs.Remove(dir); err != nil {
+			return stacktrace.Propagate(err, "Failed to remove empty directory %s", dir)
+		}
+	}
+
+	if len(removed) > 0 {
+		log.Info("Pruned %d definition files of objects that no longer exist", len(removed))
+	}
+	return nil
+}
+
+// prunedBelow reports whether a file below dir was pruned, so directories that were
+// already empty before this export are left alone
+func prunedBelow(dir string, removed map[string]bool) bool {
+	prefix := dir + string(filepath.Separator)
+	for path := range removed {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestPruneRemovedObjects(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	connector := &mockConnector{shouldFail: false}
+
+	before := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_email_idx", TableName: "users"},
+		{Type: types.TypeTable, Schema: "public", Name: "orders"},
+		{Type: types.TypeView, Schema: "public", Name: "active_users"},
+		{Type: types.TypeFunction, Schema: "public", Name: "add"},
+		{Type: types.TypeTable, Schema: "audit", Name: "log"},
+	}
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	if err := exporter.ExportObjects(context.Background(), before, false); err != nil {
+		t.Fatalf("First export failed: %v", err)
+	}
+	readme := filepath.Join(outputDir, "public", "README.md")
+	if err := fs.WriteFile(readme, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// orders, its directory and the view were dropped; functions and the audit schema
+	// were not part of this export and must be left alone
+	after := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_email_idx", TableName: "users"},
+	}
+	exporter = NewWithMock(connector, outputDir).
+		WithFileSystem(fs).
+		WithPrune(true, []string{"public"}, []types.ObjectType{types.TypeTable, types.TypeIndex, types.TypeView})
+	if err := exporter.ExportObjects(context.Background(), after, false); err != nil {
+		t.Fatalf("Second export failed: %v", err)
+	}
+
+	tablesDir := filepath.Join(outputDir, "public", "tables")
+	kept := []string{
+		filepath.Join(tablesDir, "users", "table.sql"),
+		filepath.Join(tablesDir, "users", "indexes", "users_email_idx.sql"),
+		filepath.Join(outputDir, "public", "functions", "add.sql"),
+		filepath.Join(outputDir, "audit", "tables", "log", "table.sql"),
+		readme,
+	}
+	for _, path := range kept {
+		if _, err := fs.ReadFile(path); err != nil {
+			t.Errorf("Expected %s to survive pruning: %v", path, err)
+		}
+	}
+	pruned := []string{
+		filepath.Join(tablesDir, "orders", "table.sql"),
+		filepath.Join(outputDir, "public", "views", "active_users.sql"),
+	}
+	for _, path := range pruned {
+		if _, err := fs.ReadFile(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be pruned, got %v", path, err)
+		}
+	}
+	for _, dir := range []string{filepath.Join(tablesDir, "orders"), filepath.Join(outputDir, "public", "views")} {
+		if fs.IsDir(dir) {
+			t.Errorf("Expected emptied directory %s to be removed", dir)
+		}
+	}
+	if !fs.IsDir(tablesDir) {
+		t.Errorf("Expected %s to be kept", tablesDir)
+	}
+}
+
+func TestPruneSkippedWhenObjectsFail(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	objects := []types.DBObject{
+		{Type: types.TypeView, Schema: "public", Name: "v1"},
+		{Type: types.TypeView, Schema: "public", Name: "v2"},
+	}
+	exporter, fs := NewWithMemFS(&mockConnector{}, outputDir)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("First export failed: %v", err)
+	}
+
+	// v2 still exists but its definition could not be fetched this time
+	connector := &selectiveFailConnector{failedObjects: map[string]bool{"v2": true}}
+	exporter = NewWithMock(connector, outputDir).
+		WithFileSystem(fs).
+		WithPrune(true, []string{"public"}, nil)
+	if err := exporter.ExportObjects(context.Background(), objects, true); err != nil {
+		t.Fatalf("Second export failed: %v", err)
+	}
+	for _, obj := range objects {
+		path := filepath.Join(outputDir, "public", "views", obj.Name+".sql")
+		if _, err := fs.ReadFile(path); err != nil {
+			t.Errorf("Expected %s to survive an incomplete export: %v", path, err)
+		}
+	}
+}
+
+func TestPruneOnDisk(t *testing.T) {
+	outputDir := t.TempDir()
+	connector := &mockConnector{shouldFail: false}
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeTable, Schema: "public", Name: "orders"},
+	}
+	if err := NewWithMock(connector, outputDir).ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("First export failed: %v", err)
+	}
+
+	exporter := NewWithMock(connector, outputDir).WithPrune(true, []string{"public"}, nil)
+	if err := exporter.ExportObjects(context.Background(), objects[:1], false); err != nil {
+		t.Fatalf("Second export failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "public", "tables", "users", "table.sql")); err != nil {
+		t.Errorf("Expected users to survive pruning: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "public", "tables", "orders")); !os.IsNotExist(err) {
+		t.Errorf("Expected the orders directory to be pruned, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package export
+
+import (
+	"regexp"
+
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// redactedText replaces every match of a redaction pattern
+const redactedText = "[REDACTED]"
+
+// WithRedactPatterns replaces every match of the patterns in every definition with
+// [REDACTED] before anything is written, as a safety net for credentials embedded in
+// function bodies and other definitions. Unlike the other transforms it deliberately
+// rewrites dollar-quoted bodies.
+func (e *Exporter) WithRedactPatterns(patterns []*regexp.Regexp) *Exporter {
+	e.redactPatterns = patterns
+	return e
+}
+
+// redact applies the redaction patterns to each object's definition, logging how many
+// matches were replaced in each
+func (e *Exporter) redact(objects []types.DBObject) {
+	total := 0
+	for i := range objects {
+		obj := &objects[i]
+		count := 0
+		for _, pattern := range e.redactPatterns {
+			matches := len(pattern.FindAllStringIndex(obj.Definition, -1))
+			if matches == 0 {
+				continue
+			}
+			count += matches
+			obj.Definition = pattern.ReplaceAllLiteralString(obj.Definition, redactedText)
+		}
+		if count > 0 {
+			log.Info("Redacted %d matches in %s %s.%s", count, obj.Type, obj.Schema, obj.Name)
+			total += count
+		}
+	}
+	if total > 0 {
+		log.Warn("Redacted %d matches of --redact-pattern; the redacted definitions will not replay as they were", total)
+	}
+}
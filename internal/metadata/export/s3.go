@@ -0,0 +1,84 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/palantir/stacktrace"
+)
+
+// s3Scheme prefixes output locations that are S3 buckets
+const s3Scheme = "s3://"
+
+// s3PutObjectAPI is the part of the S3 client the exporter needs
+type s3PutObjectAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3FileSystem writes each file as an object in a bucket, using the file path as the key.
+// Object storage has no directories, so MkdirAll is a no-op.
+type S3FileSystem struct {
+	ctx    context.Context
+	client s3PutObjectAPI
+	bucket string
+}
+
+// ParseS3URL splits s3://bucket/prefix into its bucket and key prefix.
+// ok is false if url is not an S3 location.
+func ParseS3URL(url string) (bucket, prefix string, ok bool) {
+	if !strings.HasPrefix(url, s3Scheme) {
+		return "", "", false
+	}
+	bucket, prefix, _ = strings.Cut(strings.TrimPrefix(url, s3Scheme), "/")
+	if bucket == "" {
+		return "", "", false
+	}
+	return bucket, strings.Trim(prefix, "/"), true
+}
+
+// NewS3FileSystem creates a FileSystem that writes to bucket, resolving credentials
+// and region the standard AWS way (environment, shared config, instance role)
+func NewS3FileSystem(ctx context.Context, bucket string) (*S3FileSystem, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to load AWS configuration")
+	}
+	return newS3FileSystem(ctx, s3.NewFromConfig(cfg), bucket), nil
+}
+
+// newS3FileSystem creates an S3FileSystem around an existing client
+func newS3FileSystem(ctx context.Context, client s3PutObjectAPI, bucket string) *S3FileSystem {
+	return &S3FileSystem{ctx: ctx, client: client, bucket: bucket}
+}
+
+// MkdirAll does nothing; keys are created implicitly by WriteFile
+func (f *S3FileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+// WriteFile uploads data as the object at name
+func (f *S3FileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	key := objectKey(name)
+	_, err := f.client.PutObject(f.ctx, &s3.PutObjectInput{
+		Bucket: aws.String(f.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to upload s3://%s/%s", f.bucket, key)
+	}
+	return nil
+}
+
+// objectKey converts an exporter path into an S3 key with forward slashes and no leading "./" or "/"
+func objectKey(name string) string {
+	key := path.Clean(filepath.ToSlash(name))
+	return strings.TrimPrefix(strings.TrimPrefix(key, "./"), "/")
+}
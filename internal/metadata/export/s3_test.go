@@ -0,0 +1,122 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// mockS3Client records uploaded objects and fails for selected keys
+type mockS3Client struct {
+	mu      sync.Mutex
+	objects map[string]string
+	failKey string
+}
+
+func (m *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if *params.Key == m.failKey {
+		return nil, errors.New("access denied")
+	}
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[*params.Bucket+"/"+*params.Key] = string(body)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestParseS3URL(t *testing.T) {
+	tests := []struct {
+		url    string
+		bucket string
+		prefix string
+		ok     bool
+	}{
+		{"s3://backups/pgmeta/prod", "backups", "pgmeta/prod", true},
+		{"s3://backups/pgmeta/", "backups", "pgmeta", true},
+		{"s3://backups", "backups", "", true},
+		{"s3://", "", "", false},
+		{"./pgmeta-output", "", "", false},
+	}
+
+	for _, tt := range tests {
+		bucket, prefix, ok := ParseS3URL(tt.url)
+		if bucket != tt.bucket || prefix != tt.prefix || ok != tt.ok {
+			t.Errorf("ParseS3URL(%q) = (%q, %q, %v), expected (%q, %q, %v)",
+				tt.url, bucket, prefix, ok, tt.bucket, tt.prefix, tt.ok)
+		}
+	}
+}
+
+func TestExportToS3(t *testing.T) {
+	client := &mockS3Client{objects: make(map[string]string)}
+	fs := newS3FileSystem(context.Background(), client, "backups")
+
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_idx", TableName: "users"},
+		{Type: types.TypeView, Schema: "public", Name: "active_users"},
+	}
+
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, "pgmeta/prod").WithFileSystem(fs)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	// Keys mirror the directory layout under the prefix
+	keys := make([]string, 0, len(client.objects))
+	for key := range client.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	expected := []string{
+		"backups/pgmeta/prod/public/tables/users/indexes/users_idx.sql",
+		"backups/pgmeta/prod/public/tables/users/table.sql",
+		"backups/pgmeta/prod/public/views/active_users.sql",
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected keys %v, got %v", expected, keys)
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Errorf("Expected key %q, got %q", expected[i], keys[i])
+		}
+	}
+	if got := client.objects["backups/pgmeta/prod/public/tables/users/table.sql"]; got != "CREATE TABLE public.users (id integer);" {
+		t.Errorf("Unexpected object content: %q", got)
+	}
+}
+
+func TestExportToS3UploadFailure(t *testing.T) {
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeView, Schema: "public", Name: "active_users"},
+	}
+	connector := &mockConnector{shouldFail: false}
+
+	// With on-error fail, a failed upload fails the export
+	client := &mockS3Client{objects: make(map[string]string), failKey: "public/views/active_users.sql"}
+	exporter := NewWithMock(connector, ".").WithFileSystem(newS3FileSystem(context.Background(), client, "backups"))
+	if err := exporter.ExportObjects(context.Background(), objects, false); err == nil {
+		t.Error("Expected ExportObjects to fail when an upload fails")
+	}
+
+	// With on-error warn, the other objects are still uploaded
+	client = &mockS3Client{objects: make(map[string]string), failKey: "public/views/active_users.sql"}
+	exporter = NewWithMock(connector, ".").WithFileSystem(newS3FileSystem(context.Background(), client, "backups"))
+	if err := exporter.ExportObjects(context.Background(), objects, true); err != nil {
+		t.Errorf("Expected ExportObjects to continue past the failed upload, got: %v", err)
+	}
+	if _, ok := client.objects["backups/public/tables/users/table.sql"]; !ok {
+		t.Errorf("Expected the table to be uploaded, got %v", client.objects)
+	}
+}
@@ -0,0 +1,56 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// statsFile holds a table's size and maintenance metadata, beside its table.sql
+const statsFile = "stats.json"
+
+// StatsConnector is a DBConnector that can also report table size and maintenance metadata
+type StatsConnector interface {
+	DBConnector
+	FetchTableStats(ctx context.Context, schema string) (map[string]types.TableStats, error)
+}
+
+// fetchTableStats returns the stats of every table in schema when --with-stats was requested.
+// Each schema is only queried once, however many batches its tables are written in.
+func (e *Exporter) fetchTableStats(ctx context.Context, schema string) (map[string]types.TableStats, error) {
+	if !e.withStats {
+		return nil, nil
+	}
+	if stats, ok := e.tableStats[schema]; ok {
+		return stats, nil
+	}
+	sc, ok := e.connector.(StatsConnector)
+	if !ok {
+		return nil, stacktrace.NewError("Table stats are not supported by this connector")
+	}
+	stats, err := sc.FetchTableStats(ctx, schema)
+	if err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to fetch table stats for schema %s", schema)
+	}
+	if e.tableStats == nil {
+		e.tableStats = make(map[string]map[string]types.TableStats)
+	}
+	e.tableStats[schema] = stats
+	return stats, nil
+}
+
+// writeTableStats writes a table's stats.json into its directory
+func (e *Exporter) writeTableStats(tableDir string, stats types.TableStats) error {
+	content, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return stacktrace.Propagate(err, "Failed to encode %s", statsFile)
+	}
+	path := filepath.Join(tableDir, statsFile)
+	if err := e.writeFile(path, append(content, '\n')); err != nil {
+		return stacktrace.Propagate(err, "Failed to write %s", path)
+	}
+	return nil
+}
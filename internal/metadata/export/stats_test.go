@@ -0,0 +1,91 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// statsConnector is a mockConnector that also reports table stats
+type statsConnector struct {
+	mockConnector
+	stats map[string]map[string]types.TableStats
+}
+
+func (s *statsConnector) FetchTableStats(ctx context.Context, schema string) (map[string]types.TableStats, error) {
+	return s.stats[schema], nil
+}
+
+func TestExportTableStats(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	vacuumed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	connector := &statsConnector{stats: map[string]map[string]types.TableStats{
+		"public": {
+			"users": {
+				RowEstimate:       1200,
+				TotalBytes:        819200,
+				ToastBytes:        8192,
+				ToastOptions:      []string{"autovacuum_enabled=false"},
+				AutovacuumOptions: []string{"autovacuum_vacuum_scale_factor=0.05"},
+				LiveTuples:        1180,
+				DeadTuples:        20,
+				LastAutovacuum:    &vacuumed,
+			},
+		},
+	}}
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "orders_idx", TableName: "orders"},
+	}
+
+	exporter := NewWithMock(connector, outputDir).WithStats(true)
+	fs := NewMemFileSystem()
+	exporter.WithFileSystem(fs)
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+
+	content, err := fs.ReadFile(filepath.Join(outputDir, "public", "tables", "users", statsFile))
+	if err != nil {
+		t.Fatalf("Expected stats.json beside users' table.sql: %v", err)
+	}
+	var got types.TableStats
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("stats.json is not valid JSON: %v\n%s", err, content)
+	}
+	if got.RowEstimate != 1200 || got.TotalBytes != 819200 || got.ToastBytes != 8192 || got.DeadTuples != 20 {
+		t.Errorf("Unexpected stats: %+v", got)
+	}
+	if len(got.AutovacuumOptions) != 1 || got.AutovacuumOptions[0] != "autovacuum_vacuum_scale_factor=0.05" {
+		t.Errorf("Expected the autovacuum storage parameters, got %v", got.AutovacuumOptions)
+	}
+	if got.LastAutovacuum == nil || !got.LastAutovacuum.Equal(vacuumed) || got.LastVacuum != nil {
+		t.Errorf("Expected only the last autovacuum time, got %v and %v", got.LastAutovacuum, got.LastVacuum)
+	}
+
+	// Only exported tables get stats; orders only has an index in this export
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "public", "tables", "orders", statsFile)); err == nil {
+		t.Error("Expected no stats.json for a table that was not exported")
+	}
+}
+
+func TestExportWithoutStats(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	connector := &statsConnector{stats: map[string]map[string]types.TableStats{
+		"public": {"users": {RowEstimate: 1}},
+	}}
+	exporter := NewWithMock(connector, outputDir)
+	fs := NewMemFileSystem()
+	exporter.WithFileSystem(fs)
+	objects := []types.DBObject{{Type: types.TypeTable, Schema: "public", Name: "users"}}
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "public", "tables", "users", statsFile)); err == nil {
+		t.Error("Expected stats.json only with --with-stats")
+	}
+}
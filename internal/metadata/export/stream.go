@@ -0,0 +1,102 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// WithCombinedOutputs also writes the whole export to each of writers as the single SQL
+// script WithStream produces, next to the individual files. The definitions are fetched
+// once for the files and every writer.
+func (e *Exporter) WithCombinedOutputs(writers ...io.Writer) *Exporter {
+	e.combined = writers
+	return e
+}
+
+// writeStream writes every definition to the stream sink as a single SQL script
+func (e *Exporter) writeStream(objects []types.DBObject) error {
+	return e.writeScript(e.stream, objects)
+}
+
+// writeCombinedOutputs writes every definition to each combined output as a single SQL script
+func (e *Exporter) writeCombinedOutputs(objects []types.DBObject) error {
+	for _, w := range e.combined {
+		if err := e.writeScript(w, objects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeScript writes every definition to w as a single SQL script, in the same
+// dependency order as the apply.sql manifest. Constraints are skipped for the same
+// reason: table definitions already declare them.
+func (e *Exporter) writeScript(w io.Writer, objects []types.DBObject) error {
+	rank := e.typeRank()
+
+	ordered := make([]types.DBObject, 0, len(objects))
+	for _, obj := range objects {
+		if _, ok := rank[obj.Type]; ok {
+			ordered = append(ordered, obj)
+		}
+		// A table's foreign keys are added once every table exists
+		if obj.Type == types.TypeTable && obj.ForeignKeys != "" {
+			ordered = append(ordered, types.DBObject{
+				Type:       typeForeignKeys,
+				Schema:     obj.Schema,
+				Name:       obj.Name,
+				TableName:  obj.Name,
+				Definition: obj.ForeignKeys,
+			})
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if rank[a.Type] != rank[b.Type] {
+			return rank[a.Type] < rank[b.Type]
+		}
+		if a.Schema != b.Schema {
+			return a.Schema < b.Schema
+		}
+		if a.TableName != b.TableName {
+			return a.TableName < b.TableName
+		}
+		return a.Name < b.Name
+	})
+
+	var out strings.Builder
+	if e.serverInfo != nil {
+		fmt.Fprintf(&out, "-- Exported from %s\n", e.serverInfo)
+	}
+	if slices.ContainsFunc(ordered, func(obj types.DBObject) bool { return isRoutineType(obj.Type) }) {
+		out.WriteString("SET check_function_bodies = false;\n")
+	}
+	for _, obj := range ordered {
+		definition := strings.TrimSpace(obj.Definition)
+		if obj.Type == types.TypeIndex && e.concurrentIndexes {
+			definition = makeIndexConcurrent(definition)
+		}
+		if !strings.HasSuffix(definition, ";") {
+			definition += ";"
+		}
+
+		fmt.Fprintf(&out, "\n-- %s: %s.%s\n", obj.Type, obj.Schema, obj.Name)
+		out.WriteString(definition)
+		out.WriteString("\n")
+	}
+
+	encoded, err := e.encodeOutput("export stream", []byte(out.String()))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(encoded); err != nil {
+		return stacktrace.Propagate(err, "Failed to write export stream")
+	}
+	return nil
+}
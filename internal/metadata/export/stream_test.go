@@ -0,0 +1,115 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestExportToStream(t *testing.T) {
+	// Create a temporary directory that must stay empty
+	tmpDir, err := os.MkdirTemp("", "pgmeta-test-stream")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var buf bytes.Buffer
+	connector := &mockConnector{shouldFail: false}
+	exporter := NewWithMock(connector, tmpDir).
+		WithStream(&buf).
+		WithConcurrentIndexes(true).
+		WithServerInfo(&types.ServerInfo{Version: "16.2", Encoding: "UTF8", Collation: "en_US.UTF-8"})
+
+	objects := append(manifestTestObjects(), types.DBObject{
+		Type:        types.TypeTable,
+		Schema:      "public",
+		Name:        "accounts",
+		ForeignKeys: "ALTER TABLE ONLY public.accounts ADD CONSTRAINT accounts_user_fk FOREIGN KEY (user_id) REFERENCES users(id);\n",
+	})
+	if err := exporter.ExportObjects(context.Background(), objects, false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	stream := buf.String()
+
+	if !strings.HasPrefix(stream, "-- Exported from PostgreSQL 16.2") {
+		t.Errorf("Expected stream to start with the server header, got:\n%s", stream)
+	}
+
+	// Definitions follow the manifest's dependency order, each under a section comment
+	expectedOrder := []string{
+		"-- extension: public.pgcrypto\nMOCK DEFINITION for extension pgcrypto;",
+		"-- table: public.users\nCREATE TABLE public.users (id integer);",
+		"-- view: public.active_users\nCREATE VIEW public.active_users AS SELECT 1;",
+		"-- index: public.users_idx\nCREATE INDEX CONCURRENTLY users_idx ON public.users (id);",
+		"-- foreign_keys: public.accounts\nALTER TABLE ONLY public.accounts ADD CONSTRAINT accounts_user_fk",
+		"-- subscription: postgres.sub_remote",
+	}
+	last := -1
+	for _, section := range expectedOrder {
+		idx := strings.Index(stream, section)
+		if idx < 0 {
+			t.Errorf("Expected stream to contain %q, got:\n%s", section, stream)
+			continue
+		}
+		if idx < last {
+			t.Errorf("Expected %q to appear later in the stream", section)
+		}
+		last = idx
+	}
+
+	// Constraints are already part of the table definitions
+	if strings.Contains(stream, "users_pk") {
+		t.Errorf("Stream should not include constraints, got:\n%s", stream)
+	}
+
+	// Nothing is written to the output directory
+	if entries, _ := os.ReadDir(tmpDir); len(entries) > 0 {
+		t.Errorf("Expected no files when streaming, found %d entries", len(entries))
+	}
+}
+
+// countingConnector is a mockConnector that counts how often definitions are fetched
+type countingConnector struct {
+	mockConnector
+	fetches int
+}
+
+func (c *countingConnector) FetchObjectsDefinitionsConcurrently(ctx context.Context, objects []types.DBObject, concurrency int) ([]types.DBObject, []types.ObjectKey, error) {
+	c.fetches++
+	return c.mockConnector.FetchObjectsDefinitionsConcurrently(ctx, objects, concurrency)
+}
+
+func TestExportCombinedOutputs(t *testing.T) {
+	outputDir := "/pgmeta-output"
+	connector := &countingConnector{}
+	var first, second bytes.Buffer
+	exporter, fs := NewWithMemFS(connector, outputDir)
+	exporter.WithCombinedOutputs(&first, &second)
+
+	if err := exporter.ExportObjects(context.Background(), manifestTestObjects(), false); err != nil {
+		t.Fatalf("ExportObjects failed: %v", err)
+	}
+	if connector.fetches != 1 {
+		t.Errorf("Expected the definitions to be fetched once for every output, got %d fetches", connector.fetches)
+	}
+
+	// The tree is written as without combined outputs
+	if _, err := fs.ReadFile(filepath.Join(outputDir, "public", "tables", "users", "table.sql")); err != nil {
+		t.Errorf("Expected the tree to hold the users table: %v", err)
+	}
+	// Each combined output holds the script --output - would stream
+	for _, combined := range []string{first.String(), second.String()} {
+		if !strings.Contains(combined, "-- table: public.users\nCREATE TABLE public.users (id integer);") {
+			t.Errorf("Expected the combined output to hold the users table, got:\n%s", combined)
+		}
+	}
+	if first.String() != second.String() {
+		t.Errorf("Expected every combined output to be identical")
+	}
+}
@@ -0,0 +1,32 @@
+package export
+
+import (
+	"slices"
+
+	"github.com/skamensky/pgmeta/internal/log"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// dollarQuotedBodies returns every dollar-quoted string in a definition, tags included,
+// in order. Function bodies live in these regions and must survive any transform byte for byte.
+func dollarQuotedBodies(definition string) []string {
+	var bodies []string
+	for _, seg := range splitSQL(definition) {
+		if !seg.code && seg.text[0] == '$' {
+			bodies = append(bodies, seg.text)
+		}
+	}
+	return bodies
+}
+
+// transformDefinition applies transform to obj's definition, keeping the original if the
+// transform changed any dollar-quoted body, e.g. a function body containing a $$ literal.
+// Every text transform on definitions should go through here.
+func transformDefinition(obj *types.DBObject, name string, transform func(string) string) {
+	transformed := transform(obj.Definition)
+	if !slices.Equal(dollarQuotedBodies(obj.Definition), dollarQuotedBodies(transformed)) {
+		log.Warn("Skipping %s for %s %s.%s: it would alter a dollar-quoted body", name, obj.Type, obj.Schema, obj.Name)
+		return
+	}
+	obj.Definition = transformed
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// dollarLiteralFunction is a plpgsql function whose body contains $$ literals,
+// so pg_get_functiondef quotes it with $function$ instead of $$
+const dollarLiteralFunction = "CREATE OR REPLACE FUNCTION public.price_label(amount numeric)\n" +
+	" RETURNS text\n" +
+	" LANGUAGE plpgsql\n" +
+	"AS $function$\n" +
+	"begin\n" +
+	"\t-- from $$ to $$, keep as is   \n" +
+	"    return '$$ ' || amount::text || ' $$';\n" +
+	"end;\n" +
+	"$function$\n"
+
+func TestDollarQuotedBodies(t *testing.T) {
+	bodies := dollarQuotedBodies(dollarLiteralFunction)
+	if len(bodies) != 1 {
+		t.Fatalf("Expected one dollar-quoted body, got %q", bodies)
+	}
+	if !strings.HasPrefix(bodies[0], "$function$\nbegin") || !strings.HasSuffix(bodies[0], "end;\n$function$") {
+		t.Errorf("Expected the whole $function$ body, got %q", bodies[0])
+	}
+
+	// Quotes inside literals and comments do not open a body
+	if bodies := dollarQuotedBodies("SELECT '$$' -- $$\n FROM t"); len(bodies) != 0 {
+		t.Errorf("Expected no dollar-quoted bodies, got %q", bodies)
+	}
+}
+
+func TestFormatSQLPreservesDollarLiteralBody(t *testing.T) {
+	obj := types.DBObject{Type: types.TypeFunction, Schema: "public", Name: "price_label", Definition: dollarLiteralFunction}
+	transformDefinition(&obj, "--format-sql", formatSQL)
+
+	body := dollarQuotedBodies(dollarLiteralFunction)[0]
+	if !strings.Contains(obj.Definition, body) {
+		t.Errorf("Expected the function body to be unchanged, got:\n%s", obj.Definition)
+	}
+	// The header outside the body is still formatted
+	if !strings.HasPrefix(obj.Definition, "CREATE OR REPLACE FUNCTION public.price_label(amount numeric)\n    RETURNS text\n") {
+		t.Errorf("Expected the header to be reindented, got:\n%s", obj.Definition)
+	}
+}
+
+func TestTransformDefinitionRejectsBodyChanges(t *testing.T) {
+	obj := types.DBObject{Type: types.TypeFunction, Schema: "public", Name: "price_label", Definition: dollarLiteralFunction}
+
+	// A naive newline conversion rewrites the body and must be rejected
+	transformDefinition(&obj, "CRLF conversion", func(s string) string {
+		return strings.ReplaceAll(s, "\n", "\r\n")
+	})
+	if obj.Definition != dollarLiteralFunction {
+		t.Errorf("Expected the definition to be left unchanged, got %q", obj.Definition)
+	}
+
+	// Transforms that leave the body alone are applied
+	transformDefinition(&obj, "uppercase header", func(s string) string {
+		return strings.Replace(s, "LANGUAGE plpgsql", "LANGUAGE PLPGSQL", 1)
+	})
+	if !strings.Contains(obj.Definition, "LANGUAGE PLPGSQL") {
+		t.Errorf("Expected the transform to be applied, got %q", obj.Definition)
+	}
+}
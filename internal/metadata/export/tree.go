@@ -0,0 +1,99 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+// treeNode is a directory of the tree WriteTree prints
+type treeNode struct {
+	dirs    map[string]*treeNode
+	objects []string
+}
+
+// dir returns the subdirectory name of n, creating it if needed
+func (n *treeNode) dir(name string) *treeNode {
+	if n.dirs == nil {
+		n.dirs = make(map[string]*treeNode)
+	}
+	child, ok := n.dirs[name]
+	if !ok {
+		child = &treeNode{}
+		n.dirs[name] = child
+	}
+	return child
+}
+
+// path returns the directory below n reached through names, skipping empty ones
+func (n *treeNode) path(names ...string) *treeNode {
+	for _, name := range names {
+		if name != "" {
+			n = n.dir(name)
+		}
+	}
+	return n
+}
+
+// write prints the directories and objects below n, sorted together by name, indented by depth
+func (n *treeNode) write(w *bufio.Writer, depth int) {
+	type entry struct {
+		name string
+		dir  *treeNode
+	}
+	entries := make([]entry, 0, len(n.dirs)+len(n.objects))
+	for name, dir := range n.dirs {
+		entries = append(entries, entry{name: name + "/", dir: dir})
+	}
+	for _, name := range n.objects {
+		entries = append(entries, entry{name: name})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	indent := strings.Repeat("  ", depth)
+	for _, e := range entries {
+		w.WriteString(indent + e.name + "\n")
+		if e.dir != nil {
+			e.dir.write(w, depth+1)
+		}
+	}
+}
+
+// WriteTree prints objects to w as an indented tree of the directories ExportObjects would
+// write them into: schema, type directory and, for objects of a table, the table and their
+// own type directory. Objects are listed by name, so no definitions are needed.
+func WriteTree(w io.Writer, objects []types.DBObject) error {
+	schemaObjects, schemaStandalone := GroupObjects(objects)
+
+	root := &treeNode{}
+	tablesDir := typeDir(types.TypeTable)
+	for schemaDir, tables := range schemaObjects {
+		for table, objs := range tables {
+			tableNode := root.path(schemaDir, tablesDir, table)
+			for _, obj := range objs {
+				if obj.Type != types.TypeTable {
+					child := tableNode.dir(tableChildDirs[obj.Type])
+					child.objects = append(child.objects, obj.Name)
+				}
+			}
+		}
+	}
+	for schemaDir, objs := range schemaStandalone {
+		for _, obj := range objs {
+			// Languages have no schema directory and sit beside the schemas
+			node := root.path(schemaDir, typeDir(obj.Type))
+			node.objects = append(node.objects, obj.Name)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	root.write(bw, 0)
+	if err := bw.Flush(); err != nil {
+		return stacktrace.Propagate(err, "Failed to write the object tree")
+	}
+	return nil
+}
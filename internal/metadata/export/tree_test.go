@@ -0,0 +1,59 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skamensky/pgmeta/internal/metadata/types"
+)
+
+func TestWriteTree(t *testing.T) {
+	objects := []types.DBObject{
+		{Type: types.TypeTable, Schema: "public", Name: "users"},
+		{Type: types.TypeIndex, Schema: "public", Name: "users_email_idx", TableName: "users"},
+		{Type: types.TypeConstraint, Schema: "public", Name: "users_pkey", TableName: "users"},
+		{Type: types.TypeTrigger, Schema: "public", Name: "users_audit", TableName: "users"},
+		// Same table name in another schema keeps its own objects
+		{Type: types.TypeTable, Schema: "app", Name: "users"},
+		{Type: types.TypeFunction, Schema: "public", Name: "tag"},
+		{Type: types.TypeView, Schema: "public", Name: "totals"},
+		// A rule on a view is not under a table
+		{Type: types.TypeRule, Schema: "public", Name: "totals_insert", TableName: "totals"},
+		{Type: types.TypePublication, Schema: "postgres", Name: "changes"},
+		{Type: types.TypeLanguage, Schema: "postgres", Name: "plpython3u"},
+	}
+
+	var out strings.Builder
+	if err := WriteTree(&out, objects); err != nil {
+		t.Fatalf("WriteTree failed: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"app/",
+		"  tables/",
+		"    users/",
+		"languages/",
+		"  plpython3u",
+		"postgres/",
+		"  publications/",
+		"    changes",
+		"public/",
+		"  functions/",
+		"    tag",
+		"  rules/",
+		"    totals_insert",
+		"  tables/",
+		"    users/",
+		"      constraints/",
+		"        users_pkey",
+		"      indexes/",
+		"        users_email_idx",
+		"      triggers/",
+		"        users_audit",
+		"  views/",
+		"    totals",
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("Unexpected tree:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
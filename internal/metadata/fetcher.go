@@ -2,7 +2,9 @@ package metadata
 
 import (
 	"context"
+	"time"
 
+	"github.com/palantir/stacktrace"
 	"github.com/skamensky/pgmeta/internal/log"
 	"github.com/skamensky/pgmeta/internal/metadata/db"
 	"github.com/skamensky/pgmeta/internal/metadata/export"
@@ -12,41 +14,178 @@ import (
 // Fetcher handles PostgreSQL metadata retrieval
 type Fetcher struct {
 	connector *db.Connector
+	ctx       context.Context    // Bounds every operation; carries the overall timeout when set
+	cancel    context.CancelFunc // Releases the timeout's resources; nil without a timeout
 }
 
-// NewFetcher creates a new metadata fetcher instance
-func NewFetcher(dbURL string) (*Fetcher, error) {
-	connector, err := db.New(dbURL)
+// NewFetcher creates a new metadata fetcher instance, connecting as db.New does with opts
+func NewFetcher(dbURL string, opts db.Options) (*Fetcher, error) {
+	connector, err := db.New(dbURL, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Fetcher{connector: connector}, nil
+	return &Fetcher{connector: connector, ctx: context.Background()}, nil
+}
+
+// SetTimeout limits the total time of all subsequent operations. The clock starts now,
+// and once it runs out every query in flight is cancelled. A timeout of 0 means no limit.
+func (f *Fetcher) SetTimeout(timeout time.Duration) {
+	if f.cancel != nil {
+		f.cancel()
+		f.ctx, f.cancel = context.Background(), nil
+	}
+	if timeout > 0 {
+		f.ctx, f.cancel = context.WithTimeout(context.Background(), timeout)
+	}
+}
+
+// SetObjectTimeout limits the time spent fetching any single definition; a slower object
+// is recorded as failed instead of holding up the export. A timeout of 0 means no limit.
+func (f *Fetcher) SetObjectTimeout(timeout time.Duration) {
+	f.connector.SetObjectTimeout(timeout)
+}
+
+// SetProfiling times every definition fetched, for SlowestFetches
+func (f *Fetcher) SetProfiling(enabled bool) {
+	f.connector.SetProfiling(enabled)
+}
+
+// SlowestFetches returns the n slowest definition fetches, slowest first
+func (f *Fetcher) SlowestFetches(n int) []db.ObjectTiming {
+	return f.connector.SlowestFetches(n)
+}
+
+// SetMaxDefinitionSize caps the size of fetched definitions in bytes.
+// If truncate is true oversized definitions are truncated with a warning, otherwise they fail.
+func (f *Fetcher) SetMaxDefinitionSize(limit int, truncate bool) {
+	f.connector.SetMaxDefinitionSize(limit, truncate)
+}
+
+// SetSequenceCurrentValue makes exported sequences resume at their current value
+// instead of their start value
+func (f *Fetcher) SetSequenceCurrentValue(enabled bool) {
+	f.connector.SetSequenceCurrentValue(enabled)
+}
+
+// SetIdentitySequences makes sequences backing identity columns exported as standalone
+// sequences instead of being left to their column's identity clause
+func (f *Fetcher) SetIdentitySequences(enabled bool) {
+	f.connector.SetIdentitySequences(enabled)
+}
+
+// SetDefinitionSource chooses whether table and view definitions are read from pg_catalog
+// or information_schema
+func (f *Fetcher) SetDefinitionSource(source string) {
+	f.connector.SetDefinitionSource(source)
+}
+
+// SetNormalizeDefaults makes table definitions drop redundant casts from column defaults
+func (f *Fetcher) SetNormalizeDefaults(enabled bool) {
+	f.connector.SetNormalizeDefaults(enabled)
 }
 
 // Close closes the database connection
 func (f *Fetcher) Close() error {
+	if f.cancel != nil {
+		f.cancel()
+	}
 	return f.connector.Close()
 }
 
 // QueryObjects retrieves database objects matching the query options
 func (f *Fetcher) QueryObjects(opts types.QueryOptions) ([]types.DBObject, error) {
-	ctx := context.Background()
+	ctx := f.ctx
 	return f.connector.QueryObjects(ctx, opts)
 }
 
 // SaveObjects exports database objects to files
-// If continueOnError is true, it will log errors and continue; otherwise it will fail on first error
-func (f *Fetcher) SaveObjects(objects []types.DBObject, outputDir string, continueOnError bool) error {
-	log.Info("Exporting %d objects to %s (continueOnError: %v)", len(objects), outputDir, continueOnError)
-	exporter := export.New(f.connector, outputDir)
-	return exporter.ExportObjects(context.Background(), objects, continueOnError)
+// If opts.ContinueOnError is true, it will log errors and continue; otherwise it will fail on first error.
+// It reports whether the export is incomplete because some objects failed and were skipped.
+func (f *Fetcher) SaveObjects(objects []types.DBObject, opts types.ExportOptions) (bool, error) {
+	log.Info("Exporting %d objects to %s (continueOnError: %v)", len(objects), opts.OutputDir, opts.ContinueOnError)
+	ctx := f.ctx
+
+	// s3://bucket/prefix writes objects keyed by prefix/<path> instead of local files
+	outputDir := opts.OutputDir
+	fs := export.OSFileSystem()
+	if bucket, prefix, ok := export.ParseS3URL(opts.OutputDir); ok {
+		s3fs, err := export.NewS3FileSystem(ctx, bucket)
+		if err != nil {
+			return false, stacktrace.Propagate(err, "Failed to initialize S3 output for bucket %s", bucket)
+		}
+		outputDir, fs = prefix, s3fs
+		if outputDir == "" {
+			outputDir = "."
+		}
+	}
+
+	exporter := export.New(f.connector, outputDir).
+		WithFileSystem(fs).
+		WithFetchConcurrency(opts.FetchConcurrency).
+		WithConcurrency(opts.WriteConcurrency).
+		WithManifest(opts.Manifest, opts.WrapTransaction).
+		WithManifestOrder(opts.ManifestOrder).
+		WithPsqlMetaCommands(opts.PsqlMetaCommands).
+		WithStats(opts.WithStats).
+		WithConcurrentIndexes(opts.ConcurrentIndexes).
+		WithServerInfo(opts.ServerInfo).
+		WithIndex(opts.WriteIndex).
+		WithCompression(opts.Compression).
+		WithLint(opts.Lint, opts.LintFail, opts.LintSchemas).
+		WithStream(opts.Stream).
+		WithCombinedOutputs(opts.CombinedOutputs...).
+		WithDedupe(opts.Dedupe).
+		WithFormatSQL(opts.FormatSQL).
+		WithOutputEncoding(opts.OutputEncoding).
+		WithPrune(opts.Prune, opts.PruneSchemas, opts.PruneTypes).
+		WithRedactPatterns(opts.RedactPatterns).
+		WithResume(opts.Resume).
+		WithDatabaseComments(opts.DatabaseComments).
+		WithCommentsLayout(opts.CommentsLayout).
+		WithSkipPermissionErrors(opts.SkipPermissionErrors).
+		WithHashOnly(opts.DefinitionHashOnly).
+		WithCaveatHeaders(opts.CaveatHeaders).
+		WithGroupBy(opts.GroupBy).
+		WithDirNames(export.DirNames(opts.DirNames)).
+		WithCatalog(opts.Catalog).
+		WithBatchSize(opts.BatchSize)
+	if err := exporter.ExportObjects(ctx, objects, opts.ContinueOnError); err != nil {
+		return false, err
+	}
+	return exporter.Incomplete(), nil
+}
+
+// ClampConcurrency lowers a requested fetch concurrency to what the server's free
+// connection slots can safely absorb
+func (f *Fetcher) ClampConcurrency(requested int) int {
+	ctx := f.ctx
+	return f.connector.ClampConcurrency(ctx, requested)
+}
+
+// WarmUpPool opens concurrency connections at once, failing if the server cannot take them
+func (f *Fetcher) WarmUpPool(concurrency int) error {
+	ctx := f.ctx
+	return f.connector.WarmUpPool(ctx, concurrency)
+}
+
+// ServerInfo returns the version, encoding and collation of the connected server
+func (f *Fetcher) ServerInfo() (types.ServerInfo, error) {
+	ctx := f.ctx
+	return f.connector.ServerInfo(ctx)
+}
+
+// ListDatabases returns the databases on the server that can be exported
+func (f *Fetcher) ListDatabases() ([]string, error) {
+	ctx := f.ctx
+	return f.connector.ListDatabases(ctx)
 }
 
 // GetAllSchemas returns a list of all schemas in the database
-func (f *Fetcher) GetAllSchemas() ([]string, error) {
-	ctx := context.Background()
-	return f.connector.GetAllSchemas(ctx)
+// If includeSystem is true, system schemas such as pg_catalog are included
+func (f *Fetcher) GetAllSchemas(includeSystem bool) ([]string, error) {
+	ctx := f.ctx
+	return f.connector.GetAllSchemas(ctx, includeSystem)
 }
 
 // Utility function to check if a type is valid
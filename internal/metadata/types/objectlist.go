@@ -0,0 +1,156 @@
+package types
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/palantir/stacktrace"
+)
+
+// ObjectRef identifies a single object by its type and schema-qualified name
+type ObjectRef struct {
+	Type ObjectType
+	Name string // schema.name
+}
+
+// String renders the reference in the object list format, "type schema.name"
+func (r ObjectRef) String() string {
+	return string(r.Type) + " " + r.Name
+}
+
+// ParseObjectList reads newline-delimited "type schema.name" entries.
+// Blank lines and lines starting with # are ignored. Every malformed line
+// is reported in the returned error, with its line number.
+func ParseObjectList(r io.Reader) ([]ObjectRef, error) {
+	var refs []ObjectRef
+	var problems []string
+	seen := make(map[ObjectRef]bool)
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			problems = append(problems, fmt.Sprintf("line %d: expected 'type schema.name', got %q", lineNo, line))
+			continue
+		}
+		ref := ObjectRef{Type: ObjectType(fields[0]), Name: fields[1]}
+		if !IsValidType(ref.Type) {
+			problems = append(problems, fmt.Sprintf("line %d: invalid object type %q", lineNo, fields[0]))
+			continue
+		}
+		if schema, name, ok := strings.Cut(ref.Name, "."); !ok || schema == "" || name == "" {
+			problems = append(problems, fmt.Sprintf("line %d: object name %q must be schema-qualified (schema.name)", lineNo, ref.Name))
+			continue
+		}
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, stacktrace.Propagate(err, "Failed to read object list")
+	}
+	if len(problems) > 0 {
+		return nil, stacktrace.NewError("Malformed object list entries:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return refs, nil
+}
+
+// QueryOptionsFor builds options that fetch every object in refs from their schemas.
+// The result can also include same-named objects of other listed types;
+// narrow it with FilterRefs. Database-level objects such as languages are listed under
+// the placeholder schema "postgres", which is not a schema to query.
+func QueryOptionsFor(refs []ObjectRef) QueryOptions {
+	var opts QueryOptions
+	seenTypes := make(map[ObjectType]bool)
+	seenSchemas := make(map[string]bool)
+	seenNames := make(map[string]bool)
+	for _, ref := range refs {
+		schema, _, _ := strings.Cut(ref.Name, ".")
+		if !seenTypes[ref.Type] {
+			seenTypes[ref.Type] = true
+			opts.Types = append(opts.Types, ref.Type)
+		}
+		if !seenSchemas[schema] && !isDatabaseLevel(ref.Type) {
+			seenSchemas[schema] = true
+			opts.Schemas = append(opts.Schemas, schema)
+		}
+		if !seenNames[ref.Name] {
+			seenNames[ref.Name] = true
+			opts.Names = append(opts.Names, ref.Name)
+		}
+	}
+	return opts
+}
+
+// isDatabaseLevel reports whether objects of type t belong to the database rather than a schema
+func isDatabaseLevel(t ObjectType) bool {
+	return t == TypeLanguage || t == TypePublication || t == TypeSubscription
+}
+
+// FilterRefs keeps only the objects whose type and name exactly match an entry in refs
+func FilterRefs(refs []ObjectRef, objects []DBObject) []DBObject {
+	wanted := make(map[ObjectRef]bool, len(refs))
+	for _, ref := range refs {
+		wanted[ref] = true
+	}
+
+	var filtered []DBObject
+	for _, obj := range objects {
+		if wanted[ObjectRef{Type: obj.Type, Name: obj.Schema + "." + obj.Name}] {
+			filtered = append(filtered, obj)
+		}
+	}
+	return filtered
+}
+
+// MissingRefs returns the entries of refs that no object matched, as "type schema.name"
+func MissingRefs(refs []ObjectRef, objects []DBObject) []string {
+	found := make(map[ObjectRef]bool, len(objects))
+	for _, obj := range objects {
+		found[ObjectRef{Type: obj.Type, Name: obj.Schema + "." + obj.Name}] = true
+	}
+
+	var missing []string
+	for _, ref := range refs {
+		if !found[ref] {
+			missing = append(missing, ref.String())
+		}
+	}
+	return missing
+}
+
+// DependentTypes are the types of the objects --with-dependents adds for each selected table
+func DependentTypes() []ObjectType {
+	return []ObjectType{TypeIndex, TypeConstraint, TypeTrigger}
+}
+
+// DependentsOf returns the candidates that belong to one of the tables in objects and are
+// not in objects already
+func DependentsOf(objects, candidates []DBObject) []DBObject {
+	tables := make(map[[2]string]bool)
+	selected := make(map[ObjectKey]bool, len(objects))
+	for _, obj := range objects {
+		selected[obj.Key()] = true
+		if obj.Type == TypeTable {
+			tables[[2]string{obj.Schema, obj.Name}] = true
+		}
+	}
+
+	var dependents []DBObject
+	for _, obj := range candidates {
+		if obj.TableName == "" || !tables[[2]string{obj.Schema, obj.TableName}] || selected[obj.Key()] {
+			continue
+		}
+		selected[obj.Key()] = true
+		dependents = append(dependents, obj)
+	}
+	return dependents
+}
@@ -0,0 +1,137 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseObjectList(t *testing.T) {
+	input := `# curated objects for CI
+table public.users
+view   app.active_users
+
+function app.get_product
+table public.users
+`
+	refs, err := ParseObjectList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseObjectList failed: %v", err)
+	}
+
+	expected := []ObjectRef{
+		{Type: TypeTable, Name: "public.users"},
+		{Type: TypeView, Name: "app.active_users"},
+		{Type: TypeFunction, Name: "app.get_product"},
+	}
+	if len(refs) != len(expected) {
+		t.Fatalf("Expected %d refs, got %v", len(expected), refs)
+	}
+	for i := range expected {
+		if refs[i] != expected[i] {
+			t.Errorf("Expected ref %d to be %v, got %v", i, expected[i], refs[i])
+		}
+	}
+}
+
+func TestParseObjectListMalformed(t *testing.T) {
+	input := `table public.users
+tables public.orders
+view active_users
+function
+table public.a public.b
+`
+	_, err := ParseObjectList(strings.NewReader(input))
+	if err == nil {
+		t.Fatal("Expected malformed entries to be rejected")
+	}
+	// Every malformed line is reported, not just the first
+	for _, lineRef := range []string{"line 2", "line 3", "line 4", "line 5"} {
+		if !strings.Contains(err.Error(), lineRef) {
+			t.Errorf("Expected error to report %s, got: %v", lineRef, err)
+		}
+	}
+	if strings.Contains(err.Error(), "line 1:") {
+		t.Errorf("Expected line 1 to be valid, got: %v", err)
+	}
+}
+
+func TestQueryOptionsFor(t *testing.T) {
+	refs := []ObjectRef{
+		{Type: TypeTable, Name: "public.users"},
+		{Type: TypeView, Name: "public.users_view"},
+		{Type: TypeTable, Name: "app.orders"},
+	}
+	opts := QueryOptionsFor(refs)
+
+	if len(opts.Types) != 2 || opts.Types[0] != TypeTable || opts.Types[1] != TypeView {
+		t.Errorf("Unexpected types: %v", opts.Types)
+	}
+	if len(opts.Schemas) != 2 || opts.Schemas[0] != "public" || opts.Schemas[1] != "app" {
+		t.Errorf("Unexpected schemas: %v", opts.Schemas)
+	}
+	if len(opts.Names) != 3 {
+		t.Errorf("Unexpected names: %v", opts.Names)
+	}
+}
+
+func TestQueryOptionsForDatabaseLevel(t *testing.T) {
+	opts := QueryOptionsFor([]ObjectRef{
+		{Type: TypeLanguage, Name: "postgres.plpython3u"},
+		{Type: TypeFunction, Name: "app.tag"},
+	})
+
+	// The placeholder schema of the language is not queried, but its name still filters
+	if len(opts.Schemas) != 1 || opts.Schemas[0] != "app" {
+		t.Errorf("Unexpected schemas: %v", opts.Schemas)
+	}
+	if len(opts.Names) != 2 || opts.Names[0] != "postgres.plpython3u" {
+		t.Errorf("Unexpected names: %v", opts.Names)
+	}
+}
+
+func TestFilterAndMissingRefs(t *testing.T) {
+	refs := []ObjectRef{
+		{Type: TypeTable, Name: "public.users"},
+		{Type: TypeView, Name: "public.orders"},
+	}
+	objects := []DBObject{
+		{Type: TypeTable, Schema: "public", Name: "users"},
+		// Same name as a listed view, but a different type
+		{Type: TypeTable, Schema: "public", Name: "orders"},
+	}
+
+	filtered := FilterRefs(refs, objects)
+	if len(filtered) != 1 || filtered[0].Name != "users" {
+		t.Errorf("Expected only public.users to be kept, got %v", filtered)
+	}
+
+	missing := MissingRefs(refs, filtered)
+	if len(missing) != 1 || missing[0] != "view public.orders" {
+		t.Errorf("Expected view public.orders to be missing, got %v", missing)
+	}
+}
+
+func TestDependentsOf(t *testing.T) {
+	objects := []DBObject{
+		{Type: TypeTable, Schema: "public", Name: "users"},
+		{Type: TypeIndex, Schema: "public", Name: "users_email_idx", TableName: "users"},
+	}
+	candidates := []DBObject{
+		{Type: TypeIndex, Schema: "public", Name: "users_email_idx", TableName: "users"},
+		{Type: TypeIndex, Schema: "public", Name: "users_pkey", TableName: "users"},
+		{Type: TypeConstraint, Schema: "public", Name: "users_pkey", TableName: "users"},
+		{Type: TypeTrigger, Schema: "public", Name: "users_audit", TableName: "users"},
+		{Type: TypeIndex, Schema: "public", Name: "orders_pkey", TableName: "orders"},
+		{Type: TypeTrigger, Schema: "audit", Name: "users_audit", TableName: "users"},
+	}
+
+	got := DependentsOf(objects, candidates)
+	var names []string
+	for _, obj := range got {
+		names = append(names, string(obj.Type)+" "+obj.Schema+"."+obj.Name)
+	}
+	expected := "index public.users_pkey,constraint public.users_pkey,trigger public.users_audit"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("Expected dependents %s, got %s", expected, strings.Join(names, ","))
+	}
+}
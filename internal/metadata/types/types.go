@@ -1,5 +1,14 @@
 package types
 
+import (
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/palantir/stacktrace"
+)
+
 // ObjectType represents the type of database object
 type ObjectType string
 
@@ -19,15 +28,42 @@ const (
 	TypeSubscription     ObjectType = "subscription"
 	TypeRule             ObjectType = "rule"
 	TypeAggregate        ObjectType = "aggregate"
+	TypeWindowFunction   ObjectType = "window_function"
+	TypeLanguage         ObjectType = "language"
+	TypeStatistics       ObjectType = "statistics"
 )
 
 // DBObject represents a database object
 type DBObject struct {
-	Type       ObjectType
-	Schema     string
-	Name       string
-	Definition string
-	TableName  string // For indexes, triggers, and constraints - stores the parent table name
+	Type        ObjectType
+	Schema      string
+	Name        string
+	Definition  string
+	TableName   string // For indexes, triggers, and constraints - stores the parent table name
+	FileName    string // Base name of the exported file when it must differ from Name, e.g. to avoid a collision
+	ForeignKeys string // For tables - ALTER TABLE statements adding its foreign keys, run once every table exists
+	SearchPath  string // For functions and procedures - the search_path they set (pg_proc.proconfig); empty when none
+}
+
+// ObjectKey identifies an object. Names are only unique within a schema and object type,
+// and for triggers, policies, rules and other table-level objects only within their table,
+// so anything that tracks objects by identity must use the full key.
+type ObjectKey struct {
+	Type      ObjectType
+	Schema    string
+	TableName string // The parent table of a table-level object; empty otherwise
+	Name      string
+}
+
+// String renders the key as "type schema.name", the object list format, which leaves out
+// the table name
+func (k ObjectKey) String() string {
+	return string(k.Type) + " " + k.Schema + "." + k.Name
+}
+
+// Key returns the object's identity
+func (o DBObject) Key() ObjectKey {
+	return ObjectKey{Type: o.Type, Schema: o.Schema, TableName: o.TableName, Name: o.Name}
 }
 
 // QueryOptions contains options for database queries
@@ -36,28 +72,188 @@ type QueryOptions struct {
 	Schemas   []string
 	Database  string
 	NameRegex string
+	// Names restricts results to these schema-qualified names instead of NameRegex
+	Names []string
+	// OIDs selects exactly the objects with these OIDs; all other options are ignored
+	OIDs []uint32
+	// CommentTag keeps only objects whose COMMENT contains this text
+	CommentTag string
+	// ExcludeExtensionMembers skips objects created by an extension, except those named
+	// (schema-qualified) in ExtensionMemberExceptions
+	ExcludeExtensionMembers   bool
+	ExtensionMemberExceptions []string
+}
+
+// ServerInfo describes the PostgreSQL server an export was taken from
+type ServerInfo struct {
+	Version   string
+	Encoding  string
+	Collation string
+}
+
+// String renders the server info as a single human-readable line
+func (s ServerInfo) String() string {
+	return "PostgreSQL " + s.Version + " (encoding " + s.Encoding + ", collation " + s.Collation + ")"
+}
+
+// TableStats is read-only size and maintenance metadata for a table, written beside its
+// definition for performance reviews. Values are estimates as of the last ANALYZE.
+type TableStats struct {
+	RowEstimate       int64      `json:"row_estimate"`
+	TotalBytes        int64      `json:"total_bytes"`
+	ToastBytes        int64      `json:"toast_bytes"`
+	ToastOptions      []string   `json:"toast_options"`
+	AutovacuumOptions []string   `json:"autovacuum_options"`
+	LiveTuples        int64      `json:"live_tuples"`
+	DeadTuples        int64      `json:"dead_tuples"`
+	LastVacuum        *time.Time `json:"last_vacuum,omitempty"`
+	LastAutovacuum    *time.Time `json:"last_autovacuum,omitempty"`
+	LastAnalyze       *time.Time `json:"last_analyze,omitempty"`
+	LastAutoanalyze   *time.Time `json:"last_autoanalyze,omitempty"`
+}
+
+// ExportOptions contains options for exporting objects to files
+type ExportOptions struct {
+	OutputDir       string
+	ContinueOnError bool
+	Manifest        bool
+	WrapTransaction bool
+	// PsqlMetaCommands makes the manifest set ON_ERROR_STOP and echo each file before including it
+	PsqlMetaCommands bool
+	// ManifestOrder lists types replayed first in the manifest, ahead of the default order
+	ManifestOrder []ObjectType
+	// ConcurrentIndexes rewrites CREATE INDEX to CREATE INDEX CONCURRENTLY
+	ConcurrentIndexes bool
+	// ServerInfo is recorded in the manifest header when set
+	ServerInfo *ServerInfo
+	// WriteIndex writes an index.json per schema listing every exported file
+	WriteIndex bool
+	// Compression is applied to each definition file ("" for none, or "gzip")
+	Compression string
+	// Lint reports migration hazards in the fetched definitions
+	Lint bool
+	// LintFail aborts the export when lint reports any findings
+	LintFail bool
+	// LintSchemas lists the database's schemas so lint can recognize cross-schema references
+	LintSchemas []string
+	// Stream receives the whole export as one SQL script instead of writing files
+	Stream io.Writer
+	// CombinedOutputs each receive the whole export as one SQL script, as Stream would, next to the files
+	CombinedOutputs []io.Writer
+	// Dedupe links byte-identical definition files to a single original
+	Dedupe bool
+	// FormatSQL canonicalizes keyword casing and indentation of definitions
+	FormatSQL bool
+	// OutputEncoding is the character encoding definitions are written in ("" or "utf-8" for UTF-8)
+	OutputEncoding string
+	// FetchConcurrency is the number of definitions fetched at once (0 for the default)
+	FetchConcurrency int
+	// WriteConcurrency is the number of files written at once (0 for the default)
+	WriteConcurrency int
+	// WithStats writes a stats.json with each table's size and maintenance metadata
+	WithStats bool
+	// Prune deletes definition files in PruneSchemas and of PruneTypes (all types when empty)
+	// whose objects were not exported
+	Prune        bool
+	PruneSchemas []string
+	PruneTypes   []ObjectType
+	// Resume reuses the definitions checkpointed by an interrupted export
+	Resume bool
+	// RedactPatterns are replaced with [REDACTED] wherever they match in a definition
+	RedactPatterns []*regexp.Regexp
+	// GroupBy is the layout of the output directory: "schema" (the default) or "owner"
+	GroupBy string
+	// Catalog is the path, relative to OutputDir, of a CSV catalog of the exported files ("" for none)
+	Catalog string
+	// BatchSize is the number of objects fetched and written at a time (0 fetches everything first)
+	BatchSize int
+	// DirNames renames output directories, keyed by their default name such as "tables" or "indexes"
+	DirNames map[string]string
+	// DatabaseComments writes the database's comment to database.sql and each schema's to <schema>/schema.sql
+	DatabaseComments bool
+	// CommentsLayout is where comments on objects are exported: "none", "inline" or "separate"
+	CommentsLayout string
+	// SkipPermissionErrors treats definitions the role may not fetch as warnings, even when not continuing on error
+	SkipPermissionErrors bool
+	// DefinitionHashOnly writes hashes.json, the SHA-256 of each definition, instead of the definition files
+	DefinitionHashOnly bool
+	// CaveatHeaders starts the files of object types with restore prerequisites with a comment noting them
+	CaveatHeaders bool
+}
+
+// MissingNames returns the schema-qualified names that no object matched
+func MissingNames(names []string, objects []DBObject) []string {
+	found := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		found[obj.Schema+"."+obj.Name] = true
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// ValidTypes returns all supported object types in a stable order
+func ValidTypes() []ObjectType {
+	return []ObjectType{
+		TypeTable,
+		TypeView,
+		TypeFunction,
+		TypeAggregate,
+		TypeWindowFunction,
+		TypeTrigger,
+		TypeIndex,
+		TypeConstraint,
+		TypeSequence,
+		TypeMaterializedView,
+		TypePolicy,
+		TypeExtension,
+		TypeProcedure,
+		TypePublication,
+		TypeSubscription,
+		TypeRule,
+		TypeLanguage,
+		TypeStatistics,
+	}
 }
 
 // IsValidType checks if a given type is valid
 func IsValidType(t ObjectType) bool {
-	validTypes := map[ObjectType]bool{
-		TypeTable:            true,
-		TypeView:             true,
-		TypeFunction:         true,
-		TypeTrigger:          true,
-		TypeIndex:            true,
-		TypeConstraint:       true,
-		TypeSequence:         true,
-		TypeMaterializedView: true,
-		TypePolicy:           true,
-		TypeExtension:        true,
-		TypeProcedure:        true,
-		TypePublication:      true,
-		TypeSubscription:     true,
-		TypeRule:             true,
-		TypeAggregate:        true,
+	for _, valid := range ValidTypes() {
+		if t == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the type's name, as used in --types and object lists
+func (t ObjectType) String() string {
+	return string(t)
+}
+
+// MarshalText renders the type as its name
+func (t ObjectType) MarshalText() ([]byte, error) {
+	return []byte(t), nil
+}
+
+// UnmarshalText parses a type name, rejecting any that is not a valid type. JSON decoding
+// uses it too, so a misspelled type in a JSON file fails instead of matching nothing.
+func (t *ObjectType) UnmarshalText(text []byte) error {
+	parsed := ObjectType(text)
+	if !IsValidType(parsed) {
+		names := make([]string, 0, len(ValidTypes()))
+		for _, valid := range ValidTypes() {
+			names = append(names, string(valid))
+		}
+		return stacktrace.NewError("Invalid object type: %q. Valid types are: %s", text, strings.Join(names, ", "))
 	}
-	return validTypes[t]
+	*t = parsed
+	return nil
 }
 
 // ContainsAny checks if the slice contains any of the given elements
@@ -1,6 +1,10 @@
 package types
 
-import "testing"
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
 
 func TestIsValidType(t *testing.T) {
 	// Test all valid types
@@ -9,6 +13,7 @@ func TestIsValidType(t *testing.T) {
 		TypeView,
 		TypeFunction,
 		TypeAggregate,
+		TypeWindowFunction,
 		TypeTrigger,
 		TypeIndex,
 		TypeConstraint,
@@ -26,6 +31,30 @@ func TestIsValidType(t *testing.T) {
 	}
 }
 
+func TestObjectTypeJSON(t *testing.T) {
+	var key ObjectKey
+	if err := json.Unmarshal([]byte(`{"Type": "materialized_view", "Schema": "public", "Name": "totals"}`), &key); err != nil {
+		t.Fatalf("Expected a valid type to unmarshal, got %v", err)
+	}
+	if key.Type != TypeMaterializedView {
+		t.Errorf("Expected type %s, got %s", TypeMaterializedView, key.Type)
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"Type":"materialized_view"`) {
+		t.Errorf("Expected the type to marshal as its name, got %s", data)
+	}
+
+	// A typo is rejected instead of silently becoming a type that matches nothing
+	err = json.Unmarshal([]byte(`{"Type": "tabel", "Schema": "public", "Name": "users"}`), &key)
+	if err == nil || !strings.Contains(err.Error(), `"tabel"`) {
+		t.Errorf("Expected an invalid type error naming tabel, got %v", err)
+	}
+}
+
 func TestContainsAny(t *testing.T) {
 	// Test with empty slice (should return true)
 	if !ContainsAny(nil, TypeTable) {
@@ -51,3 +80,68 @@ func TestContainsAny(t *testing.T) {
 		t.Error("ContainsAny should return true when slice contains any of the elements")
 	}
 }
+
+func TestValidTypes(t *testing.T) {
+	seen := make(map[ObjectType]bool)
+	for _, typeName := range ValidTypes() {
+		if seen[typeName] {
+			t.Errorf("Type %s listed more than once", typeName)
+		}
+		seen[typeName] = true
+
+		if !IsValidType(typeName) {
+			t.Errorf("Expected %s from ValidTypes to be a valid type", typeName)
+		}
+	}
+}
+
+func TestServerInfoString(t *testing.T) {
+	info := ServerInfo{Version: "16.2", Encoding: "UTF8", Collation: "en_US.UTF-8"}
+	expected := "PostgreSQL 16.2 (encoding UTF8, collation en_US.UTF-8)"
+	if got := info.String(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestMissingNames(t *testing.T) {
+	objects := []DBObject{
+		{Type: TypeTable, Schema: "public", Name: "users"},
+		{Type: TypeFunction, Schema: "app", Name: "get_product"},
+	}
+
+	missing := MissingNames([]string{"public.users", "app.get_product", "public.orders"}, objects)
+	if len(missing) != 1 || missing[0] != "public.orders" {
+		t.Errorf("Expected only public.orders to be missing, got %v", missing)
+	}
+
+	if missing := MissingNames(nil, objects); len(missing) != 0 {
+		t.Errorf("Expected no missing names when none requested, got %v", missing)
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	table := DBObject{Type: TypeTable, Schema: "app", Name: "users"}
+	view := DBObject{Type: TypeView, Schema: "app", Name: "users"}
+	other := DBObject{Type: TypeTable, Schema: "public", Name: "users"}
+
+	if table.Key() == view.Key() || table.Key() == other.Key() {
+		t.Error("Objects differing in type or schema must have different keys")
+	}
+	if got := table.Key().String(); got != "table app.users" {
+		t.Errorf("Expected key string 'table app.users', got %q", got)
+	}
+}
+
+func TestObjectKeyTableName(t *testing.T) {
+	onUsers := DBObject{Type: TypeTrigger, Schema: "public", Name: "audit", TableName: "users"}
+	onOrders := DBObject{Type: TypeTrigger, Schema: "public", Name: "audit", TableName: "orders"}
+	if onUsers.Key() == onOrders.Key() {
+		t.Errorf("Expected same-named triggers on different tables to have different keys, got %v", onUsers.Key())
+	}
+	if onUsers.Key().TableName != "users" {
+		t.Errorf("Expected the key to carry the table name, got %+v", onUsers.Key())
+	}
+	if got := onUsers.Key().String(); got != "trigger public.audit" {
+		t.Errorf("Expected the key to render in the object list format, got %q", got)
+	}
+}